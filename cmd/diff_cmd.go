@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/config"
+	"github.com/kakeetopius/gscn/scanner"
+	"github.com/spf13/cobra"
+)
+
+func DiffCmd() *cobra.Command {
+	var scanType string
+	var rttThreshold time.Duration
+	var changesOnly bool
+	diffCmd := cobra.Command{
+		Use:   "diff <old file> <new file>",
+		Short: "Show what changed between two scan results saved in json format.",
+		Example: `  gscn diff monday.json tuesday.json
+  gscn diff old.json new.json --changes-only --notify`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			oldResults, err := loadResultsFile(args[0], scanType)
+			if err != nil {
+				return err
+			}
+			newResults, err := loadResultsFile(args[1], scanType)
+			if err != nil {
+				return err
+			}
+
+			diff, err := scanner.DiffResults(oldResults, newResults, scanner.DiffOptions{
+				RTTThreshold: rttThreshold,
+			})
+			if err != nil {
+				return err
+			}
+			if changesOnly && !diff.HasChanges() {
+				return nil
+			}
+
+			appConfig, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			opts := scanOptions(appConfig, nil)
+			if opts.Stream {
+				return fmt.Errorf("--stream can only be used when scanning")
+			}
+			return scanner.WriteResults(diff, opts)
+		},
+	}
+
+	diffCmd.Flags().SortFlags = false
+
+	diffCmd.Flags().StringVarP(&scanType, "type", "t", "", fmt.Sprintf("Scan type of the results. One of %v. Detected from the files if not given.", strings.Join(scanner.ResultTypes, ", ")))
+	diffCmd.Flags().DurationVar(&rttThreshold, "rtt-threshold", 10*time.Millisecond, "Smallest change in a host's average round trip time to report.")
+	diffCmd.Flags().BoolVar(&changesOnly, "changes-only", false, "Do not print or send anything when nothing changed.")
+
+	return &diffCmd
+}
+
+// loadResultsFile loads scan results saved in json format from the file at path.
+func loadResultsFile(path string, scanType string) (scanner.ScanResults, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	results, err := scanner.LoadResults(f, scanType)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return results, nil
+}
@@ -28,6 +28,7 @@ func DiscoverCmd() *cobra.Command {
 		discoverArpCmd(),
 		discoverNDPCmd(),
 		discoverDHCPv4Cmd(),
+		discoverRouterCmd(),
 	)
 
 	return &discoverCmd
@@ -64,13 +65,7 @@ func discoverArpCmd() *cobra.Command {
 				return err
 			}
 
-			return scanner.DoScan(context.Background(), arpScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), arpScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -119,13 +114,7 @@ func discoverNDPCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			return scanner.DoScan(context.Background(), ndpScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), ndpScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -169,13 +158,7 @@ func discoverDHCPv4Cmd() *cobra.Command {
 				return err
 			}
 
-			return scanner.DoScan(context.Background(), arpScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), arpScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -190,6 +173,46 @@ func discoverDHCPv4Cmd() *cobra.Command {
 	return &dhcpCmd
 }
 
+func discoverRouterCmd() *cobra.Command {
+	var opts scanner.RouterScanOptions
+	var ifaceStrings []string
+
+	routerCmd := cobra.Command{
+		Use:   "router",
+		Short: "Discover IPv6 routers on the connected networks using ICMPv6 Router Solicitations and Advertisements.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			appConfig, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			ifaces, err := getDiscoverInterfaces(ifaceStrings)
+			if err != nil {
+				return err
+			}
+			opts.Interfaces = ifaces
+			opts.Verbose = true
+
+			routerScanner, err := scanner.NewRouterScanner(opts)
+			if err != nil {
+				return err
+			}
+
+			return scanner.DoScan(context.Background(), routerScanner, scanOptions(appConfig, args))
+		},
+	}
+
+	routerCmd.Flags().SortFlags = false
+
+	routerCmd.Flags().StringSliceVarP(&ifaceStrings, "iface", "i", nil, "A network interface to find routers from. If omitted, all interfaces are used.")
+	routerCmd.Flags().UintVarP(&opts.ProbeCount, "count", "c", 1, "The number of ICMPv6 Router Solicitations to send on each interface.")
+	routerCmd.Flags().BoolVarP(&opts.Passive, "passive", "p", false, "Do not send any Router Solicitations rather passively listen for the Router Advertisements routers send periodically.")
+	routerCmd.Flags().DurationVarP(&opts.ResponseTimeout, "response-timeout", "t", 2*time.Second, "Amount of time in seconds to wait for responses. Routers may only advertise every few minutes so use a longer timeout with --passive.")
+	routerCmd.Flags().BoolVar(&opts.WithVendorInfo, "vendors", true, "Add mac address based vendor information to the results.")
+
+	return &routerCmd
+}
+
 func getDiscoverTargets(targetStrs []string) ([]netip.Prefix, error) {
 	targets, err := scanner.TargetsFromString(targetStrs)
 	if err != nil {
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/kakeetopius/gscn/internal/config"
+	"github.com/kakeetopius/gscn/scanner"
+	"github.com/spf13/cobra"
+)
+
+func HistoryCmd() *cobra.Command {
+	historyCmd := cobra.Command{
+		Use:   "history",
+		Short: "Query the history of completed scans saved in the history database.",
+		Example: "\nThe history is enabled in the configuration file with:\n\n" +
+			"[history]\nenabled = true\n",
+		Aliases: []string{"hist"},
+	}
+
+	historyCmd.AddCommand(
+		historyListCmd(),
+		historyShowCmd(),
+		historyHostCmd(),
+	)
+
+	return &historyCmd
+}
+
+func historyListCmd() *cobra.Command {
+	var limit int
+	listCmd := cobra.Command{
+		Use:   "list",
+		Short: "List the most recent scans in the history.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, opts, err := historyOptions()
+			if err != nil {
+				return err
+			}
+
+			scans, err := scanner.LoadHistoryScans(path, limit)
+			if err != nil {
+				return err
+			}
+			return scanner.WriteResults(scans, opts)
+		},
+	}
+
+	listCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of scans to list. 0 lists all scans.")
+
+	return &listCmd
+}
+
+func historyShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show the results of a scan in the history in any output format.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid scan id: %v", args[0])
+			}
+
+			path, opts, err := historyOptions()
+			if err != nil {
+				return err
+			}
+
+			results, err := scanner.LoadHistoryScan(path, id)
+			if err != nil {
+				return err
+			}
+			return scanner.WriteResults(results, opts)
+		},
+	}
+}
+
+func historyHostCmd() *cobra.Command {
+	var port int
+	hostCmd := cobra.Command{
+		Use:   "host <ip>",
+		Short: "Show what every scan in the history saw of a host, including the MAC addresses it has had and when its ports were open.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ip, err := netip.ParseAddr(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid ip address: %v", args[0])
+			}
+
+			path, opts, err := historyOptions()
+			if err != nil {
+				return err
+			}
+
+			hostHistory, err := scanner.LoadHostHistory(path, ip, port)
+			if err != nil {
+				return err
+			}
+			return scanner.WriteResults(hostHistory, opts)
+		},
+	}
+
+	hostCmd.Flags().IntVarP(&port, "port", "p", 0, "Only show when this port was open.")
+
+	return &hostCmd
+}
+
+// historyOptions returns the path to the history database and the options for writing the history's results.
+func historyOptions() (string, scanner.ScanOptions, error) {
+	appConfig, err := config.Load(cfgFile)
+	if err != nil {
+		return "", scanner.ScanOptions{}, err
+	}
+
+	path := historyFile(appConfig)
+	if path == "" {
+		return "", scanner.ScanOptions{}, fmt.Errorf("the scan history is not enabled in the configuration file")
+	}
+
+	opts := scanOptions(appConfig, nil)
+	if opts.Stream {
+		return "", scanner.ScanOptions{}, fmt.Errorf("--stream can only be used when scanning")
+	}
+	return path, opts, nil
+}
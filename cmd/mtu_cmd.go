@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/config"
+	"github.com/kakeetopius/gscn/scanner"
+	"github.com/spf13/cobra"
+)
+
+func MTUCmd() *cobra.Command {
+	var opts scanner.MTUOptions
+	var ipv6 bool
+
+	mtuCmd := cobra.Command{
+		Use:   "mtu <target>",
+		Short: "Find the largest packet that reaches a host without being fragmented.",
+		Example: "\nThe target may be an IPv4 or IPv6 address or a domain name e.g.\n" +
+			"  gscn mtu 10.1.1.1\n" +
+			"  gscn mtu gscn.com -6\n" +
+			"  gscn mtu 10.1.1.1 --max-mtu 1400\n",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			opts.Target, opts.HostName, err = getSingleTarget(args[0], ipv6)
+			if err != nil {
+				return err
+			}
+
+			appConfig, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			prober, err := scanner.NewMTUProber(opts)
+			if err != nil {
+				return err
+			}
+			return scanner.DoScan(context.Background(), prober, scanOptions(appConfig, args))
+		},
+	}
+
+	mtuCmd.Flags().SortFlags = false
+	mtuCmd.Flags().BoolVarP(&ipv6, "ipv6", "6", false, "Probe the IPv6 address of a target given as a domain name.")
+	mtuCmd.Flags().IntVar(&opts.MaxMTU, "max-mtu", 0, "The size of the largest probe. Defaults to the mtu of the interface the target is reached through.")
+	mtuCmd.Flags().IntVarP(&opts.Attempts, "count", "c", 3, "Number of times to send a probe before its size is taken to be dropped on the way.")
+	mtuCmd.Flags().DurationVarP(&opts.ResponseTimeout, "response-timeout", "t", time.Second, "Amount of time to wait for the reply to each probe.")
+	mtuCmd.Flags().IntVarP(&opts.MaxHops, "max-hops", "m", 30, "The largest TTL or hop limit to look for the hop that limits the mtu at.")
+	mtuCmd.Flags().BoolVarP(&opts.NoHostNames, "numeric", "n", false, "Do not look up the host name of the hop that limits the mtu.")
+
+	return &mtuCmd
+}
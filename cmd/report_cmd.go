@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kakeetopius/gscn/internal/config"
+	"github.com/kakeetopius/gscn/scanner"
+	"github.com/spf13/cobra"
+)
+
+func ReportCmd() *cobra.Command {
+	var scanType string
+	reportCmd := cobra.Command{
+		Use:   "report <file>",
+		Short: "Re-render scan results previously saved in json format.",
+		Long: `Load scan results that were saved with --json and write them again in any output format or send them with --notify.
+The scan type is detected from the file. Results of syn scans saved by older versions are detected as tcp scans unless --type syn is given.`,
+		Example: `  gscn report results.json
+  gscn report results.json --format html -o report.html
+  gscn report results.json --type syn --xml --notify`,
+		Aliases: []string{"r"},
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := loadResultsFile(args[0], scanType)
+			if err != nil {
+				return err
+			}
+
+			appConfig, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			opts := scanOptions(appConfig, nil)
+			if opts.Stream {
+				return fmt.Errorf("--stream can only be used when scanning")
+			}
+			return scanner.WriteResults(results, opts)
+		},
+	}
+
+	reportCmd.Flags().StringVarP(&scanType, "type", "t", "", fmt.Sprintf("Scan type of the results. One of %v. Detected from the file if not given.", strings.Join(scanner.ResultTypes, ", ")))
+
+	return &reportCmd
+}
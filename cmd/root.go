@@ -4,11 +4,14 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
 	goversion "github.com/caarlos0/go-version"
+	"github.com/kakeetopius/gscn/scanner"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -18,6 +21,12 @@ var (
 	outputFile       string
 	outputJSON       bool
 	jsonPretty       bool
+	outputXML        bool
+	outputFormat     string
+	streamResults    bool
+	templateFile     string
+	pcapOutputFile   string
+	noHistory        bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -45,12 +54,24 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&outputFile, "out", "o", "", "Save scan results to an output file")
 	rootCmd.PersistentFlags().BoolVarP(&outputJSON, "json", "j", false, "Print scan results in json format.")
 	rootCmd.PersistentFlags().BoolVarP(&jsonPretty, "pretty", "P", false, "Print scan results in pretty json format.")
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "format", "", "Print scan results in the given format. One of csv, tsv, xml, html or grep.")
+	rootCmd.PersistentFlags().BoolVar(&outputXML, "xml", false, "Print port scan results in Nmap compatible xml format.")
+	rootCmd.PersistentFlags().BoolVar(&streamResults, "stream", false, "Write results as newline delimited json objects as soon as they are known.")
+	rootCmd.PersistentFlags().StringVar(&templateFile, "template", "", "Render the text output and notifications with the Go template in the given file.")
+	rootCmd.PersistentFlags().StringVar(&pcapOutputFile, "pcap-out", "", "Record all packets sent and received by syn, fin, null, xmas, ack, raw udp, raw ping, arp, ndp, dhcp and router scans, traces and mtu probes to a pcapng file.")
+	rootCmd.PersistentFlags().BoolVar(&noHistory, "no-history", false, "Do not save the scan to the history database.")
 	rootCmd.PersistentFlags().BoolVar(&sendNotification, "notify", false, "Send scan results via a configured notifier in $HOME/config/gscn.toml file")
 
 	rootCmd.MarkFlagFilename("out")
+	rootCmd.MarkFlagFilename("pcap-out", "pcapng")
 	rootCmd.AddCommand(
 		DiscoverCmd(),
 		ScanCmd(),
+		TraceCmd(),
+		MTUCmd(),
+		ReportCmd(),
+		DiffCmd(),
+		HistoryCmd(),
 		versionCmd(),
 	)
 
@@ -59,6 +80,55 @@ func init() {
 	}
 }
 
+// scanOptions returns the options used to output scan results as set by the global flags. targets are the command's targets which are
+// saved with the scan in the history.
+func scanOptions(appConfig *viper.Viper, targets []string) scanner.ScanOptions {
+	opts := scanner.ScanOptions{
+		ResultsOutputFile: outputFile,
+		PrintJSON:         outputJSON,
+		PrintJSONPretty:   jsonPretty,
+		PrintXML:          outputXML,
+		Format:            scanner.OutputFormat(outputFormat),
+		Stream:            streamResults,
+		Template:          templateFile,
+		TemplatesDir:      templatesDir(appConfig),
+		PcapOutputFile:    pcapOutputFile,
+		Targets:           targets,
+		Notify:            sendNotification,
+		Config:            appConfig,
+	}
+	if !noHistory {
+		opts.HistoryFile = historyFile(appConfig)
+	}
+	return opts
+}
+
+// historyFile returns the path to the history database if the history is enabled in the config file. The database is kept next to the
+// config file unless another path is set. Relative paths are relative to the config file's directory.
+func historyFile(appConfig *viper.Viper) string {
+	if !appConfig.GetBool("history.enabled") {
+		return ""
+	}
+
+	path := appConfig.GetString("history.path")
+	if path == "" {
+		path = "gscn_history.db"
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(appConfig.ConfigFileUsed()), path)
+}
+
+// templatesDir returns the templates directory set in the config file. Relative paths are relative to the config file's directory.
+func templatesDir(appConfig *viper.Viper) string {
+	dir := appConfig.GetString("templates")
+	if dir == "" || filepath.IsAbs(dir) || appConfig.ConfigFileUsed() == "" {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(appConfig.ConfigFileUsed()), dir)
+}
+
 // versionCmd returns a cobra command that displays the application's version information.
 func versionCmd() *cobra.Command {
 	return &cobra.Command{
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/netip"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/kakeetopius/gscn/internal/config"
@@ -28,7 +30,11 @@ func ScanCmd() *cobra.Command {
 
 	scanCmd.AddCommand(
 		tcpFullScanCmd(),
-		tcpSynScanCmd(),
+		tcpSynScanCmd(scanner.TCPScanModeSyn),
+		tcpSynScanCmd(scanner.TCPScanModeFin),
+		tcpSynScanCmd(scanner.TCPScanModeNull),
+		tcpSynScanCmd(scanner.TCPScanModeXmas),
+		tcpSynScanCmd(scanner.TCPScanModeAck),
 		udpScanCmd(),
 		pingScanCmd(),
 	)
@@ -38,6 +44,8 @@ func ScanCmd() *cobra.Command {
 
 func tcpFullScanCmd() *cobra.Command {
 	var ports string
+	var certExpiryDays int
+	var discovery discoveryFlags
 
 	opts := scanner.TCPFullScanOptions{}
 	tcpCmd := cobra.Command{
@@ -57,6 +65,14 @@ func tcpFullScanCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			opts.Discovery, err = discovery.options()
+			if err != nil {
+				return err
+			}
+			if certExpiryDays < 0 {
+				return fmt.Errorf("certificate expiry warning days cannot be negative")
+			}
+			opts.CertExpiryWarning = time.Duration(certExpiryDays) * 24 * time.Hour
 
 			appConfig, err := config.Load(cfgFile)
 			if err != nil {
@@ -65,13 +81,7 @@ func tcpFullScanCmd() *cobra.Command {
 
 			tcpScanner := scanner.NewTCPFullScanner(opts)
 
-			return scanner.DoScan(context.Background(), tcpScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), tcpScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -87,6 +97,13 @@ func tcpFullScanCmd() *cobra.Command {
 	tcpCmd.Flags().DurationVar(&opts.PingTimeout, "ping-timeout", 500*time.Millisecond, "Amount of time to wait for ping replies when doing scans.")
 
 	tcpCmd.Flags().BoolVar(&opts.SkipPingScan, "skip-ping", false, "Skip pinging hosts before scanning ports. All hosts are treated as up.")
+	discovery.addFlags(&tcpCmd, "ping-")
+	tcpCmd.Flags().BoolVarP(&opts.ServiceVersion, "service-version", "V", false, "Probe open ports to find out which service and version is running on them.")
+	tcpCmd.Flags().BoolVar(&opts.TLS, "tls", false, "Collect the TLS version, cipher and certificate chain of open ports that speak TLS or support STARTTLS.")
+	tcpCmd.Flags().IntVar(&certExpiryDays, "cert-expiry", 0, "Warn about certificates that expire within this many days. Turns on --tls.")
+	tcpCmd.Flags().BoolVar(&opts.HTTP, "http", false, "Record the status code, server headers, page title and favicon hash of open ports that answer HTTP or HTTPS.")
+	tcpCmd.Flags().BoolVar(&opts.SSHHostKeys, "ssh-hostkeys", false, "Collect the banner, host key algorithms and host key fingerprints of open ports that are port 22 or run SSH.")
+	tcpCmd.Flags().DurationVar(&opts.ServiceTimeout, "service-timeout", 2*time.Second, "Amount of time to wait for an answer to each service detection, TLS, HTTP and SSH probe.")
 
 	tcpCmd.Flags().BoolVar(&opts.PrintOpenOnly, "open", false, "Only show open and possibly filtered ports.")
 	tcpCmd.Flags().BoolVar(&opts.PrintUpOnly, "up", false, "Show results for only up hosts.")
@@ -94,13 +111,16 @@ func tcpFullScanCmd() *cobra.Command {
 	return &tcpCmd
 }
 
-func tcpSynScanCmd() *cobra.Command {
+// tcpSynScanCmd returns the command for a scan that probes ports with raw TCP packets with the flags of the given mode.
+func tcpSynScanCmd(mode scanner.TCPScanMode) *cobra.Command {
 	var ports string
+	var certExpiryDays int
+	var discovery discoveryFlags
 
-	opts := scanner.TCPSynScanOptions{}
+	opts := scanner.TCPSynScanOptions{Mode: mode}
 	tcpCmd := cobra.Command{
-		Use:   "syn <targets>",
-		Short: "Carry out a TCP SYN scan.",
+		Use:   string(mode) + " <targets>",
+		Short: fmt.Sprintf("Carry out a TCP %v scan.", mode.Name()),
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var err error
@@ -115,6 +135,14 @@ func tcpSynScanCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			opts.Discovery, err = discovery.options()
+			if err != nil {
+				return err
+			}
+			if certExpiryDays < 0 {
+				return fmt.Errorf("certificate expiry warning days cannot be negative")
+			}
+			opts.CertExpiryWarning = time.Duration(certExpiryDays) * 24 * time.Hour
 
 			appConfig, err := config.Load(cfgFile)
 			if err != nil {
@@ -125,13 +153,7 @@ func tcpSynScanCmd() *cobra.Command {
 				return err
 			}
 
-			return scanner.DoScan(context.Background(), synScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), synScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -146,15 +168,41 @@ func tcpSynScanCmd() *cobra.Command {
 
 	tcpCmd.Flags().BoolVar(&opts.SkipPingScan, "skip-ping", false, "Skip pinging hosts before scanning ports. All hosts are treated as up.")
 	tcpCmd.Flags().DurationVar(&opts.PingTimeout, "ping-timeout", 500*time.Millisecond, "Amount of time to wait for ping replies when doing scans.")
+	discovery.addFlags(&tcpCmd, "ping-")
+	if mode == scanner.TCPScanModeSyn {
+		// only syn scans tell open ports apart so the other modes have nothing to run service detection on.
+		tcpCmd.Flags().BoolVarP(&opts.ServiceVersion, "service-version", "V", false, "Probe open ports to find out which service and version is running on them.")
+		tcpCmd.Flags().BoolVar(&opts.TLS, "tls", false, "Collect the TLS version, cipher and certificate chain of open ports that speak TLS or support STARTTLS.")
+		tcpCmd.Flags().IntVar(&certExpiryDays, "cert-expiry", 0, "Warn about certificates that expire within this many days. Turns on --tls.")
+		tcpCmd.Flags().BoolVar(&opts.HTTP, "http", false, "Record the status code, server headers, page title and favicon hash of open ports that answer HTTP or HTTPS.")
+		tcpCmd.Flags().BoolVar(&opts.SSHHostKeys, "ssh-hostkeys", false, "Collect the banner, host key algorithms and host key fingerprints of open ports that are port 22 or run SSH.")
+		tcpCmd.Flags().DurationVar(&opts.ServiceTimeout, "service-timeout", 2*time.Second, "Amount of time to wait for an answer to each service detection, TLS, HTTP and SSH probe.")
+	}
 
-	tcpCmd.Flags().BoolVar(&opts.PrintOpenOnly, "open", false, "Only show open and possibly filtered ports.")
+	if mode != scanner.TCPScanModeAck {
+		// ack scans never find closed ports so there is nothing for --open to hide.
+		tcpCmd.Flags().BoolVar(&opts.PrintOpenOnly, "open", false, "Only show open and possibly filtered ports.")
+	}
 	tcpCmd.Flags().BoolVar(&opts.PrintUpOnly, "up", false, "Show results for only up hosts.")
 
+	switch mode {
+	case scanner.TCPScanModeSyn:
+	case scanner.TCPScanModeAck:
+		tcpCmd.Long = "Carry out a TCP ACK scan.\n\nHosts answer ACK probes with a RST whether the port is open or closed, so the scan does not " +
+			"tell open ports from closed ones. Ports that answer are unfiltered and ports that do not answer or whose probes are answered " +
+			"with an ICMP unreachable message are filtered, which shows whether a stateful firewall is in front of the host."
+	default:
+		tcpCmd.Long = fmt.Sprintf("Carry out a TCP %v scan.\n\nHosts that follow RFC 793 answer the probes with a RST if the port is closed and drop "+
+			"them if it is open, so ports that do not answer are shown as open | filtered. Ports whose probes are answered with an ICMP "+
+			"unreachable message are filtered. Windows and some other systems answer with a RST for all ports.", mode.Name())
+	}
+
 	return &tcpCmd
 }
 
 func udpScanCmd() *cobra.Command {
 	var ports string
+	var discovery discoveryFlags
 
 	var opts scanner.UDPScanOptions
 	udpCmd := cobra.Command{
@@ -175,20 +223,22 @@ func udpScanCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			opts.Discovery, err = discovery.options()
+			if err != nil {
+				return err
+			}
 
 			appConfig, err := config.Load(cfgFile)
 			if err != nil {
 				return err
 			}
+			opts.Payloads, err = scanner.UDPPayloadsFromConfig(appConfig)
+			if err != nil {
+				return err
+			}
 
 			udpScanner := scanner.NewUDPScanner(opts)
-			return scanner.DoScan(context.Background(), udpScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), udpScanner, scanOptions(appConfig, args))
 		},
 	}
 	udpCmd.Flags().SortFlags = false
@@ -201,6 +251,10 @@ func udpScanCmd() *cobra.Command {
 	udpCmd.Flags().IntVar(&opts.PingCount, "ping-count", 3, "Number of ICMP Echo Request packets to send when pinging")
 
 	udpCmd.Flags().DurationVar(&opts.PingTimeout, "ping-timeout", 500*time.Millisecond, "Amount of time to wait for ping replies when doing scans.")
+	discovery.addFlags(&udpCmd, "ping-")
+
+	udpCmd.Flags().BoolVar(&opts.Raw, "raw", false, "Send raw udp probes and read the ICMP port unreachable messages of closed ports. Needs root privileges.")
+	udpCmd.Flags().IntVar(&opts.Retries, "retries", 2, "Number of times unanswered probes are sent again in raw scans.")
 
 	udpCmd.Flags().BoolVar(&opts.PrintOpenOnly, "open", false, "Only show open and possibly filtered ports.")
 	udpCmd.Flags().BoolVar(&opts.PrintUpOnly, "up", false, "Show results for only up hosts.")
@@ -210,6 +264,8 @@ func udpScanCmd() *cobra.Command {
 
 func pingScanCmd() *cobra.Command {
 	var opts scanner.PingScanOptions
+	var engine string
+	var discovery discoveryFlags
 	pingCmd := cobra.Command{
 		Use:   "ping <targets>",
 		Short: "Carry out a ping scan",
@@ -225,6 +281,14 @@ func pingScanCmd() *cobra.Command {
 				return err
 			}
 			opts.SortResults = true
+			opts.Engine = scanner.PingEngine(engine)
+			if engine != "" && !slices.Contains(scanner.PingEngines, opts.Engine) {
+				return fmt.Errorf("unknown ping engine %q", engine)
+			}
+			opts.DiscoveryOptions, err = discovery.options()
+			if err != nil {
+				return err
+			}
 
 			appConfig, err := config.Load(cfgFile)
 			if err != nil {
@@ -232,13 +296,7 @@ func pingScanCmd() *cobra.Command {
 			}
 
 			pingScanner := scanner.NewPingScanner(opts)
-			return scanner.DoScan(context.Background(), pingScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), pingScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -248,12 +306,56 @@ func pingScanCmd() *cobra.Command {
 	pingCmd.Flags().IntVarP(&opts.Workers, "workers", "w", 64, "Number of workers to run concurrently when scanning with a maximum of 500")
 	pingCmd.Flags().IntVarP(&opts.PingCount, "count", "c", 3, "Number of ICMP Echo Request packets to send when pinging")
 
-	pingCmd.Flags().DurationVarP(&opts.PingTimeout, "timeout", "t", 0*time.Second, "Amount of time to wait for ping replies when doing scans.")
+	pingCmd.Flags().DurationVarP(&opts.PingTimeout, "timeout", "t", 0*time.Second, "Amount of time to wait for ping replies when doing scans. The raw engine waits this long after its last request, 1s by default.")
 
 	pingCmd.Flags().BoolVar(&opts.PrintOnlyUp, "up", false, "Show results for only up hosts.")
+
+	engines := make([]string, 0, len(scanner.PingEngines))
+	for _, engine := range scanner.PingEngines {
+		engines = append(engines, string(engine))
+	}
+	pingCmd.Flags().StringVarP(&engine, "engine", "e", "", fmt.Sprintf("How hosts are pinged. One of %v. Defaults to raw when probes other than echo requests are picked and probing otherwise. The raw engine sends to all hosts from one socket and needs root privileges.", strings.Join(engines, ", ")))
+	discovery.addFlags(&pingCmd, "")
+	pingCmd.Flags().IntVar(&opts.Rate, "rate", 1000, "Number of requests per second the raw engine sends. 0 means no limit.")
 	return &pingCmd
 }
 
+// discoveryFlags are the flags that pick the probes which find out whether hosts are up.
+type discoveryFlags struct {
+	probes   []string
+	synPorts string
+	ackPorts string
+	udpPorts string
+}
+
+// addFlags adds the discovery flags to cmd with their names starting with prefix.
+func (f *discoveryFlags) addFlags(cmd *cobra.Command, prefix string) {
+	probes := make([]string, 0, len(scanner.PingProbes))
+	for _, probe := range scanner.PingProbes {
+		probes = append(probes, string(probe))
+	}
+	cmd.Flags().StringSliceVar(&f.probes, prefix+"probes", nil, fmt.Sprintf("ICMP requests to send to IPv4 hosts. Any of %v. IPv6 hosts get echo requests. Defaults to echo when no ports are given.", strings.Join(probes, ", ")))
+	cmd.Flags().StringVar(&f.synPorts, prefix+"syn", "", "Ports to send TCP SYN probes to when finding out whether hosts are up, for example 22,80,443.")
+	cmd.Flags().StringVar(&f.ackPorts, prefix+"ack", "", "Ports to send TCP ACK probes to when finding out whether hosts are up.")
+	cmd.Flags().StringVar(&f.udpPorts, prefix+"udp", "", "Ports to send UDP probes to when finding out whether hosts are up. Closed ports answer with ICMP port unreachable.")
+}
+
+func (f *discoveryFlags) options() (opts scanner.DiscoveryOptions, err error) {
+	for _, probe := range f.probes {
+		opts.Probes = append(opts.Probes, scanner.PingProbe(probe))
+	}
+	if opts.SYNPorts, err = getPorts(f.synPorts); err != nil {
+		return opts, err
+	}
+	if opts.ACKPorts, err = getPorts(f.ackPorts); err != nil {
+		return opts, err
+	}
+	if opts.UDPPorts, err = getPorts(f.udpPorts); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
 // getScanTargets takes strings of targets and returns a slice of netip.Prefixes and a map of netip.Addr to hostnames.
 // It also returns an error if there are no targets provided or if there is an error parsing the targets.
 func getScanTargets(targetStrs []string) ([]netip.Prefix, map[netip.Addr]string, error) {
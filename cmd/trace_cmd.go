@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/config"
+	"github.com/kakeetopius/gscn/scanner"
+	"github.com/spf13/cobra"
+)
+
+func TraceCmd() *cobra.Command {
+	var opts scanner.TraceOptions
+	var method string
+	var port uint16
+	var ipv6 bool
+
+	traceCmd := cobra.Command{
+		Use:   "trace <target>",
+		Short: "Trace the route packets take to a host.",
+		Example: "\nThe target may be an IPv4 or IPv6 address or a domain name e.g.\n" +
+			"  gscn trace 10.1.1.1\n" +
+			"  gscn trace gscn.com -M tcp -p 443\n" +
+			"  gscn trace gscn.com -6 -M icmp\n",
+		Aliases: []string{"tr"},
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			opts.Target, opts.HostName, err = getSingleTarget(args[0], ipv6)
+			if err != nil {
+				return err
+			}
+			opts.Method = scanner.TraceMethod(method)
+			opts.Port = scanner.PortNumber(port)
+
+			appConfig, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+
+			tracer, err := scanner.NewTracer(opts)
+			if err != nil {
+				return err
+			}
+			return scanner.DoScan(context.Background(), tracer, scanOptions(appConfig, args))
+		},
+	}
+
+	methods := make([]string, 0, len(scanner.TraceMethods))
+	for _, method := range scanner.TraceMethods {
+		methods = append(methods, string(method))
+	}
+
+	traceCmd.Flags().SortFlags = false
+	traceCmd.Flags().StringVarP(&method, "method", "M", string(scanner.TraceMethodUDP), fmt.Sprintf("The kind of probes to send. One of %v.", strings.Join(methods, ", ")))
+	traceCmd.Flags().Uint16VarP(&port, "port", "p", 0, "The port tcp probes are sent to or the port udp probes start at. Defaults to 80 for tcp and 33434 for udp.")
+	traceCmd.Flags().BoolVarP(&ipv6, "ipv6", "6", false, "Trace the IPv6 address of a target given as a domain name.")
+	traceCmd.Flags().IntVarP(&opts.FirstHop, "first-hop", "f", 1, "The TTL or hop limit to start tracing from.")
+	traceCmd.Flags().IntVarP(&opts.MaxHops, "max-hops", "m", 30, "The largest TTL or hop limit to trace up to.")
+	traceCmd.Flags().IntVarP(&opts.Queries, "queries", "q", 3, "Number of probes to send to each hop.")
+	traceCmd.Flags().IntVarP(&opts.Parallel, "parallel", "N", 16, "Number of hops to probe at the same time.")
+	traceCmd.Flags().DurationVarP(&opts.ResponseTimeout, "response-timeout", "t", 2*time.Second, "Amount of time to wait for replies after each round of probes.")
+	traceCmd.Flags().BoolVarP(&opts.NoHostNames, "numeric", "n", false, "Do not look up the host names of the hops.")
+
+	return &traceCmd
+}
+
+// getSingleTarget returns the address of a single target and the name it was given as if target is a domain name, in which case its
+// IPv6 address is used if ipv6 is set.
+func getSingleTarget(target string, ipv6 bool) (netip.Addr, string, error) {
+	target = strings.TrimSpace(target)
+	if addr, err := netip.ParseAddr(target); err == nil {
+		return addr.Unmap(), "", nil
+	}
+
+	network := "ip4"
+	if ipv6 {
+		network = "ip6"
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(context.Background(), network, target)
+	if err != nil {
+		return netip.Addr{}, "", err
+	}
+	if len(addrs) == 0 {
+		return netip.Addr{}, "", fmt.Errorf("no ips returned after resolving %v", target)
+	}
+	return addrs[0].Unmap(), target, nil
+}
@@ -33,13 +33,7 @@ func WifiCmd() *cobra.Command {
 				return err
 			}
 
-			return scanner.DoScan(context.Background(), wifiScanner, scanner.ScanOptions{
-				ResultsOutputFile: outputFile,
-				PrintJSON:         outputJSON,
-				PrintJSONPretty:   jsonPretty,
-				Notify:            sendNotification,
-				Config:            appConfig,
-			})
+			return scanner.DoScan(context.Background(), wifiScanner, scanOptions(appConfig, args))
 		},
 	}
 
@@ -11,3 +11,47 @@ func Htons(num int) int {
 	binary.BigEndian.PutUint32(b[:], uint32(num))
 	return int(binary.BigEndian.Uint32(b[:]))
 }
+
+// Murmur3 returns the 32 bit MurmurHash3 (x86 variant) of data with the given seed.
+func Murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	h := seed
+	blocks := len(data) / 4
+	for i := range blocks {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = k<<15 | k>>17
+		k *= c2
+		h ^= k
+		h = h<<13 | h>>19
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[blocks*4:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = k<<15 | k>>17
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
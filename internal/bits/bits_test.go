@@ -0,0 +1,29 @@
+package bits
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		data     string
+		seed     uint32
+		expected int32
+	}{
+		{data: "", seed: 0, expected: 0},
+		{data: "", seed: 1, expected: 0x514e28b7},
+		{data: "\x00\x00\x00\x00", seed: 0, expected: 0x2362f9de},
+		{data: "foo", seed: 0, expected: -156908512},
+		{data: "hello", seed: 0, expected: 613153351},
+		{data: "Hello, world!", seed: 1234, expected: -84488781},
+		{data: "The quick brown fox jumps over the lazy dog", seed: 0, expected: 0x2e4ff723},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			assert.Equal(t, tt.expected, int32(Murmur3([]byte(tt.data), tt.seed)))
+		})
+	}
+}
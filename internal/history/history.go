@@ -0,0 +1,199 @@
+// Package history stores the results of completed scans in a local database so that they can be queried later.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// scansBucket maps scan ids to scans.
+	scansBucket = []byte("scans")
+	// hostsBucket maps a host's address followed by a scan id to what that scan saw of the host. It lets the history of a single host
+	// be read without going through every scan.
+	hostsBucket = []byte("hosts")
+)
+
+// Store is a scan history database.
+type Store struct {
+	db *bolt.DB
+}
+
+// Scan is a completed scan saved in the history.
+type Scan struct {
+	ID          uint64    `json:"id"`
+	Time        time.Time `json:"time"`
+	CommandLine string    `json:"command_line"`
+	ScanType    string    `json:"scan_type"`
+	Targets     []string  `json:"targets"`
+	NumHosts    int       `json:"num_hosts"`
+	// Hosts are the hosts found by the scan normalised into the same form for all scan types.
+	Hosts []Host `json:"hosts,omitempty"`
+	// Results are the scan's results in json format as written by gscn's --json flag.
+	Results json.RawMessage `json:"results,omitempty"`
+}
+
+// Host is what a scan found out about a single host.
+type Host struct {
+	IP       netip.Addr `json:"ip"`
+	State    string     `json:"state,omitempty"`
+	HostName string     `json:"hostname,omitempty"`
+	MAC      string     `json:"mac,omitempty"`
+	Vendor   string     `json:"vendor,omitempty"`
+	Ports    []Port     `json:"ports,omitempty"`
+}
+
+type Port struct {
+	Number   uint16 `json:"number"`
+	Protocol string `json:"protocol"`
+	State    string `json:"state"`
+	Service  string `json:"service,omitempty"`
+	// HostKeys are the SSH host keys collected from the port in the form "<type> <fingerprint>".
+	HostKeys []string `json:"host_keys,omitempty"`
+}
+
+// Observation is a host as seen by one scan in the history.
+type Observation struct {
+	ScanID   uint64    `json:"scan_id"`
+	Time     time.Time `json:"time"`
+	ScanType string    `json:"scan_type"`
+	Host     Host      `json:"host"`
+}
+
+// Open opens the history database at path, creating it if it does not exist.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open history database %v: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{scansBucket, hostsBucket} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Save adds a completed scan to the history and sets its ID.
+func (s *Store) Save(scan *Scan) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		scans := tx.Bucket(scansBucket)
+		hosts := tx.Bucket(hostsBucket)
+
+		id, err := scans.NextSequence()
+		if err != nil {
+			return err
+		}
+		scan.ID = id
+		scan.NumHosts = len(scan.Hosts)
+
+		for _, host := range scan.Hosts {
+			observation, err := json.Marshal(Observation{
+				ScanID:   scan.ID,
+				Time:     scan.Time,
+				ScanType: scan.ScanType,
+				Host:     host,
+			})
+			if err != nil {
+				return err
+			}
+			err = hosts.Put(hostKey(host.IP, scan.ID), observation)
+			if err != nil {
+				return err
+			}
+		}
+
+		data, err := json.Marshal(scan)
+		if err != nil {
+			return err
+		}
+		return scans.Put(binary.BigEndian.AppendUint64(nil, scan.ID), data)
+	})
+}
+
+// Scans returns the most recent scans in the history, newest first, without their hosts and results. All scans are returned if limit
+// is 0.
+func (s *Store) Scans(limit int) ([]Scan, error) {
+	scans := []Scan{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(scansBucket).Cursor()
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			if limit > 0 && len(scans) == limit {
+				break
+			}
+
+			var scan Scan
+			err := json.Unmarshal(value, &scan)
+			if err != nil {
+				return err
+			}
+			scan.Hosts = nil
+			scan.Results = nil
+			scans = append(scans, scan)
+		}
+		return nil
+	})
+	return scans, err
+}
+
+// Scan returns the scan with the given id.
+func (s *Store) Scan(id uint64) (Scan, error) {
+	var scan Scan
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(scansBucket).Get(binary.BigEndian.AppendUint64(nil, id))
+		if data == nil {
+			return fmt.Errorf("no scan with id %v in the history", id)
+		}
+		return json.Unmarshal(data, &scan)
+	})
+	return scan, err
+}
+
+// Host returns what every scan in the history saw of the host with address ip, oldest first.
+func (s *Store) Host(ip netip.Addr) ([]Observation, error) {
+	observations := []Observation{}
+	prefix := hostKey(ip, 0)
+	prefix = prefix[:len(prefix)-8]
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(hostsBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && slices.Equal(key[:min(len(key), len(prefix))], prefix); key, value = cursor.Next() {
+			var observation Observation
+			err := json.Unmarshal(value, &observation)
+			if err != nil {
+				return err
+			}
+			observations = append(observations, observation)
+		}
+		return nil
+	})
+	return observations, err
+}
+
+// hostKey returns the key of a host's observation in the hosts bucket. The address is prefixed with its length so that IPv4 addresses
+// are never a prefix of IPv6 ones, and the scan id is big endian so that observations of a host are sorted oldest first.
+func hostKey(ip netip.Addr, scanID uint64) []byte {
+	addr := ip.Unmap().AsSlice()
+	key := append([]byte{byte(len(addr))}, addr...)
+	return binary.BigEndian.AppendUint64(key, scanID)
+}
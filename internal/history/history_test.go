@@ -0,0 +1,74 @@
+package history
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	v4 := netip.MustParseAddr("10.0.5.12")
+	// shares its first 4 bytes with v4 so must not show up in v4's history.
+	v6 := netip.MustParseAddr("a00:50c::1")
+	first := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	scans := []*Scan{
+		{
+			Time:     first,
+			ScanType: "arp",
+			Targets:  []string{"10.0.5.0/24"},
+			Hosts:    []Host{{IP: v4, MAC: "00:1a:2b:3c:4d:5e"}, {IP: v6}},
+			Results:  []byte(`{"results":[]}`),
+		},
+		{
+			Time:     first.Add(time.Hour),
+			ScanType: "syn",
+			Hosts:    []Host{{IP: v4, Ports: []Port{{Number: 3389, Protocol: "tcp", State: "open"}}}},
+		},
+	}
+	for _, scan := range scans {
+		require.NoError(t, store.Save(scan))
+	}
+	assert.Equal(t, uint64(1), scans[0].ID)
+	assert.Equal(t, uint64(2), scans[1].ID)
+
+	listed, err := store.Scans(0)
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	assert.Equal(t, uint64(2), listed[0].ID)
+	assert.Equal(t, 2, listed[1].NumHosts)
+	assert.Nil(t, listed[1].Hosts)
+	assert.Nil(t, listed[1].Results)
+
+	listed, err = store.Scans(1)
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+
+	scan, err := store.Scan(1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.5.0/24"}, scan.Targets)
+	assert.JSONEq(t, `{"results":[]}`, string(scan.Results))
+
+	_, err = store.Scan(3)
+	assert.Error(t, err)
+
+	observations, err := store.Host(v4)
+	require.NoError(t, err)
+	require.Len(t, observations, 2)
+	assert.Equal(t, "arp", observations[0].ScanType)
+	assert.Equal(t, "00:1a:2b:3c:4d:5e", observations[0].Host.MAC)
+	assert.Equal(t, first.Add(time.Hour), observations[1].Time.UTC())
+	assert.Equal(t, uint16(3389), observations[1].Host.Ports[0].Number)
+
+	observations, err = store.Host(netip.MustParseAddr("10.0.5.13"))
+	require.NoError(t, err)
+	assert.Empty(t, observations)
+}
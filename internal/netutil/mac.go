@@ -16,6 +16,25 @@ func (m MAC) MarshalJSON() ([]byte, error) {
 	return json.Marshal(net.HardwareAddr(m).String())
 }
 
+func (m *MAC) UnmarshalJSON(data []byte) error {
+	var addr string
+	err := json.Unmarshal(data, &addr)
+	if err != nil {
+		return err
+	}
+	if addr == "" {
+		*m = nil
+		return nil
+	}
+
+	hwAddr, err := net.ParseMAC(addr)
+	if err != nil {
+		return err
+	}
+	*m = MAC(hwAddr)
+	return nil
+}
+
 func (m MAC) IsZero() bool {
 	return slices.Equal(m, MAC{0, 0, 0, 0, 0, 0})
 }
@@ -61,6 +61,13 @@ func (r *resolver) Resolve(addr netip.Addr) (netutil.MAC, error) {
 	return mac, nil
 }
 
+func (r *resolver) Add(addr netip.Addr, mac netutil.MAC) {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	r.resolveCache[addr] = mac
+	delete(r.macNotFound, addr)
+}
+
 func (r *resolver) resolveMAC(addr netip.Addr) (netutil.MAC, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
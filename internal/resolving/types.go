@@ -10,6 +10,9 @@ import (
 
 type Resolver interface {
 	Resolve(netip.Addr) (netutil.MAC, error)
+	// Add records mac as the mac address of addr, eg one learnt from an ARP or NDP reply, so that Resolve returns it without
+	// resolving addr again.
+	Add(addr netip.Addr, mac netutil.MAC)
 }
 
 type ErrMacNotFound struct {
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/google/gopacket/layers"
 	"github.com/kakeetopius/gscn/internal/bits"
 	"github.com/kakeetopius/gscn/internal/netutil"
 	"golang.org/x/sys/unix"
@@ -32,11 +33,13 @@ type LinuxPacketSender struct {
 	ctx               context.Context
 	cancelFunc        context.CancelFunc
 	closed            bool
+	recorder          *Recorder
 }
 
 type linuxPacket struct {
 	data          []byte
 	outgoingIface unix.SockaddrLinklayer
+	iface         *netutil.Interface
 }
 
 func NewLinuxPacketSender(ctx context.Context) (*LinuxPacketSender, error) {
@@ -56,6 +59,7 @@ func NewLinuxPacketSender(ctx context.Context) (*LinuxPacketSender, error) {
 		senderFinished:    make(chan struct{}),
 		ctx:               newCtx,
 		cancelFunc:        cancel,
+		recorder:          RecorderFromContext(ctx),
 	}
 
 	go ps.startSender()
@@ -79,6 +83,7 @@ func (ps *LinuxPacketSender) SendPacket(packetData []byte, iface *netutil.Interf
 	ps.sendChannel <- linuxPacket{
 		data:          packetData,
 		outgoingIface: addr,
+		iface:         iface,
 	}
 
 	return nil
@@ -108,7 +113,9 @@ func (ps *LinuxPacketSender) startSender() {
 			err := unix.Sendto(ps.socketFD, packet.data, 0, &packet.outgoingIface)
 			if err != nil {
 				fmt.Println(err)
+				continue
 			}
+			ps.recorder.RecordSent(packet.data, packet.iface, packet.iface.LinkType)
 		}
 	}
 }
@@ -121,10 +128,12 @@ type LinuxRawIPSender struct {
 	ctx            context.Context
 	cancelFunc     context.CancelFunc
 	closed         bool
+	recorder       *Recorder
 }
 
 type linuxIPPacket struct {
-	data []byte
+	data  []byte
+	iface *netutil.Interface
 }
 
 func NewLinuxRawIPSender(ctx context.Context) (*LinuxRawIPSender, error) {
@@ -152,6 +161,7 @@ func NewLinuxRawIPSender(ctx context.Context) (*LinuxRawIPSender, error) {
 		senderFinished: make(chan struct{}),
 		ctx:            newCtx,
 		cancelFunc:     cancel,
+		recorder:       RecorderFromContext(ctx),
 	}
 
 	go ps.startSender()
@@ -163,9 +173,10 @@ func (ps *LinuxRawIPSender) Type() PacketSenderType {
 	return PacketSenderTypeIPLayer
 }
 
-func (ps *LinuxRawIPSender) SendPacket(packetData []byte, _ *netutil.Interface) error {
+func (ps *LinuxRawIPSender) SendPacket(packetData []byte, iface *netutil.Interface) error {
 	ps.sendChannel <- linuxIPPacket{
-		data: packetData,
+		data:  packetData,
+		iface: iface,
 	}
 
 	return nil
@@ -206,20 +217,24 @@ func (ps *LinuxRawIPSender) startSender() {
 			}
 
 			// Assumes packet starts from IP header
+			var err error
 			switch packet.data[0] >> 4 { // extract ip version from the raw bytes
 			case 4:
 				var dst unix.SockaddrInet4
 				copy(dst.Addr[:], packet.data[16:20]) // ip4 address is from byte  16 to 19
-				_ = unix.Sendto(ps.ipv4Sock, packet.data, 0, &dst)
+				err = unix.Sendto(ps.ipv4Sock, packet.data, 0, &dst)
 
 			case 6:
 				var dst unix.SockaddrInet6
 				copy(dst.Addr[:], packet.data[24:40]) // ip6 address is from byte 24 to 39
-				_ = unix.Sendto(ps.ipv6Sock, packet.data, 0, &dst)
+				err = unix.Sendto(ps.ipv6Sock, packet.data, 0, &dst)
 
 			default:
 				continue
 			}
+			if err == nil {
+				ps.recorder.RecordSent(packet.data, packet.iface, layers.LinkTypeRaw)
+			}
 		}
 	}
 }
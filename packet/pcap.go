@@ -18,11 +18,13 @@ type PcapPacketSender struct {
 	ctx            context.Context
 	cancelFunc     context.CancelFunc
 	closed         bool
+	recorder       *Recorder
 }
 
 type packet struct {
 	data          []byte
 	outgoingIface *pcap.Handle
+	iface         *netutil.Interface
 }
 
 func NewPcapPacketSender(ctx context.Context) *PcapPacketSender {
@@ -34,6 +36,7 @@ func NewPcapPacketSender(ctx context.Context) *PcapPacketSender {
 		mu:             sync.RWMutex{},
 		ctx:            newCtx,
 		cancelFunc:     cancel,
+		recorder:       RecorderFromContext(ctx),
 	}
 
 	go ps.startSender()
@@ -73,6 +76,7 @@ func (ps *PcapPacketSender) SendPacket(packetData []byte, iface *netutil.Interfa
 	ps.sendChannel <- packet{
 		data:          packetData,
 		outgoingIface: handle,
+		iface:         iface,
 	}
 	return nil
 }
@@ -90,7 +94,10 @@ func (ps *PcapPacketSender) startSender() {
 			if !ok {
 				return
 			}
-			packet.outgoingIface.WritePacketData(packet.data)
+			err := packet.outgoingIface.WritePacketData(packet.data)
+			if err == nil {
+				ps.recorder.RecordSent(packet.data, packet.iface, packet.outgoingIface.LinkType())
+			}
 		}
 	}
 }
@@ -115,6 +122,7 @@ type PcapPacketReceiver struct {
 	packetChan chan gopacket.Packet
 	receiverWg sync.WaitGroup
 	closed     bool
+	recorder   *Recorder
 }
 
 type receivingInterface struct {
@@ -130,6 +138,7 @@ func NewPacketReceiver(ctx context.Context, filter string, channelCapacity int,
 		filter:     filter,
 		ifaces:     make(map[int]receivingInterface),
 		packetChan: make(chan gopacket.Packet, channelCapacity),
+		recorder:   RecorderFromContext(ctx),
 	}
 
 	for _, iface := range receivingInterfaces {
@@ -217,6 +226,7 @@ func (pr *PcapPacketReceiver) capturePacketsOnInterface(iface receivingInterface
 		case <-pr.ctx.Done():
 			return
 		case pr.packetChan <- packet:
+			pr.recorder.RecordReceived(packet, iface.Interface, iface.handle.LinkType())
 		}
 	}
 }
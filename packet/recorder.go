@@ -0,0 +1,227 @@
+package packet
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+)
+
+// pcapng block types and options. See https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+const (
+	pcapngSectionHeaderBlock   uint32 = 0x0A0D0D0A
+	pcapngInterfaceBlock       uint32 = 0x00000001
+	pcapngEnhancedPacketBlock  uint32 = 0x00000006
+	pcapngByteOrderMagic       uint32 = 0x1A2B3C4D
+	pcapngOptEndOfOpt          uint16 = 0
+	pcapngOptComment           uint16 = 1
+	pcapngOptShbUserAppl       uint16 = 4
+	pcapngOptIfName            uint16 = 2
+	pcapngOptIfTsResol         uint16 = 9
+	pcapngOptEpbFlags          uint16 = 2
+	pcapngEpbFlagInbound       uint32 = 0b01
+	pcapngEpbFlagOutbound      uint32 = 0b10
+	pcapngTimestampNanoseconds uint8  = 9
+)
+
+// Recorder writes the packets gscn sends and receives to a pcapng file. Every interface packets pass through gets its own interface
+// block and every packet is marked as inbound or outbound and carries a comment saying whether gscn sent or received it.
+//
+// A nil *Recorder is valid and records nothing so senders and receivers do not need to check whether recording is enabled.
+type Recorder struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	ifaces map[recorderInterface]uint32
+	err    error
+}
+
+// recorderInterface identifies an interface block in the pcapng file.
+type recorderInterface struct {
+	name     string
+	linkType layers.LinkType
+}
+
+type recorderKey struct{}
+
+// errRecorderClosed stops packets that are sent or received after the recorder is closed from being recorded.
+var errRecorderClosed = errors.New("recorder closed")
+
+// NewRecorder returns a recorder that writes a pcapng file to w.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	r := &Recorder{
+		w:      bufio.NewWriter(w),
+		ifaces: make(map[recorderInterface]uint32),
+	}
+	if closer, ok := w.(io.Closer); ok {
+		r.closer = closer
+	}
+
+	err := r.writeBlock(pcapngSectionHeaderBlock, func(body []byte) []byte {
+		body = binary.LittleEndian.AppendUint32(body, pcapngByteOrderMagic)
+		body = binary.LittleEndian.AppendUint16(body, 1) // major version
+		body = binary.LittleEndian.AppendUint16(body, 0) // minor version
+		body = binary.LittleEndian.AppendUint64(body, 0xFFFFFFFFFFFFFFFF)
+		body = appendOption(body, pcapngOptShbUserAppl, []byte("gscn"))
+		return appendOption(body, pcapngOptEndOfOpt, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// NewFileRecorder creates the file at path and returns a recorder that writes to it.
+func NewFileRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewRecorder(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ContextWithRecorder returns a copy of ctx that carries r. Packet senders and receivers created with the returned context record
+// their packets with r.
+func ContextWithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// RecorderFromContext returns the recorder carried by ctx or nil if there is none.
+func RecorderFromContext(ctx context.Context) *Recorder {
+	r, _ := ctx.Value(recorderKey{}).(*Recorder)
+	return r
+}
+
+// RecordSent records a packet that was sent out of iface. iface may be nil for packets sent at the IP layer.
+func (r *Recorder) RecordSent(data []byte, iface *netutil.Interface, linkType layers.LinkType) {
+	name := "raw"
+	if iface != nil {
+		name = iface.Name
+	}
+	r.record(gopacket.CaptureInfo{
+		Timestamp:     time.Now(),
+		CaptureLength: len(data),
+		Length:        len(data),
+	}, data, recorderInterface{name: name, linkType: linkType}, pcapngEpbFlagOutbound, "sent by gscn")
+}
+
+// RecordReceived records a packet that was received on iface and delivered to a scanner.
+func (r *Recorder) RecordReceived(packet gopacket.Packet, iface netutil.Interface, linkType layers.LinkType) {
+	r.record(packet.Metadata().CaptureInfo, packet.Data(), recorderInterface{name: iface.Name, linkType: linkType},
+		pcapngEpbFlagInbound, "received by gscn")
+}
+
+func (r *Recorder) record(ci gopacket.CaptureInfo, data []byte, iface recorderInterface, flags uint32, comment string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	id, ok := r.ifaces[iface]
+	if !ok {
+		id = uint32(len(r.ifaces))
+		r.err = r.writeBlock(pcapngInterfaceBlock, func(body []byte) []byte {
+			body = binary.LittleEndian.AppendUint16(body, uint16(iface.linkType))
+			body = binary.LittleEndian.AppendUint16(body, 0) // reserved
+			body = binary.LittleEndian.AppendUint32(body, 0) // no snap length
+			body = appendOption(body, pcapngOptIfName, []byte(iface.name))
+			body = appendOption(body, pcapngOptIfTsResol, []byte{pcapngTimestampNanoseconds})
+			return appendOption(body, pcapngOptEndOfOpt, nil)
+		})
+		if r.err != nil {
+			return
+		}
+		r.ifaces[iface] = id
+	}
+
+	timestamp := uint64(ci.Timestamp.UnixNano())
+	r.err = r.writeBlock(pcapngEnhancedPacketBlock, func(body []byte) []byte {
+		body = binary.LittleEndian.AppendUint32(body, id)
+		body = binary.LittleEndian.AppendUint32(body, uint32(timestamp>>32))
+		body = binary.LittleEndian.AppendUint32(body, uint32(timestamp))
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+		body = binary.LittleEndian.AppendUint32(body, uint32(max(ci.Length, len(data))))
+		body = append(body, data...)
+		body = append(body, make([]byte, padding(len(data)))...)
+		body = appendOption(body, pcapngOptEpbFlags, binary.LittleEndian.AppendUint32(nil, flags))
+		body = appendOption(body, pcapngOptComment, []byte(comment))
+		return appendOption(body, pcapngOptEndOfOpt, nil)
+	})
+}
+
+// writeBlock writes a block of the given type whose body is built by appendBody.
+func (r *Recorder) writeBlock(blockType uint32, appendBody func(body []byte) []byte) error {
+	body := appendBody(nil)
+	totalLength := uint32(len(body) + 12) // type and both length fields
+
+	block := make([]byte, 0, totalLength)
+	block = binary.LittleEndian.AppendUint32(block, blockType)
+	block = binary.LittleEndian.AppendUint32(block, totalLength)
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, totalLength)
+
+	_, err := r.w.Write(block)
+	return err
+}
+
+// Close flushes the recorded packets and closes the underlying writer if it is an io.Closer. It returns the first error encountered
+// while recording.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == errRecorderClosed {
+		return nil
+	}
+	err := r.w.Flush()
+	if r.err == nil {
+		r.err = err
+	}
+	if r.closer != nil {
+		err = r.closer.Close()
+		if r.err == nil {
+			r.err = err
+		}
+	}
+	err, r.err = r.err, errRecorderClosed
+	if err != nil {
+		return fmt.Errorf("could not write pcapng file: %w", err)
+	}
+	return nil
+}
+
+func appendOption(body []byte, code uint16, value []byte) []byte {
+	body = binary.LittleEndian.AppendUint16(body, code)
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(value)))
+	body = append(body, value...)
+	return append(body, make([]byte, padding(len(value)))...)
+}
+
+// padding returns the number of bytes needed to pad length to a multiple of 4.
+func padding(length int) int {
+	return (4 - length%4) % 4
+}
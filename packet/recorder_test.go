@@ -0,0 +1,61 @@
+package packet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder(t *testing.T) {
+	buf := bytes.Buffer{}
+	recorder, err := NewRecorder(&buf)
+	require.NoError(t, err)
+
+	eth0 := &netutil.Interface{Interface: net.Interface{Index: 2, Name: "eth0"}, LinkType: layers.LinkTypeEthernet}
+	sent := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e, 0x08, 0x06, 0x00}
+	received := gopacket.NewPacket([]byte{0x45, 0x00, 0x00, 0x14}, layers.LayerTypeIPv4, gopacket.Default)
+	receivedAt := time.Unix(1700000000, 123456789)
+	received.Metadata().CaptureInfo = gopacket.CaptureInfo{Timestamp: receivedAt, CaptureLength: 4, Length: 4}
+
+	recorder.RecordSent(sent, eth0, eth0.LinkType)
+	recorder.RecordSent([]byte{0x45, 0x00}, nil, layers.LinkTypeRaw)
+	recorder.RecordReceived(received, *eth0, layers.LinkTypeEthernet)
+	require.NoError(t, recorder.Close())
+
+	// packets recorded after closing are dropped.
+	recorder.RecordSent(sent, eth0, eth0.LinkType)
+	assert.NoError(t, recorder.Close())
+
+	reader, err := pcapgo.NewNgReader(&buf, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+	require.NoError(t, err)
+
+	data, ci, err := reader.ReadPacketData()
+	require.NoError(t, err)
+	assert.Equal(t, sent, data)
+	assert.Equal(t, 0, ci.InterfaceIndex)
+
+	data, ci, err = reader.ReadPacketData()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x45, 0x00}, data)
+	assert.Equal(t, 1, ci.InterfaceIndex)
+
+	data, ci, err = reader.ReadPacketData()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x45, 0x00, 0x00, 0x14}, data)
+	assert.Equal(t, 0, ci.InterfaceIndex)
+	assert.True(t, receivedAt.Equal(ci.Timestamp))
+
+	assert.Equal(t, 2, reader.NInterfaces())
+	iface, err := reader.Interface(1)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", iface.Name)
+	assert.Equal(t, layers.LinkTypeRaw, iface.LinkType)
+}
@@ -7,9 +7,7 @@ import (
 	"net/netip"
 	"runtime"
 	"slices"
-	"strings"
 	"syscall"
-	"text/template"
 	"time"
 
 	"github.com/google/gopacket"
@@ -30,6 +28,7 @@ type ARPScanner struct {
 	router         routing.Router
 	packetReceiver *packet.PcapPacketReceiver
 	packetSender   packet.PacketSender
+	stream         *resultStream
 }
 
 type ARPScanOptions struct {
@@ -113,6 +112,10 @@ func (s *ARPScanner) Scan(ctx context.Context) (ScanResults, error) {
 	return &s.results, nil
 }
 
+func (s *ARPScanner) setResultStream(stream *resultStream) {
+	s.stream = stream
+}
+
 func (s *ARPScanner) addResultInfo() error {
 	results := s.results
 	numHosts := len(results.HostResults)
@@ -156,13 +159,16 @@ func (r *ARPScanResults) Print() {
 	displayARPResults(r, r.printHostNames, r.printVendors)
 }
 
-func (r *ARPScanResults) String() string {
-	stringBuilder := strings.Builder{}
-
-	tmpl := template.Must(template.New("arp_scan_results").Parse(ARPScanResultsTemplate))
-	tmpl.Execute(&stringBuilder, r)
+func (r *ARPScanResults) table() [][]string {
+	rows := [][]string{{"ip", "mac", "hostname", "vendor"}}
+	for _, result := range r.HostResults {
+		rows = append(rows, []string{result.IPAddr.String(), result.MacAddr.String(), result.HostName, result.Vendor})
+	}
+	return rows
+}
 
-	return stringBuilder.String()
+func (r *ARPScanResults) String() string {
+	return executeResultsTemplate("arp_scan_results", ARPScanResultsTemplate, r)
 }
 
 func (s *ARPScanner) runArp(ctx context.Context) error {
@@ -404,10 +410,16 @@ func (s *ARPScanner) getARPReplies(ctx context.Context, startSendChan chan<- str
 				continue
 			}
 			receivedFrom[ipAddr] = struct{}{}
-			results = append(results, ARPHostResult{
+			result := ARPHostResult{
 				IPAddr:  ipAddr,
 				MacAddr: netutil.MAC(arpPacket.SourceHwAddress),
-			})
+			}
+			results = append(results, result)
+
+			if s.WithVendorInfo {
+				result.Vendor = netutil.MACVendor(result.MacAddr.String())
+			}
+			s.stream.writeHost(result)
 		}
 	}
 }
@@ -9,8 +9,8 @@ import (
 	"net"
 	"net/netip"
 	"runtime"
+	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/google/gopacket"
@@ -125,24 +125,30 @@ func (r DHCPv4ScannerResults) Print() {
 	displayDHCPServerResults(&r, r.printHostNames, r.printVendors)
 }
 
-func (r DHCPv4ScannerResults) String() string {
-	stringBuilder := strings.Builder{}
-
-	funcMap := template.FuncMap{
-		"add": func(a, b int) int {
-			return a + b
-		},
-		"join": joinAddrs,
+func (r DHCPv4ScannerResults) table() [][]string {
+	rows := [][]string{{
+		"ip", "mac", "hostname", "vendor", "offered_ip", "subnet_mask", "broadcast", "routers", "dns_servers", "domain_name", "lease_time_s",
+	}}
+	for _, server := range r.Servers {
+		rows = append(rows, []string{
+			server.IP.String(),
+			server.MACAddress.String(),
+			server.HostName,
+			server.Vendor,
+			addrString(server.OfferedIP),
+			addrString(server.SubnetMask),
+			addrString(server.BroadCast),
+			joinAddrs(server.Routers),
+			joinAddrs(server.DNSServers),
+			server.DomainName,
+			strconv.Itoa(int(server.LeaseTime.Seconds())),
+		})
 	}
-	tmpl := template.Must(
-		template.
-			New("dhcpv4_scan").
-			Funcs(funcMap).
-			Parse(DHCPScanResultsTemplate),
-	)
+	return rows
+}
 
-	tmpl.Execute(&stringBuilder, r)
-	return stringBuilder.String()
+func (r DHCPv4ScannerResults) String() string {
+	return executeResultsTemplate("dhcpv4_scan", DHCPScanResultsTemplate, r)
 }
 
 func (s *DHCPv4Scanner) addResultInfo() error {
@@ -462,6 +468,14 @@ func joinAddrs(addrs []netip.Addr) string {
 	return strings.Join(result, ", ")
 }
 
+// addrString returns the string form of addr or an empty string if addr is the zero value.
+func addrString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
 func decodeAddrSlice(b []byte) ([]netip.Addr, error) {
 	if len(b)%4 != 0 {
 		return nil, fmt.Errorf("invalid ip address slice")
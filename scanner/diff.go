@@ -0,0 +1,356 @@
+package scanner
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+)
+
+// Kinds of changes reported in a ScanDiff.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// DiffOptions control which differences between two scan results are reported.
+type DiffOptions struct {
+	// RTTThreshold is the smallest change in a host's average round trip time that is reported.
+	RTTThreshold time.Duration
+}
+
+// ScanDiff is the difference between an older and a newer set of results of the same scan type.
+type ScanDiff struct {
+	// ScanType is the type of the compared scans eg syn or arp.
+	ScanType string `json:"scan_type"`
+	// Hosts are the hosts that came up (added) or went down (removed) between the port or ping scans.
+	Hosts []HostChange `json:"hosts"`
+	// Ports are the ports whose state changed on hosts found in both port scans.
+	Ports []PortChange `json:"ports"`
+	// HostKeys are the SSH host keys that were added, removed or changed on ports whose host keys were collected by both port scans. A
+	// changed host key can mean the host was reinstalled or is being impersonated.
+	HostKeys []HostKeyChange `json:"host_keys"`
+	// RTTs are the hosts whose average round trip time changed by at least the threshold.
+	RTTs []RTTChange `json:"rtts"`
+	// Addresses are the IP to MAC address pairs that were added, removed or changed between the ARP or NDP scans.
+	Addresses []AddressChange `json:"addresses"`
+	// DHCPServers are the DHCP servers that were added, removed or whose offered options changed.
+	DHCPServers []DHCPServerChange `json:"dhcp_servers"`
+}
+
+type HostChange struct {
+	Addr     netip.Addr `json:"ip"`
+	HostName string     `json:"hostname"`
+	Change   string     `json:"change"`
+}
+
+type PortChange struct {
+	Addr     netip.Addr `json:"ip"`
+	Number   PortNumber `json:"number"`
+	Name     string     `json:"name"`
+	Protocol string     `json:"protocol"`
+	OldState PortState  `json:"old_state"`
+	NewState PortState  `json:"new_state"`
+}
+
+// HostKeyChange is an SSH host key of a port that was added, removed or changed. OldFingerprint is empty for added keys and
+// NewFingerprint is empty for removed ones.
+type HostKeyChange struct {
+	Addr           netip.Addr `json:"ip"`
+	Port           PortNumber `json:"port"`
+	KeyType        string     `json:"key_type"`
+	OldFingerprint string     `json:"old_fingerprint"`
+	NewFingerprint string     `json:"new_fingerprint"`
+	Change         string     `json:"change"`
+}
+
+type RTTChange struct {
+	Addr   netip.Addr    `json:"ip"`
+	OldRTT time.Duration `json:"old_rtt"`
+	NewRTT time.Duration `json:"new_rtt"`
+}
+
+type AddressChange struct {
+	IPAddr netip.Addr  `json:"ip"`
+	OldMAC netutil.MAC `json:"old_mac"`
+	NewMAC netutil.MAC `json:"new_mac"`
+	Change string      `json:"change"`
+}
+
+type DHCPServerChange struct {
+	IP      netip.Addr     `json:"ip"`
+	Change  string         `json:"change"`
+	Options []OptionChange `json:"options,omitempty"`
+}
+
+type OptionChange struct {
+	Name     string `json:"name"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// DiffResults compares the results of an earlier scan before with the results of a later scan after. Both must be of the same scan type.
+func DiffResults(before ScanResults, after ScanResults, opts DiffOptions) (*ScanDiff, error) {
+	scanType := templateName(before)
+	if scanType != templateName(after) {
+		return nil, fmt.Errorf("cannot compare %v scan results with %v scan results", scanType, templateName(after))
+	}
+	diff := &ScanDiff{ScanType: scanType}
+
+	switch before := before.(type) {
+	case portScanResults:
+		diff.diffPortScans(before.hostResults(), after.(portScanResults).hostResults(), opts)
+	case *PingScanResults:
+		diff.diffPingScans(before.HostResults, after.(*PingScanResults).HostResults, opts)
+	case *ARPScanResults:
+		diff.diffAddresses(arpAddresses(before), arpAddresses(after.(*ARPScanResults)))
+	case *NDPScanResults:
+		diff.diffAddresses(ndpAddresses(before), ndpAddresses(after.(*NDPScanResults)))
+	case DHCPv4ScannerResults:
+		diff.diffDHCPServers(before.Servers, after.(DHCPv4ScannerResults).Servers)
+	default:
+		return nil, fmt.Errorf("comparing %v scan results is not supported", scanType)
+	}
+
+	return diff, nil
+}
+
+// HasChanges reports whether any differences were found.
+func (d *ScanDiff) HasChanges() bool {
+	return len(d.Hosts) != 0 || len(d.Ports) != 0 || len(d.HostKeys) != 0 || len(d.RTTs) != 0 || len(d.Addresses) != 0 || len(d.DHCPServers) != 0
+}
+
+func (d *ScanDiff) diffPortScans(before HostResults, after HostResults, opts DiffOptions) {
+	for _, newHost := range sortedHostResults(after) {
+		oldHost, found := before[newHost.Addr]
+		d.diffHostState(oldHost.HostState == HostStateUp, newHost.HostState == HostStateUp, newHost.Addr, newHost.HostName)
+		if !found {
+			continue
+		}
+
+		for _, newPort := range newHost.Ports {
+			i := slices.IndexFunc(oldHost.Ports, func(p Port) bool {
+				return p.Number == newPort.Number && p.Protocol == newPort.Protocol
+			})
+			if i == -1 {
+				continue
+			}
+			d.diffHostKeys(oldHost.Ports[i].SSH, newPort.SSH, newHost.Addr, newPort.Number)
+			if oldHost.Ports[i].State == newPort.State {
+				continue
+			}
+			d.Ports = append(d.Ports, PortChange{
+				Addr:     newHost.Addr,
+				Number:   newPort.Number,
+				Name:     newPort.Name,
+				Protocol: newPort.Protocol,
+				OldState: oldHost.Ports[i].State,
+				NewState: newPort.State,
+			})
+		}
+
+		d.diffRTT(oldHost.AverageRTT, newHost.AverageRTT, newHost.Addr, opts)
+	}
+
+	for _, oldHost := range sortedHostResults(before) {
+		if _, found := after[oldHost.Addr]; !found {
+			d.diffHostState(oldHost.HostState == HostStateUp, false, oldHost.Addr, oldHost.HostName)
+		}
+	}
+}
+
+func (d *ScanDiff) diffPingScans(before []PingHostResult, after []PingHostResult, opts DiffOptions) {
+	oldHosts := make(PingScanResultsMap, len(before))
+	for _, host := range before {
+		oldHosts[host.IP] = host
+	}
+
+	for _, newHost := range after {
+		oldHost, found := oldHosts[newHost.IP]
+		d.diffHostState(oldHost.HostState == HostStateUp, newHost.HostState == HostStateUp, newHost.IP, newHost.HostName)
+		if found {
+			d.diffRTT(oldHost.AverageRTT, newHost.AverageRTT, newHost.IP, opts)
+		}
+		delete(oldHosts, newHost.IP)
+	}
+
+	for _, oldHost := range before {
+		if _, found := oldHosts[oldHost.IP]; found {
+			d.diffHostState(oldHost.HostState == HostStateUp, false, oldHost.IP, oldHost.HostName)
+		}
+	}
+}
+
+func (d *ScanDiff) diffHostState(wasUp bool, isUp bool, addr netip.Addr, hostName string) {
+	switch {
+	case !wasUp && isUp:
+		d.Hosts = append(d.Hosts, HostChange{Addr: addr, HostName: hostName, Change: ChangeAdded})
+	case wasUp && !isUp:
+		d.Hosts = append(d.Hosts, HostChange{Addr: addr, HostName: hostName, Change: ChangeRemoved})
+	}
+}
+
+// diffHostKeys records the SSH host keys of a port that were added, removed or changed if both scans collected them.
+func (d *ScanDiff) diffHostKeys(before *SSHInfo, after *SSHInfo, addr netip.Addr, port PortNumber) {
+	if before == nil || after == nil {
+		return
+	}
+	for _, newKey := range after.HostKeys {
+		i := slices.IndexFunc(before.HostKeys, func(k SSHHostKey) bool { return k.Type == newKey.Type })
+		switch {
+		case i == -1:
+			d.HostKeys = append(d.HostKeys, HostKeyChange{Addr: addr, Port: port, KeyType: newKey.Type, NewFingerprint: newKey.Fingerprint, Change: ChangeAdded})
+		case before.HostKeys[i].Fingerprint != newKey.Fingerprint:
+			d.HostKeys = append(d.HostKeys, HostKeyChange{
+				Addr:           addr,
+				Port:           port,
+				KeyType:        newKey.Type,
+				OldFingerprint: before.HostKeys[i].Fingerprint,
+				NewFingerprint: newKey.Fingerprint,
+				Change:         ChangeChanged,
+			})
+		}
+	}
+	for _, oldKey := range before.HostKeys {
+		if !slices.ContainsFunc(after.HostKeys, func(k SSHHostKey) bool { return k.Type == oldKey.Type }) {
+			d.HostKeys = append(d.HostKeys, HostKeyChange{Addr: addr, Port: port, KeyType: oldKey.Type, OldFingerprint: oldKey.Fingerprint, Change: ChangeRemoved})
+		}
+	}
+}
+
+// diffRTT records a change in a host's average round trip time if both scans measured it and it changed by at least the threshold.
+func (d *ScanDiff) diffRTT(before time.Duration, after time.Duration, addr netip.Addr, opts DiffOptions) {
+	if before == 0 || after == 0 {
+		return
+	}
+	if (after-before).Abs() < opts.RTTThreshold || before == after {
+		return
+	}
+	d.RTTs = append(d.RTTs, RTTChange{Addr: addr, OldRTT: before, NewRTT: after})
+}
+
+// addressPair is an IP address and the MAC address it was found at.
+type addressPair struct {
+	ip  netip.Addr
+	mac netutil.MAC
+}
+
+func arpAddresses(r *ARPScanResults) []addressPair {
+	pairs := make([]addressPair, 0, len(r.HostResults))
+	for _, host := range r.HostResults {
+		pairs = append(pairs, addressPair{ip: host.IPAddr, mac: host.MacAddr})
+	}
+	return pairs
+}
+
+func ndpAddresses(r *NDPScanResults) []addressPair {
+	pairs := make([]addressPair, 0, len(r.HostResults))
+	for _, host := range r.HostResults {
+		pairs = append(pairs, addressPair{ip: host.IPAddr, mac: host.MacAddr})
+	}
+	return pairs
+}
+
+func (d *ScanDiff) diffAddresses(before []addressPair, after []addressPair) {
+	oldMACs := make(map[netip.Addr]netutil.MAC, len(before))
+	for _, pair := range before {
+		oldMACs[pair.ip] = pair.mac
+	}
+	newMACs := make(map[netip.Addr]netutil.MAC, len(after))
+	for _, pair := range after {
+		newMACs[pair.ip] = pair.mac
+	}
+
+	for _, pair := range after {
+		oldMAC, found := oldMACs[pair.ip]
+		switch {
+		case !found:
+			d.Addresses = append(d.Addresses, AddressChange{IPAddr: pair.ip, NewMAC: pair.mac, Change: ChangeAdded})
+		case !slices.Equal(oldMAC, pair.mac):
+			d.Addresses = append(d.Addresses, AddressChange{IPAddr: pair.ip, OldMAC: oldMAC, NewMAC: pair.mac, Change: ChangeChanged})
+		}
+	}
+	for _, pair := range before {
+		if _, found := newMACs[pair.ip]; !found {
+			d.Addresses = append(d.Addresses, AddressChange{IPAddr: pair.ip, OldMAC: pair.mac, Change: ChangeRemoved})
+		}
+	}
+
+	slices.SortStableFunc(d.Addresses, func(a, b AddressChange) int {
+		return a.IPAddr.Compare(b.IPAddr)
+	})
+}
+
+func (d *ScanDiff) diffDHCPServers(before []DHCPv4Server, after []DHCPv4Server) {
+	for _, newServer := range after {
+		i := slices.IndexFunc(before, func(s DHCPv4Server) bool { return s.IP == newServer.IP })
+		if i == -1 {
+			d.DHCPServers = append(d.DHCPServers, DHCPServerChange{IP: newServer.IP, Change: ChangeAdded})
+			continue
+		}
+
+		oldOptions := structFields(before[i].DHCPv4ServerOptions)
+		newOptions := structFields(newServer.DHCPv4ServerOptions)
+		var changes []OptionChange
+		for j := range newOptions {
+			if oldOptions[j].Value != newOptions[j].Value {
+				changes = append(changes, OptionChange{
+					Name:     newOptions[j].Name,
+					OldValue: oldOptions[j].Value,
+					NewValue: newOptions[j].Value,
+				})
+			}
+		}
+		if len(changes) != 0 {
+			d.DHCPServers = append(d.DHCPServers, DHCPServerChange{IP: newServer.IP, Change: ChangeChanged, Options: changes})
+		}
+	}
+
+	for _, oldServer := range before {
+		if !slices.ContainsFunc(after, func(s DHCPv4Server) bool { return s.IP == oldServer.IP }) {
+			d.DHCPServers = append(d.DHCPServers, DHCPServerChange{IP: oldServer.IP, Change: ChangeRemoved})
+		}
+	}
+}
+
+func (d *ScanDiff) Print() {
+	fmt.Print(d.String())
+}
+
+func (d *ScanDiff) String() string {
+	return executeResultsTemplate("scan_diff", ScanDiffTemplate, d)
+}
+
+func (d *ScanDiff) table() [][]string {
+	rows := [][]string{{"kind", "change", "ip", "item", "old", "new"}}
+	for _, host := range d.Hosts {
+		rows = append(rows, []string{"host", host.Change, host.Addr.String(), host.HostName, "", ""})
+	}
+	for _, port := range d.Ports {
+		item := strconv.Itoa(int(port.Number)) + "/" + port.Protocol
+		rows = append(rows, []string{"port", ChangeChanged, port.Addr.String(), item, port.OldState.String(), port.NewState.String()})
+	}
+	for _, key := range d.HostKeys {
+		item := strconv.Itoa(int(key.Port)) + "/" + key.KeyType
+		rows = append(rows, []string{"host_key", key.Change, key.Addr.String(), item, key.OldFingerprint, key.NewFingerprint})
+	}
+	for _, rtt := range d.RTTs {
+		rows = append(rows, []string{"rtt", ChangeChanged, rtt.Addr.String(), "", durationMillis(rtt.OldRTT), durationMillis(rtt.NewRTT)})
+	}
+	for _, addr := range d.Addresses {
+		rows = append(rows, []string{"address", addr.Change, addr.IPAddr.String(), "mac", addr.OldMAC.String(), addr.NewMAC.String()})
+	}
+	for _, server := range d.DHCPServers {
+		if len(server.Options) == 0 {
+			rows = append(rows, []string{"dhcp_server", server.Change, server.IP.String(), "", "", ""})
+		}
+		for _, option := range server.Options {
+			rows = append(rows, []string{"dhcp_server", server.Change, server.IP.String(), option.Name, option.OldValue, option.NewValue})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,170 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffResults(t *testing.T) {
+	host1 := netip.MustParseAddr("10.1.1.1")
+	host2 := netip.MustParseAddr("10.1.1.2")
+	host3 := netip.MustParseAddr("10.1.1.3")
+	mac1 := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x01}
+	mac2 := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x02}
+
+	tests := []struct {
+		name   string
+		before ScanResults
+		after  ScanResults
+		want   *ScanDiff
+	}{
+		{
+			name: "port scans",
+			before: &TCPSynScanResults{Results: HostResults{
+				host1: {Addr: host1, HostState: HostStateUp, AverageRTT: 10 * time.Millisecond, Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen},
+					{Number: 80, Name: "http", Protocol: "tcp", State: PortStateClosed},
+				}},
+				host2: {Addr: host2, HostState: HostStateUp},
+			}},
+			after: &TCPSynScanResults{Results: HostResults{
+				host1: {Addr: host1, HostState: HostStateUp, AverageRTT: 50 * time.Millisecond, Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen},
+					{Number: 80, Name: "http", Protocol: "tcp", State: PortStateOpen},
+				}},
+				host2: {Addr: host2, HostState: HostStateDown},
+				host3: {Addr: host3, HostState: HostStateUp, HostName: "new.lan"},
+			}},
+			want: &ScanDiff{
+				ScanType: "syn",
+				Hosts: []HostChange{
+					{Addr: host2, Change: ChangeRemoved},
+					{Addr: host3, HostName: "new.lan", Change: ChangeAdded},
+				},
+				Ports: []PortChange{
+					{Addr: host1, Number: 80, Name: "http", Protocol: "tcp", OldState: PortStateClosed, NewState: PortStateOpen},
+				},
+				RTTs: []RTTChange{
+					{Addr: host1, OldRTT: 10 * time.Millisecond, NewRTT: 50 * time.Millisecond},
+				},
+			},
+		},
+		{
+			name: "ssh host keys",
+			before: &TCPFullScanResults{Results: HostResults{
+				host1: {Addr: host1, HostState: HostStateUp, Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{
+						{Type: "ssh-ed25519", Fingerprint: "SHA256:old"},
+						{Type: "ssh-dss", Fingerprint: "SHA256:dss"},
+					}}},
+					{Number: 2222, Name: "ssh", Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{
+						{Type: "ssh-ed25519", Fingerprint: "SHA256:same"},
+					}}},
+					// host keys were not collected by the newer scan.
+					{Number: 2200, Name: "ssh", Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{
+						{Type: "ssh-ed25519", Fingerprint: "SHA256:other"},
+					}}},
+				}},
+			}},
+			after: &TCPFullScanResults{Results: HostResults{
+				host1: {Addr: host1, HostState: HostStateUp, Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{
+						{Type: "ssh-ed25519", Fingerprint: "SHA256:new"},
+						{Type: "ssh-rsa", Fingerprint: "SHA256:rsa"},
+					}}},
+					{Number: 2222, Name: "ssh", Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{
+						{Type: "ssh-ed25519", Fingerprint: "SHA256:same"},
+					}}},
+					{Number: 2200, Name: "ssh", Protocol: "tcp", State: PortStateOpen},
+				}},
+			}},
+			want: &ScanDiff{
+				ScanType: "tcp",
+				HostKeys: []HostKeyChange{
+					{Addr: host1, Port: 22, KeyType: "ssh-ed25519", OldFingerprint: "SHA256:old", NewFingerprint: "SHA256:new", Change: ChangeChanged},
+					{Addr: host1, Port: 22, KeyType: "ssh-rsa", NewFingerprint: "SHA256:rsa", Change: ChangeAdded},
+					{Addr: host1, Port: 22, KeyType: "ssh-dss", OldFingerprint: "SHA256:dss", Change: ChangeRemoved},
+				},
+			},
+		},
+		{
+			name: "small rtt changes are ignored",
+			before: &PingScanResults{HostResults: []PingHostResult{
+				{IP: host1, HostState: HostStateUp, AverageRTT: 10 * time.Millisecond},
+				{IP: host2, HostState: HostStateUp},
+			}},
+			after: &PingScanResults{HostResults: []PingHostResult{
+				{IP: host1, HostState: HostStateUp, AverageRTT: 15 * time.Millisecond},
+			}},
+			want: &ScanDiff{
+				ScanType: "ping",
+				Hosts:    []HostChange{{Addr: host2, Change: ChangeRemoved}},
+			},
+		},
+		{
+			name: "arp scans",
+			before: &ARPScanResults{HostResults: []ARPHostResult{
+				{IPAddr: host1, MacAddr: mac1},
+				{IPAddr: host2, MacAddr: mac2},
+			}},
+			after: &ARPScanResults{HostResults: []ARPHostResult{
+				{IPAddr: host1, MacAddr: mac2},
+				{IPAddr: host3, MacAddr: mac1},
+			}},
+			want: &ScanDiff{
+				ScanType: "arp",
+				Addresses: []AddressChange{
+					{IPAddr: host1, OldMAC: mac1, NewMAC: mac2, Change: ChangeChanged},
+					{IPAddr: host2, OldMAC: mac2, Change: ChangeRemoved},
+					{IPAddr: host3, NewMAC: mac1, Change: ChangeAdded},
+				},
+			},
+		},
+		{
+			name: "dhcp scans",
+			before: DHCPv4ScannerResults{Servers: []DHCPv4Server{
+				{IP: host1, DHCPv4ServerOptions: DHCPv4ServerOptions{OfferedIP: host2, LeaseTime: time.Hour}},
+				{IP: host2},
+			}},
+			after: DHCPv4ScannerResults{Servers: []DHCPv4Server{
+				{IP: host1, DHCPv4ServerOptions: DHCPv4ServerOptions{OfferedIP: host3, LeaseTime: time.Hour}},
+				{IP: host3},
+			}},
+			want: &ScanDiff{
+				ScanType: "dhcp",
+				DHCPServers: []DHCPServerChange{
+					{IP: host1, Change: ChangeChanged, Options: []OptionChange{{Name: "offered ip", OldValue: "10.1.1.2", NewValue: "10.1.1.3"}}},
+					{IP: host3, Change: ChangeAdded},
+					{IP: host2, Change: ChangeRemoved},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffResults(tt.before, tt.after, DiffOptions{RTTThreshold: 10 * time.Millisecond})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, got.HasChanges())
+		})
+	}
+}
+
+func TestDiffResultsErrors(t *testing.T) {
+	_, err := DiffResults(&TCPSynScanResults{}, &UDPScanResults{}, DiffOptions{})
+	assert.Error(t, err)
+
+	_, err = DiffResults(&WiFiScanResults{}, &WiFiScanResults{}, DiffOptions{})
+	assert.Error(t, err)
+
+	diff, err := DiffResults(&ARPScanResults{}, &ARPScanResults{}, DiffOptions{})
+	require.NoError(t, err)
+	assert.False(t, diff.HasChanges())
+	assert.Contains(t, diff.String(), "No changes.")
+}
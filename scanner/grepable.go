@@ -0,0 +1,99 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// getGrepableResults writes the scan results with one host per line so that they can be filtered with tools like grep and awk, in the
+// spirit of Nmap's -oG output. Fields are separated by tabs and empty fields are written as "-".
+//
+// Port scans have lines of ip, hostname, host state and a comma separated list of number/state/protocol/service ports eg
+//
+//	10.0.0.1	router.lan	up	22/open/tcp/ssh,80/closed/tcp/http
+//
+// Ports whose service was detected have the product, version and extra information as a fifth field with "/" and "," replaced by "|"
+// eg 22/open/tcp/ssh/OpenSSH 9.6 (protocol 2.0).
+//
+// ARP and NDP scans have lines of ip, mac, vendor and hostname. Other results have one line for each row of their table.
+func getGrepableResults(r ScanResults) ([]byte, error) {
+	var lines [][]string
+
+	switch r := r.(type) {
+	case portScanResults:
+		lines = portScanGrepable(r)
+	case *PingScanResults:
+		for _, host := range r.HostResults {
+			if host.HostState == HostStateDown && r.printUpOnly {
+				continue
+			}
+			lines = append(lines, []string{host.IP.String(), host.HostName, host.HostState.String(), durationMillis(host.AverageRTT)})
+		}
+	case *ARPScanResults:
+		for _, host := range r.HostResults {
+			lines = append(lines, []string{host.IPAddr.String(), host.MacAddr.String(), host.Vendor, host.HostName})
+		}
+	case *NDPScanResults:
+		for _, host := range r.HostResults {
+			lines = append(lines, []string{host.IPAddr.String(), host.MacAddr.String(), host.Vendor, host.HostName})
+		}
+	case tabularResults:
+		lines = r.table()[1:]
+	default:
+		return nil, fmt.Errorf("grepable output is not supported for these scan results")
+	}
+
+	buf := bytes.Buffer{}
+	for _, line := range lines {
+		for i, field := range line {
+			if i != 0 {
+				buf.WriteByte('\t')
+			}
+			buf.WriteString(grepableField(field))
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func portScanGrepable(r portScanResults) [][]string {
+	info := r.portScanInfo()
+
+	lines := [][]string{}
+	for _, hostResult := range sortedHostResults(r.hostResults()) {
+		if hostResult.HostState == HostStateDown && info.printUpOnly {
+			continue
+		}
+
+		ports := []string{}
+		for _, port := range hostResult.Ports {
+			if port.State == PortStateClosed && info.printOpenOnly {
+				continue
+			}
+			// "open | filtered" is written as "open|filtered" like Nmap does to keep the port list free of spaces.
+			state := strings.ReplaceAll(port.State.String(), " ", "")
+			fields := []string{strconv.Itoa(int(port.Number)), state, port.Protocol, port.Name}
+			if port.serviceDetected() {
+				fields = append(fields, strings.NewReplacer("/", "|", ",", "|").Replace(port.VersionInfo()))
+			}
+			ports = append(ports, strings.Join(fields, "/"))
+		}
+		lines = append(lines, []string{hostResult.Addr.String(), hostResult.HostName, hostResult.HostState.String(), strings.Join(ports, ",")})
+	}
+	return lines
+}
+
+// grepableField keeps a field on its line and in its column by replacing tabs and newlines in it with spaces.
+func grepableField(field string) string {
+	if field == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, field)
+}
@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetGrepableResults(t *testing.T) {
+	portResults := &UDPScanResults{
+		Results: HostResults{
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:      netip.MustParseAddr("10.1.1.2"),
+				HostName:  "dns.lan",
+				HostState: HostStateUp,
+				Ports: []Port{
+					{Number: 53, Name: "domain", Protocol: "udp", State: PortStateOpen, Product: "ISC BIND", Version: "9.18", ExtraInfo: "a/b, c"},
+					{Number: 67, Protocol: "udp", State: PortStatePossibleFilter},
+					{Number: 69, Name: "tftp", Protocol: "udp", State: PortStateClosed},
+				},
+			},
+			netip.MustParseAddr("10.1.1.1"): {
+				Addr:      netip.MustParseAddr("10.1.1.1"),
+				HostState: HostStateDown,
+			},
+		},
+	}
+
+	filteredResults := *portResults
+	filteredResults.printUpOnly = true
+	filteredResults.printOpenOnly = true
+
+	tests := []struct {
+		name    string
+		results ScanResults
+		want    string
+	}{
+		{
+			name:    "port scan has one line per host sorted by address",
+			results: portResults,
+			want: "10.1.1.1\t-\tdown\t-\n" +
+				"10.1.1.2\tdns.lan\tup\t53/open/udp/domain/ISC BIND 9.18 (a|b| c),67/open|filtered/udp/,69/closed/udp/tftp\n",
+		},
+		{
+			name:    "port scan filters",
+			results: &filteredResults,
+			want:    "10.1.1.2\tdns.lan\tup\t53/open/udp/domain/ISC BIND 9.18 (a|b| c),67/open|filtered/udp/\n",
+		},
+		{
+			name: "ping scan",
+			results: &PingScanResults{HostResults: []PingHostResult{
+				{IP: netip.MustParseAddr("10.1.1.1"), HostState: HostStateUp, AverageRTT: 1500 * time.Microsecond},
+			}},
+			want: "10.1.1.1\t-\tup\t1.500\n",
+		},
+		{
+			name: "arp scan",
+			results: &ARPScanResults{HostResults: []ARPHostResult{
+				{
+					IPAddr:   netip.MustParseAddr("10.1.1.1"),
+					MacAddr:  netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+					Vendor:   "Acme\tInc.",
+					HostName: "router.lan",
+				},
+			}},
+			want: "10.1.1.1\t00:1a:2b:3c:4d:5e\tAcme Inc.\trouter.lan\n",
+		},
+		{
+			name: "other results have a line per table row",
+			results: &ScanDiff{Hosts: []HostChange{
+				{Addr: netip.MustParseAddr("10.1.1.1"), Change: ChangeAdded},
+			}},
+			want: "host\tadded\t10.1.1.1\t-\t-\t-\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getGrepableResults(tt.results)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
@@ -3,12 +3,16 @@ package scanner
 import (
 	"context"
 	"fmt"
+	"maps"
 	"math/rand/v2"
 	"net/netip"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/internal/routing"
 	"github.com/pterm/pterm"
 )
 
@@ -38,6 +42,9 @@ func getResultSet(targets []netip.Prefix, ports []PortNumber, hostnames map[neti
 			if hoststates != nil {
 				hostResult.HostState = hoststates[addr].HostState
 				hostResult.AverageRTT = hoststates[addr].AverageRTT
+				hostResult.OS = hoststates[addr].OS
+				hostResult.MAC = hoststates[addr].MAC
+				hostResult.Vendor = hoststates[addr].Vendor
 			}
 
 			for i, p := range ports {
@@ -66,21 +73,49 @@ func getResultSet(targets []netip.Prefix, ports []PortNumber, hostnames map[neti
 	return results
 }
 
-func pingHosts(ctx context.Context, targets []netip.Prefix, pingTimeout time.Duration, workers int, pingCount int) (PingScanResultsMap, error) {
-	pinger := NewPingScanner(PingScanOptions{
-		Targets:       targets,
-		PingTimeout:   pingTimeout,
-		Workers:       workers,
-		PingCount:     pingCount,
-		ResultMapOnly: true,
-	})
+// defaultDiscoveryRate is the number of requests per second sent when finding out which hosts are up with the raw ping engine before
+// a port scan.
+const defaultDiscoveryRate = 1000
 
+// pingHosts finds out which of the targets of a port scan are up. Targets on directly connected networks are sent ARP or NDP requests
+// and the others are pinged with the probes in opts. The raw ping engine is used if any of them is not an echo request.
+func pingHosts(ctx context.Context, opts PingScanOptions) (PingScanResultsMap, error) {
+	opts.ResultMapOnly = true
+	if opts.Rate == 0 {
+		opts.Rate = defaultDiscoveryRate
+	}
+
+	results := make(PingScanResultsMap)
+	if ifaceProvider, err := netutil.InterfaceProvider(); err == nil {
+		if router, err := routing.NewRouter(ifaceProvider); err == nil {
+			split := splitTargetsByRoute(router, opts.Targets)
+			var unchecked []netip.Prefix
+			results, unchecked = neighbourHosts(ctx, split, opts)
+			opts.Targets = append(split.routed, unchecked...)
+		}
+	}
+	if len(opts.Targets) == 0 {
+		return results, nil
+	}
+
+	pinger := NewPingScanner(opts)
 	_, err := pinger.Scan(ctx)
 	if err != nil {
 		return PingScanResultsMap{}, err
 	}
+	maps.Copy(results, pinger.ResultMap())
 
-	return pinger.ResultMap(), nil
+	return results, nil
+}
+
+// addNeighbourMACs adds the mac addresses of the hosts that answered ARP or NDP requests to resolver. Those requests are sent as raw
+// packets so the kernel does not learn the addresses from the replies and resolving them would fail.
+func addNeighbourMACs(resolver resolving.Resolver, hosts PingScanResultsMap) {
+	for addr, host := range hosts {
+		if host.MAC != nil {
+			resolver.Add(addr, host.MAC)
+		}
+	}
 }
 
 func randomEphemeralPort() uint16 {
@@ -123,7 +158,11 @@ func printScanResultsMap(results map[netip.Addr]HostResult, scanTime time.Durati
 			continue
 		}
 
+		showVersions := slices.ContainsFunc(hostResults.Ports, Port.serviceDetected)
 		tableData = pterm.TableData{{"Port", "State", "Service"}}
+		if showVersions {
+			tableData[0] = append(tableData[0], "Version")
+		}
 		name := ""
 		if hostResults.HostName != "" {
 			name = fmt.Sprintf("(%v)", hostResults.HostName)
@@ -144,7 +183,11 @@ func printScanResultsMap(results map[netip.Addr]HostResult, scanTime time.Durati
 			if port.State == PortStateClosed && totalPortsScanned > 10 {
 				continue // do not add closed ports to table if scanned ports are above 10
 			}
-			tableData = append(tableData, []string{fmt.Sprintf("%v/%v", port.Protocol, port.Number), port.State.String(), port.Name})
+			row := []string{fmt.Sprintf("%v/%v", port.Protocol, port.Number), port.State.String(), port.Name}
+			if showVersions {
+				row = append(row, port.VersionInfo())
+			}
+			tableData = append(tableData, row)
 		}
 
 		hostStateStyle := pterm.FgDefault
@@ -156,8 +199,21 @@ func printScanResultsMap(results map[netip.Addr]HostResult, scanTime time.Durati
 		}
 		fmt.Printf("Host State: %s\n", hostStateStyle.Sprint(hostResults.HostState))
 		fmt.Println("Average RTT: ", hostResults.AverageRTT.Truncate(time.Microsecond))
+		if hostResults.OS != nil {
+			fmt.Println("OS Guess:    ", hostResults.OS)
+		}
+		if hostResults.MAC != nil {
+			mac := hostResults.MAC.String()
+			if hostResults.Vendor != "" {
+				mac = fmt.Sprintf("%v (%v)", mac, hostResults.Vendor)
+			}
+			fmt.Println("MAC Address: ", mac)
+		}
 		if len(tableData) > 1 && hostResults.HostState == HostStateUp {
 			pterm.DefaultTable.WithHasHeader().WithBoxed().WithData(tableData).Render()
+			printTLSInfo(hostResults.Ports)
+			printHTTPInfo(hostResults.Ports)
+			printSSHInfo(hostResults.Ports)
 		}
 		fmt.Println("Ports Scanned: ", totalPortsScanned)
 		fmt.Println("Open Ports:    ", hostResults.OpenPorts)
@@ -165,6 +221,9 @@ func printScanResultsMap(results map[netip.Addr]HostResult, scanTime time.Durati
 		if hostResults.FilteredPorts > 0 {
 			fmt.Println("Filtered Ports: ", hostResults.FilteredPorts)
 		}
+		if hostResults.UnfilteredPorts > 0 {
+			fmt.Println("Unfiltered Ports: ", hostResults.UnfilteredPorts)
+		}
 	}
 	fmt.Println("\n──────────────────────────────────────────────")
 	fmt.Println("Scan Duration:      ", scanTime.Truncate(time.Millisecond))
@@ -172,3 +231,82 @@ func printScanResultsMap(results map[netip.Addr]HostResult, scanTime time.Durati
 	fmt.Printf("Hosts that are Up:   %v\n", totalUp)
 	fmt.Printf("Hosts that are down: %v\n\n", totalHosts-totalUp)
 }
+
+// printTLSInfo prints what TLS inspection found out about the ports.
+func printTLSInfo(ports []Port) {
+	for _, port := range ports {
+		if port.TLS == nil {
+			continue
+		}
+		startTLS := ""
+		if port.TLS.StartTLS != "" {
+			startTLS = fmt.Sprintf(" (STARTTLS %v)", port.TLS.StartTLS)
+		}
+		fmt.Printf("TLS on %v/%v: %v %v%v\n", port.Protocol, port.Number, port.TLS.Version, port.TLS.CipherSuite, startTLS)
+		for i, cert := range port.TLS.Certificates {
+			fmt.Printf("  Certificate %v: %v\n", i+1, cert.Subject)
+			if len(cert.SANs) != 0 {
+				fmt.Printf("    SANs:      %v\n", strings.Join(cert.SANs, ", "))
+			}
+			fmt.Printf("    Issuer:    %v\n", cert.Issuer)
+			fmt.Printf("    Valid:     %v to %v\n", cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly))
+			fmt.Printf("    Key:       %v %v bits, signed with %v\n", cert.KeyType, cert.KeyBits, cert.SignatureAlgorithm)
+		}
+	}
+}
+
+// printHTTPInfo prints what HTTP fingerprinting found out about the ports.
+func printHTTPInfo(ports []Port) {
+	for _, port := range ports {
+		if port.HTTP == nil {
+			continue
+		}
+		title := ""
+		if port.HTTP.Title != "" {
+			title = fmt.Sprintf(" %q", port.HTTP.Title)
+		}
+		fmt.Printf("HTTP on %v/%v: %v%v\n", port.Protocol, port.Number, port.HTTP.StatusCode, title)
+		fmt.Printf("    URL:          %v\n", port.HTTP.URL)
+		for _, field := range []struct{ name, value string }{
+			{"Server", port.HTTP.Server},
+			{"X-Powered-By", port.HTTP.PoweredBy},
+			{"Location", port.HTTP.Location},
+		} {
+			if field.value != "" {
+				fmt.Printf("    %-13s %v\n", field.name+":", field.value)
+			}
+		}
+		if port.HTTP.FaviconHash != 0 {
+			fmt.Printf("    Favicon Hash: %v\n", port.HTTP.FaviconHash)
+		}
+	}
+}
+
+// printSSHInfo prints the SSH banners and host keys collected from the ports.
+func printSSHInfo(ports []Port) {
+	for _, port := range ports {
+		if port.SSH == nil {
+			continue
+		}
+		fmt.Printf("SSH on %v/%v: %v\n", port.Protocol, port.Number, port.SSH.Banner)
+		fmt.Printf("    Host Key Algorithms: %v\n", strings.Join(port.SSH.HostKeyAlgorithms, ","))
+		for _, key := range port.SSH.HostKeys {
+			fmt.Printf("    %-20s %v\n", key.Type, key.Fingerprint)
+		}
+	}
+}
+
+// printCertificateWarnings prints the certificates that have expired or are close to expiring.
+func printCertificateWarnings(warnings []CertificateWarning) {
+	for _, warning := range warnings {
+		host := warning.Addr.String()
+		if warning.HostName != "" {
+			host += " (" + warning.HostName + ")"
+		}
+		expiry := "expires"
+		if warning.Expired {
+			expiry = "expired"
+		}
+		pterm.Warning.Printfln("Certificate %v on %v port %v %v on %v", warning.Subject, host, warning.Port, expiry, warning.NotAfter.Format(time.DateOnly))
+	}
+}
@@ -0,0 +1,326 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/history"
+	"github.com/pterm/pterm"
+)
+
+// saveToHistory saves the completed scan's results to the history database in opts.HistoryFile.
+func saveToHistory(results ScanResults, opts ScanOptions) error {
+	store, err := history.Open(opts.HistoryFile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	err = store.Save(&history.Scan{
+		Time:        time.Now(),
+		CommandLine: strings.Join(os.Args, " "),
+		ScanType:    templateName(results),
+		Targets:     opts.Targets,
+		Hosts:       historyHosts(results),
+		Results:     resultsJSON,
+	})
+	if err != nil {
+		return fmt.Errorf("could not save scan to history: %w", err)
+	}
+	return nil
+}
+
+// historyHosts normalises the hosts found by a scan into history rows. Only hosts that were found to be up are included.
+func historyHosts(results ScanResults) []history.Host {
+	hosts := []history.Host{}
+
+	switch r := results.(type) {
+	case portScanResults:
+		for _, hostResult := range sortedHostResults(r.hostResults()) {
+			if hostResult.HostState != HostStateUp {
+				continue
+			}
+			host := history.Host{
+				IP:       hostResult.Addr,
+				State:    hostResult.HostState.String(),
+				HostName: hostResult.HostName,
+				Vendor:   hostResult.Vendor,
+			}
+			if hostResult.MAC != nil {
+				host.MAC = hostResult.MAC.String()
+			}
+			for _, port := range hostResult.Ports {
+				historyPort := history.Port{
+					Number:   uint16(port.Number),
+					Protocol: port.Protocol,
+					State:    port.State.String(),
+					Service:  port.Name,
+				}
+				if port.SSH != nil {
+					for _, key := range port.SSH.HostKeys {
+						historyPort.HostKeys = append(historyPort.HostKeys, key.Type+" "+key.Fingerprint)
+					}
+				}
+				host.Ports = append(host.Ports, historyPort)
+			}
+			hosts = append(hosts, host)
+		}
+	case *PingScanResults:
+		for _, hostResult := range r.HostResults {
+			if hostResult.HostState == HostStateUp {
+				hosts = append(hosts, history.Host{IP: hostResult.IP, State: hostResult.HostState.String(), HostName: hostResult.HostName})
+			}
+		}
+	case *ARPScanResults:
+		for _, hostResult := range r.HostResults {
+			hosts = append(hosts, history.Host{
+				IP:       hostResult.IPAddr,
+				State:    HostStateUp.String(),
+				HostName: hostResult.HostName,
+				MAC:      hostResult.MacAddr.String(),
+				Vendor:   hostResult.Vendor,
+			})
+		}
+	case *NDPScanResults:
+		for _, hostResult := range r.HostResults {
+			hosts = append(hosts, history.Host{
+				IP:       hostResult.IPAddr,
+				State:    HostStateUp.String(),
+				HostName: hostResult.HostName,
+				MAC:      hostResult.MacAddr.String(),
+				Vendor:   hostResult.Vendor,
+			})
+		}
+	case DHCPv4ScannerResults:
+		for _, server := range r.Servers {
+			hosts = append(hosts, history.Host{
+				IP:       server.IP,
+				State:    HostStateUp.String(),
+				HostName: server.HostName,
+				MAC:      server.MACAddress.String(),
+				Vendor:   server.Vendor,
+			})
+		}
+	case *RouterScanResults:
+		for _, router := range r.Routers {
+			hosts = append(hosts, history.Host{
+				IP:     router.IP,
+				State:  HostStateUp.String(),
+				MAC:    router.MACAddress.String(),
+				Vendor: router.Vendor,
+			})
+		}
+	}
+
+	return hosts
+}
+
+// LoadHistoryScan loads the results of the scan with the given id from the history database at path.
+func LoadHistoryScan(path string, id uint64) (ScanResults, error) {
+	store, err := history.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	scan, err := store.Scan(id)
+	if err != nil {
+		return nil, err
+	}
+	return LoadResults(strings.NewReader(string(scan.Results)), scan.ScanType)
+}
+
+// HistoryScans are the scans saved in the history database.
+type HistoryScans struct {
+	Scans []history.Scan `json:"scans"`
+}
+
+// LoadHistoryScans returns the limit most recent scans in the history database at path or all of them if limit is 0.
+func LoadHistoryScans(path string, limit int) (*HistoryScans, error) {
+	store, err := history.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	scans, err := store.Scans(limit)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryScans{Scans: scans}, nil
+}
+
+func (r *HistoryScans) Print() {
+	if len(r.Scans) == 0 {
+		fmt.Println()
+		pterm.Info.Println("No scans in the history")
+		return
+	}
+	printTable(r.table())
+}
+
+func (r *HistoryScans) String() string {
+	return executeResultsTemplate("history_scans", HistoryScansTemplate, r)
+}
+
+func (r *HistoryScans) table() [][]string {
+	rows := [][]string{{"id", "time", "type", "hosts", "targets", "command"}}
+	for _, scan := range r.Scans {
+		rows = append(rows, []string{
+			strconv.FormatUint(scan.ID, 10),
+			scan.Time.Format(time.DateTime),
+			scan.ScanType,
+			strconv.Itoa(scan.NumHosts),
+			strings.Join(scan.Targets, " "),
+			scan.CommandLine,
+		})
+	}
+	return rows
+}
+
+// HostHistory is what the scans in the history database saw of a single host.
+type HostHistory struct {
+	IP           netip.Addr            `json:"ip"`
+	Observations []history.Observation `json:"observations"`
+	// MACs are the MAC addresses the host has had, in the order they were first seen.
+	MACs []HistoryValue `json:"macs"`
+	// OpenPorts are the ports that were found open on the host, in the order they were first seen open.
+	OpenPorts []HistoryValue `json:"open_ports"`
+	// HostKeys are the SSH host keys collected from the host's ports, in the order they were first seen. A new key for a port and key
+	// type that was seen before means the host was reinstalled or is being impersonated.
+	HostKeys []HistoryValue `json:"host_keys"`
+
+	port int
+}
+
+// HistoryValue is a value seen for a host over several scans.
+type HistoryValue struct {
+	Value     string    `json:"value"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
+}
+
+// LoadHostHistory returns what the scans in the history database at path saw of the host with address ip. If port is not 0 only the
+// observations of that port are included.
+func LoadHostHistory(path string, ip netip.Addr, port int) (*HostHistory, error) {
+	store, err := history.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	observations, err := store.Host(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	hostHistory := &HostHistory{IP: ip, Observations: observations, port: port}
+	for _, observation := range observations {
+		if observation.Host.MAC != "" {
+			hostHistory.MACs = addHistoryValue(hostHistory.MACs, observation.Host.MAC, observation.Time)
+		}
+		for _, p := range observation.Host.Ports {
+			if port != 0 && int(p.Number) != port {
+				continue
+			}
+			if p.State == PortStateOpen.String() {
+				hostHistory.OpenPorts = addHistoryValue(hostHistory.OpenPorts, fmt.Sprintf("%d/%s", p.Number, p.Protocol), observation.Time)
+			}
+			for _, key := range p.HostKeys {
+				hostHistory.HostKeys = addHistoryValue(hostHistory.HostKeys, fmt.Sprintf("%d/%s %s", p.Number, p.Protocol, key), observation.Time)
+			}
+		}
+	}
+
+	return hostHistory, nil
+}
+
+func addHistoryValue(values []HistoryValue, value string, seen time.Time) []HistoryValue {
+	for i := range values {
+		if values[i].Value == value {
+			values[i].LastSeen = seen
+			values[i].Count++
+			return values
+		}
+	}
+	return append(values, HistoryValue{Value: value, FirstSeen: seen, LastSeen: seen, Count: 1})
+}
+
+func (r *HostHistory) Print() {
+	if len(r.Observations) == 0 {
+		fmt.Println()
+		pterm.Info.Printfln("%v has not been seen by any scan in the history", r.IP)
+		return
+	}
+	printTable(r.table())
+
+	for _, values := range []struct {
+		title  string
+		values []HistoryValue
+	}{{"MAC Addresses", r.MACs}, {"Open Ports", r.OpenPorts}, {"SSH Host Keys", r.HostKeys}} {
+		if len(values.values) == 0 {
+			continue
+		}
+		tableData := pterm.TableData{{values.title, "First Seen", "Last Seen", "Times Seen"}}
+		for _, value := range values.values {
+			tableData = append(tableData, []string{
+				value.Value,
+				value.FirstSeen.Format(time.DateTime),
+				value.LastSeen.Format(time.DateTime),
+				strconv.Itoa(value.Count),
+			})
+		}
+		printTable(tableData)
+	}
+}
+
+func (r *HostHistory) String() string {
+	return executeResultsTemplate("host_history", HostHistoryTemplate, r)
+}
+
+func (r *HostHistory) table() [][]string {
+	rows := [][]string{{"scan_id", "time", "type", "hostname", "mac", "open_ports"}}
+	for _, observation := range r.Observations {
+		rows = append(rows, []string{
+			strconv.FormatUint(observation.ScanID, 10),
+			observation.Time.Format(time.DateTime),
+			observation.ScanType,
+			observation.Host.HostName,
+			observation.Host.MAC,
+			strings.Join(r.OpenPortsOf(observation.Host), " "),
+		})
+	}
+	return rows
+}
+
+// OpenPortsOf returns the open ports of host in an observation. Only the port the history was loaded for is included if one was given.
+func (r *HostHistory) OpenPortsOf(host history.Host) []string {
+	ports := []string{}
+	for _, p := range host.Ports {
+		if p.State == PortStateOpen.String() && (r.port == 0 || int(p.Number) == r.port) {
+			ports = append(ports, fmt.Sprintf("%d/%s", p.Number, p.Protocol))
+		}
+	}
+	return ports
+}
+
+func printTable(tableData pterm.TableData) {
+	fmt.Println()
+	pterm.DefaultTable.
+		WithHasHeader().
+		WithHeaderRowSeparator("-").
+		WithBoxed().
+		WithData(tableData).
+		Render()
+}
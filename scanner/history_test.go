@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	opts := ScanOptions{
+		HistoryFile: filepath.Join(t.TempDir(), "history.db"),
+		Targets:     []string{"10.0.5.0/24"},
+	}
+	ip := netip.MustParseAddr("10.0.5.12")
+	oldMAC := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x01}
+	newMAC := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x02}
+	// learnt by the ARP discovery of a port scan.
+	scanMAC := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x03}
+
+	scans := []ScanResults{
+		&ARPScanResults{HostResults: []ARPHostResult{{IPAddr: ip, MacAddr: oldMAC}}},
+		&TCPSynScanResults{Results: HostResults{
+			ip: {Addr: ip, HostState: HostStateUp, Ports: []Port{
+				{Number: 22, Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{{Type: "ssh-ed25519", Fingerprint: "SHA256:old"}}}},
+				{Number: 3389, Protocol: "tcp", State: PortStateClosed},
+			}},
+			netip.MustParseAddr("10.0.5.13"): {Addr: netip.MustParseAddr("10.0.5.13"), HostState: HostStateDown},
+		}},
+		&TCPSynScanResults{Results: HostResults{
+			ip: {Addr: ip, HostState: HostStateUp, MAC: scanMAC, Vendor: "Acme", Ports: []Port{
+				{Number: 22, Protocol: "tcp", State: PortStateOpen, SSH: &SSHInfo{HostKeys: []SSHHostKey{{Type: "ssh-ed25519", Fingerprint: "SHA256:new"}}}},
+				{Number: 3389, Protocol: "tcp", State: PortStateOpen},
+			}},
+		}},
+		&ARPScanResults{HostResults: []ARPHostResult{{IPAddr: ip, MacAddr: newMAC}}},
+	}
+	for _, scan := range scans {
+		require.NoError(t, saveToHistory(scan, opts))
+	}
+
+	list, err := LoadHistoryScans(opts.HistoryFile, 0)
+	require.NoError(t, err)
+	require.Len(t, list.Scans, 4)
+	assert.Equal(t, "syn", list.Scans[1].ScanType)
+	// hosts that are down are not saved.
+	assert.Equal(t, 1, list.Scans[2].NumHosts)
+
+	results, err := LoadHistoryScan(opts.HistoryFile, 2)
+	require.NoError(t, err)
+	synResults := results.(*TCPSynScanResults).Results
+	assert.Len(t, synResults, 2)
+	assert.Equal(t, scans[1].(*TCPSynScanResults).Results[ip].Ports, synResults[ip].Ports)
+
+	sshHistory, err := LoadHostHistory(opts.HistoryFile, ip, 22)
+	require.NoError(t, err)
+	require.Len(t, sshHistory.HostKeys, 2)
+	assert.Equal(t, "22/tcp ssh-ed25519 SHA256:old", sshHistory.HostKeys[0].Value)
+	assert.Equal(t, "22/tcp ssh-ed25519 SHA256:new", sshHistory.HostKeys[1].Value)
+	assert.Contains(t, sshHistory.String(), "SSH Host Keys")
+
+	hostHistory, err := LoadHostHistory(opts.HistoryFile, ip, 3389)
+	require.NoError(t, err)
+	assert.Len(t, hostHistory.Observations, 4)
+	require.Len(t, hostHistory.MACs, 3)
+	assert.Equal(t, oldMAC.String(), hostHistory.MACs[0].Value)
+	assert.Equal(t, scanMAC.String(), hostHistory.MACs[1].Value)
+	assert.Equal(t, newMAC.String(), hostHistory.MACs[2].Value)
+	assert.Equal(t, "Acme", historyHosts(scans[2])[0].Vendor)
+	require.Len(t, hostHistory.OpenPorts, 1)
+	assert.Equal(t, "3389/tcp", hostHistory.OpenPorts[0].Value)
+	assert.Equal(t, hostHistory.Observations[2].Time, hostHistory.OpenPorts[0].FirstSeen)
+	assert.Equal(t, []string{"", "", "3389/tcp", ""}, columnOf(hostHistory.table(), 5))
+	// the text output only lists the port the history was loaded for.
+	assert.Contains(t, hostHistory.String(), " 3389/tcp")
+	assert.NotContains(t, hostHistory.String(), "22/tcp")
+}
+
+// testScanner is a scanner that returns results without scanning anything.
+type testScanner struct {
+	results ScanResults
+}
+
+func (s testScanner) Scan(ctx context.Context) (ScanResults, error) {
+	return s.results, nil
+}
+
+func (s testScanner) setResultStream(stream *resultStream) {}
+
+func TestDoScanSavesHistoryWhenNotifyFails(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stream %v", stream), func(t *testing.T) {
+			dir := t.TempDir()
+			opts := ScanOptions{
+				ResultsOutputFile: filepath.Join(dir, "results"),
+				Stream:            stream,
+				HistoryFile:       filepath.Join(dir, "history.db"),
+				// there is no notifier config so sending the results fails.
+				Notify: true,
+			}
+			scanner := testScanner{results: &ARPScanResults{HostResults: []ARPHostResult{{IPAddr: netip.MustParseAddr("10.0.5.12")}}}}
+
+			require.Error(t, DoScan(context.Background(), scanner, opts))
+
+			list, err := LoadHistoryScans(opts.HistoryFile, 0)
+			require.NoError(t, err)
+			assert.Len(t, list.Scans, 1)
+		})
+	}
+}
+
+// columnOf returns the values in column i of the table rows without the header.
+func columnOf(rows [][]string, i int) []string {
+	column := []string{}
+	for _, row := range rows[1:] {
+		column = append(column, row[i])
+	}
+	return column
+}
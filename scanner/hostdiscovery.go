@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/pterm/pterm"
+)
+
+// routedTargets are the targets of a port scan split by how to find out whether they are up. Hosts on directly connected networks
+// always answer ARP and NDP requests, even when a firewall drops everything else they are sent, so only the hosts behind a router are
+// pinged.
+type routedTargets struct {
+	// arp are the IPv4 targets on directly connected networks.
+	arp []netip.Prefix
+	// ndp are the IPv6 targets on directly connected networks grouped by the interface they are reached on.
+	ndp []ndpTargets
+	// routed are the targets that are pinged.
+	routed []netip.Prefix
+}
+
+type ndpTargets struct {
+	iface   netutil.Interface
+	targets []netip.Prefix
+}
+
+// splitTargetsByRoute splits targets by the routes to them. A target is only sent ARP or NDP requests if all of it is on a directly
+// connected network.
+func splitTargetsByRoute(router routing.Router, targets []netip.Prefix) routedTargets {
+	var split routedTargets
+	for _, target := range targets {
+		target = target.Masked()
+		route, err := router.Lookup(target.Addr())
+		if err != nil || !route.DirectlyConnected || route.Interface.Flags&net.FlagLoopback != 0 || !prefixWithin(target, route.Network) {
+			split.routed = append(split.routed, target)
+			continue
+		}
+		if target.Contains(route.SrcAddr) {
+			// hosts do not answer ARP and NDP requests for their own addresses.
+			split.routed = append(split.routed, netip.PrefixFrom(route.SrcAddr, route.SrcAddr.BitLen()))
+		}
+
+		if target.Addr().Is4() {
+			split.arp = append(split.arp, target)
+			continue
+		}
+		i := slices.IndexFunc(split.ndp, func(group ndpTargets) bool { return group.iface.Index == route.Interface.Index })
+		if i == -1 {
+			split.ndp = append(split.ndp, ndpTargets{iface: route.Interface})
+			i = len(split.ndp) - 1
+		}
+		split.ndp[i].targets = append(split.ndp[i].targets, target)
+	}
+	return split
+}
+
+// prefixWithin reports whether all addresses of inner are in outer.
+func prefixWithin(inner, outer netip.Prefix) bool {
+	return outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
+// neighbourHosts sends ARP or NDP requests to the on-link targets and returns the hosts that answered along with the targets that
+// could not be checked, which are pinged instead. Sending ARP and NDP requests needs root privileges.
+func neighbourHosts(ctx context.Context, split routedTargets, opts PingScanOptions) (PingScanResultsMap, []netip.Prefix) {
+	results := make(PingScanResultsMap)
+	var unchecked []netip.Prefix
+	if len(split.arp) == 0 && len(split.ndp) == 0 {
+		return results, unchecked
+	}
+
+	spinner, _ := pterm.DefaultSpinner.Start("Finding hosts on directly connected networks")
+	defer spinner.Success("Neighbour discovery done")
+
+	probeCount := uint(max(opts.PingCount, 1))
+	addResult := func(addr netip.Addr, mac netutil.MAC, vendor string) {
+		results[addr] = PingHostResult{
+			IP:        addr,
+			HostName:  opts.HostNames[addr],
+			HostState: HostStateUp,
+			MAC:       mac,
+			Vendor:    vendor,
+		}
+	}
+
+	if len(split.arp) != 0 {
+		var arpResults ScanResults
+		arpScanner, err := NewARPScanner(ARPScanOptions{
+			Targets:         split.arp,
+			ResponseTimeout: opts.PingTimeout,
+			WithVendorInfo:  true,
+			ProbeCount:      probeCount,
+		})
+		if err == nil {
+			arpResults, err = arpScanner.Scan(ctx)
+		}
+		if err != nil {
+			unchecked = append(unchecked, split.arp...)
+		} else {
+			for _, host := range arpResults.(*ARPScanResults).HostResults {
+				addResult(host.IPAddr, host.MacAddr, host.Vendor)
+			}
+		}
+	}
+
+	for _, group := range split.ndp {
+		var ndpResults ScanResults
+		ndpScanner, err := NewNDPScanner(NDPScanOptions{
+			Targets:         group.targets,
+			Interface:       &group.iface,
+			ResponseTimeout: opts.PingTimeout,
+			WithVendorInfo:  true,
+			ProbeCount:      probeCount,
+		})
+		if err == nil {
+			ndpResults, err = ndpScanner.Scan(ctx)
+		}
+		if err != nil {
+			unchecked = append(unchecked, group.targets...)
+			continue
+		}
+		for _, host := range ndpResults.(*NDPScanResults).HostResults {
+			addResult(host.IPAddr, host.MacAddr, host.Vendor)
+		}
+	}
+
+	return results, unchecked
+}
@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRouter looks up destinations in a fixed list of routes, picking the one with the longest prefix.
+type testRouter []routing.Route
+
+func (r testRouter) Lookup(dst netip.Addr) (routing.Route, error) {
+	var best *routing.Route
+	for i, route := range r {
+		if route.Network.Contains(dst) && (best == nil || route.Network.Bits() > best.Network.Bits()) {
+			best = &r[i]
+		}
+	}
+	if best == nil {
+		return routing.Route{}, fmt.Errorf("no route to %v", dst)
+	}
+	return *best, nil
+}
+
+func TestSplitTargetsByRoute(t *testing.T) {
+	eth0 := netutil.Interface{Interface: net.Interface{Index: 2, Name: "eth0"}}
+	eth1 := netutil.Interface{Interface: net.Interface{Index: 3, Name: "eth1"}}
+	lo := netutil.Interface{Interface: net.Interface{Index: 1, Name: "lo", Flags: net.FlagLoopback}}
+	router := testRouter{
+		{Network: netip.MustParsePrefix("0.0.0.0/0"), SrcAddr: netip.MustParseAddr("192.168.1.5"), Interface: eth0},
+		{Network: netip.MustParsePrefix("192.168.1.0/24"), SrcAddr: netip.MustParseAddr("192.168.1.5"), Interface: eth0, DirectlyConnected: true},
+		{Network: netip.MustParsePrefix("127.0.0.0/8"), SrcAddr: netip.MustParseAddr("127.0.0.1"), Interface: lo, DirectlyConnected: true},
+		{Network: netip.MustParsePrefix("2001:db8:1::/64"), SrcAddr: netip.MustParseAddr("2001:db8:1::5"), Interface: eth0, DirectlyConnected: true},
+		{Network: netip.MustParsePrefix("2001:db8:2::/64"), SrcAddr: netip.MustParseAddr("2001:db8:2::5"), Interface: eth1, DirectlyConnected: true},
+	}
+
+	prefixes := func(prefixes ...string) []netip.Prefix {
+		var parsed []netip.Prefix
+		for _, prefix := range prefixes {
+			parsed = append(parsed, netip.MustParsePrefix(prefix))
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name    string
+		targets []netip.Prefix
+		want    routedTargets
+	}{
+		{
+			name:    "on-link hosts",
+			targets: prefixes("192.168.1.10/32", "192.168.1.64/26"),
+			want:    routedTargets{arp: prefixes("192.168.1.10/32", "192.168.1.64/26")},
+		},
+		{
+			name:    "on-link network with the local address",
+			targets: prefixes("192.168.1.7/24"),
+			want:    routedTargets{arp: prefixes("192.168.1.0/24"), routed: prefixes("192.168.1.5/32")},
+		},
+		{
+			name:    "routed hosts",
+			targets: prefixes("10.0.0.1/32", "8.8.8.8/32"),
+			want:    routedTargets{routed: prefixes("10.0.0.1/32", "8.8.8.8/32")},
+		},
+		{
+			name:    "target larger than the on-link network",
+			targets: prefixes("192.168.0.0/23"),
+			want:    routedTargets{routed: prefixes("192.168.0.0/23")},
+		},
+		{
+			name:    "loopback",
+			targets: prefixes("127.0.0.1/32"),
+			want:    routedTargets{routed: prefixes("127.0.0.1/32")},
+		},
+		{
+			name:    "no route",
+			targets: prefixes("2001:db8:3::1/128"),
+			want:    routedTargets{routed: prefixes("2001:db8:3::1/128")},
+		},
+		{
+			name:    "ipv6 hosts grouped by interface",
+			targets: prefixes("2001:db8:1::10/128", "2001:db8:2::10/128", "2001:db8:1::20/128", "192.168.1.10/32"),
+			want: routedTargets{
+				arp: prefixes("192.168.1.10/32"),
+				ndp: []ndpTargets{
+					{iface: eth0, targets: prefixes("2001:db8:1::10/128", "2001:db8:1::20/128")},
+					{iface: eth1, targets: prefixes("2001:db8:2::10/128")},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitTargetsByRoute(router, tt.targets))
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package scanner
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"html/template"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// htmlReport is the data the HTML report template is rendered with.
+type htmlReport struct {
+	Title     string
+	Generated string
+	Tables    []htmlTable
+	Sections  []htmlSection
+	Stats     []htmlField
+}
+
+// htmlTable is a table in the report that can be sorted by clicking on its column headers.
+type htmlTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// htmlSection is a collapsible block with details about a single host or server.
+type htmlSection struct {
+	Title  string
+	Fields []htmlField
+	Table  *htmlTable
+}
+
+type htmlField struct {
+	Name  string
+	Value string
+}
+
+// htmlStateClass returns the CSS class of a host or port state eg state-open-filtered for "open | filtered".
+func htmlStateClass(state string) string {
+	return "state-" + strings.Join(strings.Fields(strings.ReplaceAll(state, "|", " ")), "-")
+}
+
+// getHTMLResults renders the scan results into a single self-contained HTML document with no external resources.
+func getHTMLResults(r ScanResults) ([]byte, error) {
+	report, err := htmlReportFromResults(r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New("html_report").Funcs(template.FuncMap{"stateClass": htmlStateClass}).Parse(HTMLReportTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	err = tmpl.Execute(&buf, report)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// htmlReportFromResults builds the report for the scan results r. generated is the time the report is considered to have been created.
+func htmlReportFromResults(r ScanResults, generated time.Time) (htmlReport, error) {
+	report := htmlReport{
+		Title:     reportTitle(r),
+		Generated: generated.Format(time.RFC1123),
+		Stats:     structFields(resultsStats(r)),
+	}
+
+	switch r := r.(type) {
+	case portScanResults:
+		hosts, sections := portScanHTML(r)
+		report.Tables = append(report.Tables, hosts)
+		report.Sections = sections
+	case tabularResults:
+		rows := r.table()
+		report.Tables = append(report.Tables, htmlTable{Title: "Hosts", Header: rows[0], Rows: rows[1:]})
+	default:
+		return htmlReport{}, fmt.Errorf("html output is not supported for these scan results")
+	}
+
+	switch r := r.(type) {
+	case DHCPv4ScannerResults:
+		report.Sections = dhcpHTMLSections(r)
+	case *DHCPv4ScannerResults:
+		report.Sections = dhcpHTMLSections(*r)
+	case *RouterScanResults:
+		report.Sections = routerHTMLSections(r)
+	}
+
+	return report, nil
+}
+
+// portScanHTML returns a table with one row per host and a section with a port breakdown for every host.
+func portScanHTML(r portScanResults) (htmlTable, []htmlSection) {
+	info := r.portScanInfo()
+	hosts := htmlTable{
+		Title:  "Hosts",
+		Header: []string{"ip", "hostname", "state", "rtt_ms", "open", "closed", "filtered"},
+	}
+	sections := []htmlSection{}
+
+	for _, hostResult := range sortedHostResults(r.hostResults()) {
+		if hostResult.HostState == HostStateDown && info.printUpOnly {
+			continue
+		}
+		hosts.Rows = append(hosts.Rows, []string{
+			hostResult.Addr.String(),
+			hostResult.HostName,
+			hostResult.HostState.String(),
+			durationMillis(hostResult.AverageRTT),
+			strconv.Itoa(hostResult.OpenPorts),
+			strconv.Itoa(hostResult.ClosedPorts),
+			strconv.Itoa(hostResult.FilteredPorts),
+		})
+
+		ports := &htmlTable{Header: []string{"port", "protocol", "state", "service", "version"}}
+		for _, port := range hostResult.Ports {
+			if port.State == PortStateClosed && info.printOpenOnly {
+				continue
+			}
+			ports.Rows = append(ports.Rows, []string{
+				strconv.Itoa(int(port.Number)),
+				port.Protocol,
+				port.State.String(),
+				port.Name,
+				port.VersionInfo(),
+			})
+		}
+
+		title := hostResult.Addr.String()
+		if hostResult.HostName != "" {
+			title += " - " + hostResult.HostName
+		}
+		sections = append(sections, htmlSection{
+			Title: fmt.Sprintf("%s (%s)", title, hostResult.HostState),
+			Table: ports,
+		})
+	}
+
+	return hosts, sections
+}
+
+// dhcpHTMLSections returns a section with the offered options for every DHCP server.
+func dhcpHTMLSections(r DHCPv4ScannerResults) []htmlSection {
+	sections := make([]htmlSection, 0, len(r.Servers))
+	for _, server := range r.Servers {
+		sections = append(sections, htmlSection{
+			Title:  "DHCP server " + server.IP.String(),
+			Fields: structFields(server.DHCPv4ServerOptions),
+		})
+	}
+	return sections
+}
+
+// routerHTMLSections returns a section with the advertised configuration and prefixes of every router.
+func routerHTMLSections(r *RouterScanResults) []htmlSection {
+	sections := make([]htmlSection, 0, len(r.Routers))
+	for _, router := range r.Routers {
+		prefixes := &htmlTable{Header: []string{"prefix", "valid_lifetime", "preferred_lifetime", "on_link", "autonomous"}}
+		for _, prefix := range router.Prefixes {
+			prefixes.Rows = append(prefixes.Rows, []string{
+				prefix.Prefix.String(),
+				lifetimeString(prefix.ValidLifetime),
+				lifetimeString(prefix.PreferredLifetime),
+				strconv.FormatBool(prefix.OnLink),
+				strconv.FormatBool(prefix.Autonomous),
+			})
+		}
+		fields := []htmlField{{Name: "mac", Value: router.MACAddress.String()}}
+		if r.printVendors {
+			fields = append(fields, htmlField{Name: "vendor", Value: cmp.Or(router.Vendor, "(unknown)")})
+		}
+		sections = append(sections, htmlSection{
+			Title: fmt.Sprintf("Router %s on %s", router.IP, router.Interface),
+			Fields: append(fields, []htmlField{
+				{Name: "lifetime", Value: router.Lifetime.String()},
+				{Name: "managed", Value: strconv.FormatBool(router.Managed)},
+				{Name: "other config", Value: strconv.FormatBool(router.OtherConfig)},
+				{Name: "hop limit", Value: strconv.Itoa(int(router.HopLimit))},
+				{Name: "mtu", Value: strconv.Itoa(int(router.MTU))},
+				{Name: "dns servers", Value: joinAddrs(router.DNSServers())},
+				{Name: "dns search list", Value: strings.Join(router.DNSSearchList(), ", ")},
+			}...),
+			Table: prefixes,
+		})
+	}
+	return sections
+}
+
+func reportTitle(r ScanResults) string {
+	switch templateName(r) {
+	case "tcp":
+		return "TCP Full Scan Report"
+	case "syn":
+		mode := TCPScanModeSyn
+		if synResults, ok := r.(*TCPSynScanResults); ok {
+			mode = synResults.Mode
+		}
+		return "TCP " + mode.Name() + " Scan Report"
+	case "udp":
+		return "UDP Scan Report"
+	case "ping":
+		return "Ping Scan Report"
+	case "arp":
+		return "ARP Scan Report"
+	case "ndp":
+		return "NDP Scan Report"
+	case "dhcp":
+		return "DHCPv4 Scan Report"
+	case "router":
+		return "Router Discovery Report"
+	case "wifi":
+		return "WiFi Scan Report"
+	case "trace":
+		return "Trace Report"
+	case "mtu":
+		return "Path MTU Report"
+	case "diff":
+		return "Scan Diff Report"
+	case "history":
+		return "Scan History"
+	case "host_history":
+		return "Host History"
+	default:
+		return "Scan Report"
+	}
+}
+
+// resultsStats returns the field of the results struct that is marshalled under the "stats" key or nil if there is none.
+func resultsStats(r ScanResults) any {
+	v := reflect.Indirect(reflect.ValueOf(r))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := range v.NumField() {
+		if jsonName(v.Type().Field(i)) == "stats" {
+			return v.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+// structFields flattens the exported fields of a struct into name and value pairs named after their json keys.
+func structFields(s any) []htmlField {
+	v := reflect.ValueOf(s)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := []htmlField{}
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		name := jsonName(field)
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		fields = append(fields, htmlField{
+			Name:  strings.ReplaceAll(name, "_", " "),
+			Value: htmlFieldValue(v.Field(i).Interface()),
+		})
+	}
+	return fields
+}
+
+func htmlFieldValue(value any) string {
+	switch value := value.(type) {
+	case time.Duration:
+		return value.String()
+	case netip.Addr:
+		return addrString(value)
+	case []netip.Addr:
+		return joinAddrs(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+var HTMLReportTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, Helvetica, Arial, sans-serif; margin: 2rem auto; max-width: 72rem; padding: 0 1rem; color: #1f2328; }
+h1 { margin-bottom: 0.2rem; }
+h2 { margin-top: 2rem; border-bottom: 1px solid #d0d7de; padding-bottom: 0.3rem; }
+.generated { color: #656d76; margin-top: 0; }
+table { border-collapse: collapse; width: 100%; margin: 0.5rem 0 1rem; font-size: 0.9rem; }
+th, td { text-align: left; padding: 0.35rem 0.6rem; border-bottom: 1px solid #d0d7de; }
+th { background: #f6f8fa; cursor: pointer; user-select: none; white-space: nowrap; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+tr:hover td { background: #f6f8fa; }
+details { border: 1px solid #d0d7de; border-radius: 6px; padding: 0.5rem 0.8rem; margin: 0.5rem 0; }
+summary { cursor: pointer; font-weight: 600; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.3rem 1.5rem; }
+dt { color: #656d76; text-transform: capitalize; }
+dd { margin: 0; }
+.state-up, .state-open { color: #1a7f37; font-weight: 600; }
+.state-down, .state-closed { color: #cf222e; }
+.state-filtered { color: #9a6700; }
+.state-open-filtered { color: #bc4c00; }
+.state-unfiltered { color: #0969da; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+<p class="generated">Generated by gscn on {{ .Generated }}</p>
+{{- range .Tables }}
+<h2>{{ .Title }}</h2>
+{{ template "table" . }}
+{{- end }}
+{{- if .Sections }}
+<h2>Details</h2>
+{{- range .Sections }}
+<details>
+<summary>{{ .Title }}</summary>
+{{- if .Fields }}
+{{ template "fields" .Fields }}
+{{- end }}
+{{- if .Table }}
+{{- if .Table.Rows }}
+{{ template "table" .Table }}
+{{- else }}
+<p>No ports to show.</p>
+{{- end }}
+{{- end }}
+</details>
+{{- end }}
+{{- end }}
+{{- if .Stats }}
+<h2>Stats</h2>
+{{ template "fields" .Stats }}
+{{- end }}
+<script>
+document.querySelectorAll("table.sortable").forEach(function (table) {
+  table.querySelectorAll("th").forEach(function (th, column) {
+    th.addEventListener("click", function () {
+      var ascending = !th.classList.contains("asc");
+      table.querySelectorAll("th").forEach(function (other) { other.classList.remove("asc", "desc"); });
+      th.classList.add(ascending ? "asc" : "desc");
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column].textContent, y = b.cells[column].textContent;
+        var cmp = x.localeCompare(y, undefined, { numeric: true, sensitivity: "base" });
+        return ascending ? cmp : -cmp;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+{{- define "table" }}
+<table class="sortable">
+<thead><tr>{{ range .Header }}<th>{{ . }}</th>{{ end }}</tr></thead>
+<tbody>
+{{- $header := .Header }}
+{{- range .Rows }}
+<tr>{{ range $i, $cell := . }}<td{{ if eq (index $header $i) "state" "host_state" "status" }} class="{{ stateClass $cell }}"{{ end }}>{{ $cell }}</td>{{ end }}</tr>
+{{- end }}
+</tbody>
+</table>
+{{- end }}
+{{- define "fields" }}
+<dl>
+{{- range . }}
+<dt>{{ .Name }}</dt><dd>{{ .Value }}</dd>
+{{- end }}
+</dl>
+{{- end }}
+`
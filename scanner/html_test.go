@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLReportFromResults(t *testing.T) {
+	generated := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	portResults := &TCPSynScanResults{
+		Results: HostResults{
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:        netip.MustParseAddr("10.1.1.2"),
+				HostName:    "web.lan",
+				HostState:   HostStateUp,
+				OpenPorts:   1,
+				ClosedPorts: 1,
+				AverageRTT:  2 * time.Millisecond,
+				Ports: []Port{
+					{Number: 80, Name: "http", Protocol: "tcp", State: PortStateOpen},
+					{Number: 81, Protocol: "tcp", State: PortStateClosed},
+				},
+			},
+			netip.MustParseAddr("10.1.1.1"): {
+				Addr:      netip.MustParseAddr("10.1.1.1"),
+				HostState: HostStateDown,
+			},
+		},
+		Stats:         TCPSynScanStats{TotalNumOfHosts: 2, ScanTime: 3 * time.Second},
+		printUpOnly:   true,
+		printOpenOnly: true,
+	}
+
+	report, err := htmlReportFromResults(portResults, generated)
+	require.NoError(t, err)
+	assert.Equal(t, "TCP SYN Scan Report", report.Title)
+	require.Len(t, report.Tables, 1)
+	assert.Equal(t, [][]string{{"10.1.1.2", "web.lan", "up", "2.000", "1", "1", "0"}}, report.Tables[0].Rows)
+	require.Len(t, report.Sections, 1)
+	assert.Equal(t, "10.1.1.2 - web.lan (up)", report.Sections[0].Title)
+	assert.Equal(t, [][]string{{"80", "tcp", "open", "http", ""}}, report.Sections[0].Table.Rows)
+	assert.Equal(t, []htmlField{{Name: "total scanned", Value: "2"}, {Name: "scan duration", Value: "3s"}}, report.Stats)
+
+	dhcpResults := DHCPv4ScannerResults{
+		Servers: []DHCPv4Server{
+			{
+				IP:         netip.MustParseAddr("10.1.1.1"),
+				MACAddress: netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+				DHCPv4ServerOptions: DHCPv4ServerOptions{
+					OfferedIP: netip.MustParseAddr("10.1.1.50"),
+					Routers:   []netip.Addr{netip.MustParseAddr("10.1.1.1")},
+					LeaseTime: time.Hour,
+				},
+			},
+		},
+	}
+
+	report, err = htmlReportFromResults(dhcpResults, generated)
+	require.NoError(t, err)
+	require.Len(t, report.Sections, 1)
+	assert.Contains(t, report.Sections[0].Fields, htmlField{Name: "offered ip", Value: "10.1.1.50"})
+	assert.Contains(t, report.Sections[0].Fields, htmlField{Name: "subnet mask", Value: ""})
+	assert.Contains(t, report.Sections[0].Fields, htmlField{Name: "lease time", Value: "1h0m0s"})
+}
+
+func TestReportTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		results ScanResults
+		want    string
+	}{
+		{name: "tcp connect scan", results: &TCPFullScanResults{}, want: "TCP Full Scan Report"},
+		{name: "syn results without a mode", results: &TCPSynScanResults{}, want: "TCP SYN Scan Report"},
+		{name: "syn scan", results: &TCPSynScanResults{Mode: TCPScanModeSyn}, want: "TCP SYN Scan Report"},
+		{name: "fin scan", results: &TCPSynScanResults{Mode: TCPScanModeFin}, want: "TCP FIN Scan Report"},
+		{name: "null scan", results: &TCPSynScanResults{Mode: TCPScanModeNull}, want: "TCP NULL Scan Report"},
+		{name: "xmas scan", results: &TCPSynScanResults{Mode: TCPScanModeXmas}, want: "TCP Xmas Scan Report"},
+		{name: "ack scan", results: &TCPSynScanResults{Mode: TCPScanModeAck}, want: "TCP ACK Scan Report"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, reportTitle(tt.results))
+		})
+	}
+}
+
+func TestGetHTMLResults(t *testing.T) {
+	arpResults := &ARPScanResults{
+		HostResults: []ARPHostResult{
+			{
+				IPAddr:  netip.MustParseAddr("10.1.1.1"),
+				MacAddr: netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+				Vendor:  "<Acme>",
+			},
+		},
+	}
+
+	output, err := getHTMLResults(arpResults)
+	require.NoError(t, err)
+	html := string(output)
+	assert.Contains(t, html, "<title>ARP Scan Report</title>")
+	assert.Contains(t, html, "<th>vendor</th>")
+	assert.Contains(t, html, "&lt;Acme&gt;")
+	assert.NotContains(t, html, "<link")
+	assert.NotContains(t, html, "src=")
+
+	routerResults := &RouterScanResults{
+		Routers: []Router{
+			{IP: netip.MustParseAddr("fe80::1"), MACAddress: netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}, Vendor: "Acme", Interface: "eth0"},
+		},
+		printVendors: true,
+	}
+	output, err = getHTMLResults(routerResults)
+	require.NoError(t, err)
+	html = string(output)
+	assert.Contains(t, html, "00:1a:2b:3c:4d:5e")
+	assert.Contains(t, html, "Acme")
+
+	finResults := &TCPSynScanResults{
+		Mode: TCPScanModeFin,
+		Results: HostResults{
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:          netip.MustParseAddr("10.1.1.2"),
+				HostState:     HostStateUp,
+				FilteredPorts: 1,
+				Ports:         []Port{{Number: 80, Name: "http", Protocol: "tcp", State: PortStatePossibleFilter}},
+			},
+		},
+	}
+	output, err = getHTMLResults(finResults)
+	require.NoError(t, err)
+	html = string(output)
+	assert.Contains(t, html, `<td class="state-open-filtered">open | filtered</td>`)
+	assert.Contains(t, html, `<td class="state-up">up</td>`)
+}
@@ -0,0 +1,200 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/bits"
+)
+
+// maxHTTPBody is the most of a page or favicon that is read.
+const maxHTTPBody = 1024 * 1024
+
+// HTTPInfo describes the web server on a port as seen from a request for its root page.
+type HTTPInfo struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Server     string `json:"server,omitempty"`
+	PoweredBy  string `json:"powered_by,omitempty"`
+	Title      string `json:"title,omitempty"`
+	// Location is where the server redirects to. Redirects are not followed.
+	Location string `json:"location,omitempty"`
+	// FaviconHash is the MurmurHash3 of the base64 encoded favicon as computed by Shodan's http.favicon.hash. It is 0 if there is no
+	// favicon.
+	FaviconHash int32 `json:"favicon_hash,omitempty"`
+}
+
+var (
+	htmlTitle     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlLinkTag   = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	htmlIconRel   = regexp.MustCompile(`(?is)\brel\s*=\s*["']?(?:shortcut\s+)?icon\b`)
+	htmlHrefValue = regexp.MustCompile(`(?is)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// httpServices are the names of services that are fingerprinted even when service detection has identified them.
+var httpServices = []string{"http", "https", "http-alt", "http-proxy"}
+
+// fingerprintHTTP requests the root page of the open tcp ports of the hosts in results that answer HTTP or HTTPS and records what the
+// responses tell about the web servers.
+func fingerprintHTTP(ctx context.Context, results HostResults, workers int, timeout time.Duration, stream *resultStream) {
+	enrichOpenPorts(ctx, results, workers, stream, "Fingerprinting web servers....", "HTTP fingerprinting done",
+		func(ctx context.Context, host HostResult, port Port) func(*Port) {
+			if port.serviceDetected() && !slices.Contains(httpServices, port.Name) {
+				// service detection found something that is not a web server.
+				return nil
+			}
+
+			schemes := []string{"http", "https"}
+			if port.TLS != nil {
+				schemes = []string{"https"}
+			}
+			for _, scheme := range schemes {
+				info, err := httpFingerprint(ctx, scheme, netip.AddrPortFrom(host.Addr, uint16(port.Number)), host.HostName, timeout)
+				if err == nil {
+					return func(port *Port) {
+						port.HTTP = info
+					}
+				}
+			}
+			return nil
+		})
+}
+
+// httpFingerprint requests the root page and favicon of the web server at target with the given scheme. hostName is sent in the Host
+// header if it is not empty.
+func httpFingerprint(ctx context.Context, scheme string, target netip.AddrPort, hostName string, timeout time.Duration) (*HTTPInfo, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// always connect to the scanned address whatever the host in the url resolves to.
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, target.String())
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ServerName: hostName},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	host := target.String()
+	if hostName != "" {
+		host = net.JoinHostPort(hostName, strconv.Itoa(int(target.Port())))
+	}
+	root := &url.URL{Scheme: scheme, Host: host, Path: "/"}
+
+	resp, body, err := httpGet(ctx, client, root.String())
+	if err != nil {
+		return nil, err
+	}
+	if scheme == "http" && strings.Contains(string(body), "plain HTTP request was sent to HTTPS port") {
+		return nil, errPlainHTTPToHTTPS
+	}
+
+	info := &HTTPInfo{
+		URL:        root.String(),
+		StatusCode: resp.StatusCode,
+		Server:     resp.Header.Get("Server"),
+		PoweredBy:  resp.Header.Get("X-Powered-By"),
+		Location:   resp.Header.Get("Location"),
+		Title:      pageTitle(body),
+	}
+
+	favicon := root.ResolveReference(&url.URL{Path: "/favicon.ico"})
+	if href := faviconHref(body); href != "" {
+		if ref, err := url.Parse(href); err == nil {
+			if resolved := root.ResolveReference(ref); resolved.Host == root.Host {
+				favicon = resolved
+			}
+		}
+	}
+	resp, body, err = httpGet(ctx, client, favicon.String())
+	if err == nil && resp.StatusCode == http.StatusOK && len(body) != 0 {
+		info.FaviconHash = faviconHash(body)
+	}
+
+	return info, nil
+}
+
+// errPlainHTTPToHTTPS is returned when a plain HTTP request is answered with a page saying the port expects HTTPS.
+var errPlainHTTPToHTTPS = errors.New("plain http request sent to https port")
+
+// httpGet requests rawURL and returns the response along with up to maxHTTPBody bytes of its body.
+func httpGet(ctx context.Context, client *http.Client, rawURL string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", "gscn")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+// pageTitle returns the text of the page's title element with its white space collapsed.
+func pageTitle(body []byte) string {
+	match := htmlTitle.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
+
+// faviconHref returns the href of the first link element of the page whose rel is icon.
+func faviconHref(body []byte) string {
+	for _, tag := range htmlLinkTag.FindAll(body, -1) {
+		if !htmlIconRel.Match(tag) {
+			continue
+		}
+		href := htmlHrefValue.FindSubmatch(tag)
+		if href == nil {
+			continue
+		}
+		for _, value := range href[1:] {
+			if len(value) != 0 {
+				return html.UnescapeString(string(value))
+			}
+		}
+	}
+	return ""
+}
+
+// faviconHash returns the hash Shodan uses to identify favicons: the MurmurHash3 of the favicon encoded as base64 with a new line after
+// every 76 characters and at the end, like Python's base64.encodebytes.
+func faviconHash(favicon []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(favicon)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteByte('\n')
+	return int32(bits.Murmur3([]byte(b.String()), 0))
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPFingerprint(t *testing.T) {
+	favicon := []byte("not really an icon")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.24.0")
+		w.Header().Set("X-Powered-By", "PHP/8.2.7")
+		w.Write([]byte(`<html><head><link href="/static/icon.png" rel="shortcut icon">
+			<title>
+				Router &amp; Admin
+			</title></head></html>`))
+	})
+	mux.HandleFunc("/static/icon.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(favicon)
+	})
+	mux.HandleFunc("/old/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+
+	for _, newServer := range []func(http.Handler) *httptest.Server{httptest.NewServer, httptest.NewTLSServer} {
+		server := newServer(mux)
+		defer server.Close()
+
+		serverURL, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		target := netip.MustParseAddrPort(serverURL.Host)
+
+		info, err := httpFingerprint(context.Background(), serverURL.Scheme, target, "", time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, &HTTPInfo{
+			URL:         server.URL + "/",
+			StatusCode:  http.StatusOK,
+			Server:      "nginx/1.24.0",
+			PoweredBy:   "PHP/8.2.7",
+			Title:       "Router & Admin",
+			FaviconHash: faviconHash(favicon),
+		}, info)
+	}
+}
+
+func TestHTTPFingerprintRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "https://portal.lan/login", http.StatusMovedPermanently)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	target := netip.MustParseAddrPort(serverURL.Host)
+
+	info, err := httpFingerprint(context.Background(), "http", target, "portal.lan", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "http://portal.lan:"+serverURL.Port()+"/", info.URL)
+	assert.Equal(t, http.StatusMovedPermanently, info.StatusCode)
+	assert.Equal(t, "https://portal.lan/login", info.Location)
+	assert.Zero(t, info.FaviconHash)
+}
+
+func TestHTTPFingerprintNotHTTP(t *testing.T) {
+	target := serveOnce(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	})
+	_, err := httpFingerprint(context.Background(), "http", target, "", time.Second)
+	assert.Error(t, err)
+}
+
+func TestFaviconHref(t *testing.T) {
+	tests := []struct {
+		page     string
+		expected string
+	}{
+		{page: `<link rel="icon" href="/favicon.png">`, expected: "/favicon.png"},
+		{page: `<link rel=stylesheet href=/app.css><LINK HREF='img/fav.ico' REL='Shortcut Icon'>`, expected: "img/fav.ico"},
+		{page: `<link rel="apple-touch-icon" href="/touch.png">`, expected: ""},
+		{page: `<title>no icon</title>`, expected: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, faviconHref([]byte(tt.page)), tt.page)
+	}
+}
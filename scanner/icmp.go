@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// icmpUnreachableFilter matches ICMP and ICMPv6 destination unreachable messages.
+const icmpUnreachableFilter = "(icmp and icmp[0] == 3) or (icmp6 and icmp6[0] == 1)"
+
+// unreachablePacket is the packet an ICMP or ICMPv6 destination unreachable message was sent back for, as read from the copy of its
+// headers that the message carries.
+type unreachablePacket struct {
+	quotedHeaders
+	// portUnreachable is true if the message says that nothing is listening on the port, which only the destination host itself
+	// normally says.
+	portUnreachable bool
+}
+
+// parseICMPUnreachable returns the packet that an ICMP destination unreachable message with a code that means the packet was dropped
+// by a router or firewall, or an ICMPv6 destination unreachable message, was sent back for. ok is false for any other packet.
+func parseICMPUnreachable(packet gopacket.Packet) (original unreachablePacket, ok bool) {
+	if layer := packet.Layer(layers.LayerTypeICMPv4); layer != nil {
+		icmp := layer.(*layers.ICMPv4)
+		if icmp.TypeCode.Type() != layers.ICMPv4TypeDestinationUnreachable {
+			return original, false
+		}
+		switch icmp.TypeCode.Code() {
+		case layers.ICMPv4CodeHost, layers.ICMPv4CodeProtocol, layers.ICMPv4CodePort, layers.ICMPv4CodeNetAdminProhibited,
+			layers.ICMPv4CodeHostAdminProhibited, layers.ICMPv4CodeCommAdminProhibited:
+			original.quotedHeaders, ok = parseQuotedHeaders(icmp.Payload)
+			original.portUnreachable = icmp.TypeCode.Code() == layers.ICMPv4CodePort
+			return original, ok
+		}
+		return original, false
+	}
+
+	if layer := packet.Layer(layers.LayerTypeICMPv6); layer != nil {
+		icmp := layer.(*layers.ICMPv6)
+		if icmp.TypeCode.Type() != layers.ICMPv6TypeDestinationUnreachable {
+			return original, false
+		}
+		quoted, ok := icmpv6QuotedPacket(icmp)
+		if !ok {
+			return original, false
+		}
+		original.quotedHeaders, ok = parseQuotedHeaders(quoted)
+		original.portUnreachable = icmp.TypeCode.Code() == layers.ICMPv6CodePortUnreachable
+		return original, ok
+	}
+
+	return original, false
+}
+
+// icmpv6QuotedPacket returns the packet an ICMPv6 error message was sent back for. It comes after 4 bytes that hold the MTU in packet
+// too big messages and are unused in the others.
+func icmpv6QuotedPacket(icmp *layers.ICMPv6) ([]byte, bool) {
+	if len(icmp.Payload) < 4 {
+		return nil, false
+	}
+	return icmp.Payload[4:], true
+}
+
+// quotedHeaders are the headers of a packet that an ICMP or ICMPv6 error message was sent back for.
+type quotedHeaders struct {
+	dst      netip.Addr
+	protocol layers.IPProtocol
+	// transport is the first 8 bytes of the transport header, which are all that is guaranteed to be quoted.
+	transport []byte
+}
+
+// parseQuotedHeaders reads the headers of the IPv4 or IPv6 packet at the start of data. IPv6 packets with extension headers are not
+// supported.
+func parseQuotedHeaders(data []byte) (quoted quotedHeaders, ok bool) {
+	switch {
+	case len(data) >= 20 && data[0]>>4 == 4:
+		headerLength := int(data[0]&0x0f) * 4
+		if len(data) < headerLength+8 {
+			return quoted, false
+		}
+		quoted.dst, _ = netip.AddrFromSlice(data[16:20])
+		quoted.protocol = layers.IPProtocol(data[9])
+		quoted.transport = data[headerLength : headerLength+8]
+	case len(data) >= 48 && data[0]>>4 == 6:
+		quoted.dst, _ = netip.AddrFromSlice(data[24:40])
+		quoted.protocol = layers.IPProtocol(data[6])
+		quoted.transport = data[40:48]
+	default:
+		return quoted, false
+	}
+	return quoted, true
+}
+
+func (q quotedHeaders) srcPort() uint16 {
+	return binary.BigEndian.Uint16(q.transport[0:2])
+}
+
+func (q quotedHeaders) dstPort() uint16 {
+	return binary.BigEndian.Uint16(q.transport[2:4])
+}
+
+// isEcho reports whether the quoted packet is an ICMP or ICMPv6 echo request.
+func (q quotedHeaders) isEcho() bool {
+	return (q.protocol == layers.IPProtocolICMPv4 && q.transport[0] == layers.ICMPv4TypeEchoRequest) ||
+		(q.protocol == layers.IPProtocolICMPv6 && q.transport[0] == layers.ICMPv6TypeEchoRequest)
+}
+
+// echoID returns the identifier of a quoted echo request, which comes after the type, code and checksum.
+func (q quotedHeaders) echoID() uint16 {
+	return binary.BigEndian.Uint16(q.transport[4:6])
+}
+
+func (q quotedHeaders) echoSeq() uint16 {
+	return binary.BigEndian.Uint16(q.transport[6:8])
+}
@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// icmpUnreachableReply builds the ethernet frame a router at src sends back when it drops a probe of the given protocol from dst to
+// target.
+func icmpUnreachableReply(t *testing.T, src, dst netip.Addr, target netip.AddrPort, protocol layers.IPProtocol, code uint8) gopacket.Packet {
+	t.Helper()
+	return icmpUnreachableReplyFromPort(t, src, dst, 50000, target, protocol, code)
+}
+
+// icmpUnreachableReplyFromPort is like icmpUnreachableReply but the quoted packet was sent from srcPort.
+func icmpUnreachableReplyFromPort(t *testing.T, src, dst netip.Addr, srcPort uint16, target netip.AddrPort, protocol layers.IPProtocol, code uint8) gopacket.Packet {
+	t.Helper()
+
+	var probe transportLayer = &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(target.Port()), FIN: true}
+	if protocol == layers.IPProtocolUDP {
+		probe = &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(target.Port())}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	eth := &layers.Ethernet{SrcMAC: []byte{0, 1, 2, 3, 4, 5}, DstMAC: []byte{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+
+	if target.Addr().Is4() {
+		probeIP := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: protocol, SrcIP: dst.AsSlice(), DstIP: target.Addr().AsSlice()}
+		probe.SetNetworkLayerForChecksum(probeIP)
+		require.NoError(t, gopacket.SerializeLayers(buf, opts, probeIP, probe))
+		original := buf.Bytes()[:28] // the ip header and the first 8 bytes of the transport header
+
+		reply := gopacket.NewSerializeBuffer()
+		require.NoError(t, gopacket.SerializeLayers(reply, opts, eth,
+			&layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: src.AsSlice(), DstIP: dst.AsSlice()},
+			&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, code)},
+			gopacket.Payload(original),
+		))
+		return gopacket.NewPacket(reply.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	}
+
+	probeIP := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: protocol, SrcIP: dst.AsSlice(), DstIP: target.Addr().AsSlice()}
+	probe.SetNetworkLayerForChecksum(probeIP)
+	require.NoError(t, gopacket.SerializeLayers(buf, opts, probeIP, probe))
+
+	eth.EthernetType = layers.EthernetTypeIPv6
+	replyIP := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolICMPv6, SrcIP: src.AsSlice(), DstIP: dst.AsSlice()}
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeDestinationUnreachable, code)}
+	icmp.SetNetworkLayerForChecksum(replyIP)
+	reply := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(reply, opts, eth, replyIP, icmp, gopacket.Payload(append([]byte{0, 0, 0, 0}, buf.Bytes()...))))
+	return gopacket.NewPacket(reply.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestParseICMPUnreachable(t *testing.T) {
+	router4 := netip.MustParseAddr("10.0.0.1")
+	local4 := netip.MustParseAddr("10.0.0.2")
+	target4 := netip.MustParseAddrPort("192.168.1.10:443")
+	router6 := netip.MustParseAddr("2001:db8::1")
+	local6 := netip.MustParseAddr("2001:db8::2")
+	target6 := netip.MustParseAddrPort("[2001:db8:1::10]:22")
+
+	tests := []struct {
+		name            string
+		packet          gopacket.Packet
+		want            netip.AddrPort
+		ok              bool
+		portUnreachable bool
+	}{
+		{
+			name:   "admin prohibited",
+			packet: icmpUnreachableReply(t, router4, local4, target4, layers.IPProtocolTCP, layers.ICMPv4CodeCommAdminProhibited),
+			want:   target4,
+			ok:     true,
+		},
+		{
+			name:   "host unreachable",
+			packet: icmpUnreachableReply(t, router4, local4, target4, layers.IPProtocolTCP, layers.ICMPv4CodeHost),
+			want:   target4,
+			ok:     true,
+		},
+		{
+			name:            "port unreachable",
+			packet:          icmpUnreachableReply(t, target4.Addr(), local4, target4, layers.IPProtocolTCP, layers.ICMPv4CodePort),
+			want:            target4,
+			ok:              true,
+			portUnreachable: true,
+		},
+		{
+			name:   "fragmentation needed is not a filter",
+			packet: icmpUnreachableReply(t, router4, local4, target4, layers.IPProtocolTCP, layers.ICMPv4CodeFragmentationNeeded),
+		},
+		{
+			name:   "icmpv6",
+			packet: icmpUnreachableReply(t, router6, local6, target6, layers.IPProtocolTCP, layers.ICMPv6CodeAdminProhibited),
+			want:   target6,
+			ok:     true,
+		},
+		{
+			name:            "icmpv6 port unreachable",
+			packet:          icmpUnreachableReply(t, target6.Addr(), local6, target6, layers.IPProtocolTCP, layers.ICMPv6CodePortUnreachable),
+			want:            target6,
+			ok:              true,
+			portUnreachable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseICMPUnreachable(tt.packet)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.want, netip.AddrPortFrom(got.dst, got.dstPort()))
+				assert.Equal(t, layers.IPProtocolTCP, got.protocol)
+				assert.Equal(t, tt.portUnreachable, got.portUnreachable)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ResultTypes are the scan types whose json results can be loaded with LoadResults.
+var ResultTypes = []string{"tcp", "syn", "udp", "ping", "arp", "ndp", "dhcp", "router", "wifi", "trace", "mtu"}
+
+// LoadResults reads scan results previously written in json format from r so that they can be written again in any output format.
+// scanType is one of ResultTypes. When it is empty the scan type is detected from the json, with tcp connect scans assumed for tcp port
+// scans saved without the scan mode that syn scan results now have.
+func LoadResults(r io.Reader, scanType string) (ScanResults, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if scanType == "" {
+		scanType, err = detectScanType(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var results ScanResults
+	switch scanType {
+	case "tcp":
+		results = &TCPFullScanResults{}
+	case "syn":
+		results = &TCPSynScanResults{}
+	case "udp":
+		results = &UDPScanResults{}
+	case "ping":
+		results = &PingScanResults{}
+	case "arp":
+		results = &ARPScanResults{}
+	case "ndp":
+		results = &NDPScanResults{}
+	case "dhcp":
+		results = &DHCPv4ScannerResults{}
+	case "router":
+		results = &RouterScanResults{}
+	case "wifi":
+		results = &WiFiScanResults{}
+	case "trace":
+		results = &TraceResults{}
+	case "mtu":
+		results = &MTUResults{}
+	default:
+		return nil, fmt.Errorf("unknown scan type %v. Expected one of %v", scanType, strings.Join(ResultTypes, ", "))
+	}
+
+	err = json.Unmarshal(data, results)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v scan results: %w", scanType, err)
+	}
+
+	// show the optional columns that the saved results have values for.
+	switch results := results.(type) {
+	case *ARPScanResults:
+		results.printHostNames = slices.ContainsFunc(results.HostResults, func(h ARPHostResult) bool { return h.HostName != "" })
+		results.printVendors = slices.ContainsFunc(results.HostResults, func(h ARPHostResult) bool { return h.Vendor != "" })
+	case *NDPScanResults:
+		results.printHostNames = slices.ContainsFunc(results.HostResults, func(h NDPHostResult) bool { return h.HostName != "" })
+		results.printVendors = slices.ContainsFunc(results.HostResults, func(h NDPHostResult) bool { return h.Vendor != "" })
+	case *DHCPv4ScannerResults:
+		results.printHostNames = slices.ContainsFunc(results.Servers, func(s DHCPv4Server) bool { return s.HostName != "" })
+		results.printVendors = slices.ContainsFunc(results.Servers, func(s DHCPv4Server) bool { return s.Vendor != "" })
+		// the DHCP scanner returns its results by value.
+		return *results, nil
+	case *RouterScanResults:
+		results.printVendors = slices.ContainsFunc(results.Routers, func(r Router) bool { return r.Vendor != "" })
+	}
+
+	return results, nil
+}
+
+// detectScanType works out the scan type of json results from the keys they contain.
+func detectScanType(data []byte) (string, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return "", fmt.Errorf("could not read scan results: %w", err)
+	}
+
+	switch {
+	case fields["servers"] != nil:
+		return "dhcp", nil
+	case fields["routers"] != nil:
+		return "router", nil
+	case fields["aps"] != nil:
+		return "wifi", nil
+	case fields["hops"] != nil:
+		return "trace", nil
+	case fields["interface_mtu"] != nil:
+		return "mtu", nil
+	case fields["mode"] != nil:
+		return "syn", nil
+	}
+
+	var hosts []map[string]json.RawMessage
+	err = json.Unmarshal(fields["results"], &hosts)
+	if err != nil || len(hosts) == 0 {
+		return "", fmt.Errorf("could not detect the scan type of the results. Please provide it")
+	}
+
+	host := hosts[0]
+	switch {
+	case host["ports"] != nil || host["open"] != nil:
+		var ports []Port
+		err = json.Unmarshal(host["ports"], &ports)
+		if err == nil && len(ports) != 0 && ports[0].Protocol == "udp" {
+			return "udp", nil
+		}
+		return "tcp", nil
+	case host["PacketsSent"] != nil:
+		return "ping", nil
+	case host["IsRouter"] != nil:
+		return "ndp", nil
+	case host["mac"] != nil:
+		return "arp", nil
+	default:
+		return "", fmt.Errorf("could not detect the scan type of the results. Please provide it")
+	}
+}
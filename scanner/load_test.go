@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadResults(t *testing.T) {
+	hostResults := HostResults{
+		netip.MustParseAddr("10.1.1.2"): {
+			Addr:        netip.MustParseAddr("10.1.1.2"),
+			HostState:   HostStateUp,
+			OpenPorts:   1,
+			ClosedPorts: 1,
+			AverageRTT:  time.Millisecond,
+			Ports: []Port{
+				{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen},
+				{Number: 23, Name: "telnet", Protocol: "tcp", State: PortStateClosed},
+			},
+			portIndex: map[PortNumber]int{22: 0, 23: 1},
+		},
+	}
+	udpHostResults := HostResults{
+		netip.MustParseAddr("10.1.1.3"): {
+			Addr:          netip.MustParseAddr("10.1.1.3"),
+			HostState:     HostStateUp,
+			FilteredPorts: 1,
+			Ports: []Port{
+				{Number: 53, Name: "domain", Protocol: "udp", State: PortStatePossibleFilter},
+			},
+			portIndex: map[PortNumber]int{53: 0},
+		},
+	}
+	mac := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+
+	tests := []struct {
+		name     string
+		results  ScanResults
+		scanType string
+		want     ScanResults
+	}{
+		{
+			name:    "tcp scan detected",
+			results: &TCPFullScanResults{Results: hostResults, Stats: TCPFullScanStats{TotalNumOfHosts: 1, ScanTime: time.Second}},
+		},
+		{
+			name:     "syn scan given",
+			results:  &TCPSynScanResults{Results: hostResults, Stats: TCPSynScanStats{TotalNumOfHosts: 1}},
+			scanType: "syn",
+		},
+		{
+			name:    "syn scan detected from its mode",
+			results: &TCPSynScanResults{Mode: TCPScanModeFin, Results: hostResults},
+		},
+		{
+			name:    "udp scan detected",
+			results: &UDPScanResults{Results: udpHostResults, Stats: UDPScanStats{TotalNumOfHosts: 1}},
+		},
+		{
+			name: "ping scan detected",
+			results: &PingScanResults{
+				HostResults: []PingHostResult{{IP: netip.MustParseAddr("10.1.1.1"), HostState: HostStateUp, PacketsSent: 1, PacketReceived: 1}},
+				PingStats:   PingStats{UpHosts: 1, TotalHosts: 1},
+			},
+		},
+		{
+			name: "arp scan detected",
+			results: &ARPScanResults{
+				HostResults:  []ARPHostResult{{IPAddr: netip.MustParseAddr("10.1.1.1"), MacAddr: mac, Vendor: "Acme"}},
+				ARPScanStats: ARPScanStats{PacketsSent: 1},
+			},
+			want: &ARPScanResults{
+				HostResults:  []ARPHostResult{{IPAddr: netip.MustParseAddr("10.1.1.1"), MacAddr: mac, Vendor: "Acme"}},
+				ARPScanStats: ARPScanStats{PacketsSent: 1},
+				printVendors: true,
+			},
+		},
+		{
+			name: "ndp scan detected",
+			results: &NDPScanResults{
+				HostResults: []NDPHostResult{{IPAddr: netip.MustParseAddr("fe80::1"), MacAddr: mac, IsRouter: true}},
+			},
+		},
+		{
+			name: "dhcp scan detected",
+			results: DHCPv4ScannerResults{
+				Servers: []DHCPv4Server{{
+					IP:                  netip.MustParseAddr("10.1.1.1"),
+					MACAddress:          mac,
+					DHCPv4ServerOptions: DHCPv4ServerOptions{OfferedIP: netip.MustParseAddr("10.1.1.50"), LeaseTime: time.Hour},
+				}},
+			},
+		},
+		{
+			name: "router discovery detected",
+			results: &RouterScanResults{
+				Routers: []Router{{
+					IP:             netip.MustParseAddr("fe80::1"),
+					MACAddress:     mac,
+					Interface:      "eth0",
+					Advertisements: 1,
+					RouterAdvertisement: RouterAdvertisement{
+						Lifetime: 30 * time.Minute,
+						Prefixes: []RouterPrefix{{Prefix: netip.MustParsePrefix("2001:db8::/64"), ValidLifetime: infiniteLifetime, OnLink: true, Autonomous: true}},
+						RDNSS:    []RDNSSOption{{Servers: []netip.Addr{netip.MustParseAddr("2001:db8::53")}, Lifetime: time.Hour}},
+					},
+				}},
+				Stats: RouterScanStats{PacketsSent: 1, PacketsReceived: 1},
+			},
+		},
+		{
+			name: "trace detected",
+			results: &TraceResults{
+				Target:  netip.MustParseAddr("10.1.2.1"),
+				Method:  TraceMethodUDP,
+				Port:    33434,
+				Reached: true,
+				Hops: []TraceHop{
+					{TTL: 1, Probes: []TraceProbe{{Addr: netip.MustParseAddr("10.1.1.1"), RTT: time.Millisecond, Reply: "time-exceeded"}, {}}},
+					{TTL: 2, Probes: []TraceProbe{{Addr: netip.MustParseAddr("10.1.2.1"), RTT: time.Millisecond, Reply: "port-unreachable"}, {}}},
+				},
+				Stats: TraceStats{ProbesSent: 4, RepliesReceived: 2},
+			},
+		},
+		{
+			name: "mtu probe detected",
+			results: &MTUResults{
+				Target:       netip.MustParseAddr("10.1.2.1"),
+				MTU:          1420,
+				InterfaceMTU: 1500,
+				LimitingHop:  &MTUHop{TTL: 2, Addr: netip.MustParseAddr("10.1.1.1")},
+				Probes: []MTUProbe{
+					{Size: 68, Result: "reply", From: netip.MustParseAddr("10.1.2.1"), RTT: time.Millisecond},
+					{Size: 1500, Result: "too-big", From: netip.MustParseAddr("10.1.1.1"), ReportedMTU: 1420, RTT: time.Millisecond},
+					{Size: 1420, Result: "reply", From: netip.MustParseAddr("10.1.2.1"), RTT: time.Millisecond},
+				},
+				Stats: MTUStats{ProbesSent: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.results)
+			require.NoError(t, err)
+
+			got, err := LoadResults(bytes.NewReader(data), tt.scanType)
+			require.NoError(t, err)
+
+			want := tt.want
+			if want == nil {
+				want = tt.results
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestLoadResultsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		scanType string
+	}{
+		{name: "not json", data: "ip,port"},
+		{name: "empty results cannot be detected", data: `{"results":[],"stats":{}}`},
+		{name: "unknown scan type", data: `{"results":[]}`, scanType: "icmp"},
+		{name: "bad port state", data: `{"results":[{"ip":"10.1.1.1","state":"up","ports":[{"number":22,"state":"ajar"}]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadResults(bytes.NewBufferString(tt.data), tt.scanType)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,599 @@
+package scanner
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/kakeetopius/gscn/packet"
+	"github.com/pterm/pterm"
+)
+
+const (
+	// minMTUv4 and minMTUv6 are the smallest MTUs every IPv4 and IPv6 link has to support.
+	minMTUv4 = 68
+	minMTUv6 = 1280
+
+	defaultMTUTimeout  = time.Second
+	defaultMTUAttempts = 3
+	defaultMTUMaxHops  = 30
+)
+
+// The results of a path MTU probe.
+const (
+	mtuProbeReply        = "reply"
+	mtuProbeTooBig       = "too-big"
+	mtuProbeTimeExceeded = "time-exceeded"
+	mtuProbeLost         = "lost"
+)
+
+type MTUOptions struct {
+	Target netip.Addr
+	// HostName is the name the target was given as, if any.
+	HostName string
+	// MaxMTU is the size of the largest probe. Defaults to, and cannot go above, the MTU of the interface the target is reached through.
+	MaxMTU int
+	// ResponseTimeout is how long to wait for the reply to each probe. Defaults to 1 second.
+	ResponseTimeout time.Duration
+	// Attempts is the number of times a probe is sent before its size is taken to be dropped on the way. Defaults to 3.
+	Attempts int
+	// MaxHops is the largest TTL or hop limit used when looking for the hop that limits the MTU. Defaults to 30.
+	MaxHops int
+	// NoHostNames turns off the reverse lookup of the hop that limits the MTU.
+	NoHostNames bool
+}
+
+// MTUProber finds the largest packet that reaches a host without being fragmented by sending it ICMP echo requests of different sizes
+// that must not be fragmented. Routers that cannot forward a probe are expected to say so with an ICMP fragmentation needed or ICMPv6
+// packet too big message, but probes that are dropped without one (a PMTUD black hole) are found too by searching for the largest
+// size that still gets a reply.
+type MTUProber struct {
+	MTUOptions
+
+	results       MTUResults
+	ifaceProvider netutil.NetInterfaceProvider
+	macResolver   resolving.Resolver
+	router        routing.Router
+
+	icmpID uint16
+	// seq is the sequence number of the last probe sent.
+	seq uint16
+	// replies gets the replies to the probes from the packet receiver.
+	replies chan mtuReply
+}
+
+type MTUResults struct {
+	Target   netip.Addr `json:"target"`
+	HostName string     `json:"hostname,omitempty"`
+	// MTU is the size in bytes of the largest packet, IP header included, that reaches the target without being fragmented.
+	MTU int `json:"mtu"`
+	// InterfaceMTU is the MTU of the interface the target is reached through, which is as large as the path MTU can be.
+	InterfaceMTU int `json:"interface_mtu"`
+	// LimitingHop is the router that cannot forward packets larger than MTU. It is nil if nothing on the way is smaller than the
+	// interface or the router could not be found.
+	LimitingHop *MTUHop `json:"limiting_hop,omitempty"`
+	// BlackHole is set when packets larger than MTU are dropped without an ICMP message saying that they are too big.
+	BlackHole bool       `json:"black_hole"`
+	Probes    []MTUProbe `json:"probes"`
+	Stats     MTUStats   `json:"stats"`
+}
+
+type MTUStats struct {
+	ProbesSent int           `json:"probes_sent"`
+	ScanTime   time.Duration `json:"scan_duration"`
+}
+
+// MTUHop is a router on the way to the target.
+type MTUHop struct {
+	// TTL is the number of the hop, which is 0 if it is not known.
+	TTL      int        `json:"ttl,omitempty"`
+	Addr     netip.Addr `json:"ip,omitzero"`
+	HostName string     `json:"hostname,omitempty"`
+}
+
+// MTUProbe is a probe of one size and the reply to it.
+type MTUProbe struct {
+	Size int `json:"size"`
+	// TTL is set for the probes sent to find the hop that limits the MTU.
+	TTL int `json:"ttl,omitempty"`
+	// Result is one of reply, too-big, time-exceeded or lost.
+	Result string     `json:"result"`
+	From   netip.Addr `json:"from,omitzero"`
+	// ReportedMTU is the MTU given in a fragmentation needed or packet too big message.
+	ReportedMTU int           `json:"reported_mtu,omitempty"`
+	RTT         time.Duration `json:"rtt,omitempty"`
+}
+
+// mtuReply is a reply to the probe with the sequence number seq.
+type mtuReply struct {
+	seq      uint16
+	result   string
+	from     netip.Addr
+	mtu      int
+	received time.Time
+}
+
+func NewMTUProber(opts MTUOptions) (*MTUProber, error) {
+	if !opts.Target.IsValid() {
+		return nil, fmt.Errorf("no target to probe provided")
+	}
+	opts.Target = opts.Target.Unmap()
+	if opts.ResponseTimeout == 0 {
+		opts.ResponseTimeout = defaultMTUTimeout
+	}
+	if opts.Attempts == 0 {
+		opts.Attempts = defaultMTUAttempts
+	}
+	if opts.MaxHops == 0 {
+		opts.MaxHops = defaultMTUMaxHops
+	}
+	if opts.Attempts < 0 {
+		return nil, fmt.Errorf("number of attempts cannot be negative")
+	}
+	if opts.MaxHops < 1 || opts.MaxHops > maxTraceHops {
+		return nil, fmt.Errorf("maximum number of hops must be between 1 and %v", maxTraceHops)
+	}
+
+	ifaceProvider, err := netutil.InterfaceProvider()
+	if err != nil {
+		return nil, err
+	}
+	router, err := routing.NewRouter(ifaceProvider)
+	if err != nil {
+		return nil, err
+	}
+	route, err := router.Lookup(opts.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaceMTU := route.Interface.MTU
+	if opts.MaxMTU == 0 {
+		opts.MaxMTU = interfaceMTU
+	}
+	if opts.MaxMTU > interfaceMTU {
+		return nil, fmt.Errorf("maximum mtu %v is larger than the mtu %v of interface %v", opts.MaxMTU, interfaceMTU, route.Interface.Name)
+	}
+	if opts.MaxMTU < minMTU(opts.Target) {
+		return nil, fmt.Errorf("maximum mtu cannot be below %v", minMTU(opts.Target))
+	}
+
+	return &MTUProber{
+		MTUOptions: opts,
+		results: MTUResults{
+			Target:       opts.Target,
+			HostName:     opts.HostName,
+			InterfaceMTU: interfaceMTU,
+		},
+		ifaceProvider: ifaceProvider,
+		macResolver:   resolving.NewResolver(ifaceProvider),
+		router:        router,
+		icmpID:        uint16(rand.UintN(65536)),
+	}, nil
+}
+
+// minMTU returns the smallest MTU every link of the IP version of addr has to support.
+func minMTU(addr netip.Addr) int {
+	if addr.Is4() {
+		return minMTUv4
+	}
+	return minMTUv6
+}
+
+func (p *MTUProber) Scan(ctx context.Context) (ScanResults, error) {
+	startTime := time.Now()
+	err := p.runMTUProbe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hop := p.results.LimitingHop; hop != nil && !p.NoHostNames && hop.Addr.IsValid() {
+		lookupCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		hop.HostName = strings.TrimSuffix(netutil.ReverseLookup(lookupCtx, hop.Addr.String()), ".")
+		cancel()
+	}
+	p.results.Stats.ScanTime = time.Since(startTime)
+	return &p.results, nil
+}
+
+func (p *MTUProber) runMTUProbe(ctx context.Context) (err error) {
+	p.replies = make(chan mtuReply, 16)
+
+	spinner, err := pterm.DefaultSpinner.Start(fmt.Sprintf("Finding the path MTU to %v", p.Target))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			spinner.Fail("MTU Discovery Failed")
+		} else {
+			spinner.Success("MTU Discovery Done")
+		}
+	}()
+
+	allIfaces, err := p.ifaceProvider.Interfaces()
+	if err != nil {
+		return err
+	}
+
+	sender, err := newRawSender(ctx, p.ifaceProvider, p.router, p.macResolver)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	packetReceiver, err := packet.NewPacketReceiver(ctx, "icmp or icmp6", 1500, allIfaces...)
+	if err != nil {
+		return err
+	}
+
+	masterDone := make(chan struct{})
+	go p.getMTUResults(ctx, packetReceiver, masterDone)
+	defer func() {
+		packetReceiver.Close()
+		<-masterDone // wait for master to finish processing what is already enqueued by the packet receiver
+	}()
+
+	packetBuf := gopacket.NewSerializeBuffer()
+	probe := func(size, ttl int) (MTUProbe, error) {
+		return p.probe(ctx, sender, packetBuf, size, ttl)
+	}
+	return p.findMTU(probe)
+}
+
+// findMTU finds the path MTU and the hop that limits it with probes sent by probe.
+func (p *MTUProber) findMTU(probe mtuProbeFunc) error {
+	limit, err := p.searchMTU(probe)
+	if err != nil {
+		return err
+	}
+	p.results.BlackHole = limit.Result == mtuProbeLost
+	if limit.Result == mtuProbeTooBig {
+		p.results.LimitingHop = &MTUHop{Addr: limit.From}
+	}
+	if p.results.MTU < p.MaxMTU {
+		return p.locateLimitingHop(probe)
+	}
+	return nil
+}
+
+// searchMTU finds the largest probe that gets a reply and returns the result of the smallest probe that did not. Sizes given in too
+// big messages are tried first and the rest of the sizes are binary searched.
+func (p *MTUProber) searchMTU(probe mtuProbeFunc) (limit MTUProbe, err error) {
+	lo, hi := minMTU(p.Target), p.MaxMTU
+	result, err := probe(lo, defaultTTL)
+	if err != nil {
+		return limit, err
+	}
+	if result.Result != mtuProbeReply {
+		return limit, fmt.Errorf("%v did not answer echo requests of %v bytes", p.Target, lo)
+	}
+
+	next := hi
+	for lo < hi {
+		result, err := probe(next, defaultTTL)
+		if err != nil {
+			return limit, err
+		}
+		if result.Result == mtuProbeReply {
+			lo = next
+		} else {
+			hi = next - 1
+			limit = result
+		}
+
+		next = (lo + hi + 1) / 2
+		if limit.Result == mtuProbeTooBig && limit.ReportedMTU > lo && limit.ReportedMTU <= hi {
+			next = limit.ReportedMTU
+		}
+	}
+	p.results.MTU = lo
+	return limit, nil
+}
+
+// locateLimitingHop finds the router that cannot forward packets larger than the MTU by sending probes one byte larger than it with
+// growing TTLs. Routers check the TTL before the size, so a router answers the probes that run out at it with time exceeded messages
+// and the probes that go one hop further with too big messages or not at all.
+func (p *MTUProber) locateLimitingHop(probe mtuProbeFunc) error {
+	size := p.results.MTU + 1
+	var passed MTUHop
+	for ttl := 1; ttl <= p.MaxHops; ttl++ {
+		result, err := probe(size, ttl)
+		if err != nil {
+			return err
+		}
+
+		switch result.Result {
+		case mtuProbeTimeExceeded:
+			passed = MTUHop{TTL: ttl, Addr: result.From}
+		case mtuProbeTooBig:
+			p.results.LimitingHop = &MTUHop{TTL: ttl - 1, Addr: result.From}
+			return nil
+		case mtuProbeReply:
+			// the probe got through this time so there is nothing to find.
+			return nil
+		case mtuProbeLost:
+			// a small probe tells a router that drops the large ones from a hop that does not answer at all.
+			small, err := probe(minMTU(p.Target), ttl)
+			if err != nil {
+				return err
+			}
+			if small.Result == mtuProbeLost {
+				continue
+			}
+			if ttl > 1 {
+				hop := MTUHop{TTL: ttl - 1}
+				if passed.TTL == ttl-1 {
+					hop.Addr = passed.Addr
+				}
+				p.results.LimitingHop = &hop
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// mtuProbeFunc sends a probe of size bytes with the given TTL and returns the reply to it.
+type mtuProbeFunc func(size, ttl int) (MTUProbe, error)
+
+// probe sends an echo request of size bytes with the given TTL up to Attempts times and returns the first reply to it.
+func (p *MTUProber) probe(ctx context.Context, sender *rawSender, buf gopacket.SerializeBuffer, size, ttl int) (MTUProbe, error) {
+	result := MTUProbe{Size: size, Result: mtuProbeLost}
+	if ttl != defaultTTL {
+		result.TTL = ttl
+	}
+
+	for range p.Attempts {
+		p.seq++
+		transport, payload := p.probeLayers(size, p.seq)
+		sent := time.Now()
+		err := sender.sendWithOptions(buf, p.Target, ipOptions{ttl: uint8(ttl), dontFragment: true}, transport, payload...)
+		if err != nil {
+			return result, err
+		}
+		p.results.Stats.ProbesSent++
+
+		reply, ok, err := p.waitForReply(ctx, p.seq)
+		if err != nil {
+			return result, err
+		}
+		if ok {
+			result.Result = reply.result
+			result.From = reply.from
+			result.ReportedMTU = reply.mtu
+			result.RTT = max(reply.received.Sub(sent), 0)
+			break
+		}
+	}
+
+	p.results.Probes = append(p.results.Probes, result)
+	return result, nil
+}
+
+// probeLayers returns the headers and padding of an echo request that makes an IP packet of size bytes.
+func (p *MTUProber) probeLayers(size int, seq uint16) (transport gopacket.SerializableLayer, payload []gopacket.SerializableLayer) {
+	if p.Target.Is4() {
+		transport = &layers.ICMPv4{
+			TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
+			Id:       p.icmpID,
+			Seq:      seq,
+		}
+		// the IPv4 and ICMP headers take 28 bytes.
+		return transport, []gopacket.SerializableLayer{gopacket.Payload(make([]byte, max(size-28, 0)))}
+	}
+
+	transport = &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)}
+	// the IPv6 and ICMPv6 headers take 48 bytes.
+	return transport, []gopacket.SerializableLayer{
+		&layers.ICMPv6Echo{Identifier: p.icmpID, SeqNumber: seq},
+		gopacket.Payload(make([]byte, max(size-48, 0))),
+	}
+}
+
+// waitForReply waits for a reply to the probe with sequence number seq until the response timeout runs out. Late replies to earlier
+// probes are dropped.
+func (p *MTUProber) waitForReply(ctx context.Context, seq uint16) (mtuReply, bool, error) {
+	timeout := time.NewTimer(p.ResponseTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return mtuReply{}, false, ctx.Err()
+		case <-timeout.C:
+			return mtuReply{}, false, nil
+		case reply := <-p.replies:
+			if reply.seq == seq {
+				return reply, true, nil
+			}
+		}
+	}
+}
+
+func (p *MTUProber) getMTUResults(ctx context.Context, packetReceiver packet.PacketReceiver, masterDone chan<- struct{}) {
+	// To Be Run By Main Worker (aggregator)
+	packetChan := packetReceiver.Packets()
+
+	defer close(masterDone)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet, ok := <-packetChan:
+			if !ok {
+				return
+			}
+			reply, ok := p.matchReply(packet)
+			if !ok {
+				continue
+			}
+			reply.received = packet.Metadata().Timestamp
+			if reply.received.IsZero() {
+				reply.received = time.Now()
+			}
+
+			// nobody waits for replies that come in after the probe timed out.
+			select {
+			case p.replies <- reply:
+			default:
+			}
+		}
+	}
+}
+
+// matchReply returns the reply to a probe that packet carries. ok is false if packet is not a reply to any of the probes.
+func (p *MTUProber) matchReply(packet gopacket.Packet) (reply mtuReply, ok bool) {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return reply, false
+	}
+	reply.from, ok = netip.AddrFromSlice(network.NetworkFlow().Src().Raw())
+	if !ok {
+		return reply, false
+	}
+	reply.from = reply.from.Unmap()
+
+	var quoted []byte
+	if layer := packet.Layer(layers.LayerTypeICMPv4); layer != nil {
+		icmp := layer.(*layers.ICMPv4)
+		switch {
+		case icmp.TypeCode.Type() == layers.ICMPv4TypeEchoReply:
+			if icmp.Id != p.icmpID || reply.from != p.Target {
+				return reply, false
+			}
+			reply.seq, reply.result = icmp.Seq, mtuProbeReply
+			return reply, true
+		case icmp.TypeCode == layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded):
+			// the next hop MTU is in the second half of the otherwise unused field that gopacket reads as the sequence number.
+			reply.result, reply.mtu = mtuProbeTooBig, int(icmp.Seq)
+		case icmp.TypeCode.Type() == layers.ICMPv4TypeTimeExceeded:
+			reply.result = mtuProbeTimeExceeded
+		default:
+			return reply, false
+		}
+		quoted = icmp.Payload
+	} else if layer := packet.Layer(layers.LayerTypeICMPv6); layer != nil {
+		icmp := layer.(*layers.ICMPv6)
+		switch icmp.TypeCode.Type() {
+		case layers.ICMPv6TypeEchoReply:
+			echoLayer := packet.Layer(layers.LayerTypeICMPv6Echo)
+			if echoLayer == nil || echoLayer.(*layers.ICMPv6Echo).Identifier != p.icmpID || reply.from != p.Target {
+				return reply, false
+			}
+			reply.seq, reply.result = echoLayer.(*layers.ICMPv6Echo).SeqNumber, mtuProbeReply
+			return reply, true
+		case layers.ICMPv6TypePacketTooBig:
+			reply.result = mtuProbeTooBig
+		case layers.ICMPv6TypeTimeExceeded:
+			reply.result = mtuProbeTimeExceeded
+		default:
+			return reply, false
+		}
+		var ok bool
+		quoted, ok = icmpv6QuotedPacket(icmp)
+		if !ok {
+			return reply, false
+		}
+		if reply.result == mtuProbeTooBig {
+			reply.mtu = int(binary.BigEndian.Uint32(icmp.Payload))
+		}
+	} else {
+		return reply, false
+	}
+
+	original, ok := parseQuotedHeaders(quoted)
+	if !ok || original.dst != p.Target || !original.isEcho() || original.echoID() != p.icmpID {
+		return reply, false
+	}
+	reply.seq = original.echoSeq()
+	return reply, true
+}
+
+func (h *MTUHop) String() string {
+	host := h.Addr.String()
+	if !h.Addr.IsValid() {
+		host = "unknown address"
+	} else if h.HostName != "" {
+		host = fmt.Sprintf("%v (%v)", h.HostName, h.Addr)
+	}
+	if h.TTL == 0 {
+		return host
+	}
+	return fmt.Sprintf("hop %v, %v", h.TTL, host)
+}
+
+// limitedBy describes what limits the path MTU.
+func (r *MTUResults) limitedBy() string {
+	switch {
+	case r.LimitingHop != nil:
+		return r.LimitingHop.String()
+	case r.MTU >= r.InterfaceMTU:
+		return "the local interface"
+	default:
+		return "an unknown hop"
+	}
+}
+
+func (r *MTUResults) Print() {
+	tableData := pterm.TableData{{"Size", "TTL", "Result", "From", "Reported MTU", "RTT"}}
+	for _, probe := range r.Probes {
+		tableData = append(tableData, mtuProbeRow(probe, func(d time.Duration) string { return d.Round(time.Microsecond).String() }))
+	}
+	pterm.DefaultTable.WithHasHeader().WithBoxed().WithHeaderRowSeparator("-").WithData(tableData).Render()
+
+	target := r.Target.String()
+	if r.HostName != "" {
+		target = fmt.Sprintf("%v (%v)", r.HostName, r.Target)
+	}
+	blackHole := pterm.FgGreen.Sprint("no")
+	if r.BlackHole {
+		blackHole = pterm.FgRed.Sprint("yes")
+	}
+	fmt.Println("\nTarget:          ", target)
+	fmt.Println("Path MTU:        ", pterm.FgGreen.Sprintf("%v bytes", r.MTU))
+	fmt.Printf("Interface MTU:    %v bytes\n", r.InterfaceMTU)
+	fmt.Println("Limited By:      ", r.limitedBy())
+	fmt.Println("Black Hole:      ", blackHole)
+	fmt.Println("Probes Sent:     ", r.Stats.ProbesSent)
+	fmt.Printf("Scan Duration:    %v\n\n", r.Stats.ScanTime.Truncate(time.Millisecond))
+}
+
+func (r *MTUResults) table() [][]string {
+	rows := [][]string{{"size", "ttl", "result", "from", "reported_mtu", "rtt_ms"}}
+	for _, probe := range r.Probes {
+		rows = append(rows, mtuProbeRow(probe, durationMillis))
+	}
+	return rows
+}
+
+// mtuProbeRow returns the size, ttl, result, sender, reported MTU and round trip time of the probe, with rtt formatting the round
+// trip time. Values that the probe does not have are left empty.
+func mtuProbeRow(probe MTUProbe, rtt func(time.Duration) string) []string {
+	row := []string{strconv.Itoa(probe.Size), "", probe.Result, "", "", ""}
+	if probe.TTL != 0 {
+		row[1] = strconv.Itoa(probe.TTL)
+	}
+	if probe.From.IsValid() {
+		row[3] = probe.From.String()
+		row[5] = rtt(probe.RTT)
+	}
+	if probe.ReportedMTU != 0 {
+		row[4] = strconv.Itoa(probe.ReportedMTU)
+	}
+	return row
+}
+
+func (r MTUResults) String() string {
+	return executeResultsTemplate("mtu_results", MTUResultsTemplate, r)
+}
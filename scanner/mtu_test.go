@@ -0,0 +1,267 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMTUPath simulates the routers on the way to a target.
+type testMTUPath struct {
+	routers []netip.Addr
+	target  netip.Addr
+	// links are the MTUs of the links leaving the local host and then each router, the last one leading to the target.
+	links []int
+	// silent are the hops that drop packets that are too big without saying so.
+	silent map[int]bool
+	// quiet are the hops that do not send time exceeded messages.
+	quiet map[int]bool
+	// noReportedMTU leaves the MTU out of too big messages like some old routers do.
+	noReportedMTU bool
+	// targetSilent makes the target ignore echo requests.
+	targetSilent bool
+}
+
+func (path testMTUPath) probe(size, ttl int) (MTUProbe, error) {
+	result := MTUProbe{Size: size, Result: mtuProbeLost}
+	if ttl != defaultTTL {
+		result.TTL = ttl
+	}
+	for hop := range path.links {
+		// routers check the ttl before the size.
+		if hop > 0 && ttl == hop {
+			if !path.quiet[hop] {
+				result.Result, result.From = mtuProbeTimeExceeded, path.routers[hop-1]
+			}
+			return result, nil
+		}
+		if size > path.links[hop] {
+			if hop > 0 && !path.silent[hop] {
+				result.Result, result.From = mtuProbeTooBig, path.routers[hop-1]
+				if !path.noReportedMTU {
+					result.ReportedMTU = path.links[hop]
+				}
+			}
+			return result, nil
+		}
+	}
+	if !path.targetSilent {
+		result.Result, result.From = mtuProbeReply, path.target
+	}
+	return result, nil
+}
+
+func TestMTUProberFindMTU(t *testing.T) {
+	target := netip.MustParseAddr("192.168.1.10")
+	routers := []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.1.1"), netip.MustParseAddr("10.0.2.1")}
+
+	tests := []struct {
+		name        string
+		path        testMTUPath
+		mtu         int
+		limitingHop *MTUHop
+		blackHole   bool
+		wantErr     bool
+	}{
+		{
+			name: "nothing smaller than the interface",
+			path: testMTUPath{routers: routers, target: target, links: []int{1500, 1500, 1500, 1500}},
+			mtu:  1500,
+		},
+		{
+			name:        "tunnel that reports its mtu",
+			path:        testMTUPath{routers: routers, target: target, links: []int{1500, 1500, 1420, 1500}},
+			mtu:         1420,
+			limitingHop: &MTUHop{TTL: 2, Addr: routers[1]},
+		},
+		{
+			name:        "too big messages without the mtu",
+			path:        testMTUPath{routers: routers, target: target, links: []int{1500, 1400, 1500, 1500}, noReportedMTU: true},
+			mtu:         1400,
+			limitingHop: &MTUHop{TTL: 1, Addr: routers[0]},
+		},
+		{
+			name:        "two smaller links",
+			path:        testMTUPath{routers: routers, target: target, links: []int{1500, 1480, 1500, 1280}},
+			mtu:         1280,
+			limitingHop: &MTUHop{TTL: 3, Addr: routers[2]},
+		},
+		{
+			name:        "black hole",
+			path:        testMTUPath{routers: routers, target: target, links: []int{1500, 1500, 1436, 1500}, silent: map[int]bool{2: true}},
+			mtu:         1436,
+			limitingHop: &MTUHop{TTL: 2, Addr: routers[1]},
+			blackHole:   true,
+		},
+		{
+			name: "black hole at a hop that does not answer",
+			path: testMTUPath{
+				routers: routers,
+				target:  target,
+				links:   []int{1500, 1500, 1436, 1500},
+				silent:  map[int]bool{2: true},
+				quiet:   map[int]bool{2: true},
+			},
+			mtu:         1436,
+			limitingHop: &MTUHop{TTL: 2},
+			blackHole:   true,
+		},
+		{
+			name:    "target does not answer",
+			path:    testMTUPath{routers: routers, target: target, links: []int{1500, 1500, 1500, 1500}, targetSilent: true},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := &MTUProber{
+				MTUOptions: MTUOptions{Target: target, MaxMTU: 1500, MaxHops: 30},
+				results:    MTUResults{Target: target, InterfaceMTU: 1500},
+			}
+			err := prober.findMTU(tt.path.probe)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.mtu, prober.results.MTU)
+			assert.Equal(t, tt.limitingHop, prober.results.LimitingHop)
+			assert.Equal(t, tt.blackHole, prober.results.BlackHole)
+		})
+	}
+}
+
+func TestMTUProbeLayers(t *testing.T) {
+	local4 := netip.MustParseAddr("10.0.0.2")
+	local6 := netip.MustParseAddr("2001:db8::2")
+
+	for _, target := range []netip.Addr{netip.MustParseAddr("192.168.1.10"), netip.MustParseAddr("2001:db8:1::10")} {
+		local := local4
+		if target.Is6() {
+			local = local6
+		}
+		prober := &MTUProber{MTUOptions: MTUOptions{Target: target}}
+		for _, size := range []int{minMTU(target), 1400, 1500} {
+			transport, payload := prober.probeLayers(size, 1)
+			assert.Len(t, serializeTraceLayers(t, local, target, transport, payload...), size)
+		}
+	}
+}
+
+// mtuICMPError builds the ICMP or ICMPv6 error message that router sends back to local for the probe of prober with sequence number
+// seq. mtu is put in fragmentation needed and packet too big messages.
+func mtuICMPError(t *testing.T, prober *MTUProber, router, local netip.Addr, seq uint16, icmpType, code uint8, mtu int) gopacket.Packet {
+	t.Helper()
+
+	transport, payload := prober.probeLayers(1500, seq)
+	original := serializeTraceLayers(t, local, prober.Target, transport, payload...)
+	if local.Is4() {
+		icmp := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(icmpType, code), Seq: uint16(mtu)}
+		return tracePacket(t, router, local, icmp, gopacket.Payload(original[:28]))
+	}
+	header := binary.BigEndian.AppendUint32(nil, uint32(mtu))
+	return tracePacket(t, router, local, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(icmpType, code)},
+		gopacket.Payload(append(header, original[:1232]...)))
+}
+
+func TestMTUProberMatchReply(t *testing.T) {
+	local4 := netip.MustParseAddr("10.0.0.2")
+	router4 := netip.MustParseAddr("10.0.0.1")
+	target4 := netip.MustParseAddr("192.168.1.10")
+	local6 := netip.MustParseAddr("2001:db8::2")
+	router6 := netip.MustParseAddr("2001:db8::1")
+	target6 := netip.MustParseAddr("2001:db8:1::10")
+
+	prober4 := &MTUProber{MTUOptions: MTUOptions{Target: target4}, icmpID: 0x1234}
+	prober6 := &MTUProber{MTUOptions: MTUOptions{Target: target6}, icmpID: 0x1234}
+	otherID := &MTUProber{MTUOptions: MTUOptions{Target: target4}, icmpID: 0x4321}
+	otherTarget := &MTUProber{MTUOptions: MTUOptions{Target: netip.MustParseAddr("192.168.1.11")}, icmpID: 0x1234}
+
+	tests := []struct {
+		name   string
+		prober *MTUProber
+		packet gopacket.Packet
+		reply  mtuReply
+		ok     bool
+	}{
+		{
+			name:   "echo reply",
+			prober: prober4,
+			packet: tracePacket(t, target4, local4, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 0x1234, Seq: 3}),
+			reply:  mtuReply{seq: 3, result: mtuProbeReply, from: target4},
+			ok:     true,
+		},
+		{
+			name:   "fragmentation needed",
+			prober: prober4,
+			packet: mtuICMPError(t, prober4, router4, local4, 4, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded, 1420),
+			reply:  mtuReply{seq: 4, result: mtuProbeTooBig, from: router4, mtu: 1420},
+			ok:     true,
+		},
+		{
+			name:   "time exceeded",
+			prober: prober4,
+			packet: mtuICMPError(t, prober4, router4, local4, 5, layers.ICMPv4TypeTimeExceeded, 0, 0),
+			reply:  mtuReply{seq: 5, result: mtuProbeTimeExceeded, from: router4},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 echo reply",
+			prober: prober6,
+			packet: tracePacket(t, target6, local6, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0)},
+				&layers.ICMPv6Echo{Identifier: 0x1234, SeqNumber: 6}),
+			reply: mtuReply{seq: 6, result: mtuProbeReply, from: target6},
+			ok:    true,
+		},
+		{
+			name:   "ipv6 packet too big",
+			prober: prober6,
+			packet: mtuICMPError(t, prober6, router6, local6, 7, layers.ICMPv6TypePacketTooBig, 0, 1280),
+			reply:  mtuReply{seq: 7, result: mtuProbeTooBig, from: router6, mtu: 1280},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 time exceeded",
+			prober: prober6,
+			packet: mtuICMPError(t, prober6, router6, local6, 8, layers.ICMPv6TypeTimeExceeded, 0, 0),
+			reply:  mtuReply{seq: 8, result: mtuProbeTimeExceeded, from: router6},
+			ok:     true,
+		},
+		{
+			name:   "echo reply with another identifier",
+			prober: prober4,
+			packet: tracePacket(t, target4, local4, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 0x4321, Seq: 3}),
+		},
+		{
+			name:   "fragmentation needed for another prober",
+			prober: prober4,
+			packet: mtuICMPError(t, otherID, router4, local4, 4, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded, 1420),
+		},
+		{
+			name:   "fragmentation needed for another target",
+			prober: prober4,
+			packet: mtuICMPError(t, otherTarget, router4, local4, 4, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded, 1420),
+		},
+		{
+			name:   "other unreachable messages",
+			prober: prober4,
+			packet: mtuICMPError(t, prober4, router4, local4, 4, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeHost, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, ok := tt.prober.matchReply(tt.packet)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.reply, reply)
+			}
+		})
+	}
+}
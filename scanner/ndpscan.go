@@ -7,9 +7,8 @@ import (
 	"net/netip"
 	"runtime"
 	"slices"
-	"strings"
+	"strconv"
 	"syscall"
-	"text/template"
 	"time"
 
 	"github.com/google/gopacket"
@@ -30,6 +29,7 @@ type NDPScanner struct {
 	router         routing.Router
 	packetSender   packet.PacketSender
 	packetReceiver *packet.PcapPacketReceiver
+	stream         *resultStream
 }
 
 type NDPScanOptions struct {
@@ -116,6 +116,10 @@ func (s *NDPScanner) Scan(ctx context.Context) (ScanResults, error) {
 	return &s.results, nil
 }
 
+func (s *NDPScanner) setResultStream(stream *resultStream) {
+	s.stream = stream
+}
+
 func (s *NDPScanner) addResultInfo() error {
 	s.results.printHostNames = s.AddUnknownHostNames
 	s.results.printVendors = s.WithVendorInfo
@@ -157,13 +161,22 @@ func (r *NDPScanResults) Print() {
 	displayNDPResults(r, r.printVendors, r.printHostNames)
 }
 
-func (r *NDPScanResults) String() string {
-	stringBuilder := strings.Builder{}
-
-	tmpl := template.Must(template.New("ndp_scan_results").Parse(NDPScanResultsTemplate))
-	tmpl.Execute(&stringBuilder, r)
+func (r *NDPScanResults) table() [][]string {
+	rows := [][]string{{"ip", "mac", "hostname", "vendor", "router"}}
+	for _, result := range r.HostResults {
+		rows = append(rows, []string{
+			result.IPAddr.String(),
+			result.MacAddr.String(),
+			result.HostName,
+			result.Vendor,
+			strconv.FormatBool(result.IsRouter),
+		})
+	}
+	return rows
+}
 
-	return stringBuilder.String()
+func (r *NDPScanResults) String() string {
+	return executeResultsTemplate("ndp_scan_results", NDPScanResultsTemplate, r)
 }
 
 func (s *NDPScanner) runNDP(ctx context.Context) error {
@@ -249,32 +262,37 @@ func (s *NDPScanner) sendNSProbes() error {
 }
 
 func sendNSPacket(packetSender packet.PacketSender, iface *netutil.Interface, srcIP, dstIP netip.Addr) error {
+	nd := &layers.ICMPv6NeighborSolicitation{
+		TargetAddress: dstIP.AsSlice(),
+		Options: layers.ICMPv6Options{
+			layers.ICMPv6Option{
+				Type: layers.ICMPv6OptSourceAddress,
+				Data: iface.HardwareAddr,
+			},
+		},
+	}
+
+	return sendNDPPacket(packetSender, iface, srcIP, solicitedNodeIPAddress(dstIP), solicitedNodeMacAddress(dstIP), layers.ICMPv6TypeNeighborSolicitation, nd)
+}
+
+// sendNDPPacket sends the neighbour discovery message msg of the given ICMPv6 type from srcIP to dstIP on iface.
+func sendNDPPacket(packetSender packet.PacketSender, iface *netutil.Interface, srcIP netip.Addr, dstIP net.IP, dstMAC net.HardwareAddr, icmpType uint8, msg gopacket.SerializableLayer) error {
 	eth := &layers.Ethernet{
 		SrcMAC:       iface.HardwareAddr,
-		DstMAC:       solicitedNodeMacAddress(dstIP),
+		DstMAC:       dstMAC,
 		EthernetType: layers.EthernetTypeIPv6,
 	}
 
 	ip := &layers.IPv6{
 		SrcIP:      srcIP.AsSlice(),
-		DstIP:      solicitedNodeIPAddress(dstIP),
+		DstIP:      dstIP,
 		Version:    6,
 		NextHeader: layers.IPProtocolICMPv6,
 		HopLimit:   255,
 	}
 
 	icmp := &layers.ICMPv6{
-		TypeCode: layers.ICMPv6TypeNeighborSolicitation << 8, // typecode should be in first 8 bits of the 16 bit field
-	}
-
-	nd := &layers.ICMPv6NeighborSolicitation{
-		TargetAddress: dstIP.AsSlice(),
-		Options: layers.ICMPv6Options{
-			layers.ICMPv6Option{
-				Type: layers.ICMPv6OptSourceAddress,
-				Data: iface.HardwareAddr,
-			},
-		},
+		TypeCode: layers.ICMPv6TypeCode(icmpType) << 8, // typecode should be in first 8 bits of the 16 bit field
 	}
 
 	buf := gopacket.NewSerializeBuffer()
@@ -284,7 +302,7 @@ func sendNSPacket(packetSender packet.PacketSender, iface *netutil.Interface, sr
 	}
 
 	icmp.SetNetworkLayerForChecksum(ip)
-	err := gopacket.SerializeLayers(buf, options, eth, ip, icmp, nd)
+	err := gopacket.SerializeLayers(buf, options, eth, ip, icmp, msg)
 	if err != nil {
 		return err
 	}
@@ -357,6 +375,11 @@ func (s *NDPScanner) getNeighbourAdvertisements(ctx context.Context, startSendCh
 			}
 			hostResults = append(hostResults, result)
 			receivedFrom[srcIP] = struct{}{}
+
+			if s.WithVendorInfo {
+				result.Vendor = netutil.MACVendor(result.MacAddr.String())
+			}
+			s.stream.writeHost(result)
 		}
 	}
 }
@@ -0,0 +1,297 @@
+package scanner
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// OSGuess is the operating system a host most likely runs going by the packets it answered probes with.
+type OSGuess struct {
+	// Name is the name of the signature that matched best eg Linux 3.x - 6.x.
+	Name string `json:"name"`
+	// Family is the operating system family eg Linux or Windows.
+	Family string `json:"family"`
+	// Class is the kind of device eg general purpose or network device.
+	Class string `json:"class"`
+	// Confidence is how sure the guess is from 1 to 100. Guesses from the TTL alone are never above 20.
+	Confidence int `json:"confidence"`
+	// Hops is the number of routers between the scanner and the host going by how far the TTL of its packets dropped.
+	Hops int `json:"hops"`
+}
+
+func (g *OSGuess) String() string {
+	return fmt.Sprintf("%v (%v%%)", g.Name, g.Confidence)
+}
+
+//go:embed os_signatures.txt
+var osSignaturesFile string
+
+// osSignatures are the signatures os guesses are made from, in order of preference.
+var osSignatures = mustParseOSSignatures(osSignaturesFile)
+
+// initialTTLs are the TTLs and hop limits that systems start their packets with.
+var initialTTLs = []int{32, 64, 128, 255}
+
+// How much each part of a signature adds to the confidence of a guess when a reply matches it.
+const (
+	osWeightTTL     = 20
+	osWeightOptions = 40
+	osWeightWindow  = 25
+	osWeightMSS     = 5
+	osWeightWScale  = 10
+)
+
+// osSignature describes the replies of a system. Empty options and windows and negative numbers match anything.
+type osSignature struct {
+	name    string
+	family  string
+	class   string
+	ttl     int
+	windows []int
+	mss     int
+	options string
+	wscale  int
+}
+
+// osObservation is what a reply tells about the system that sent it.
+type osObservation struct {
+	ttl int
+	// synAck is set for TCP SYN-ACKs, the only replies whose window and options say something about the system.
+	synAck  bool
+	window  int
+	mss     int
+	options string
+	wscale  int
+}
+
+func mustParseOSSignatures(data string) []osSignature {
+	signatures, err := parseOSSignatures(data)
+	if err != nil {
+		panic(err)
+	}
+	return signatures
+}
+
+// parseOSSignatures parses signatures in the format of os_signatures.txt.
+func parseOSSignatures(data string) ([]osSignature, error) {
+	var signatures []osSignature
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if len(fields) != 8 {
+			return nil, fmt.Errorf("os signature on line %v has %v columns instead of 8", i+1, len(fields))
+		}
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+
+		sig := osSignature{name: fields[0], family: fields[1], class: fields[2], mss: -1, wscale: -1}
+		var err error
+		sig.ttl, err = strconv.Atoi(fields[3])
+		if err != nil || !slices.Contains(initialTTLs, sig.ttl) {
+			return nil, fmt.Errorf("invalid ttl %q in os signature on line %v", fields[3], i+1)
+		}
+		if fields[4] != "*" {
+			for _, window := range strings.Split(fields[4], ",") {
+				n, err := strconv.ParseUint(strings.TrimSpace(window), 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("invalid window %q in os signature on line %v", window, i+1)
+				}
+				sig.windows = append(sig.windows, int(n))
+			}
+		}
+		if fields[5] != "*" {
+			n, err := strconv.ParseUint(fields[5], 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid mss %q in os signature on line %v", fields[5], i+1)
+			}
+			sig.mss = int(n)
+		}
+		if fields[6] != "*" {
+			sig.options = fields[6]
+		}
+		if fields[7] != "*" {
+			n, err := strconv.ParseUint(fields[7], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid window scale %q in os signature on line %v", fields[7], i+1)
+			}
+			sig.wscale = int(n)
+		}
+		signatures = append(signatures, sig)
+	}
+	return signatures, nil
+}
+
+// needsSYNAck reports whether the signature describes anything only a SYN-ACK shows.
+func (sig osSignature) needsSYNAck() bool {
+	return len(sig.windows) != 0 || sig.mss >= 0 || sig.options != "" || sig.wscale >= 0
+}
+
+// match returns how much the reply observed confirms the signature or false if it does not match the signature.
+func (sig osSignature) match(obs osObservation) (int, bool) {
+	if initialTTL(obs.ttl) != sig.ttl {
+		return 0, false
+	}
+	score := osWeightTTL
+	if !sig.needsSYNAck() {
+		return score, true
+	}
+	if !obs.synAck {
+		return 0, false
+	}
+
+	if sig.options != "" {
+		if sig.options != obs.options {
+			return 0, false
+		}
+		score += osWeightOptions
+	}
+	if slices.Contains(sig.windows, obs.window) {
+		score += osWeightWindow
+	}
+	if sig.mss >= 0 && sig.mss == obs.mss {
+		score += osWeightMSS
+	}
+	if sig.wscale >= 0 && sig.wscale == obs.wscale {
+		score += osWeightWScale
+	}
+	return score, true
+}
+
+// initialTTL returns the TTL a packet most likely started out with given the TTL it arrived with.
+func initialTTL(ttl int) int {
+	for _, initial := range initialTTLs {
+		if ttl <= initial {
+			return initial
+		}
+	}
+	return initialTTLs[len(initialTTLs)-1]
+}
+
+// guessOS returns the best matching of signatures for the reply observed or nil if none match. The confidence is shared between the
+// families of signatures that match equally well.
+func guessOS(obs osObservation, signatures []osSignature) *OSGuess {
+	var best *osSignature
+	bestScore := 0
+	var families []string
+	for i, sig := range signatures {
+		score, ok := sig.match(obs)
+		if !ok || score < bestScore {
+			continue
+		}
+		if score > bestScore {
+			best, bestScore, families = &signatures[i], score, nil
+		}
+		if !slices.Contains(families, sig.family) {
+			families = append(families, sig.family)
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return &OSGuess{
+		Name:       best.name,
+		Family:     best.family,
+		Class:      best.class,
+		Confidence: max(bestScore/len(families), 1),
+		Hops:       best.ttl - obs.ttl,
+	}
+}
+
+// better reports whether obs tells more about the system than other does.
+func (obs osObservation) better(other osObservation) bool {
+	return obs.synAck && !other.synAck
+}
+
+// observeTCP returns what a TCP reply in packet tells about the system that sent it.
+func observeTCP(packet gopacket.Packet, tcp *layers.TCP) (osObservation, bool) {
+	obs := osObservation{mss: -1, wscale: -1}
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		obs.ttl = int(ip.TTL)
+	case *layers.IPv6:
+		obs.ttl = int(ip.HopLimit)
+	default:
+		return obs, false
+	}
+	if !tcp.SYN || !tcp.ACK {
+		return obs, true
+	}
+
+	obs.synAck = true
+	obs.window = int(tcp.Window)
+	var layout []string
+	for _, option := range tcp.Options {
+		switch option.OptionType {
+		case layers.TCPOptionKindMSS:
+			layout = append(layout, "M")
+			if len(option.OptionData) == 2 {
+				obs.mss = int(binary.BigEndian.Uint16(option.OptionData))
+			}
+		case layers.TCPOptionKindNop:
+			layout = append(layout, "N")
+		case layers.TCPOptionKindWindowScale:
+			layout = append(layout, "W")
+			if len(option.OptionData) == 1 {
+				obs.wscale = int(option.OptionData[0])
+			}
+		case layers.TCPOptionKindSACKPermitted:
+			layout = append(layout, "S")
+		case layers.TCPOptionKindTimestamps:
+			layout = append(layout, "T")
+		case layers.TCPOptionKindEndList:
+			layout = append(layout, "E")
+		default:
+			layout = append(layout, "?")
+		}
+	}
+	obs.options = strings.Join(layout, ",")
+	return obs, true
+}
+
+// synProbeOptions returns the TCP options sent with syn scan probes. Hosts only put the options offered to them in their SYN-ACKs, so
+// every option that differs between systems is offered.
+func synProbeOptions() []layers.TCPOption {
+	timestamps := binary.BigEndian.AppendUint32(nil, rand.Uint32())
+	timestamps = binary.BigEndian.AppendUint32(timestamps, 0)
+	return []layers.TCPOption{
+		{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}},
+		{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
+		{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: timestamps},
+		{OptionType: layers.TCPOptionKindNop, OptionLength: 1},
+		{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+	}
+}
+
+// osGuessString returns the guess as shown in tables or an empty string if there is none.
+func osGuessString(guess *OSGuess) string {
+	if guess == nil {
+		return ""
+	}
+	return guess.String()
+}
+
+func osName(guess *OSGuess) string {
+	if guess == nil {
+		return ""
+	}
+	return guess.Name
+}
+
+func osConfidence(guess *OSGuess) string {
+	if guess == nil {
+		return ""
+	}
+	return strconv.Itoa(guess.Confidence)
+}
@@ -0,0 +1,144 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tcpReply builds the ethernet frame of a TCP reply that arrived with the given TTL.
+func tcpReply(t *testing.T, ttl uint8, tcp *layers.TCP) gopacket.Packet {
+	t.Helper()
+
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: ttl, Protocol: layers.IPProtocolTCP, SrcIP: []byte{10, 1, 1, 1}, DstIP: []byte{10, 1, 1, 2}}
+	tcp.SrcPort, tcp.DstPort = 22, 50000
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&layers.Ethernet{SrcMAC: []byte{0, 1, 2, 3, 4, 5}, DstMAC: []byte{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4},
+		ip, tcp,
+	))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+// tcpOptions returns TCP options laid out as in os_signatures.txt with an mss of 1460 and a window scale of wscale.
+func tcpOptions(layout string, wscale byte) []layers.TCPOption {
+	var options []layers.TCPOption
+	for _, kind := range layout {
+		switch kind {
+		case 'M':
+			options = append(options, layers.TCPOption{OptionType: layers.TCPOptionKindMSS, OptionData: []byte{0x05, 0xb4}})
+		case 'N':
+			options = append(options, layers.TCPOption{OptionType: layers.TCPOptionKindNop})
+		case 'W':
+			options = append(options, layers.TCPOption{OptionType: layers.TCPOptionKindWindowScale, OptionData: []byte{wscale}})
+		case 'S':
+			options = append(options, layers.TCPOption{OptionType: layers.TCPOptionKindSACKPermitted})
+		case 'T':
+			options = append(options, layers.TCPOption{OptionType: layers.TCPOptionKindTimestamps, OptionData: make([]byte, 8)})
+		case 'E':
+			options = append(options, layers.TCPOption{OptionType: layers.TCPOptionKindEndList})
+		}
+	}
+	return options
+}
+
+func TestGuessOS(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      uint8
+		tcp      *layers.TCP
+		expected *OSGuess
+	}{
+		{
+			name:     "linux syn-ack one hop away",
+			ttl:      63,
+			tcp:      &layers.TCP{SYN: true, ACK: true, Window: 65160, Options: tcpOptions("MSTNW", 7)},
+			expected: &OSGuess{Name: "Linux 3.x - 6.x", Family: "Linux", Class: "general purpose", Confidence: 85, Hops: 1},
+		},
+		{
+			name:     "windows 10 syn-ack",
+			ttl:      128,
+			tcp:      &layers.TCP{SYN: true, ACK: true, Window: 65535, Options: tcpOptions("MNWNNS", 8)},
+			expected: &OSGuess{Name: "Windows 10, 11 or Server 2016+", Family: "Windows", Class: "general purpose", Confidence: 95},
+		},
+		{
+			name:     "freebsd syn-ack",
+			ttl:      64,
+			tcp:      &layers.TCP{SYN: true, ACK: true, Window: 65535, Options: tcpOptions("MNWST", 6)},
+			expected: &OSGuess{Name: "FreeBSD", Family: "FreeBSD", Class: "general purpose", Confidence: 95},
+		},
+		{
+			name:     "macos syn-ack with unknown window",
+			ttl:      64,
+			tcp:      &layers.TCP{SYN: true, ACK: true, Window: 1024, Options: tcpOptions("MNWNNTSE", 6)},
+			expected: &OSGuess{Name: "macOS or iOS", Family: "macOS", Class: "general purpose", Confidence: 60},
+		},
+		{
+			name:     "cisco syn-ack",
+			ttl:      253,
+			tcp:      &layers.TCP{SYN: true, ACK: true, Window: 4128, Options: tcpOptions("M", 0)},
+			expected: &OSGuess{Name: "Cisco IOS", Family: "IOS", Class: "network device", Confidence: 85, Hops: 2},
+		},
+		{
+			name:     "unknown option layout falls back to the ttl",
+			ttl:      64,
+			tcp:      &layers.TCP{SYN: true, ACK: true, Window: 512, Options: tcpOptions("M", 0)},
+			expected: &OSGuess{Name: "Linux or Unix", Family: "Unix", Class: "general purpose", Confidence: 20},
+		},
+		{
+			name:     "rst only shows the ttl",
+			ttl:      124,
+			tcp:      &layers.TCP{RST: true, ACK: true},
+			expected: &OSGuess{Name: "Windows", Family: "Windows", Class: "general purpose", Confidence: 20, Hops: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := tcpReply(t, tt.ttl, tt.tcp)
+			obs, ok := observeTCP(packet, packet.Layer(layers.LayerTypeTCP).(*layers.TCP))
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, guessOS(obs, osSignatures))
+		})
+	}
+}
+
+func TestGuessOSFromPing(t *testing.T) {
+	assert.Equal(t, &OSGuess{Name: "Network or embedded device", Family: "Embedded", Class: "network device", Confidence: 20, Hops: 5},
+		guessOS(osObservation{ttl: 250}, osSignatures))
+}
+
+func TestGuessOSSharesConfidenceBetweenFamilies(t *testing.T) {
+	signatures, err := parseOSSignatures(`
+		Linux   | Linux   | general purpose | 64 | * | * | * | *
+		FreeBSD | FreeBSD | general purpose | 64 | * | * | * | *
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, &OSGuess{Name: "Linux", Family: "Linux", Class: "general purpose", Confidence: 10}, guessOS(osObservation{ttl: 64}, signatures))
+	assert.Nil(t, guessOS(osObservation{ttl: 128}, signatures))
+}
+
+func TestParseOSSignaturesErrors(t *testing.T) {
+	for _, data := range []string{
+		"Linux | Linux | general purpose | 64 | * | * | *",
+		"Linux | Linux | general purpose | 60 | * | * | * | *",
+		"Linux | Linux | general purpose | 64 | big | * | * | *",
+		"Linux | Linux | general purpose | 64 | * | * | * | 300",
+	} {
+		_, err := parseOSSignatures(data)
+		assert.Error(t, err, data)
+	}
+}
+
+func TestSynProbeOptions(t *testing.T) {
+	packet := tcpReply(t, 64, &layers.TCP{SYN: true, ACK: true, Window: 64240, Options: synProbeOptions()})
+	obs, ok := observeTCP(packet, packet.Layer(layers.LayerTypeTCP).(*layers.TCP))
+	require.True(t, ok)
+	assert.Equal(t, "M,S,T,N,W", obs.options)
+	assert.Equal(t, 1460, obs.mss)
+	assert.Equal(t, 7, obs.wscale)
+}
@@ -10,9 +10,7 @@ import (
 	"runtime"
 	"slices"
 	"strconv"
-	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/kakeetopius/gscn/internal/netutil"
@@ -25,6 +23,7 @@ type PingScanner struct {
 
 	scanResults PingScanResults
 	resultMap   PingScanResultsMap
+	stream      *resultStream
 }
 
 type PingScanOptions struct {
@@ -37,6 +36,12 @@ type PingScanOptions struct {
 	SortResults         bool
 	ResultMapOnly       bool
 	PrintOnlyUp         bool
+	// Engine is how the hosts are pinged. PingEngineProbing is used when it is empty.
+	Engine PingEngine
+	// DiscoveryOptions are the probes sent to the hosts. Any probes other than echo requests are only sent by the raw engine.
+	DiscoveryOptions
+	// Rate is the number of requests per second the raw engine sends. There is no limit when it is 0.
+	Rate int
 }
 
 type PingScanResults struct {
@@ -53,6 +58,12 @@ type PingHostResult struct {
 	AverageRTT     time.Duration `json:"rtt"`
 	PacketsSent    int
 	PacketReceived int
+	// OS is the operating system the host most likely runs going by the TTL of its replies.
+	OS *OSGuess `json:"os,omitempty"`
+	// MAC and Vendor are the hardware address of hosts on directly connected networks that answered ARP or NDP requests and the
+	// vendor it belongs to.
+	MAC    netutil.MAC `json:"mac,omitempty"`
+	Vendor string      `json:"vendor,omitempty"`
 }
 
 type PingStats struct {
@@ -113,6 +124,10 @@ func (s *PingScanner) Scan(ctx context.Context) (ScanResults, error) {
 	return &s.scanResults, err
 }
 
+func (s *PingScanner) setResultStream(stream *resultStream) {
+	s.stream = stream
+}
+
 func (s *PingScanner) ResultMap() PingScanResultsMap {
 	return s.resultMap
 }
@@ -152,16 +167,48 @@ func (r *PingScanResults) Print() {
 	printPingScanResults(r, r.printUpOnly)
 }
 
-func (r PingScanResults) String() string {
-	stringBuilder := strings.Builder{}
-
-	tmpl := template.Must(template.New("ping_scan_results").Parse(PingScanResultsTemplate))
-	tmpl.Execute(&stringBuilder, r)
+func (r *PingScanResults) table() [][]string {
+	rows := [][]string{{"ip", "hostname", "state", "rtt_ms", "packets_sent", "packets_received", "os", "os_confidence"}}
+	for _, result := range r.HostResults {
+		if result.HostState == HostStateDown && r.printUpOnly {
+			continue
+		}
+		rows = append(rows, []string{
+			result.IP.String(),
+			result.HostName,
+			result.HostState.String(),
+			durationMillis(result.AverageRTT),
+			strconv.Itoa(result.PacketsSent),
+			strconv.Itoa(result.PacketReceived),
+			osName(result.OS),
+			osConfidence(result.OS),
+		})
+	}
+	return rows
+}
 
-	return stringBuilder.String()
+func (r PingScanResults) String() string {
+	return executeResultsTemplate("ping_scan_results", PingScanResultsTemplate, r)
 }
 
 func (s *PingScanner) runPing(ctx context.Context) error {
+	engine := s.Engine
+	if engine == "" {
+		engine = PingEngineProbing
+		if s.needsRawEngine() {
+			engine = PingEngineRaw
+		}
+	}
+	switch engine {
+	case PingEngineRaw:
+		return s.runRawPing(ctx)
+	case PingEngineProbing:
+		if s.needsRawEngine() {
+			return fmt.Errorf("only echo requests can be sent by the %v engine", PingEngineProbing)
+		}
+	default:
+		return fmt.Errorf("unknown ping engine %q", s.Engine)
+	}
 	if s.Workers <= 0 {
 		return fmt.Errorf("invalid number of workers")
 	}
@@ -238,6 +285,9 @@ func pingHost(scanner *PingScanner, wg *sync.WaitGroup, jobs chan PingScanJob, r
 				pingResult.HostState = HostStateUp
 				pingResult.AverageRTT = stats.AvgRtt
 				pingResult.PacketReceived = stats.PacketsRecv
+				if len(stats.TTLs) != 0 {
+					pingResult.OS = guessOS(osObservation{ttl: int(slices.Max(stats.TTLs))}, osSignatures)
+				}
 			}
 		}
 		resultChan <- pingResult
@@ -269,6 +319,10 @@ func (s *PingScanner) getPingScanResults(ctx context.Context, workerResultsChan
 				s.scanResults.UpHosts++
 			}
 			s.resultMap[result.IP] = result
+
+			if result.HostState == HostStateUp || !s.PrintOnlyUp {
+				s.stream.writeHost(result)
+			}
 		}
 	}
 }
@@ -277,7 +331,7 @@ func printPingScanResults(results *PingScanResults, printUpOnly bool) {
 	stats := results.PingStats
 
 	var tableData [][]string
-	tableData = pterm.TableData{{"Host", "State", "Sent", "Recvd", "Average RTT"}}
+	tableData = pterm.TableData{{"Host", "State", "Sent", "Recvd", "Average RTT", "OS Guess"}}
 	totalHosts := stats.TotalHosts
 	for _, result := range results.HostResults {
 		if result.HostState == HostStateDown && printUpOnly {
@@ -304,6 +358,7 @@ func printPingScanResults(results *PingScanResults, printUpOnly bool) {
 			strconv.Itoa(result.PacketsSent),
 			strconv.Itoa(result.PacketReceived),
 			result.AverageRTT.Truncate(time.Microsecond).String(),
+			osGuessString(result.OS),
 		})
 	}
 	if len(tableData) > 1 {
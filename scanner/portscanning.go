@@ -49,3 +49,36 @@ func sendPortScanningJobs(ctx context.Context, jobChan chan PortScanJob, targets
 		}
 	}
 }
+
+// streamUpHosts writes a record for every host that the ping or discovery phase found up. Hosts that are down are only written once the
+// scan is done as they can still answer a probe.
+func streamUpHosts(results HostResults, stream *resultStream) {
+	if stream == nil {
+		return
+	}
+	for _, hostResult := range sortedHostResults(results) {
+		if hostResult.HostState == HostStateUp {
+			stream.writeHostResult(hostResult)
+		}
+	}
+}
+
+// recordPortState records the state of a port on a host that was learnt from a response to a probe and streams the port if its state
+// changed. hostUp is true if the host itself responded, in which case the host is streamed too if it was not up before.
+func recordPortState(results HostResults, stream *resultStream, addr netip.Addr, number PortNumber, state PortState, hostUp bool) {
+	hostResult, found := results[addr]
+	if !found {
+		// response not from our scan
+		return
+	}
+	if hostUp && hostResult.HostState != HostStateUp {
+		hostResult.HostState = HostStateUp
+		stream.writeHostResult(hostResult)
+	}
+
+	port, changed := hostResult.setPortState(number, state)
+	if changed {
+		stream.writePort(addr, port)
+	}
+	results[addr] = hostResult
+}
@@ -0,0 +1,577 @@
+package scanner
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/kakeetopius/gscn/packet"
+	"github.com/pterm/pterm"
+)
+
+// PingEngine is the way a ping scan sends its requests.
+type PingEngine string
+
+const (
+	// PingEngineProbing runs a pinger with its own socket for every host.
+	PingEngineProbing PingEngine = "probing"
+	// PingEngineRaw sends the requests to all hosts from one raw sender and matches the replies caught by one packet receiver.
+	PingEngineRaw PingEngine = "raw"
+)
+
+var PingEngines = []PingEngine{PingEngineProbing, PingEngineRaw}
+
+// PingProbe is a kind of ICMP request sent by the raw ping engine.
+type PingProbe string
+
+const (
+	PingProbeEcho      PingProbe = "echo"
+	PingProbeTimestamp PingProbe = "timestamp"
+	PingProbeMask      PingProbe = "mask"
+
+	// the kinds of the TCP and UDP discovery probes, which are picked with the ports they are sent to.
+	pingProbeSYN PingProbe = "syn"
+	pingProbeACK PingProbe = "ack"
+	pingProbeUDP PingProbe = "udp"
+)
+
+var PingProbes = []PingProbe{PingProbeEcho, PingProbeTimestamp, PingProbeMask}
+
+// DiscoveryOptions are the probes that find out whether a host is up. A host is up if any of them gets a reply, which finds hosts
+// behind firewalls that drop ICMP.
+type DiscoveryOptions struct {
+	// Probes are the kinds of ICMP requests sent to IPv4 hosts. IPv6 hosts get echo requests if there are any. Echo requests are sent
+	// when it is empty and no ports are given.
+	Probes []PingProbe
+	// SYNPorts are the ports TCP SYN probes are sent to. Hosts answer them with a SYN-ACK if the port is open and a RST if it is closed.
+	SYNPorts []PortNumber
+	// ACKPorts are the ports TCP ACK probes are sent to. Hosts answer them with a RST whether the port is open or closed, but stateful
+	// firewalls drop them.
+	ACKPorts []PortNumber
+	// UDPPorts are the ports UDP probes are sent to. Hosts answer them with an ICMP port unreachable message if the port is closed.
+	UDPPorts []PortNumber
+}
+
+// portProbes reports whether any TCP or UDP probes are sent.
+func (o DiscoveryOptions) portProbes() bool {
+	return len(o.SYNPorts)+len(o.ACKPorts)+len(o.UDPPorts) > 0
+}
+
+// needsRawEngine reports whether any of the probes can only be sent by the raw engine.
+func (o DiscoveryOptions) needsRawEngine() bool {
+	return o.portProbes() || slices.ContainsFunc(o.Probes, func(probe PingProbe) bool { return probe != PingProbeEcho })
+}
+
+// probes returns the requests sent to IPv4 and IPv6 hosts in every round.
+func (o DiscoveryOptions) probes() (probes4, probes6 []discoveryProbe, err error) {
+	icmpProbes := o.Probes
+	if len(icmpProbes) == 0 && !o.portProbes() {
+		icmpProbes = []PingProbe{PingProbeEcho}
+	}
+	for _, kind := range icmpProbes {
+		if !slices.Contains(PingProbes, kind) {
+			return nil, nil, fmt.Errorf("unknown ping probe %q", kind)
+		}
+		if !slices.Contains(probes4, discoveryProbe{kind: kind}) {
+			probes4 = append(probes4, discoveryProbe{kind: kind})
+		}
+	}
+	if len(probes4) != 0 {
+		probes6 = append(probes6, discoveryProbe{kind: PingProbeEcho})
+	}
+
+	portProbes := []struct {
+		kind  PingProbe
+		ports []PortNumber
+	}{{pingProbeSYN, o.SYNPorts}, {pingProbeACK, o.ACKPorts}, {pingProbeUDP, o.UDPPorts}}
+	for _, probes := range portProbes {
+		for _, port := range probes.ports {
+			probe := discoveryProbe{kind: probes.kind, port: port}
+			if !slices.Contains(probes4, probe) {
+				probes4 = append(probes4, probe)
+				probes6 = append(probes6, probe)
+			}
+		}
+	}
+	return probes4, probes6, nil
+}
+
+// discoveryProbe is one of the requests sent to a host in every round.
+type discoveryProbe struct {
+	kind PingProbe
+	// port is the port TCP and UDP probes are sent to.
+	port PortNumber
+}
+
+const (
+	// defaultRawPingTimeout is how long the raw engine waits for replies after the last request when no ping timeout is given.
+	defaultRawPingTimeout = time.Second
+	// maxRawPingRequests is the most requests the raw engine sends to one host, which keeps the source ports of the TCP and UDP
+	// probes in the ephemeral range.
+	maxRawPingRequests = 16384
+)
+
+// rawPinger pings all targets of a ping scan from one raw sender. The sequence number of a request is its position among those sent to
+// its host. ICMP requests carry it along with an identifier shared by all requests and TCP and UDP probes are sent from a source port
+// that is that many ports above srcPortBase, so replies are matched by their source address and sequence number.
+type rawPinger struct {
+	*PingScanner
+
+	icmpID      uint16
+	srcPortBase uint16
+	// probes4 and probes6 are the requests sent to IPv4 and IPv6 hosts in every round.
+	probes4, probes6 []discoveryProbe
+	// requests is the most requests sent to one host.
+	requests int
+
+	mu    sync.Mutex
+	hosts map[netip.Addr]*rawPingHost
+
+	ifaceProvider netutil.NetInterfaceProvider
+	router        routing.Router
+	macResolver   resolving.Resolver
+}
+
+// rawPingHost is what the raw engine knows about one host.
+type rawPingHost struct {
+	// sent are the times the requests were sent, indexed by sequence number.
+	sent     []time.Time
+	replied  []bool
+	received int
+	rttTotal time.Duration
+	maxTTL   uint8
+}
+
+type rawPingReply struct {
+	from netip.Addr
+	// probe is the kind of request the reply answers and the port it was sent to.
+	probe discoveryProbe
+	// rst is set for TCP resets, which answer both SYN and ACK probes.
+	rst      bool
+	seq      uint16
+	ttl      uint8
+	received time.Time
+}
+
+// answers reports whether the reply is one that probe can get.
+func (r rawPingReply) answers(probe discoveryProbe) bool {
+	if r.rst {
+		return (probe.kind == pingProbeSYN || probe.kind == pingProbeACK) && probe.port == r.probe.port
+	}
+	return r.probe == probe
+}
+
+func newRawPinger(s *PingScanner) (*rawPinger, error) {
+	probes4, probes6, err := s.DiscoveryOptions.probes()
+	if err != nil {
+		return nil, err
+	}
+	if s.PingCount <= 0 {
+		return nil, fmt.Errorf("ping count should be at least 1")
+	}
+	requests := s.PingCount * len(probes4)
+	if requests > maxRawPingRequests {
+		return nil, fmt.Errorf("too many requests per host, the ping count times the number of probes cannot go above %v", maxRawPingRequests)
+	}
+	if s.Rate < 0 {
+		return nil, fmt.Errorf("rate cannot be negative")
+	}
+
+	ifaceProvider, err := netutil.InterfaceProvider()
+	if err != nil {
+		return nil, err
+	}
+	router, err := routing.NewRouter(ifaceProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawPinger{
+		PingScanner:   s,
+		icmpID:        uint16(rand.UintN(65536)),
+		srcPortBase:   uint16(32768 + rand.IntN(32768-requests+1)),
+		probes4:       probes4,
+		probes6:       probes6,
+		requests:      requests,
+		hosts:         make(map[netip.Addr]*rawPingHost),
+		ifaceProvider: ifaceProvider,
+		router:        router,
+		macResolver:   resolving.NewResolver(ifaceProvider),
+	}, nil
+}
+
+// probesFor returns the requests sent to addr in every round.
+func (p *rawPinger) probesFor(addr netip.Addr) []discoveryProbe {
+	if addr.Is6() {
+		return p.probes6
+	}
+	return p.probes4
+}
+
+// filter returns the BPF filter that catches the replies to the probes.
+func (p *rawPinger) filter() string {
+	filter := "(icmp and (icmp[0] == 0 or icmp[0] == 3 or icmp[0] == 14 or icmp[0] == 18)) or (icmp6 and (icmp6[0] == 1 or icmp6[0] == 129))"
+	if p.portProbes() {
+		filter += fmt.Sprintf(" or ((tcp or udp) and dst portrange %v-%v)", p.srcPortBase, int(p.srcPortBase)+p.requests-1)
+	}
+	return filter
+}
+
+// portSeq returns the sequence number of the TCP or UDP probe sent from port.
+func (p *rawPinger) portSeq(port uint16) (uint16, bool) {
+	if port < p.srcPortBase || int(port-p.srcPortBase) >= p.requests {
+		return 0, false
+	}
+	return port - p.srcPortBase, true
+}
+
+func (s *PingScanner) runRawPing(ctx context.Context) (err error) {
+	pinger, err := newRawPinger(s)
+	if err != nil {
+		return err
+	}
+
+	spinner, err := pterm.DefaultSpinner.Start("Pinging Hosts")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			spinner.Fail("Pinging Failed")
+		} else {
+			spinner.Success("Pinging done")
+		}
+	}()
+
+	allIfaces, err := pinger.ifaceProvider.Interfaces()
+	if err != nil {
+		return err
+	}
+
+	sender, err := newRawSender(ctx, pinger.ifaceProvider, pinger.router, pinger.macResolver)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	packetReceiver, err := packet.NewPacketReceiver(ctx, pinger.filter(), 1500, allIfaces...)
+	if err != nil {
+		return err
+	}
+
+	receiverDone := make(chan struct{})
+	go pinger.getReplies(ctx, packetReceiver, receiverDone)
+
+	err = pinger.sendProbes(ctx, sender)
+	sender.Wait()
+	if err == nil {
+		timeout := s.PingTimeout
+		if timeout == 0 {
+			timeout = defaultRawPingTimeout
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(timeout):
+		}
+	}
+	packetReceiver.Close()
+	<-receiverDone // wait for the replies already caught to be recorded
+	if err != nil {
+		return err
+	}
+
+	hostResults := make(chan PingHostResult, 64)
+	masterDone := make(chan struct{})
+	go s.getPingScanResults(ctx, hostResults, masterDone)
+	for addr := range targetAddrs(s.Targets) {
+		hostResults <- pinger.hostResult(addr)
+	}
+	close(hostResults)
+	<-masterDone
+
+	return nil
+}
+
+// targetAddrs yields every address in targets.
+func targetAddrs(targets []netip.Prefix) iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, target := range targets {
+			for addr := target.Masked().Addr(); target.Contains(addr); addr = addr.Next() {
+				if !yield(addr) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendProbes sends PingCount rounds of requests to all targets, going through every target once per round so the requests to a
+// single host are spread out. Requests are paced to Rate packets per second.
+func (p *rawPinger) sendProbes(ctx context.Context, sender *rawSender) error {
+	var ticker *time.Ticker
+	if p.Rate > 0 {
+		ticker = time.NewTicker(max(time.Second/time.Duration(p.Rate), time.Microsecond))
+		defer ticker.Stop()
+	}
+
+	packetBuf := gopacket.NewSerializeBuffer()
+	for round := range p.PingCount {
+		for addr := range targetAddrs(p.Targets) {
+			probes := p.probesFor(addr)
+			for i, probe := range probes {
+				if ticker != nil {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-ticker.C:
+					}
+				} else if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				seq := uint16(round*len(probes) + i)
+				transport, payload := p.probeLayers(addr, probe, seq)
+				p.recordSent(addr, len(probes), seq)
+				err := sender.sendWithOptions(packetBuf, addr, ipOptions{ttl: defaultTTL}, transport, payload...)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// probeLayers returns the headers and payload of probe with sequence number seq.
+func (p *rawPinger) probeLayers(addr netip.Addr, probe discoveryProbe, seq uint16) (transport gopacket.SerializableLayer, payload []gopacket.SerializableLayer) {
+	switch probe.kind {
+	case pingProbeSYN:
+		return &layers.TCP{SrcPort: layers.TCPPort(p.srcPortBase + seq), DstPort: layers.TCPPort(probe.port), Seq: rand.Uint32(), SYN: true, Window: 1024}, nil
+	case pingProbeACK:
+		return &layers.TCP{SrcPort: layers.TCPPort(p.srcPortBase + seq), DstPort: layers.TCPPort(probe.port), Ack: rand.Uint32(), ACK: true, Window: 1024}, nil
+	case pingProbeUDP:
+		return &layers.UDP{SrcPort: layers.UDPPort(p.srcPortBase + seq), DstPort: layers.UDPPort(probe.port)}, nil
+	}
+
+	if addr.Is6() {
+		transport = &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)}
+		return transport, []gopacket.SerializableLayer{&layers.ICMPv6Echo{Identifier: p.icmpID, SeqNumber: seq}}
+	}
+
+	icmp := &layers.ICMPv4{Id: p.icmpID, Seq: seq}
+	switch probe.kind {
+	case PingProbeTimestamp:
+		icmp.TypeCode = layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimestampRequest, 0)
+		// the originate timestamp in milliseconds since midnight UT followed by the receive and transmit timestamps the host fills in.
+		now := time.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		timestamps := binary.BigEndian.AppendUint32(make([]byte, 0, 12), uint32(now.Sub(midnight).Milliseconds()))
+		payload = append(payload, gopacket.Payload(append(timestamps, make([]byte, 8)...)))
+	case PingProbeMask:
+		icmp.TypeCode = layers.CreateICMPv4TypeCode(layers.ICMPv4TypeAddressMaskRequest, 0)
+		// the address mask the host fills in.
+		payload = append(payload, gopacket.Payload(make([]byte, 4)))
+	default:
+		icmp.TypeCode = layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0)
+	}
+	return icmp, payload
+}
+
+func (p *rawPinger) recordSent(addr netip.Addr, probesPerRound int, seq uint16) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	host := p.hosts[addr]
+	if host == nil {
+		requests := p.PingCount * probesPerRound
+		host = &rawPingHost{sent: make([]time.Time, requests), replied: make([]bool, requests)}
+		p.hosts[addr] = host
+	}
+	host.sent[seq] = time.Now()
+}
+
+func (p *rawPinger) getReplies(ctx context.Context, packetReceiver packet.PacketReceiver, done chan<- struct{}) {
+	packetChan := packetReceiver.Packets()
+
+	defer close(done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet, ok := <-packetChan:
+			if !ok {
+				return
+			}
+			reply, ok := p.matchReply(packet)
+			if !ok {
+				continue
+			}
+			reply.received = packet.Metadata().Timestamp
+			if reply.received.IsZero() {
+				reply.received = time.Now()
+			}
+			p.recordReply(reply)
+		}
+	}
+}
+
+// matchReply returns the reply packet carries. ok is false if packet is not a reply to a request of this scan.
+func (p *rawPinger) matchReply(packet gopacket.Packet) (reply rawPingReply, ok bool) {
+	switch network := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		reply.ttl = network.TTL
+	case *layers.IPv6:
+		reply.ttl = network.HopLimit
+	default:
+		return reply, false
+	}
+	reply.from, ok = netip.AddrFromSlice(packet.NetworkLayer().NetworkFlow().Src().Raw())
+	if !ok {
+		return reply, false
+	}
+	reply.from = reply.from.Unmap()
+
+	if layer := packet.Layer(layers.LayerTypeTCP); layer != nil {
+		tcp := layer.(*layers.TCP)
+		switch {
+		case tcp.RST:
+			reply.rst = true
+		case tcp.SYN && tcp.ACK:
+			reply.probe.kind = pingProbeSYN
+		default:
+			return reply, false
+		}
+		reply.probe.port = PortNumber(tcp.SrcPort)
+		reply.seq, ok = p.portSeq(uint16(tcp.DstPort))
+		return reply, ok
+	}
+	if layer := packet.Layer(layers.LayerTypeUDP); layer != nil {
+		udp := layer.(*layers.UDP)
+		reply.probe = discoveryProbe{kind: pingProbeUDP, port: PortNumber(udp.SrcPort)}
+		reply.seq, ok = p.portSeq(uint16(udp.DstPort))
+		return reply, ok
+	}
+
+	if layer := packet.Layer(layers.LayerTypeICMPv4); layer != nil {
+		icmp := layer.(*layers.ICMPv4)
+		switch icmp.TypeCode.Type() {
+		case layers.ICMPv4TypeEchoReply:
+			reply.probe.kind = PingProbeEcho
+		case layers.ICMPv4TypeTimestampReply:
+			reply.probe.kind = PingProbeTimestamp
+		case layers.ICMPv4TypeAddressMaskReply:
+			reply.probe.kind = PingProbeMask
+		case layers.ICMPv4TypeDestinationUnreachable:
+			if icmp.TypeCode.Code() != layers.ICMPv4CodePort {
+				return reply, false
+			}
+			return p.matchPortUnreachable(reply, icmp.Payload)
+		default:
+			return reply, false
+		}
+		if icmp.Id != p.icmpID {
+			return reply, false
+		}
+		reply.seq = icmp.Seq
+		return reply, true
+	}
+
+	layer := packet.Layer(layers.LayerTypeICMPv6)
+	if layer == nil {
+		return reply, false
+	}
+	icmp := layer.(*layers.ICMPv6)
+	switch icmp.TypeCode.Type() {
+	case layers.ICMPv6TypeEchoReply:
+		echoLayer := packet.Layer(layers.LayerTypeICMPv6Echo)
+		if echoLayer == nil || echoLayer.(*layers.ICMPv6Echo).Identifier != p.icmpID {
+			return reply, false
+		}
+		reply.probe.kind, reply.seq = PingProbeEcho, echoLayer.(*layers.ICMPv6Echo).SeqNumber
+		return reply, true
+	case layers.ICMPv6TypeDestinationUnreachable:
+		if icmp.TypeCode.Code() != layers.ICMPv6CodePortUnreachable {
+			return reply, false
+		}
+		quoted, ok := icmpv6QuotedPacket(icmp)
+		if !ok {
+			return reply, false
+		}
+		return p.matchPortUnreachable(reply, quoted)
+	}
+	return reply, false
+}
+
+// matchPortUnreachable returns the reply to the UDP probe quoted by a port unreachable message, which hosts send back for probes to
+// closed ports. Messages about packets to other hosts come from routers and do not show the host is up.
+func (p *rawPinger) matchPortUnreachable(reply rawPingReply, quoted []byte) (rawPingReply, bool) {
+	original, ok := parseQuotedHeaders(quoted)
+	if !ok || original.dst != reply.from || original.protocol != layers.IPProtocolUDP {
+		return reply, false
+	}
+	reply.probe = discoveryProbe{kind: pingProbeUDP, port: PortNumber(original.dstPort())}
+	reply.seq, ok = p.portSeq(original.srcPort())
+	return reply, ok
+}
+
+// recordReply adds reply to the host it came from. Replies to requests that were never sent, of the wrong kind or that were already
+// answered are dropped.
+func (p *rawPinger) recordReply(reply rawPingReply) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	host := p.hosts[reply.from]
+	if host == nil || int(reply.seq) >= len(host.sent) || host.replied[reply.seq] || host.sent[reply.seq].IsZero() {
+		return
+	}
+	probes := p.probesFor(reply.from)
+	if !reply.answers(probes[int(reply.seq)%len(probes)]) {
+		return
+	}
+
+	host.replied[reply.seq] = true
+	host.received++
+	host.rttTotal += max(reply.received.Sub(host.sent[reply.seq]), 0)
+	host.maxTTL = max(host.maxTTL, reply.ttl)
+}
+
+// hostResult returns the result of pinging addr.
+func (p *rawPinger) hostResult(addr netip.Addr) PingHostResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := PingHostResult{
+		IP:        addr,
+		HostName:  p.HostNames[addr],
+		HostState: HostStateDown,
+	}
+	host := p.hosts[addr]
+	if host == nil {
+		return result
+	}
+	for _, sent := range host.sent {
+		if !sent.IsZero() {
+			result.PacketsSent++
+		}
+	}
+	if host.received > 0 {
+		result.HostState = HostStateUp
+		result.PacketReceived = host.received
+		result.AverageRTT = host.rttTotal / time.Duration(host.received)
+		result.OS = guessOS(osObservation{ttl: int(host.maxTTL)}, osSignatures)
+	}
+	return result
+}
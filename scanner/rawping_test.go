@@ -0,0 +1,396 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRawPinger(t *testing.T, count int, opts DiscoveryOptions) *rawPinger {
+	t.Helper()
+
+	probes4, probes6, err := opts.probes()
+	require.NoError(t, err)
+	return &rawPinger{
+		PingScanner: NewPingScanner(PingScanOptions{PingCount: count, DiscoveryOptions: opts}),
+		icmpID:      0x1234,
+		srcPortBase: 50000,
+		probes4:     probes4,
+		probes6:     probes6,
+		requests:    count * len(probes4),
+		hosts:       make(map[netip.Addr]*rawPingHost),
+	}
+}
+
+func TestDiscoveryOptionsProbes(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    DiscoveryOptions
+		probes4 []discoveryProbe
+		probes6 []discoveryProbe
+		raw     bool
+		wantErr bool
+	}{
+		{
+			name:    "echo by default",
+			probes4: []discoveryProbe{{kind: PingProbeEcho}},
+			probes6: []discoveryProbe{{kind: PingProbeEcho}},
+		},
+		{
+			name:    "ipv6 hosts get echo requests for other icmp probes",
+			opts:    DiscoveryOptions{Probes: []PingProbe{PingProbeTimestamp, PingProbeMask, PingProbeTimestamp}},
+			probes4: []discoveryProbe{{kind: PingProbeTimestamp}, {kind: PingProbeMask}},
+			probes6: []discoveryProbe{{kind: PingProbeEcho}},
+			raw:     true,
+		},
+		{
+			name:    "ports without icmp",
+			opts:    DiscoveryOptions{SYNPorts: []PortNumber{443, 80}, ACKPorts: []PortNumber{80}, UDPPorts: []PortNumber{53}},
+			probes4: []discoveryProbe{{pingProbeSYN, 443}, {pingProbeSYN, 80}, {pingProbeACK, 80}, {pingProbeUDP, 53}},
+			probes6: []discoveryProbe{{pingProbeSYN, 443}, {pingProbeSYN, 80}, {pingProbeACK, 80}, {pingProbeUDP, 53}},
+			raw:     true,
+		},
+		{
+			name:    "icmp and ports",
+			opts:    DiscoveryOptions{Probes: []PingProbe{PingProbeEcho}, SYNPorts: []PortNumber{445}},
+			probes4: []discoveryProbe{{kind: PingProbeEcho}, {pingProbeSYN, 445}},
+			probes6: []discoveryProbe{{kind: PingProbeEcho}, {pingProbeSYN, 445}},
+			raw:     true,
+		},
+		{
+			name:    "unknown probe",
+			opts:    DiscoveryOptions{Probes: []PingProbe{"info"}},
+			raw:     true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.raw, tt.opts.needsRawEngine())
+			probes4, probes6, err := tt.opts.probes()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.probes4, probes4)
+			assert.Equal(t, tt.probes6, probes6)
+		})
+	}
+}
+
+func TestRawPingerProbeLayers(t *testing.T) {
+	local4 := netip.MustParseAddr("10.0.0.2")
+	target4 := netip.MustParseAddr("10.0.0.10")
+	local6 := netip.MustParseAddr("2001:db8::2")
+	target6 := netip.MustParseAddr("2001:db8::10")
+	pinger := testRawPinger(t, 1, DiscoveryOptions{})
+
+	tests := []struct {
+		name   string
+		target netip.Addr
+		probe  discoveryProbe
+		length int
+		check  func(t *testing.T, packet gopacket.Packet)
+	}{
+		{
+			name: "echo", target: target4, probe: discoveryProbe{kind: PingProbeEcho}, length: 28,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				icmp := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+				assert.Equal(t, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), icmp.TypeCode)
+				assert.Equal(t, uint16(0x1234), icmp.Id)
+				assert.Equal(t, uint16(7), icmp.Seq)
+			},
+		},
+		{
+			name: "timestamp", target: target4, probe: discoveryProbe{kind: PingProbeTimestamp}, length: 40,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				icmp := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+				assert.Equal(t, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimestampRequest, 0), icmp.TypeCode)
+				assert.Equal(t, uint16(7), icmp.Seq)
+			},
+		},
+		{
+			name: "address mask", target: target4, probe: discoveryProbe{kind: PingProbeMask}, length: 32,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				icmp := packet.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4)
+				assert.Equal(t, layers.CreateICMPv4TypeCode(layers.ICMPv4TypeAddressMaskRequest, 0), icmp.TypeCode)
+				assert.Equal(t, uint16(7), icmp.Seq)
+			},
+		},
+		{
+			name: "ipv6 echo", target: target6, probe: discoveryProbe{kind: PingProbeEcho}, length: 48,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				echo := packet.Layer(layers.LayerTypeICMPv6Echo).(*layers.ICMPv6Echo)
+				assert.Equal(t, uint16(0x1234), echo.Identifier)
+				assert.Equal(t, uint16(7), echo.SeqNumber)
+			},
+		},
+		{
+			name: "syn", target: target4, probe: discoveryProbe{pingProbeSYN, 443}, length: 40,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+				assert.True(t, tcp.SYN)
+				assert.False(t, tcp.ACK)
+				assert.Equal(t, layers.TCPPort(50007), tcp.SrcPort)
+				assert.Equal(t, layers.TCPPort(443), tcp.DstPort)
+			},
+		},
+		{
+			name: "ipv6 ack", target: target6, probe: discoveryProbe{pingProbeACK, 80}, length: 60,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+				assert.True(t, tcp.ACK)
+				assert.False(t, tcp.SYN)
+				assert.Equal(t, layers.TCPPort(50007), tcp.SrcPort)
+				assert.Equal(t, layers.TCPPort(80), tcp.DstPort)
+			},
+		},
+		{
+			name: "udp", target: target4, probe: discoveryProbe{pingProbeUDP, 53}, length: 28,
+			check: func(t *testing.T, packet gopacket.Packet) {
+				udp := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+				assert.Equal(t, layers.UDPPort(50007), udp.SrcPort)
+				assert.Equal(t, layers.UDPPort(53), udp.DstPort)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, firstLayer := local4, layers.LayerTypeIPv4
+			if tt.target.Is6() {
+				local, firstLayer = local6, layers.LayerTypeIPv6
+			}
+			transport, payload := pinger.probeLayers(tt.target, tt.probe, 7)
+			data := serializeTraceLayers(t, local, tt.target, transport, payload...)
+			assert.Len(t, data, tt.length)
+			tt.check(t, gopacket.NewPacket(data, firstLayer, gopacket.Default))
+		})
+	}
+}
+
+func TestRawPingerMatchReply(t *testing.T) {
+	local4 := netip.MustParseAddr("10.0.0.2")
+	router4 := netip.MustParseAddr("10.0.0.1")
+	target4 := netip.MustParseAddr("10.0.0.10")
+	local6 := netip.MustParseAddr("2001:db8::2")
+	target6 := netip.MustParseAddr("2001:db8::10")
+	pinger := testRawPinger(t, 2, DiscoveryOptions{Probes: []PingProbe{PingProbeEcho}, SYNPorts: []PortNumber{443}, UDPPorts: []PortNumber{53}})
+
+	icmp4 := func(icmpType uint8, id, seq uint16) *layers.ICMPv4 {
+		return &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(icmpType, 0), Id: id, Seq: seq}
+	}
+	// portUnreachable builds the port unreachable message that from sends back for the UDP probe with sequence number seq.
+	portUnreachable := func(from, local netip.Addr, seq uint16) gopacket.Packet {
+		transport, payload := pinger.probeLayers(target4, discoveryProbe{pingProbeUDP, 53}, seq)
+		if local.Is6() {
+			transport, payload = pinger.probeLayers(target6, discoveryProbe{pingProbeUDP, 53}, seq)
+			original := serializeTraceLayers(t, local, target6, transport, payload...)
+			return tracePacket(t, from, local, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeDestinationUnreachable, layers.ICMPv6CodePortUnreachable)},
+				gopacket.Payload(append(make([]byte, 4), original...)))
+		}
+		original := serializeTraceLayers(t, local, target4, transport, payload...)
+		return tracePacket(t, from, local, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodePort)},
+			gopacket.Payload(original))
+	}
+
+	tests := []struct {
+		name   string
+		packet gopacket.Packet
+		reply  rawPingReply
+		ok     bool
+	}{
+		{
+			name:   "echo reply",
+			packet: tracePacket(t, target4, local4, icmp4(layers.ICMPv4TypeEchoReply, 0x1234, 2)),
+			reply:  rawPingReply{from: target4, probe: discoveryProbe{kind: PingProbeEcho}, seq: 2, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "timestamp reply",
+			packet: tracePacket(t, target4, local4, icmp4(layers.ICMPv4TypeTimestampReply, 0x1234, 3), gopacket.Payload(make([]byte, 12))),
+			reply:  rawPingReply{from: target4, probe: discoveryProbe{kind: PingProbeTimestamp}, seq: 3, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "address mask reply",
+			packet: tracePacket(t, target4, local4, icmp4(layers.ICMPv4TypeAddressMaskReply, 0x1234, 4), gopacket.Payload([]byte{255, 255, 255, 0})),
+			reply:  rawPingReply{from: target4, probe: discoveryProbe{kind: PingProbeMask}, seq: 4, ttl: 1},
+			ok:     true,
+		},
+		{
+			name: "ipv6 echo reply",
+			packet: tracePacket(t, target6, local6, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0)},
+				&layers.ICMPv6Echo{Identifier: 0x1234, SeqNumber: 5}),
+			reply: rawPingReply{from: target6, probe: discoveryProbe{kind: PingProbeEcho}, seq: 5, ttl: 1},
+			ok:    true,
+		},
+		{
+			name:   "syn-ack",
+			packet: tracePacket(t, target4, local4, &layers.TCP{SrcPort: 443, DstPort: 50001, SYN: true, ACK: true}),
+			reply:  rawPingReply{from: target4, probe: discoveryProbe{pingProbeSYN, 443}, seq: 1, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "rst",
+			packet: tracePacket(t, target6, local6, &layers.TCP{SrcPort: 443, DstPort: 50004, RST: true, ACK: true}),
+			reply:  rawPingReply{from: target6, probe: discoveryProbe{port: 443}, rst: true, seq: 4, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "udp reply",
+			packet: tracePacket(t, target4, local4, &layers.UDP{SrcPort: 53, DstPort: 50002}, gopacket.Payload("dns")),
+			reply:  rawPingReply{from: target4, probe: discoveryProbe{pingProbeUDP, 53}, seq: 2, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "port unreachable",
+			packet: portUnreachable(target4, local4, 5),
+			reply:  rawPingReply{from: target4, probe: discoveryProbe{pingProbeUDP, 53}, seq: 5, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 port unreachable",
+			packet: portUnreachable(target6, local6, 2),
+			reply:  rawPingReply{from: target6, probe: discoveryProbe{pingProbeUDP, 53}, seq: 2, ttl: 1},
+			ok:     true,
+		},
+		{
+			name:   "port unreachable from a router",
+			packet: portUnreachable(router4, local4, 5),
+		},
+		{
+			name:   "tcp to a port no probe was sent from",
+			packet: tracePacket(t, target4, local4, &layers.TCP{SrcPort: 443, DstPort: 50006, SYN: true, ACK: true}),
+		},
+		{
+			name:   "tcp without syn or rst",
+			packet: tracePacket(t, target4, local4, &layers.TCP{SrcPort: 443, DstPort: 50001, ACK: true}),
+		},
+		{
+			name:   "reply with another identifier",
+			packet: tracePacket(t, target4, local4, icmp4(layers.ICMPv4TypeEchoReply, 0x4321, 2)),
+		},
+		{
+			name: "ipv6 reply with another identifier",
+			packet: tracePacket(t, target6, local6, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0)},
+				&layers.ICMPv6Echo{Identifier: 0x4321, SeqNumber: 5}),
+		},
+		{
+			name:   "echo request",
+			packet: tracePacket(t, target4, local4, icmp4(layers.ICMPv4TypeEchoRequest, 0x1234, 2)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply, ok := pinger.matchReply(tt.packet)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.reply, reply)
+			}
+		})
+	}
+}
+
+func TestRawPingerRecordReply(t *testing.T) {
+	target4 := netip.MustParseAddr("10.0.0.10")
+	target6 := netip.MustParseAddr("2001:db8::10")
+	sent := time.Now()
+
+	echo := discoveryProbe{kind: PingProbeEcho}
+	timestamp := discoveryProbe{kind: PingProbeTimestamp}
+	syn := discoveryProbe{pingProbeSYN, 443}
+
+	tests := []struct {
+		name     string
+		target   netip.Addr
+		replies  []rawPingReply
+		state    HostState
+		received int
+		rtt      time.Duration
+	}{
+		{
+			name:   "no replies",
+			target: target4,
+			state:  HostStateDown,
+		},
+		{
+			name:   "replies to several kinds of requests",
+			target: target4,
+			replies: []rawPingReply{
+				{probe: echo, seq: 0, ttl: 64, received: sent.Add(10 * time.Millisecond)},
+				{probe: timestamp, seq: 1, ttl: 64, received: sent.Add(20 * time.Millisecond)},
+				{probe: syn, seq: 5, ttl: 64, received: sent.Add(30 * time.Millisecond)},
+			},
+			state:    HostStateUp,
+			received: 3,
+			rtt:      20 * time.Millisecond,
+		},
+		{
+			name:   "only tcp probes answered",
+			target: target4,
+			replies: []rawPingReply{
+				{probe: discoveryProbe{port: 443}, rst: true, seq: 2, ttl: 128, received: sent.Add(5 * time.Millisecond)},
+			},
+			state:    HostStateUp,
+			received: 1,
+			rtt:      5 * time.Millisecond,
+		},
+		{
+			name:   "duplicate, mismatched and unknown replies are dropped",
+			target: target4,
+			replies: []rawPingReply{
+				{probe: echo, seq: 0, ttl: 64, received: sent.Add(10 * time.Millisecond)},
+				{probe: echo, seq: 0, ttl: 64, received: sent.Add(50 * time.Millisecond)},
+				{probe: echo, seq: 1, ttl: 64, received: sent.Add(50 * time.Millisecond)},
+				{probe: echo, seq: 9, ttl: 64, received: sent.Add(50 * time.Millisecond)},
+				{probe: discoveryProbe{port: 80}, rst: true, seq: 2, ttl: 64, received: sent.Add(50 * time.Millisecond)},
+			},
+			state:    HostStateUp,
+			received: 1,
+			rtt:      10 * time.Millisecond,
+		},
+		{
+			name:   "ipv6 host",
+			target: target6,
+			replies: []rawPingReply{
+				{probe: echo, seq: 2, ttl: 64, received: sent.Add(8 * time.Millisecond)},
+				{probe: syn, seq: 3, ttl: 64, received: sent.Add(8 * time.Millisecond)},
+			},
+			state:    HostStateUp,
+			received: 2,
+			rtt:      8 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinger := testRawPinger(t, 2, DiscoveryOptions{Probes: []PingProbe{PingProbeEcho, PingProbeTimestamp}, SYNPorts: []PortNumber{443}})
+			probes := pinger.probesFor(tt.target)
+			for seq := range 2 * len(probes) {
+				pinger.recordSent(tt.target, len(probes), uint16(seq))
+				pinger.hosts[tt.target].sent[seq] = sent
+			}
+			for _, reply := range tt.replies {
+				reply.from = tt.target
+				pinger.recordReply(reply)
+			}
+
+			result := pinger.hostResult(tt.target)
+			assert.Equal(t, tt.target, result.IP)
+			assert.Equal(t, tt.state, result.HostState)
+			assert.Equal(t, 2*len(probes), result.PacketsSent)
+			assert.Equal(t, tt.received, result.PacketReceived)
+			assert.Equal(t, tt.rtt, result.AverageRTT)
+			assert.Equal(t, tt.state == HostStateUp, result.OS != nil)
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"runtime"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/kakeetopius/gscn/packet"
+)
+
+// transportLayer is a transport layer like TCP, UDP or ICMPv6 whose checksum covers the IP header it is sent with.
+type transportLayer interface {
+	gopacket.SerializableLayer
+	SetNetworkLayerForChecksum(l gopacket.NetworkLayer) error
+}
+
+// rawSender sends probes built from raw packets to any host. The packet sender, interface and link layer headers used are picked from
+// the route to the host.
+type rawSender struct {
+	packetSender packet.PacketSender
+	// localhostPacketSender is necessary coz if packets heading to localhost or any ip on any of the device's interfaces are injected
+	// directly at the datalink, they never reache localhost, so they have to be injected at the ip layer. but the ip layer packet
+	// injector only works on linux, so for the other OSes there is no solution yet
+	localhostPacketSender packet.PacketSender
+
+	ifaceProvider netutil.NetInterfaceProvider
+	router        routing.Router
+	macResolver   resolving.Resolver
+}
+
+func newRawSender(ctx context.Context, ifaceProvider netutil.NetInterfaceProvider, router routing.Router, macResolver resolving.Resolver) (*rawSender, error) {
+	s := &rawSender{
+		ifaceProvider: ifaceProvider,
+		router:        router,
+		macResolver:   macResolver,
+	}
+
+	var err error
+	if runtime.GOOS == "linux" {
+		s.packetSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypeLinkLayer)
+		if err != nil {
+			return nil, err
+		}
+		s.localhostPacketSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypeIPLayer)
+		if err != nil {
+			s.packetSender.Close()
+			return nil, err
+		}
+	} else {
+		s.packetSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypePcap)
+		if err != nil {
+			return nil, err
+		}
+		s.localhostPacketSender = s.packetSender
+	}
+
+	return s, nil
+}
+
+// Wait waits for all packets that were queued to be sent.
+func (s *rawSender) Wait() {
+	s.packetSender.Wait()
+	if s.localhostPacketSender != s.packetSender {
+		s.localhostPacketSender.Wait()
+	}
+}
+
+func (s *rawSender) Close() error {
+	err := s.packetSender.Close()
+	if s.localhostPacketSender != s.packetSender {
+		err = errors.Join(err, s.localhostPacketSender.Close())
+	}
+	return err
+}
+
+// defaultTTL is the TTL and hop limit of the packets built by send.
+const defaultTTL = 64
+
+// ipOptions are the fields of the IP header of a packet that can be set with sendWithOptions.
+type ipOptions struct {
+	// ttl is the TTL or hop limit.
+	ttl uint8
+	// dontFragment sets the don't fragment flag of IPv4 packets. Routers never fragment IPv6 packets.
+	dontFragment bool
+}
+
+// send sends transport and the layers after it to addr. buf is reused for building the packet so every worker should have its own.
+func (s *rawSender) send(buf gopacket.SerializeBuffer, addr netip.Addr, transport transportLayer, payload ...gopacket.SerializableLayer) error {
+	return s.sendWithOptions(buf, addr, ipOptions{ttl: defaultTTL}, transport, payload...)
+}
+
+// sendWithOptions is like send but the IP header is built with opts. transport can also be an ICMP or ICMPv6 layer.
+func (s *rawSender) sendWithOptions(buf gopacket.SerializeBuffer, addr netip.Addr, opts ipOptions, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) error {
+	route, err := s.router.Lookup(addr)
+	if err != nil {
+		return err
+	}
+
+	ps := s.packetSender
+	if addr == route.SrcAddr {
+		// if the target addr is the address of the interface, meaning we are sending to ourselves, we use the localhostPacketSender
+		ps = s.localhostPacketSender
+	}
+
+	packetHeaders := make([]gopacket.SerializableLayer, 0, 3+len(payload))
+
+	iface := &route.Interface
+	if ps.Type() != packet.PacketSenderTypeIPLayer {
+		// If the packetSender is of type PacketSenderTypeIPLayer we dont bother with the ethernet header at all
+
+		var dstMac netutil.MAC
+
+		if addr == route.SrcAddr {
+			// if the target is the interface's ip we use the looback interface instead
+			iface, err = netutil.LoopbackInterface(s.ifaceProvider)
+			if err != nil {
+				return err
+			}
+		} else {
+			dstMac, err = s.macResolver.Resolve(route.NextHop)
+			var macErr resolving.ErrMacNotFound
+			if err != nil {
+				if !errors.As(err, &macErr) {
+					return err
+				}
+				// if we fail to get mac we just set to the broadcast.
+				dstMac = netutil.MAC{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+			}
+		}
+		srcMac := netutil.MAC(iface.HardwareAddr)
+		if dstMac == nil {
+			dstMac = zeroMac()
+		}
+		if srcMac == nil {
+			srcMac = zeroMac()
+		}
+
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr(srcMac),
+			DstMAC:       net.HardwareAddr(dstMac),
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		if addr.Is6() {
+			eth.EthernetType = layers.EthernetTypeIPv6
+		}
+
+		packetHeaders = append(packetHeaders, eth)
+	}
+
+	var protocol layers.IPProtocol
+	switch transport.LayerType() {
+	case layers.LayerTypeTCP:
+		protocol = layers.IPProtocolTCP
+	case layers.LayerTypeUDP:
+		protocol = layers.IPProtocolUDP
+	case layers.LayerTypeICMPv4:
+		protocol = layers.IPProtocolICMPv4
+	case layers.LayerTypeICMPv6:
+		protocol = layers.IPProtocolICMPv6
+	default:
+		return fmt.Errorf("unsupported transport layer: %v", transport.LayerType())
+	}
+
+	var ip gopacket.SerializableLayer
+	if addr.Is4() {
+		ip4 := &layers.IPv4{
+			Version:  4,
+			IHL:      5,
+			TTL:      opts.ttl,
+			Protocol: protocol,
+			SrcIP:    route.SrcAddr.AsSlice(),
+			DstIP:    addr.AsSlice(),
+		}
+		if opts.dontFragment {
+			ip4.Flags = layers.IPv4DontFragment
+		}
+		if transport, ok := transport.(transportLayer); ok {
+			transport.SetNetworkLayerForChecksum(ip4)
+		}
+		ip = ip4
+	} else {
+		ip6 := &layers.IPv6{
+			Version:    6,
+			HopLimit:   opts.ttl,
+			NextHeader: protocol,
+			SrcIP:      route.SrcAddr.AsSlice(),
+			DstIP:      addr.AsSlice(),
+		}
+		if transport, ok := transport.(transportLayer); ok {
+			transport.SetNetworkLayerForChecksum(ip6)
+		}
+		ip = ip6
+	}
+
+	packetHeaders = append(packetHeaders, ip, transport)
+	packetHeaders = append(packetHeaders, payload...)
+
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, packetHeaders...)
+	if err != nil {
+		return err
+	}
+
+	// packet senders queue the packet so it must not share buf's memory which is overwritten by the next probe.
+	return ps.SendPacket(bytes.Clone(buf.Bytes()), iface)
+}
+
+// packetSourceAddr returns the source address of an IPv4 or IPv6 packet captured at the link layer.
+func packetSourceAddr(packet gopacket.Packet) (netip.Addr, bool) {
+	ethLayer := packet.Layer(layers.LayerTypeEthernet)
+	if ethLayer == nil {
+		return netip.Addr{}, false
+	}
+	eth := ethLayer.(*layers.Ethernet)
+
+	// Determine IP version from the Ethernet EtherType and extract the source IP.
+	var srcIP net.IP
+	switch eth.EthernetType {
+	case layers.EthernetTypeIPv4:
+		ipLayer := packet.Layer(layers.LayerTypeIPv4)
+		if ipLayer == nil {
+			return netip.Addr{}, false
+		}
+		srcIP = ipLayer.(*layers.IPv4).SrcIP
+	case layers.EthernetTypeIPv6:
+		ipLayer := packet.Layer(layers.LayerTypeIPv6)
+		if ipLayer == nil {
+			return netip.Addr{}, false
+		}
+		srcIP = ipLayer.(*layers.IPv6).SrcIP
+	default:
+		return netip.Addr{}, false
+	}
+
+	return netip.AddrFromSlice(srcIP)
+}
@@ -0,0 +1,566 @@
+package scanner
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/log"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/packet"
+	"github.com/pterm/pterm"
+)
+
+// neighbour discovery options that gopacket has no names for.
+const (
+	ndpOptRDNSS layers.ICMPv6Opt = 25 // Recursive DNS Server option (RFC 8106)
+	ndpOptDNSSL layers.ICMPv6Opt = 31 // DNS Search List option (RFC 8106)
+)
+
+// infiniteLifetime is the lifetime of prefixes and DNS options that never expire.
+const infiniteLifetime = time.Duration(0xffffffff) * time.Second
+
+var (
+	allRoutersIPAddress  = net.ParseIP("ff02::2")
+	allRoutersMACAddress = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x02}
+)
+
+type RouterScanner struct {
+	RouterScanOptions
+	ifaceProvider netutil.NetInterfaceProvider
+	packetSender  packet.PacketSender
+	results       RouterScanResults
+	logger        log.Logger
+
+	mu          sync.Mutex
+	routerIndex map[routerKey]int
+}
+
+type RouterScanOptions struct {
+	Interfaces      []netutil.Interface
+	ResponseTimeout time.Duration
+	WithVendorInfo  bool
+	Verbose         bool
+	Passive         bool
+	ProbeCount      uint
+}
+
+type RouterScanResults struct {
+	Routers []Router        `json:"routers"`
+	Stats   RouterScanStats `json:"stats"`
+
+	printVendors bool `json:"-"`
+}
+
+// Router is an IPv6 router that sent a Router Advertisement on one of the scanned interfaces. When a router sends several
+// advertisements the last one is kept.
+type Router struct {
+	IP             netip.Addr  `json:"ip"`
+	MACAddress     netutil.MAC `json:"mac"`
+	Vendor         string      `json:"vendor"`
+	Interface      string      `json:"interface"`
+	Advertisements int         `json:"advertisements"`
+
+	RouterAdvertisement `json:"advertisement"`
+}
+
+type RouterAdvertisement struct {
+	// Lifetime is how long the router may be used as a default router. A lifetime of 0 means it is not a default router.
+	Lifetime time.Duration `json:"lifetime"`
+	// Managed is the M flag telling hosts to get addresses with DHCPv6.
+	Managed bool `json:"managed"`
+	// OtherConfig is the O flag telling hosts to get other configuration such as DNS servers with DHCPv6.
+	OtherConfig bool           `json:"other_config"`
+	HopLimit    uint8          `json:"hop_limit"`
+	MTU         uint32         `json:"mtu"`
+	Prefixes    []RouterPrefix `json:"prefixes"`
+	RDNSS       []RDNSSOption  `json:"rdnss"`
+	DNSSL       []DNSSLOption  `json:"dnssl"`
+}
+
+type RouterPrefix struct {
+	Prefix            netip.Prefix  `json:"prefix"`
+	ValidLifetime     time.Duration `json:"valid_lifetime"`
+	PreferredLifetime time.Duration `json:"preferred_lifetime"`
+	OnLink            bool          `json:"on_link"`
+	// Autonomous is the A flag allowing hosts to configure their own addresses in the prefix with SLAAC.
+	Autonomous bool `json:"autonomous"`
+}
+
+type RDNSSOption struct {
+	Servers  []netip.Addr  `json:"servers"`
+	Lifetime time.Duration `json:"lifetime"`
+}
+
+type DNSSLOption struct {
+	Domains  []string      `json:"domains"`
+	Lifetime time.Duration `json:"lifetime"`
+}
+
+type RouterScanStats struct {
+	PacketsSent     int           `json:"packets_sent"`
+	PacketsReceived int           `json:"packets_received"`
+	ScanDuration    time.Duration `json:"scan_duration"`
+}
+
+// routerKey identifies a router by the interface its advertisements arrive on and its address. The mac address is part of the key so
+// that a rogue router sending advertisements from the address of a real router is recorded as a router of its own.
+type routerKey struct {
+	iface string
+	ip    netip.Addr
+	mac   string
+}
+
+func NewRouterScanner(opts RouterScanOptions) (*RouterScanner, error) {
+	ifaceProvider, err := netutil.InterfaceProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RouterScanner{
+		RouterScanOptions: opts,
+		logger:            log.NewLogger(opts.Verbose),
+		ifaceProvider:     ifaceProvider,
+		routerIndex:       make(map[routerKey]int),
+	}, nil
+}
+
+func (s *RouterScanner) Scan(ctx context.Context) (ScanResults, error) {
+	var err error
+	var packetSender packet.PacketSender
+	if runtime.GOOS == "linux" {
+		packetSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypeLinkLayer)
+	} else {
+		packetSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypePcap)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer packetSender.Close()
+	s.packetSender = packetSender
+
+	start := time.Now()
+	err = s.runRouterDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.results.Stats.ScanDuration = time.Since(start)
+
+	s.addResultInfo()
+	return &s.results, nil
+}
+
+func (r *RouterScanResults) Print() {
+	displayRouterResults(r, r.printVendors)
+}
+
+func (r *RouterScanResults) table() [][]string {
+	rows := [][]string{{
+		"ip", "mac", "vendor", "interface", "lifetime_s", "managed", "other_config", "hop_limit", "mtu", "prefixes", "dns_servers", "dns_search", "advertisements",
+	}}
+	for _, router := range r.Routers {
+		rows = append(rows, []string{
+			router.IP.String(),
+			router.MACAddress.String(),
+			router.Vendor,
+			router.Interface,
+			strconv.Itoa(int(router.Lifetime.Seconds())),
+			strconv.FormatBool(router.Managed),
+			strconv.FormatBool(router.OtherConfig),
+			strconv.Itoa(int(router.HopLimit)),
+			strconv.Itoa(int(router.MTU)),
+			router.prefixList(),
+			joinAddrs(router.DNSServers()),
+			strings.Join(router.DNSSearchList(), ", "),
+			strconv.Itoa(router.Advertisements),
+		})
+	}
+	return rows
+}
+
+func (r *RouterScanResults) String() string {
+	return executeResultsTemplate("router_scan", RouterScanResultsTemplate, r)
+}
+
+// DNSServers returns the DNS servers of all the RDNSS options in the advertisement.
+func (a RouterAdvertisement) DNSServers() []netip.Addr {
+	var servers []netip.Addr
+	for _, option := range a.RDNSS {
+		servers = append(servers, option.Servers...)
+	}
+	return servers
+}
+
+// DNSSearchList returns the domains of all the DNSSL options in the advertisement.
+func (a RouterAdvertisement) DNSSearchList() []string {
+	var domains []string
+	for _, option := range a.DNSSL {
+		domains = append(domains, option.Domains...)
+	}
+	return domains
+}
+
+func (a RouterAdvertisement) prefixList() string {
+	prefixes := make([]string, len(a.Prefixes))
+	for i, prefix := range a.Prefixes {
+		prefixes[i] = prefix.Prefix.String()
+	}
+	return strings.Join(prefixes, ", ")
+}
+
+func (s *RouterScanner) addResultInfo() {
+	s.results.printVendors = s.WithVendorInfo
+
+	for i := range s.results.Routers {
+		if s.WithVendorInfo {
+			s.results.Routers[i].Vendor = netutil.MACVendor(s.results.Routers[i].MACAddress.String())
+		}
+	}
+
+	slices.SortFunc(s.results.Routers, func(a, b Router) int {
+		return cmp.Or(cmp.Compare(a.Interface, b.Interface), a.IP.Compare(b.IP))
+	})
+}
+
+func (s *RouterScanner) runRouterDiscovery(ctx context.Context) error {
+	if len(s.Interfaces) == 0 {
+		ifaces, err := s.ifaceProvider.Interfaces()
+		if err != nil {
+			return err
+		}
+		for _, iface := range ifaces {
+			err := netutil.VerifyInterface(&iface)
+			if err == nil {
+				s.Interfaces = append(s.Interfaces, iface)
+			}
+		}
+	}
+	if len(s.Interfaces) == 0 {
+		return fmt.Errorf("no usable network interfaces to discover routers on")
+	}
+
+	// a receiver per interface so that every advertisement is known to have arrived on the interface it was captured on.
+	receivers := make([]*packet.PcapPacketReceiver, 0, len(s.Interfaces))
+	defer func() {
+		for _, receiver := range receivers {
+			receiver.Close()
+		}
+	}()
+
+	var receiversDone sync.WaitGroup
+	for _, iface := range s.Interfaces {
+		receiver, err := packet.NewPacketReceiver(ctx, "icmp6 and icmp6[0] == 134", 32, iface)
+		if err != nil {
+			return err
+		}
+		receivers = append(receivers, receiver)
+
+		receiversDone.Go(func() {
+			s.getRouterAdvertisements(ctx, iface, receiver)
+		})
+	}
+
+	if !s.Passive {
+		ifaceNames := make([]string, len(s.Interfaces))
+		for i, iface := range s.Interfaces {
+			ifaceNames[i] = iface.Name
+		}
+		s.logger.Info("Sending router solicitations on interface(s): " + strings.Join(ifaceNames, ", "))
+
+		for _, iface := range s.Interfaces {
+			for range s.ProbeCount {
+				err := sendRSPacket(s.packetSender, &iface)
+				if err != nil {
+					return err
+				}
+				s.results.Stats.PacketsSent++
+			}
+		}
+		s.packetSender.Wait()
+	}
+
+	s.logger.WaitTimeout(s.ResponseTimeout, "router advertisements")
+	for _, receiver := range receivers {
+		receiver.Close()
+	}
+	receiversDone.Wait()
+
+	return nil
+}
+
+// sendRSPacket sends a Router Solicitation to all routers on iface. The solicitation is sent from the interface's link-local address
+// or from the unspecified address if it has none, in which case the source link-layer address option must be left out.
+func sendRSPacket(packetSender packet.PacketSender, iface *netutil.Interface) error {
+	srcIP := netip.IPv6Unspecified()
+	for _, prefix := range iface.IP6Addrs() {
+		if prefix.Addr().IsLinkLocalUnicast() {
+			srcIP = prefix.Addr()
+			break
+		}
+	}
+
+	rs := &layers.ICMPv6RouterSolicitation{}
+	if !srcIP.IsUnspecified() {
+		rs.Options = layers.ICMPv6Options{
+			layers.ICMPv6Option{
+				Type: layers.ICMPv6OptSourceAddress,
+				Data: iface.HardwareAddr,
+			},
+		}
+	}
+
+	return sendNDPPacket(packetSender, iface, srcIP, allRoutersIPAddress, allRoutersMACAddress, layers.ICMPv6TypeRouterSolicitation, rs)
+}
+
+func (s *RouterScanner) getRouterAdvertisements(ctx context.Context, iface netutil.Interface, receiver *packet.PcapPacketReceiver) {
+	packetChan := receiver.Packets()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet, ok := <-packetChan:
+			if !ok {
+				return
+			}
+
+			raLayer := packet.Layer(layers.LayerTypeICMPv6RouterAdvertisement)
+			if raLayer == nil {
+				continue
+			}
+			ra := raLayer.(*layers.ICMPv6RouterAdvertisement)
+
+			ip6Layer := packet.Layer(layers.LayerTypeIPv6)
+			if ip6Layer == nil {
+				continue
+			}
+			srcIP, ok := netip.AddrFromSlice(ip6Layer.(*layers.IPv6).SrcIP)
+			if !ok {
+				continue
+			}
+
+			// the ethernet source is where the advertisement really came from even if the advertisement claims otherwise.
+			var macAddr net.HardwareAddr
+			if ethLayer := packet.Layer(layers.LayerTypeEthernet); ethLayer != nil {
+				macAddr = ethLayer.(*layers.Ethernet).SrcMAC
+			} else {
+				macAddr = sourceLinkLayerAddress(ra.Options)
+			}
+
+			s.addRouter(Router{
+				IP:                  srcIP,
+				MACAddress:          netutil.MAC(macAddr),
+				Interface:           iface.Name,
+				RouterAdvertisement: parseRouterAdvertisement(ra),
+			})
+		}
+	}
+}
+
+// addRouter records an advertisement from router, replacing the previous advertisement from the same router on the same interface.
+// Advertisements with the same address but a different mac address are from another router.
+func (s *RouterScanner) addRouter(router Router) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results.Stats.PacketsReceived++
+
+	key := routerKey{iface: router.Interface, ip: router.IP, mac: router.MACAddress.String()}
+	i, seen := s.routerIndex[key]
+	if !seen {
+		router.Advertisements = 1
+		s.routerIndex[key] = len(s.results.Routers)
+		s.results.Routers = append(s.results.Routers, router)
+		return
+	}
+
+	router.Advertisements = s.results.Routers[i].Advertisements + 1
+	s.results.Routers[i] = router
+}
+
+// parseRouterAdvertisement reads the router information and the prefix, MTU, RDNSS and DNSSL options of a Router Advertisement.
+// Options that are too short are ignored.
+func parseRouterAdvertisement(ra *layers.ICMPv6RouterAdvertisement) RouterAdvertisement {
+	advertisement := RouterAdvertisement{
+		Lifetime:    time.Duration(ra.RouterLifetime) * time.Second,
+		Managed:     ra.ManagedAddressConfig(),
+		OtherConfig: ra.OtherConfig(),
+		HopLimit:    ra.HopLimit,
+	}
+
+	for _, option := range ra.Options {
+		data := option.Data
+		switch option.Type {
+		case layers.ICMPv6OptPrefixInfo:
+			// prefix length, flags, valid lifetime, preferred lifetime, 4 reserved bytes and the prefix.
+			if len(data) < 30 {
+				continue
+			}
+			addr := netip.AddrFrom16([16]byte(data[14:30]))
+			prefix, err := addr.Prefix(int(data[0]))
+			if err != nil {
+				continue
+			}
+			advertisement.Prefixes = append(advertisement.Prefixes, RouterPrefix{
+				Prefix:            prefix,
+				ValidLifetime:     durationFromSlice(data[2:6]),
+				PreferredLifetime: durationFromSlice(data[6:10]),
+				OnLink:            data[1]&0x80 != 0,
+				Autonomous:        data[1]&0x40 != 0,
+			})
+		case layers.ICMPv6OptMTU:
+			// 2 reserved bytes and the MTU.
+			if len(data) < 6 {
+				continue
+			}
+			advertisement.MTU = binary.BigEndian.Uint32(data[2:6])
+		case ndpOptRDNSS:
+			// 2 reserved bytes, the lifetime and the addresses of the servers.
+			if len(data) < 6 {
+				continue
+			}
+			option := RDNSSOption{Lifetime: durationFromSlice(data[2:6])}
+			for servers := data[6:]; len(servers) >= 16; servers = servers[16:] {
+				option.Servers = append(option.Servers, netip.AddrFrom16([16]byte(servers[:16])))
+			}
+			advertisement.RDNSS = append(advertisement.RDNSS, option)
+		case ndpOptDNSSL:
+			// 2 reserved bytes, the lifetime and the domain names in DNS wire format padded with zeros.
+			if len(data) < 6 {
+				continue
+			}
+			advertisement.DNSSL = append(advertisement.DNSSL, DNSSLOption{
+				Domains:  decodeDomainNames(data[6:]),
+				Lifetime: durationFromSlice(data[2:6]),
+			})
+		}
+	}
+
+	return advertisement
+}
+
+// decodeDomainNames decodes a sequence of uncompressed domain names in DNS wire format. Names that run past the end of data are dropped.
+func decodeDomainNames(data []byte) []string {
+	var domains []string
+	var labels []string
+	for len(data) > 0 {
+		labelLen := int(data[0])
+		data = data[1:]
+		if labelLen == 0 {
+			// the end of a name or padding.
+			if len(labels) != 0 {
+				domains = append(domains, strings.Join(labels, "."))
+				labels = nil
+			}
+			continue
+		}
+		if labelLen > len(data) {
+			break
+		}
+		labels = append(labels, string(data[:labelLen]))
+		data = data[labelLen:]
+	}
+	return domains
+}
+
+func sourceLinkLayerAddress(options layers.ICMPv6Options) net.HardwareAddr {
+	for _, option := range options {
+		if option.Type == layers.ICMPv6OptSourceAddress {
+			return net.HardwareAddr(option.Data)
+		}
+	}
+	return nil
+}
+
+// lifetimeString returns d or infinite for lifetimes that never expire.
+func lifetimeString(d time.Duration) string {
+	if d == infiniteLifetime {
+		return "infinite"
+	}
+	return d.String()
+}
+
+func displayRouterResults(routerResults *RouterScanResults, withVendors bool) {
+	if len(routerResults.Routers) == 0 {
+		fmt.Println()
+		pterm.Info.Println("No routers found")
+	} else {
+		for i, router := range routerResults.Routers {
+			fmt.Println()
+
+			lifetime := router.Lifetime.String()
+			if router.Lifetime == 0 {
+				lifetime += " (not a default router)"
+			}
+
+			tableData := pterm.TableData{
+				{fmt.Sprintf("Router %d", i+1)},
+				{"IP Address", router.IP.String()},
+				{"MAC Address", router.MACAddress.String()},
+			}
+			if withVendors {
+				tableData = append(tableData, []string{"Vendor", cmp.Or(router.Vendor, "(unknown)")})
+			}
+			tableData = append(
+				tableData,
+				[]string{"Interface", router.Interface},
+				[]string{"Router Lifetime", lifetime},
+				[]string{"Managed (M)", strconv.FormatBool(router.Managed)},
+				[]string{"Other Config (O)", strconv.FormatBool(router.OtherConfig)},
+				[]string{"Hop Limit", strconv.Itoa(int(router.HopLimit))},
+			)
+			if router.MTU != 0 {
+				tableData = append(tableData, []string{"MTU", strconv.Itoa(int(router.MTU))})
+			}
+			for _, rdnss := range router.RDNSS {
+				tableData = append(tableData, []string{"DNS Servers", fmt.Sprintf("%s (lifetime %s)", joinAddrs(rdnss.Servers), lifetimeString(rdnss.Lifetime))})
+			}
+			for _, dnssl := range router.DNSSL {
+				tableData = append(tableData, []string{"DNS Search List", fmt.Sprintf("%s (lifetime %s)", strings.Join(dnssl.Domains, ", "), lifetimeString(dnssl.Lifetime))})
+			}
+			tableData = append(tableData, []string{"Advertisements", strconv.Itoa(router.Advertisements)})
+
+			pterm.DefaultTable.
+				WithHasHeader().
+				WithHeaderRowSeparator("-").
+				WithBoxed().
+				WithData(tableData).
+				Render()
+
+			if len(router.Prefixes) == 0 {
+				continue
+			}
+			prefixData := pterm.TableData{{"Prefix", "Valid Lifetime", "Preferred Lifetime", "On-Link", "Autonomous"}}
+			for _, prefix := range router.Prefixes {
+				prefixData = append(prefixData, []string{
+					prefix.Prefix.String(),
+					lifetimeString(prefix.ValidLifetime),
+					lifetimeString(prefix.PreferredLifetime),
+					strconv.FormatBool(prefix.OnLink),
+					strconv.FormatBool(prefix.Autonomous),
+				})
+			}
+			pterm.DefaultTable.
+				WithHasHeader().
+				WithHeaderRowSeparator("-").
+				WithBoxed().
+				WithData(prefixData).
+				Render()
+		}
+	}
+
+	fmt.Println("\nScan Duration:      ", routerResults.Stats.ScanDuration.Truncate(time.Millisecond))
+	fmt.Println("Packets Sent:       ", routerResults.Stats.PacketsSent)
+	fmt.Println("Packets Received:   ", routerResults.Stats.PacketsReceived)
+	fmt.Println("Routers Found:      ", len(routerResults.Routers))
+}
@@ -0,0 +1,144 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func prefixInfoOption(prefix netip.Prefix, flags byte, valid, preferred uint32) layers.ICMPv6Option {
+	data := make([]byte, 30)
+	data[0] = byte(prefix.Bits())
+	data[1] = flags
+	binary.BigEndian.PutUint32(data[2:6], valid)
+	binary.BigEndian.PutUint32(data[6:10], preferred)
+	addr := prefix.Addr().As16()
+	copy(data[14:], addr[:])
+	return layers.ICMPv6Option{Type: layers.ICMPv6OptPrefixInfo, Data: data}
+}
+
+func lifetimeOption(optType layers.ICMPv6Opt, lifetime uint32, rest []byte) layers.ICMPv6Option {
+	data := make([]byte, 6, 6+len(rest))
+	binary.BigEndian.PutUint32(data[2:6], lifetime)
+	return layers.ICMPv6Option{Type: optType, Data: append(data, rest...)}
+}
+
+func TestParseRouterAdvertisement(t *testing.T) {
+	dns1 := netip.MustParseAddr("2001:db8::53")
+	dns2 := netip.MustParseAddr("2001:db8::54")
+	servers := append(dns1.AsSlice(), dns2.AsSlice()...)
+	// "lan" and "example.com" in DNS wire format followed by padding.
+	domains := []byte("\x03lan\x00\x07example\x03com\x00\x00\x00\x00\x00")
+
+	tests := []struct {
+		name string
+		ra   *layers.ICMPv6RouterAdvertisement
+		want RouterAdvertisement
+	}{
+		{
+			name: "router information",
+			ra:   &layers.ICMPv6RouterAdvertisement{HopLimit: 64, Flags: 0xc0, RouterLifetime: 1800},
+			want: RouterAdvertisement{Lifetime: 30 * time.Minute, Managed: true, OtherConfig: true, HopLimit: 64},
+		},
+		{
+			name: "not a default router",
+			ra:   &layers.ICMPv6RouterAdvertisement{Flags: 0x40},
+			want: RouterAdvertisement{OtherConfig: true},
+		},
+		{
+			name: "prefixes and mtu",
+			ra: &layers.ICMPv6RouterAdvertisement{
+				RouterLifetime: 1800,
+				Options: layers.ICMPv6Options{
+					prefixInfoOption(netip.MustParsePrefix("2001:db8:1::/64"), 0xc0, 2592000, 604800),
+					prefixInfoOption(netip.MustParsePrefix("2001:db8:2::/48"), 0x80, 0xffffffff, 0xffffffff),
+					{Type: layers.ICMPv6OptMTU, Data: []byte{0, 0, 0, 0, 0x05, 0xdc}},
+				},
+			},
+			want: RouterAdvertisement{
+				Lifetime: 30 * time.Minute,
+				MTU:      1500,
+				Prefixes: []RouterPrefix{
+					{Prefix: netip.MustParsePrefix("2001:db8:1::/64"), ValidLifetime: 720 * time.Hour, PreferredLifetime: 168 * time.Hour, OnLink: true, Autonomous: true},
+					{Prefix: netip.MustParsePrefix("2001:db8:2::/48"), ValidLifetime: infiniteLifetime, PreferredLifetime: infiniteLifetime, OnLink: true},
+				},
+			},
+		},
+		{
+			name: "dns options",
+			ra: &layers.ICMPv6RouterAdvertisement{
+				Options: layers.ICMPv6Options{
+					lifetimeOption(ndpOptRDNSS, 600, servers),
+					lifetimeOption(ndpOptDNSSL, 1200, domains),
+				},
+			},
+			want: RouterAdvertisement{
+				RDNSS: []RDNSSOption{{Servers: []netip.Addr{dns1, dns2}, Lifetime: 10 * time.Minute}},
+				DNSSL: []DNSSLOption{{Domains: []string{"lan", "example.com"}, Lifetime: 20 * time.Minute}},
+			},
+		},
+		{
+			name: "short options ignored",
+			ra: &layers.ICMPv6RouterAdvertisement{
+				Options: layers.ICMPv6Options{
+					{Type: layers.ICMPv6OptPrefixInfo, Data: make([]byte, 14)},
+					{Type: ndpOptRDNSS, Data: make([]byte, 6)},
+				},
+			},
+			want: RouterAdvertisement{RDNSS: []RDNSSOption{{}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRouterAdvertisement(tt.ra))
+		})
+	}
+}
+
+func TestDecodeDomainNames(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{name: "single name", data: []byte("\x04corp\x07example\x00"), want: []string{"corp.example"}},
+		{name: "padding between and after names", data: []byte("\x01a\x00\x00\x01b\x00\x00\x00"), want: []string{"a", "b"}},
+		{name: "truncated name dropped", data: []byte("\x03lan\x00\x07exam"), want: []string{"lan"}},
+		{name: "only padding", data: []byte{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, decodeDomainNames(tt.data))
+		})
+	}
+}
+
+func TestRouterScannerAddRouter(t *testing.T) {
+	router := netip.MustParseAddr("fe80::1")
+	rogue := netip.MustParseAddr("fe80::bad")
+	mac := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	spoofer := netutil.MAC{0x02, 0xde, 0xad, 0xbe, 0xef, 0x01}
+
+	s := &RouterScanner{routerIndex: make(map[routerKey]int)}
+	s.addRouter(Router{IP: router, MACAddress: mac, Interface: "eth0", RouterAdvertisement: RouterAdvertisement{Lifetime: time.Hour}})
+	s.addRouter(Router{IP: rogue, Interface: "eth0", RouterAdvertisement: RouterAdvertisement{Lifetime: time.Minute}})
+	// a rogue router using the address of the real one.
+	s.addRouter(Router{IP: router, MACAddress: spoofer, Interface: "eth0", RouterAdvertisement: RouterAdvertisement{Lifetime: 0}})
+	s.addRouter(Router{IP: router, MACAddress: mac, Interface: "eth0", RouterAdvertisement: RouterAdvertisement{Lifetime: 0}})
+	s.addRouter(Router{IP: router, MACAddress: mac, Interface: "eth1", RouterAdvertisement: RouterAdvertisement{Lifetime: time.Hour}})
+
+	assert.Equal(t, 5, s.results.Stats.PacketsReceived)
+	assert.Equal(t, []Router{
+		{IP: router, MACAddress: mac, Interface: "eth0", Advertisements: 2},
+		{IP: rogue, Interface: "eth0", Advertisements: 1, RouterAdvertisement: RouterAdvertisement{Lifetime: time.Minute}},
+		{IP: router, MACAddress: spoofer, Interface: "eth0", Advertisements: 1},
+		{IP: router, MACAddress: mac, Interface: "eth1", Advertisements: 1, RouterAdvertisement: RouterAdvertisement{Lifetime: time.Hour}},
+	}, s.results.Routers)
+}
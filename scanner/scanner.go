@@ -3,54 +3,109 @@ package scanner
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/kakeetopius/gscn/internal/notify"
+	"github.com/kakeetopius/gscn/packet"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
 )
 
+// OutputFormat is a format other than the default text and json formats that scan results can be written in.
+type OutputFormat string
+
+const (
+	OutputFormatDefault OutputFormat = ""
+	OutputFormatCSV     OutputFormat = "csv"
+	OutputFormatTSV     OutputFormat = "tsv"
+	OutputFormatXML     OutputFormat = "xml"
+	OutputFormatHTML    OutputFormat = "html"
+	// OutputFormatGrepable writes one host per line. See getGrepableResults.
+	OutputFormatGrepable OutputFormat = "grep"
+)
+
 type ScanOptions struct {
 	ResultsOutputFile string
 	PrintJSON         bool
 	PrintJSONPretty   bool
-	Notify            bool
-	Config            *viper.Viper
+	PrintXML          bool
+	Format            OutputFormat
+	Stream            bool
+	// Template is the path to a template file that replaces the built-in template used for the text output and notifications.
+	Template string
+	// TemplatesDir is a directory with templates named after the scan type (eg syn.tmpl) that replace the built-in templates.
+	// Template takes precedence over it.
+	TemplatesDir string
+	// PcapOutputFile is the path to a pcapng file that all packets sent and received by scanners using raw packets are written to.
+	PcapOutputFile string
+	// HistoryFile is the path to the history database completed scans are saved to. Scans are not saved when it is empty.
+	HistoryFile string
+	// Targets are the targets of the scan as given by the user. They are saved with the scan in the history.
+	Targets []string
+	Notify  bool
+	Config  *viper.Viper
 }
 
-func DoScan(ctx context.Context, scanner Scanner, opts ScanOptions) error {
+// DoScan runs the scan and writes its results as selected in opts.
+func DoScan(ctx context.Context, scanner Scanner, opts ScanOptions) (err error) {
+	if opts.PcapOutputFile != "" {
+		recorder, err := packet.NewFileRecorder(opts.PcapOutputFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, recorder.Close())
+		}()
+		ctx = packet.ContextWithRecorder(ctx, recorder)
+	}
+
+	if opts.Stream {
+		return streamScan(ctx, scanner, opts)
+	}
+
 	results, err := scanner.Scan(ctx)
 	if err != nil {
 		return err
 	}
 
-	out := os.Stdout
-	var output []byte
+	// the scan is saved first so that it is not lost when writing or sending the results fails.
+	historyErr := saveScan(results, opts)
+	return errors.Join(historyErr, WriteResults(results, opts))
+}
 
-	if opts.ResultsOutputFile != "" {
-		f, openErr := os.OpenFile(opts.ResultsOutputFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o754)
-		if openErr != nil {
-			return openErr
-		}
-		defer f.Close()
-		out = f
+// saveScan saves the results to the history database if opts.HistoryFile is set.
+func saveScan(results ScanResults, opts ScanOptions) error {
+	if opts.HistoryFile == "" {
+		return nil
 	}
+	return saveToHistory(results, opts)
+}
 
-	var printDefault bool // means no json output or any future output formats
+// WriteResults writes the scan results to the output file or stdout in the output format selected in opts and sends them with the
+// configured notifier if opts.Notify is set.
+func WriteResults(results ScanResults, opts ScanOptions) error {
+	out, err := openOutput(opts.ResultsOutputFile)
+	if err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		defer out.Close()
+	}
 
-	if opts.PrintJSON {
-		jsonBytes, jsonErr := getJSONResults(results, opts.PrintJSONPretty)
-		if jsonErr != nil {
-			return jsonErr
-		}
-		output = jsonBytes
-	} else {
-		output = []byte(results.String())
-		printDefault = true
+	textResults, err := applyResultsTemplate(results, opts)
+	if err != nil {
+		return err
+	}
+
+	output, printDefault, err := formatResults(results, textResults, opts)
+	if err != nil {
+		return err
 	}
 
 	if isTTY(out) && printDefault {
-		results.Print()
+		textResults.Print()
 	} else {
 		_, err = out.Write(output)
 		if err != nil {
@@ -58,15 +113,98 @@ func DoScan(ctx context.Context, scanner Scanner, opts ScanOptions) error {
 		}
 	}
 
-	if opts.Notify {
-		notifer, err := notify.NotifierFromConfig(opts.Config)
-		if err != nil {
-			return err
+	return notifyResults(textResults, opts)
+}
+
+// streamScan runs a scan that writes its results to the output as they come in instead of all at once when the scan is done.
+func streamScan(ctx context.Context, scanner Scanner, opts ScanOptions) error {
+	streamer, ok := scanner.(streamingScanner)
+	if !ok {
+		return fmt.Errorf("streaming results is not supported for this scan type")
+	}
+
+	out, err := openOutput(opts.ResultsOutputFile)
+	if err != nil {
+		return err
+	}
+	if out != os.Stdout {
+		defer out.Close()
+	}
+
+	stream := newResultStream(out)
+	streamer.setResultStream(stream)
+
+	results, err := scanner.Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	historyErr := saveScan(results, opts)
+
+	err = stream.finish(results)
+	if err != nil {
+		return errors.Join(historyErr, err)
+	}
+
+	textResults, err := applyResultsTemplate(results, opts)
+	if err != nil {
+		return errors.Join(historyErr, err)
+	}
+	return errors.Join(historyErr, notifyResults(textResults, opts))
+}
+
+// openOutput opens the file at path for writing results to or returns stdout if path is empty.
+func openOutput(path string) (*os.File, error) {
+	if path == "" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o754)
+}
+
+// notifyResults sends the results with the notifier in the config if opts.Notify is set.
+func notifyResults(results ScanResults, opts ScanOptions) error {
+	if !opts.Notify {
+		return nil
+	}
+
+	notifer, err := notify.NotifierFromConfig(opts.Config)
+	if err != nil {
+		return err
+	}
+	return notify.SendMessageWithNotifier(results, notifer)
+}
+
+// formatResults returns the scan results in the output format selected in opts. printDefault is true when no output format was selected
+// in which case text is returned.
+func formatResults(results ScanResults, text fmt.Stringer, opts ScanOptions) (output []byte, printDefault bool, err error) {
+	format := opts.Format
+	if format == OutputFormatDefault && opts.PrintXML {
+		format = OutputFormatXML
+	}
+
+	switch format {
+	case OutputFormatCSV:
+		output, err = getDelimitedResults(results, ',')
+	case OutputFormatTSV:
+		output, err = getDelimitedResults(results, '\t')
+	case OutputFormatXML:
+		output, err = getXMLResults(results)
+	case OutputFormatHTML:
+		output, err = getHTMLResults(results)
+	case OutputFormatGrepable:
+		output, err = getGrepableResults(results)
+	case OutputFormatDefault:
+		if opts.PrintJSON {
+			output, err = getJSONResults(results, opts.PrintJSONPretty)
+		} else {
+			output = []byte(text.String())
+			printDefault = true
 		}
-		return notify.SendMessageWithNotifier(results, notifer)
+	default:
+		err = fmt.Errorf("unsupported output format: %v", format)
 	}
 
-	return nil
+	return output, printDefault, err
 }
 
 // isTTY checks if the provided file is a terminal. It returns true if the file is a terminal, otherwise false.
@@ -0,0 +1,358 @@
+package scanner
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pterm/pterm"
+)
+
+// maxServiceResponse is the most that is read from a service in answer to a probe.
+const maxServiceResponse = 16 * 1024
+
+// defaultServiceTimeout is how long service detection waits for an answer to a probe if no timeout is given.
+const defaultServiceTimeout = 2 * time.Second
+
+// softMatchWait is how long reading goes on after a response only soft matched, in case the rest of the response gives away more
+// about the service.
+const softMatchWait = 500 * time.Millisecond
+
+// serviceProbe is data sent to an open port to make the service on it answer, along with the patterns its answers are matched against.
+type serviceProbe struct {
+	name string
+	// data is sent once connected. Probes without data only read what the service sends first eg an SSH banner.
+	data []byte
+	// ports are the ports the probe is tried on before the other probes.
+	ports   []PortNumber
+	matches []serviceMatch
+}
+
+// serviceMatch identifies a service from a response that matches pattern. product, version and extraInfo may refer to the pattern's
+// submatches as ${1}, ${2} etc.
+type serviceMatch struct {
+	service   string
+	pattern   *regexp.Regexp
+	product   string
+	version   string
+	extraInfo string
+	// soft matches only tell which service is on the port so reading goes on for a while in case a more specific match follows.
+	soft bool
+}
+
+//go:embed service_probes.txt
+var serviceProbesFile string
+
+// serviceProbes are the probes service detection tries, in order.
+var serviceProbes = mustParseServiceProbes(serviceProbesFile)
+
+func mustParseServiceProbes(data string) []serviceProbe {
+	probes, err := parseServiceProbes(data)
+	if err != nil {
+		panic(err)
+	}
+	return probes
+}
+
+// parseServiceProbes parses probes in the format of service_probes.txt.
+func parseServiceProbes(data string) ([]serviceProbe, error) {
+	var probes []serviceProbe
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, rest, _ := strings.Cut(line, " ")
+		if directive != "probe" && len(probes) == 0 {
+			return nil, fmt.Errorf("%v on line %v comes before any probe", directive, i+1)
+		}
+		last := len(probes) - 1
+
+		switch directive {
+		case "probe":
+			name, fields, _ := strings.Cut(rest, " ")
+			if name == "" {
+				return nil, fmt.Errorf("probe on line %v has no name", i+1)
+			}
+			values, err := parseProbeFields(fields, "q")
+			if err != nil {
+				return nil, fmt.Errorf("invalid probe on line %v: %w", i+1, err)
+			}
+			data, err := unescapeProbeData(values["q"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid data for probe on line %v: %w", i+1, err)
+			}
+			probes = append(probes, serviceProbe{name: name, data: data})
+		case "ports":
+			for _, port := range strings.Split(rest, ",") {
+				n, err := strconv.ParseUint(strings.TrimSpace(port), 10, 16)
+				if err != nil || n == 0 {
+					return nil, fmt.Errorf("invalid port %q on line %v", port, i+1)
+				}
+				probes[last].ports = append(probes[last].ports, PortNumber(n))
+			}
+		case "match", "softmatch":
+			service, fields, _ := strings.Cut(rest, " ")
+			values, err := parseProbeFields(fields, "mpvi")
+			if err != nil {
+				return nil, fmt.Errorf("invalid match on line %v: %w", i+1, err)
+			}
+			if service == "" || values["m"] == "" {
+				return nil, fmt.Errorf("match on line %v needs a service and a pattern", i+1)
+			}
+			pattern, err := regexp.Compile(values["m"])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern on line %v: %w", i+1, err)
+			}
+			probes[last].matches = append(probes[last].matches, serviceMatch{
+				service:   service,
+				pattern:   pattern,
+				product:   values["p"],
+				version:   values["v"],
+				extraInfo: values["i"],
+				soft:      directive == "softmatch",
+			})
+		default:
+			return nil, fmt.Errorf("unknown directive %q on line %v", directive, i+1)
+		}
+	}
+	return probes, nil
+}
+
+// parseProbeFields parses fields like m|pattern| p|product| where the character after the field's letter is the delimiter. Only the
+// letters in allowed may be used.
+func parseProbeFields(fields string, allowed string) (map[string]string, error) {
+	values := make(map[string]string)
+	for {
+		fields = strings.TrimSpace(fields)
+		if fields == "" {
+			return values, nil
+		}
+		if len(fields) < 2 || !strings.Contains(allowed, fields[:1]) {
+			return nil, fmt.Errorf("unexpected %q", fields)
+		}
+		letter, delimiter := fields[:1], fields[1:2]
+		value, rest, found := strings.Cut(fields[2:], delimiter)
+		if !found {
+			return nil, fmt.Errorf("%v field is missing its closing %v", letter, delimiter)
+		}
+		values[letter] = value
+		fields = rest
+	}
+}
+
+// unescapeProbeData turns the Go string escapes in data into the bytes they stand for.
+func unescapeProbeData(data string) ([]byte, error) {
+	var unescaped []byte
+	for data != "" {
+		value, multibyte, rest, err := strconv.UnquoteChar(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if value < utf8.RuneSelf || !multibyte {
+			unescaped = append(unescaped, byte(value))
+		} else {
+			unescaped = utf8.AppendRune(unescaped, value)
+		}
+		data = rest
+	}
+	return unescaped, nil
+}
+
+// serviceInfo is what service detection found out about the service on a port.
+type serviceInfo struct {
+	service   string
+	product   string
+	version   string
+	extraInfo string
+	soft      bool
+}
+
+// match returns what the first of the probe's matches that matches response tells about the service.
+func (p *serviceProbe) match(response []byte) (serviceInfo, bool) {
+	for _, m := range p.matches {
+		submatches := m.pattern.FindSubmatchIndex(response)
+		if submatches == nil {
+			continue
+		}
+		expand := func(template string) string {
+			return string(m.pattern.Expand(nil, []byte(template), response, submatches))
+		}
+		return serviceInfo{
+			service:   m.service,
+			product:   expand(m.product),
+			version:   expand(m.version),
+			extraInfo: expand(m.extraInfo),
+			soft:      m.soft,
+		}, true
+	}
+	return serviceInfo{}, false
+}
+
+// run connects to target, sends the probe's data and matches what the service sends back. Reading stops as soon as the response
+// matches, unless the match is soft.
+func (p *serviceProbe) run(ctx context.Context, target netip.AddrPort, timeout time.Duration) (info serviceInfo, found bool) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.String())
+	if err != nil {
+		return serviceInfo{}, false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if len(p.data) != 0 {
+		_, err = conn.Write(p.data)
+		if err != nil {
+			return serviceInfo{}, false
+		}
+	}
+
+	response := make([]byte, 0, 1024)
+	buf := make([]byte, 4096)
+	for len(response) < maxServiceResponse {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if n != 0 {
+			softFound := found
+			if info, found = p.match(response); found && !info.soft {
+				return info, true
+			}
+			if found && !softFound {
+				conn.SetDeadline(time.Now().Add(softMatchWait))
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return info, found
+}
+
+// detectService tries the service probes on target, starting with the ones meant for its port, until one of them matches.
+func detectService(ctx context.Context, target netip.AddrPort, timeout time.Duration) (serviceInfo, bool) {
+	port := PortNumber(target.Port())
+	probes := make([]*serviceProbe, 0, len(serviceProbes))
+	for i := range serviceProbes {
+		if i == 0 || slices.Contains(serviceProbes[i].ports, port) {
+			probes = append(probes, &serviceProbes[i])
+		}
+	}
+	for i := range serviceProbes {
+		if !slices.Contains(probes, &serviceProbes[i]) {
+			probes = append(probes, &serviceProbes[i])
+		}
+	}
+
+	var softInfo serviceInfo
+	softFound := false
+	for _, probe := range probes {
+		if ctx.Err() != nil {
+			break
+		}
+		info, found := probe.run(ctx, target, timeout)
+		if found && !info.soft {
+			return info, true
+		}
+		if found && !softFound {
+			softInfo, softFound = info, true
+		}
+	}
+	return softInfo, softFound
+}
+
+// detectServices runs service detection on the open tcp ports of the hosts in results and fills in what it finds.
+func detectServices(ctx context.Context, results HostResults, workers int, timeout time.Duration, stream *resultStream) {
+	enrichOpenPorts(ctx, results, workers, stream, "Detecting services....", "Service detection done",
+		func(ctx context.Context, host HostResult, port Port) func(*Port) {
+			info, found := detectService(ctx, netip.AddrPortFrom(host.Addr, uint16(port.Number)), timeout)
+			if !found {
+				return nil
+			}
+			return func(port *Port) {
+				port.Name = info.service
+				port.Product = info.product
+				port.Version = info.version
+				port.ExtraInfo = info.extraInfo
+			}
+		})
+}
+
+// portEnricher finds out more about the service on an open port of host. It returns a function that adds what it found to the port or
+// nil if it found nothing.
+type portEnricher func(ctx context.Context, host HostResult, port Port) func(port *Port)
+
+// enrichedPort is a port and what a portEnricher found out about it.
+type enrichedPort struct {
+	addr   netip.Addr
+	number PortNumber
+	update func(port *Port)
+}
+
+// enrichOpenPorts runs enrich on the open tcp ports of the hosts in results with the given number of workers and applies what it finds
+// to the ports. Ports that are updated are written to stream again. The spinner shows started while enriching and done after.
+func enrichOpenPorts(ctx context.Context, results HostResults, workers int, stream *resultStream, started string, done string, enrich portEnricher) {
+	spinner, _ := pterm.DefaultSpinner.Start(started)
+	defer spinner.Success(done)
+
+	type enrichJob struct {
+		host HostResult
+		port Port
+	}
+	var openPorts []enrichJob
+	for _, hostResult := range sortedHostResults(results) {
+		for _, port := range hostResult.Ports {
+			if port.State == PortStateOpen && port.Protocol == "tcp" {
+				openPorts = append(openPorts, enrichJob{host: hostResult, port: port})
+			}
+		}
+	}
+
+	jobs := make(chan enrichJob, workers)
+	enriched := make(chan enrichedPort, workers)
+	wg := &sync.WaitGroup{}
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				update := enrich(ctx, job.host, job.port)
+				if update != nil {
+					enriched <- enrichedPort{addr: job.host.Addr, number: job.port.Number, update: update}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, job := range openPorts {
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- job:
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(enriched)
+	}()
+
+	for result := range enriched {
+		hostResult := results[result.addr]
+		port := &hostResult.Ports[hostResult.portIndex[result.number]]
+		result.update(port)
+		stream.writePort(result.addr, *port)
+	}
+}
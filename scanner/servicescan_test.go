@@ -0,0 +1,223 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceProbeMatch(t *testing.T) {
+	probe := func(name string) *serviceProbe {
+		for i := range serviceProbes {
+			if serviceProbes[i].name == name {
+				return &serviceProbes[i]
+			}
+		}
+		t.Fatalf("no service probe named %v", name)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		probe    string
+		response string
+		expected serviceInfo
+		found    bool
+	}{
+		{
+			name:     "openssh banner",
+			probe:    "NULL",
+			response: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13.5\r\n",
+			expected: serviceInfo{service: "ssh", product: "OpenSSH", version: "9.6p1", extraInfo: "protocol 2.0"},
+			found:    true,
+		},
+		{
+			name:     "unknown ssh server",
+			probe:    "NULL",
+			response: "SSH-2.0-Go\r\n",
+			expected: serviceInfo{service: "ssh", extraInfo: "protocol 2.0"},
+			found:    true,
+		},
+		{
+			name:     "ssh banner cut in two is not matched",
+			probe:    "NULL",
+			response: "SSH-2.0-OpenSSH_9",
+		},
+		{
+			name:     "vsftpd banner",
+			probe:    "NULL",
+			response: "220 (vsFTPd 3.0.5)\r\n",
+			expected: serviceInfo{service: "ftp", product: "vsftpd", version: "3.0.5"},
+			found:    true,
+		},
+		{
+			name:     "exim banner",
+			probe:    "NULL",
+			response: "220 mail.example.com ESMTP Exim 4.96 Mon, 01 Jan 2024 00:00:00 +0000\r\n",
+			expected: serviceInfo{service: "smtp", product: "Exim smtpd", version: "4.96"},
+			found:    true,
+		},
+		{
+			name:     "mariadb handshake",
+			probe:    "NULL",
+			response: "\x5b\x00\x00\x00\x0a5.5.5-10.11.6-MariaDB-0+deb12u1\x00\x1f\x00\x00\x00",
+			expected: serviceInfo{service: "mysql", product: "MariaDB", version: "10.11.6"},
+			found:    true,
+		},
+		{
+			name:     "mysql handshake",
+			probe:    "NULL",
+			response: "\x4a\x00\x00\x00\x0a8.0.36\x00\x08\x00\x00\x00",
+			expected: serviceInfo{service: "mysql", product: "MySQL", version: "8.0.36"},
+			found:    true,
+		},
+		{
+			name:     "vnc handshake",
+			probe:    "NULL",
+			response: "RFB 003.008\n",
+			expected: serviceInfo{service: "vnc", product: "VNC", extraInfo: "protocol 3.8"},
+			found:    true,
+		},
+		{
+			name:     "nginx server header",
+			probe:    "GetRequest",
+			response: "HTTP/1.1 200 OK\r\nDate: Mon, 01 Jan 2024 00:00:00 GMT\r\nServer: nginx/1.24.0\r\n\r\n",
+			expected: serviceInfo{service: "http", product: "nginx", version: "1.24.0"},
+			found:    true,
+		},
+		{
+			name:     "apache server header with os",
+			probe:    "GetRequest",
+			response: "HTTP/1.1 403 Forbidden\r\nserver: Apache/2.4.58 (Ubuntu)\r\n\r\n",
+			expected: serviceInfo{service: "http", product: "Apache httpd", version: "2.4.58", extraInfo: "Ubuntu"},
+			found:    true,
+		},
+		{
+			name:     "server header in the body is ignored",
+			probe:    "GetRequest",
+			response: "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nServer: nginx/1.0\r\n",
+			expected: serviceInfo{service: "http", soft: true},
+			found:    true,
+		},
+		{
+			name:     "redis info",
+			probe:    "RedisInfo",
+			response: "$3000\r\n# Server\r\nredis_version:7.2.4\r\nredis_git_sha1:00000000\r\n",
+			expected: serviceInfo{service: "redis", product: "Redis key-value store", version: "7.2.4"},
+			found:    true,
+		},
+		{
+			name:     "no match",
+			probe:    "NULL",
+			response: "hello\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, found := probe(tt.probe).match([]byte(tt.response))
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.expected, info)
+		})
+	}
+}
+
+// serveOnce accepts connections on a local port and answers each of them with respond. It returns the port's address.
+func serveOnce(t *testing.T, respond func(conn net.Conn)) netip.AddrPort {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				respond(conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).AddrPort()
+}
+
+func TestParseServiceProbes(t *testing.T) {
+	probes, err := parseServiceProbes(`
+# comment
+probe NULL
+match ftp m%^220 (a|b)\r\n% p|ftpd| v|${1}|
+
+probe Hello q|hi\r\n\x00|
+ports 7,9
+softmatch echo m|^hi|
+`)
+	require.NoError(t, err)
+	require.Len(t, probes, 2)
+
+	assert.Equal(t, "NULL", probes[0].name)
+	assert.Nil(t, probes[0].data)
+	require.Len(t, probes[0].matches, 1)
+	assert.Equal(t, `^220 (a|b)\r\n`, probes[0].matches[0].pattern.String())
+	assert.Equal(t, serviceMatch{service: "ftp", pattern: probes[0].matches[0].pattern, product: "ftpd", version: "${1}"}, probes[0].matches[0])
+
+	assert.Equal(t, "Hello", probes[1].name)
+	assert.Equal(t, []byte("hi\r\n\x00"), probes[1].data)
+	assert.Equal(t, []PortNumber{7, 9}, probes[1].ports)
+	require.Len(t, probes[1].matches, 1)
+	assert.True(t, probes[1].matches[0].soft)
+}
+
+func TestParseServiceProbesErrors(t *testing.T) {
+	for _, data := range []string{
+		"match ssh m|^SSH|",
+		"probe",
+		"probe NULL\nports 0",
+		"probe NULL\nports ssh",
+		"probe NULL\nmatch ssh m|^SSH",
+		"probe NULL\nmatch ssh p|OpenSSH|",
+		"probe NULL\nmatch ssh m|(|",
+		"probe NULL\nmatch ssh m|^SSH| x|y|",
+		"probe Bad q|\\xZZ|",
+		"probe NULL\nrarity 1",
+	} {
+		_, err := parseServiceProbes(data)
+		assert.Error(t, err, data)
+	}
+}
+
+func TestDetectServices(t *testing.T) {
+	ssh := serveOnce(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		conn.Read(make([]byte, 1))
+	})
+	http := serveOnce(t, func(conn net.Conn) {
+		request := make([]byte, 1024)
+		n, _ := conn.Read(request)
+		if string(request[:n]) == "GET / HTTP/1.0\r\n\r\n" {
+			conn.Write([]byte("HTTP/1.0 200 OK\r\nServer: nginx/1.24.0\r\n\r\n"))
+		}
+	})
+	addr := ssh.Addr()
+
+	results := getResultSet([]netip.Prefix{netip.PrefixFrom(addr, 32)}, []PortNumber{PortNumber(ssh.Port()), PortNumber(http.Port())}, nil, nil, "tcp")
+	hostResult := results[addr]
+	hostResult.setPortState(PortNumber(ssh.Port()), PortStateOpen)
+	hostResult.setPortState(PortNumber(http.Port()), PortStateOpen)
+	results[addr] = hostResult
+
+	detectServices(context.Background(), results, 2, 500*time.Millisecond, nil)
+
+	ports := results[addr].Ports
+	assert.Equal(t, Port{Number: PortNumber(ssh.Port()), Name: "ssh", Protocol: "tcp", State: PortStateOpen, Product: "OpenSSH", Version: "9.6", ExtraInfo: "protocol 2.0"}, ports[0])
+	assert.Equal(t, Port{Number: PortNumber(http.Port()), Name: "http", Protocol: "tcp", State: PortStateOpen, Product: "nginx", Version: "1.24.0"}, ports[1])
+	assert.Equal(t, "OpenSSH 9.6 (protocol 2.0)", ports[0].VersionInfo())
+}
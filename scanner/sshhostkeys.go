@@ -0,0 +1,288 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHInfo describes the SSH server on a port as seen from the start of its key exchange.
+type SSHInfo struct {
+	// Banner is the identification string the server sends before the key exchange eg SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13.5.
+	Banner string `json:"banner"`
+	// HostKeyAlgorithms are the host key algorithms the server offers, in its order of preference.
+	HostKeyAlgorithms []string `json:"host_key_algorithms"`
+	// HostKeys are the host keys of the server, one per key type.
+	HostKeys []SSHHostKey `json:"host_keys"`
+}
+
+// SSHHostKey is a host key sent by an SSH server.
+type SSHHostKey struct {
+	// Type is the key type eg ssh-ed25519 or ssh-rsa.
+	Type string `json:"type"`
+	// Fingerprint is the SHA256 fingerprint of the key in the form printed by ssh-keygen -l eg SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s.
+	Fingerprint string `json:"fingerprint"`
+	// PublicKey is the key encoded as base64, like in a known_hosts file.
+	PublicKey string `json:"public_key"`
+}
+
+// SSH message numbers read before the key exchange.
+const (
+	sshMsgDisconnect = 1
+	sshMsgIgnore     = 2
+	sshMsgDebug      = 4
+	sshMsgKexInit    = 20
+)
+
+const (
+	// sshClientVersion is the identification string sent to servers.
+	sshClientVersion = "SSH-2.0-gscn"
+	// maxSSHPacket is the largest packet read from a server. Servers must not send packets larger than 35000 bytes before the key
+	// exchange completes.
+	maxSSHPacket = 35000
+	// maxSSHBannerLines is the most lines a server may send before its identification string.
+	maxSSHBannerLines = 32
+)
+
+// errSSHHostKeyCaptured ends a handshake once the server has sent its host key.
+var errSSHHostKeyCaptured = errors.New("ssh host key captured")
+
+// collectSSHHostKeys collects the banner, host key algorithms and host keys of the open tcp ports of the hosts in results that are port
+// 22 or were identified as SSH.
+func collectSSHHostKeys(ctx context.Context, results HostResults, workers int, timeout time.Duration, stream *resultStream) {
+	enrichOpenPorts(ctx, results, workers, stream, "Collecting SSH host keys....", "SSH host key collection done",
+		func(ctx context.Context, host HostResult, port Port) func(*Port) {
+			if port.Number != 22 && port.Name != "ssh" {
+				return nil
+			}
+			info, err := sshHostKeys(ctx, netip.AddrPortFrom(host.Addr, uint16(port.Number)), timeout)
+			if err != nil {
+				return nil
+			}
+			return func(port *Port) {
+				port.SSH = info
+			}
+		})
+}
+
+// sshHostKeys collects the host keys of the SSH server at target. A server only sends the host key of the algorithm negotiated for the
+// connection, so one handshake is started for every type of host key the server offers.
+func sshHostKeys(ctx context.Context, target netip.AddrPort, timeout time.Duration) (*SSHInfo, error) {
+	banner, hostKeyAlgorithms, err := sshServerAlgorithms(ctx, target, timeout)
+	if err != nil {
+		return nil, err
+	}
+	info := &SSHInfo{
+		Banner:            banner,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+	}
+
+	// keep the server's order of preference.
+	tried := map[string]bool{}
+	for _, algorithm := range hostKeyAlgorithms {
+		family := sshHostKeyFamily(algorithm)
+		if tried[family] || isSSHCertificate(algorithm) {
+			continue
+		}
+		tried[family] = true
+
+		key, err := sshHostKey(ctx, target, timeout, algorithm)
+		if err != nil {
+			continue
+		}
+		info.HostKeys = append(info.HostKeys, SSHHostKey{
+			Type:        key.Type(),
+			Fingerprint: ssh.FingerprintSHA256(key),
+			PublicKey:   base64.StdEncoding.EncodeToString(key.Marshal()),
+		})
+	}
+	if len(info.HostKeys) == 0 {
+		return nil, fmt.Errorf("no host key could be collected from %v", target)
+	}
+	return info, nil
+}
+
+// sshHostKey starts a handshake with the SSH server at target that only offers the host key algorithm and returns the host key the
+// server sends. The handshake is ended as soon as the key arrives.
+func sshHostKey(ctx context.Context, target netip.AddrPort, timeout time.Duration, algorithm string) (ssh.PublicKey, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		ClientVersion:     sshClientVersion,
+		HostKeyAlgorithms: []string{algorithm},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errSSHHostKeyCaptured
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, target.String(), config)
+	if !errors.Is(err, errSSHHostKeyCaptured) {
+		if err == nil {
+			err = errors.New("handshake finished without a host key")
+		}
+		return nil, err
+	}
+	return hostKey, nil
+}
+
+// sshHostKeyFamily returns the key type whose keys are used by the host key algorithm. The RSA signature algorithms all use ssh-rsa
+// keys.
+func sshHostKeyFamily(algorithm string) string {
+	switch algorithm {
+	case "rsa-sha2-256", "rsa-sha2-512":
+		return "ssh-rsa"
+	}
+	return algorithm
+}
+
+// isSSHCertificate reports whether the host key algorithm uses OpenSSH certificates instead of plain keys.
+func isSSHCertificate(algorithm string) bool {
+	return strings.Contains(algorithm, "-cert-")
+}
+
+// sshServerAlgorithms connects to the SSH server at target and returns its identification string and the host key algorithms it offers
+// in its key exchange init message.
+func sshServerAlgorithms(ctx context.Context, target netip.AddrPort, timeout time.Duration) (banner string, hostKeyAlgorithms []string, err error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.String())
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	_, err = conn.Write([]byte(sshClientVersion + "\r\n"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	banner, err = readSSHBanner(reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload, err := readSSHMessage(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	if payload[0] != sshMsgKexInit {
+		return "", nil, fmt.Errorf("expected key exchange init message but got message %v", payload[0])
+	}
+	hostKeyAlgorithms, err = parseSSHKexInit(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return banner, hostKeyAlgorithms, nil
+}
+
+// readSSHBanner reads the server's identification string, skipping any lines the server sends before it.
+func readSSHBanner(reader *bufio.Reader) (string, error) {
+	for range maxSSHBannerLines {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "SSH-") {
+			if !strings.HasPrefix(line, "SSH-2.0-") && !strings.HasPrefix(line, "SSH-1.99-") {
+				return "", fmt.Errorf("unsupported ssh protocol version in %q", line)
+			}
+			return line, nil
+		}
+	}
+	return "", errors.New("no ssh identification string")
+}
+
+// readSSHMessage reads packets from reader until one that is not an ignore or debug message and returns its payload.
+func readSSHMessage(reader io.Reader) ([]byte, error) {
+	for {
+		payload, err := readSSHPacket(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch payload[0] {
+		case sshMsgIgnore, sshMsgDebug:
+			continue
+		case sshMsgDisconnect:
+			// reason code followed by the description.
+			if len(payload) >= 5 {
+				if description, _, err := readSSHString(payload[5:]); err == nil {
+					return nil, fmt.Errorf("server disconnected: %s", description)
+				}
+			}
+			return nil, errors.New("server disconnected")
+		}
+		return payload, nil
+	}
+}
+
+// readSSHPacket reads an unencrypted packet and returns its payload, which is never empty.
+func readSSHPacket(reader io.Reader) ([]byte, error) {
+	var header [5]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	padding := uint32(header[4])
+	if length > maxSSHPacket || length < padding+2 {
+		return nil, fmt.Errorf("invalid ssh packet length %v", length)
+	}
+
+	packet := make([]byte, length-1)
+	_, err = io.ReadFull(reader, packet)
+	if err != nil {
+		return nil, err
+	}
+	return packet[:len(packet)-int(padding)], nil
+}
+
+// parseSSHKexInit returns the host key algorithms of a key exchange init message, which come after the key exchange algorithms.
+func parseSSHKexInit(payload []byte) ([]string, error) {
+	// message number and 16 byte cookie.
+	if len(payload) < 17 {
+		return nil, errors.New("key exchange init message too short")
+	}
+	_, rest, err := readSSHString(payload[17:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid key exchange init message: %w", err)
+	}
+	list, _, err := readSSHString(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key exchange init message: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(list), ","), nil
+}
+
+// readSSHString reads a length prefixed string from b and returns it along with what follows it.
+func readSSHString(b []byte) (s []byte, rest []byte, err error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("string length cut short")
+	}
+	length := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < length {
+		return nil, nil, errors.New("string cut short")
+	}
+	return b[4 : 4+length], b[4+length:], nil
+}
@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHSigners returns an ed25519, an ecdsa and an rsa host key.
+func testSSHSigners(t *testing.T) []ssh.Signer {
+	t.Helper()
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var signers []ssh.Signer
+	for _, key := range []any{ed25519Key, ecdsaKey, rsaKey} {
+		signer, err := ssh.NewSignerFromKey(key)
+		require.NoError(t, err)
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+// serveSSH runs an SSH server with config on a local port and returns the port's address.
+func serveSSH(t *testing.T, config *ssh.ServerConfig) netip.AddrPort {
+	t.Helper()
+	config.NoClientAuth = true
+	return serveOnce(t, func(conn net.Conn) {
+		ssh.NewServerConn(conn, config)
+	})
+}
+
+func TestSSHHostKeys(t *testing.T) {
+	signers := testSSHSigners(t)
+	config := &ssh.ServerConfig{ServerVersion: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13.5"}
+	var expected []SSHHostKey
+	for _, signer := range signers {
+		config.AddHostKey(signer)
+		expected = append(expected, SSHHostKey{
+			Type:        signer.PublicKey().Type(),
+			Fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+			PublicKey:   base64.StdEncoding.EncodeToString(signer.PublicKey().Marshal()),
+		})
+	}
+	target := serveSSH(t, config)
+
+	info, err := sshHostKeys(context.Background(), target, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13.5", info.Banner)
+	assert.Contains(t, info.HostKeyAlgorithms, "ssh-ed25519")
+	assert.Contains(t, info.HostKeyAlgorithms, "rsa-sha2-256")
+	assert.ElementsMatch(t, expected, info.HostKeys)
+}
+
+func TestSSHHostKey(t *testing.T) {
+	signers := testSSHSigners(t)
+	config := &ssh.ServerConfig{}
+	for _, signer := range signers {
+		config.AddHostKey(signer)
+	}
+	target := serveSSH(t, config)
+
+	tests := []struct {
+		algorithm string
+		signer    ssh.Signer
+	}{
+		{algorithm: "ssh-ed25519", signer: signers[0]},
+		{algorithm: "ecdsa-sha2-nistp256", signer: signers[1]},
+		{algorithm: "rsa-sha2-512", signer: signers[2]},
+		{algorithm: "rsa-sha2-256", signer: signers[2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			key, err := sshHostKey(context.Background(), target, time.Second, tt.algorithm)
+			require.NoError(t, err)
+			assert.Equal(t, tt.signer.PublicKey().Marshal(), key.Marshal())
+		})
+	}
+
+	_, err := sshHostKey(context.Background(), target, time.Second, "ecdsa-sha2-nistp384")
+	assert.Error(t, err)
+}
+
+func TestSSHHostKeysNotSSH(t *testing.T) {
+	target := serveOnce(t, func(conn net.Conn) {
+		conn.Write([]byte("HTTP/1.0 400 Bad Request\r\n\r\n"))
+	})
+	_, err := sshHostKeys(context.Background(), target, time.Second)
+	assert.Error(t, err)
+}
+
+func TestCollectSSHHostKeys(t *testing.T) {
+	signer := testSSHSigners(t)[0]
+	config := &ssh.ServerConfig{}
+	config.AddHostKey(signer)
+	sshPort := serveSSH(t, config)
+	otherPort := serveOnce(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	})
+	addr := sshPort.Addr()
+
+	results := getResultSet([]netip.Prefix{netip.PrefixFrom(addr, 32)}, []PortNumber{PortNumber(sshPort.Port()), PortNumber(otherPort.Port())}, nil, nil, "tcp")
+	hostResult := results[addr]
+	hostResult.setPortState(PortNumber(sshPort.Port()), PortStateOpen)
+	hostResult.setPortState(PortNumber(otherPort.Port()), PortStateOpen)
+	hostResult.Ports[0].Name = "ssh"
+	results[addr] = hostResult
+
+	collectSSHHostKeys(context.Background(), results, 2, time.Second, nil)
+
+	ports := results[addr].Ports
+	require.NotNil(t, ports[0].SSH)
+	require.Len(t, ports[0].SSH.HostKeys, 1)
+	assert.Equal(t, ssh.FingerprintSHA256(signer.PublicKey()), ports[0].SSH.HostKeys[0].Fingerprint)
+	// not port 22 and not identified as ssh.
+	assert.Nil(t, ports[1].SSH)
+}
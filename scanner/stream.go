@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"encoding/json"
+	"io"
+	"net/netip"
+	"sync"
+)
+
+// streamingScanner is implemented by scanners that can write their results to a result stream while the scan is still running.
+type streamingScanner interface {
+	Scanner
+	// setResultStream sets the stream the scanner writes results to as soon as they become final.
+	setResultStream(stream *resultStream)
+}
+
+// resultStream writes scan results as newline delimited json (one json object per line). Every write goes straight to the underlying
+// writer so that consumers see results as they arrive and nothing already written is lost if the process is killed.
+//
+// A nil *resultStream is valid and discards everything written to it so scanners do not need to check whether streaming is enabled.
+type resultStream struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	err     error
+}
+
+// streamRecord is a single line written to a result stream.
+type streamRecord struct {
+	// Type is the kind of record eg host, port or stats.
+	Type string `json:"type"`
+	// IP is the address of the host a port record belongs to.
+	IP netip.Addr `json:"ip,omitzero"`
+	// Data is the actual result.
+	Data any `json:"data"`
+}
+
+const (
+	streamRecordHost  = "host"
+	streamRecordPort  = "port"
+	streamRecordStats = "stats"
+)
+
+func newResultStream(w io.Writer) *resultStream {
+	return &resultStream{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// writeHost writes a record for a host whose state is final.
+func (s *resultStream) writeHost(host any) {
+	s.write(streamRecord{Type: streamRecordHost, Data: host})
+}
+
+// writeHostResult writes a record for a host of a port scan without its ports, which are streamed on their own. Port scans write a
+// host as soon as it is known to be up and again whenever reverse lookups or OS detection later find out more about it.
+func (s *resultStream) writeHostResult(hostResult HostResult) {
+	hostResult.Ports = nil
+	s.writeHost(hostResult)
+}
+
+// writePort writes a record for a port on the host with address addr whose state is final. The port is written again whenever
+// service detection, TLS inspection or HTTP fingerprinting later find out more about it.
+func (s *resultStream) writePort(addr netip.Addr, port Port) {
+	s.write(streamRecord{Type: streamRecordPort, IP: addr, Data: port})
+}
+
+func (s *resultStream) write(record streamRecord) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	s.err = s.encoder.Encode(record)
+}
+
+// Err returns the first error encountered while writing to the stream.
+func (s *resultStream) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// finish writes the records that are only known once the scan is done. For port scans that is every port still in the scan's default
+// state followed by every host that is still down, as a host can answer a probe until the very end. Hosts that are up were already
+// written when they came up. For all scans it is the scan's stats.
+func (s *resultStream) finish(results ScanResults) error {
+	if portResults, ok := results.(portScanResults); ok {
+		info := portResults.portScanInfo()
+		for _, hostResult := range sortedHostResults(portResults.hostResults()) {
+			if hostResult.HostState == HostStateDown && info.printUpOnly {
+				continue
+			}
+			if info.defaultPortState != PortStateClosed {
+				// ports that never answered were not streamed when their state was set.
+				for _, port := range hostResult.Ports {
+					if port.State == info.defaultPortState {
+						s.writePort(hostResult.Addr, port)
+					}
+				}
+			}
+			if hostResult.HostState != HostStateUp {
+				s.writeHostResult(hostResult)
+			}
+		}
+	}
+
+	// every results type has its stats under the "stats" key when marshalled.
+	jsonBytes, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	var fields struct {
+		Stats json.RawMessage `json:"stats"`
+	}
+	err = json.Unmarshal(jsonBytes, &fields)
+	if err != nil {
+		return err
+	}
+	if fields.Stats != nil {
+		s.write(streamRecord{Type: streamRecordStats, Data: fields.Stats})
+	}
+
+	return s.Err()
+}
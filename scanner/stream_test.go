@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"bytes"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultStream(t *testing.T) {
+	buf := bytes.Buffer{}
+	stream := newResultStream(&buf)
+
+	addr := netip.MustParseAddr("10.1.1.2")
+	open := Port{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen}
+	stream.writePort(addr, open)
+
+	results := &TCPFullScanResults{
+		Results: HostResults{
+			addr: {
+				Addr:      addr,
+				HostState: HostStateUp,
+				OpenPorts: 1,
+				Ports:     []Port{open},
+			},
+			netip.MustParseAddr("10.1.1.1"): {
+				Addr:      netip.MustParseAddr("10.1.1.1"),
+				HostState: HostStateDown,
+			},
+		},
+		Stats: TCPFullScanStats{
+			TotalNumOfHosts: 2,
+			ScanTime:        time.Second,
+		},
+	}
+	require.NoError(t, stream.finish(results))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"type":"port","ip":"10.1.1.2","data":{"number":22,"name":"ssh","protocol":"tcp","state":"open"}}`, lines[0])
+	// hosts that are up were streamed when they came up so only the down host is left.
+	assert.Contains(t, lines[1], `"type":"host"`)
+	assert.Contains(t, lines[1], `"ip":"10.1.1.1"`)
+	assert.Contains(t, lines[1], `"ports":null`)
+	assert.Contains(t, lines[2], `"type":"stats"`)
+
+	// down hosts are left out when only up hosts are printed.
+	buf.Reset()
+	results.printUpOnly = true
+	require.NoError(t, stream.finish(results))
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"type":"stats"`)
+}
+
+func TestNilResultStream(t *testing.T) {
+	var stream *resultStream
+	assert.NotPanics(t, func() {
+		stream.writeHost(PingHostResult{})
+	})
+	assert.NoError(t, stream.Err())
+}
+
+func TestResultStreamDefaultPortStates(t *testing.T) {
+	addr := netip.MustParseAddr("10.1.1.2")
+
+	tests := []struct {
+		name    string
+		mode    TCPScanMode
+		ports   []Port
+		streams []string
+	}{
+		{
+			name: "fin ports that never answered",
+			mode: TCPScanModeFin,
+			ports: []Port{
+				{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStatePossibleFilter},
+				{Number: 23, Name: "telnet", Protocol: "tcp", State: PortStateClosed},
+			},
+			streams: []string{`{"type":"port","ip":"10.1.1.2","data":{"number":22,"name":"ssh","protocol":"tcp","state":"open | filtered"}}`},
+		},
+		{
+			name: "ack ports that stay filtered",
+			mode: TCPScanModeAck,
+			ports: []Port{
+				{Number: 80, Name: "http", Protocol: "tcp", State: PortStateFiltered},
+				{Number: 443, Name: "https", Protocol: "tcp", State: PortStateUnfiltered},
+			},
+			streams: []string{`{"type":"port","ip":"10.1.1.2","data":{"number":80,"name":"http","protocol":"tcp","state":"filtered"}}`},
+		},
+		{
+			name:  "syn ports are only streamed when they answer",
+			mode:  TCPScanModeSyn,
+			ports: []Port{{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateClosed}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			stream := newResultStream(&buf)
+			results := &TCPSynScanResults{
+				Mode: tt.mode,
+				Results: HostResults{
+					addr: {Addr: addr, HostState: HostStateUp, Ports: tt.ports},
+				},
+			}
+			require.NoError(t, stream.finish(results))
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			require.Len(t, lines, len(tt.streams)+1)
+			for i, want := range tt.streams {
+				assert.JSONEq(t, want, lines[i])
+			}
+			assert.Contains(t, lines[len(tt.streams)], `"type":"stats"`)
+		})
+	}
+}
+
+func TestResultStreamRawUDP(t *testing.T) {
+	addr := netip.MustParseAddr("10.1.1.2")
+	results := &UDPScanResults{
+		Raw: true,
+		Results: HostResults{
+			addr: {
+				Addr:      addr,
+				HostState: HostStateUp,
+				Ports: []Port{
+					{Number: 53, Name: "domain", Protocol: "udp", State: PortStateOpen},
+					{Number: 161, Name: "snmp", Protocol: "udp", State: PortStatePossibleFilter},
+				},
+			},
+		},
+	}
+
+	buf := bytes.Buffer{}
+	require.NoError(t, newResultStream(&buf).finish(results))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	// the open port was streamed when it answered.
+	assert.JSONEq(t, `{"type":"port","ip":"10.1.1.2","data":{"number":161,"name":"snmp","protocol":"udp","state":"open | filtered"}}`, lines[0])
+	assert.Contains(t, lines[1], `"type":"stats"`)
+
+	// ports of udp scans that are not raw are streamed as soon as their state is known.
+	buf.Reset()
+	results.Raw = false
+	require.NoError(t, newResultStream(&buf).finish(results))
+	assert.Len(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), 1)
+}
+
+func TestStreamUpHosts(t *testing.T) {
+	up := netip.MustParseAddr("10.1.1.2")
+	down := netip.MustParseAddr("10.1.1.1")
+	results := HostResults{
+		up: {
+			Addr:        up,
+			HostState:   HostStateUp,
+			Ports:       []Port{{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateClosed}},
+			ClosedPorts: 1,
+			portIndex:   map[PortNumber]int{22: 0},
+		},
+		down: {
+			Addr:        down,
+			HostState:   HostStateDown,
+			Ports:       []Port{{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateClosed}},
+			ClosedPorts: 1,
+			portIndex:   map[PortNumber]int{22: 0},
+		},
+	}
+
+	buf := bytes.Buffer{}
+	stream := newResultStream(&buf)
+	streamUpHosts(results, stream)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"ip":"10.1.1.2"`)
+	assert.Contains(t, lines[0], `"ports":null`)
+
+	// a down host is streamed as soon as it answers a probe and only once.
+	buf.Reset()
+	recordPortState(results, stream, down, 22, PortStateOpen, true)
+	recordPortState(results, stream, up, 22, PortStateOpen, true)
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"type":"host"`)
+	assert.Contains(t, lines[0], `"ip":"10.1.1.1"`)
+	assert.Contains(t, lines[0], `"state":"up"`)
+	assert.JSONEq(t, `{"type":"port","ip":"10.1.1.1","data":{"number":22,"name":"ssh","protocol":"tcp","state":"open"}}`, lines[1])
+	assert.JSONEq(t, `{"type":"port","ip":"10.1.1.2","data":{"number":22,"name":"ssh","protocol":"tcp","state":"open"}}`, lines[2])
+}
@@ -2,14 +2,10 @@ package scanner
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"math/rand"
-	"net"
 	"net/netip"
-	"runtime"
-	"strings"
-	"text/template"
+	"slices"
 	"time"
 
 	"github.com/google/gopacket"
@@ -26,15 +22,97 @@ import (
 type TCPSynScanner struct {
 	TCPSynScanOptions
 
-	results       TCPSynScanResults
-	hostStates    PingScanResultsMap
-	ifaceProvider netutil.NetInterfaceProvider
-	logger        log.Logger
-	router        routing.Router
-	macResolver   resolving.Resolver
+	results    TCPSynScanResults
+	hostStates PingScanResultsMap
+	// osObservations are the most telling replies of each host, kept for guessing their operating systems.
+	osObservations map[netip.Addr]osObservation
+	ifaceProvider  netutil.NetInterfaceProvider
+	logger         log.Logger
+	router         routing.Router
+	macResolver    resolving.Resolver
+	stream         *resultStream
+}
+
+// TCPScanMode is the combination of TCP flags that a TCPSynScanner probes ports with.
+type TCPScanMode string
+
+const (
+	// TCPScanModeSyn probes ports with SYN packets. Ports that answer with a SYN-ACK are open.
+	TCPScanModeSyn TCPScanMode = "syn"
+	// TCPScanModeFin, TCPScanModeNull and TCPScanModeXmas probe ports with packets that have only the FIN flag, no flags and the FIN,
+	// PSH and URG flags set. Hosts that follow RFC 793 answer these with a RST if the port is closed and drop them if it is open, so
+	// ports that do not answer are open or filtered.
+	TCPScanModeFin  TCPScanMode = "fin"
+	TCPScanModeNull TCPScanMode = "null"
+	TCPScanModeXmas TCPScanMode = "xmas"
+	// TCPScanModeAck probes ports with ACK packets. Hosts answer them with a RST whether the port is open or closed so ports that answer
+	// are unfiltered and ports that do not are filtered. It is used to find out whether a stateful firewall is in front of a host.
+	TCPScanModeAck TCPScanMode = "ack"
+)
+
+// TCPScanModes are the modes a TCPSynScanner can scan in.
+var TCPScanModes = []TCPScanMode{TCPScanModeSyn, TCPScanModeFin, TCPScanModeNull, TCPScanModeXmas, TCPScanModeAck}
+
+// Name returns the name of the scan mode used in scan reports eg SYN.
+func (m TCPScanMode) Name() string {
+	switch m {
+	case TCPScanModeFin:
+		return "FIN"
+	case TCPScanModeNull:
+		return "NULL"
+	case TCPScanModeXmas:
+		return "Xmas"
+	case TCPScanModeAck:
+		return "ACK"
+	default:
+		return "SYN"
+	}
+}
+
+// setFlags sets the flags of a probe sent in this mode.
+func (m TCPScanMode) setFlags(tcp *layers.TCP) {
+	switch m {
+	case TCPScanModeFin:
+		tcp.FIN = true
+	case TCPScanModeNull:
+	case TCPScanModeXmas:
+		tcp.FIN, tcp.PSH, tcp.URG = true, true, true
+	case TCPScanModeAck:
+		tcp.ACK = true
+		tcp.Ack = rand.Uint32()
+	default:
+		tcp.SYN = true
+	}
+}
+
+// defaultPortState returns the state of ports that do not answer probes sent in this mode.
+func (m TCPScanMode) defaultPortState() PortState {
+	switch m {
+	case TCPScanModeSyn:
+		return PortStateClosed
+	case TCPScanModeAck:
+		return PortStateFiltered
+	default:
+		return PortStatePossibleFilter
+	}
+}
+
+// responseState returns the state of a port that answered a probe sent in this mode with tcp. ok is false if the answer does not tell
+// anything about the port.
+func (m TCPScanMode) responseState(tcp *layers.TCP) (state PortState, ok bool) {
+	switch m {
+	case TCPScanModeSyn:
+		return PortStateOpen, tcp.SYN && tcp.ACK
+	case TCPScanModeAck:
+		return PortStateUnfiltered, tcp.RST
+	default:
+		return PortStateClosed, tcp.RST
+	}
 }
 
 type TCPSynScanOptions struct {
+	// Mode is the combination of TCP flags ports are probed with. It defaults to TCPScanModeSyn.
+	Mode                TCPScanMode
 	Targets             []netip.Prefix
 	TargetPorts         []PortNumber
 	Workers             int
@@ -44,14 +122,40 @@ type TCPSynScanOptions struct {
 	AddUnknownHostNames bool
 	PingTimeout         time.Duration
 	SkipPingScan        bool
+	// Discovery are the probes that find out which hosts are up before their ports are scanned. Hosts only get echo requests if it is
+	// empty.
+	Discovery DiscoveryOptions
+	// ServiceVersion turns on service detection, which connects to open ports and matches what the services on them answer to probes
+	// to find out which software they run.
+	ServiceVersion bool
+	// TLS turns on TLS inspection, which collects the TLS version, cipher suite and certificate chain of open ports that speak TLS or
+	// support STARTTLS.
+	TLS bool
+	// CertExpiryWarning is how close to expiring the certificates found by TLS inspection can get before a warning is added to the
+	// results. Setting it turns on TLS inspection.
+	CertExpiryWarning time.Duration
+	// HTTP turns on HTTP fingerprinting, which records the status code, headers, page title and favicon hash of open ports that answer
+	// HTTP or HTTPS.
+	HTTP bool
+	// SSHHostKeys turns on collection of the banner, host key algorithms and host key fingerprints of open ports that are port 22 or
+	// were identified as SSH.
+	SSHHostKeys bool
+	// ServiceTimeout is how long service detection, TLS inspection, HTTP fingerprinting and SSH host key collection wait for an answer
+	// to each probe.
+	ServiceTimeout time.Duration
 
 	PrintUpOnly   bool
 	PrintOpenOnly bool
 }
 
 type TCPSynScanResults struct {
+	Mode    TCPScanMode     `json:"mode"`
 	Results HostResults     `json:"results"`
 	Stats   TCPSynScanStats `json:"stats"`
+	// PingSkipped is set when hosts were treated as up without being pinged first.
+	PingSkipped bool `json:"ping_skipped,omitempty"`
+	// CertificateWarnings are the certificates that have expired or are close to expiring.
+	CertificateWarnings []CertificateWarning `json:"certificate_warnings,omitempty"`
 
 	printUpOnly   bool `json:"-"`
 	printOpenOnly bool `json:"-"`
@@ -66,6 +170,15 @@ func NewTCPSynScanner(opts TCPSynScanOptions) (*TCPSynScanner, error) {
 	if opts.HostNames == nil {
 		opts.HostNames = make(map[netip.Addr]string)
 	}
+	if opts.ServiceTimeout == 0 {
+		opts.ServiceTimeout = defaultServiceTimeout
+	}
+	if opts.Mode == "" {
+		opts.Mode = TCPScanModeSyn
+	}
+	if !slices.Contains(TCPScanModes, opts.Mode) {
+		return nil, fmt.Errorf("unknown tcp scan mode: %v", opts.Mode)
+	}
 	ifaceProvider, err := netutil.InterfaceProvider()
 	if err != nil {
 		return nil, err
@@ -78,6 +191,7 @@ func NewTCPSynScanner(opts TCPSynScanOptions) (*TCPSynScanner, error) {
 	return &TCPSynScanner{
 		TCPSynScanOptions: opts,
 		results: TCPSynScanResults{
+			Mode:    opts.Mode,
 			Results: make(HostResults),
 		},
 		ifaceProvider: ifaceProvider,
@@ -93,17 +207,37 @@ func (s *TCPSynScanner) Scan(ctx context.Context) (ScanResults, error) {
 	if err != nil {
 		return nil, err
 	}
+	if s.ServiceVersion {
+		detectServices(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.TLS || s.CertExpiryWarning > 0 {
+		inspectTLS(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.HTTP {
+		fingerprintHTTP(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.SSHHostKeys {
+		collectSSHHostKeys(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.CertExpiryWarning > 0 {
+		s.results.CertificateWarnings = certificateWarnings(s.results.Results, s.CertExpiryWarning, time.Now())
+	}
 	stopTime := time.Now()
 
 	s.results.Stats.ScanTime = stopTime.Sub(startTime)
 	s.results.Stats.TotalNumOfHosts = len(s.results.Results)
 	s.results.printOpenOnly = s.PrintOpenOnly
 	s.results.printUpOnly = s.PrintUpOnly
+	s.results.PingSkipped = s.SkipPingScan
 
 	s.addResultsInfo()
 	return &s.results, nil
 }
 
+func (s *TCPSynScanner) setResultStream(stream *resultStream) {
+	s.stream = stream
+}
+
 func (s *TCPSynScanner) addResultsInfo() {
 	if s.AddUnknownHostNames {
 		spinner, _ := pterm.DefaultSpinner.Start("Resolving Host Names....")
@@ -118,22 +252,45 @@ func (s *TCPSynScanner) addResultsInfo() {
 			name := netutil.ReverseLookup(ctx, host.String())
 			results.HostName = name
 			s.results.Results[host] = results
+			if name != "" && results.HostState == HostStateUp {
+				s.stream.writeHostResult(results)
+			}
 		}
 	}
 }
 
 func (r *TCPSynScanResults) Print() {
 	printScanResultsMap(r.Results, r.Stats.ScanTime, r.printUpOnly, r.printOpenOnly)
+	printCertificateWarnings(r.CertificateWarnings)
 }
 
-func (r *TCPSynScanResults) String() string {
-	stringBuilder := strings.Builder{}
+func (r *TCPSynScanResults) hostResults() HostResults {
+	return r.Results
+}
 
-	hostTmpl := template.Must(template.New("host_result").Parse(HostResultTemplate))
-	tmpl := template.Must(hostTmpl.New("tcp_full_scan").Parse(TCPSynScanResultsTemplate))
+func (r *TCPSynScanResults) portScanInfo() portScanInfo {
+	scanType := r.Mode
+	if scanType == "" {
+		// results saved before scan modes were added.
+		scanType = TCPScanModeSyn
+	}
+	return portScanInfo{
+		ScanType:         string(scanType),
+		Protocol:         "tcp",
+		ScanTime:         r.Stats.ScanTime,
+		pingSkipped:      r.PingSkipped,
+		defaultPortState: scanType.defaultPortState(),
+		printUpOnly:      r.printUpOnly,
+		printOpenOnly:    r.printOpenOnly,
+	}
+}
 
-	tmpl.Execute(&stringBuilder, r)
-	return stringBuilder.String()
+func (r *TCPSynScanResults) table() [][]string {
+	return portScanTable(r)
+}
+
+func (r *TCPSynScanResults) String() string {
+	return executeResultsTemplate("tcp_full_scan", TCPSynScanResultsTemplate, r)
 }
 
 func (s *TCPSynScanner) runTCPSynScan(ctx context.Context) (err error) {
@@ -148,15 +305,32 @@ func (s *TCPSynScanner) runTCPSynScan(ctx context.Context) (err error) {
 	}
 
 	if !s.SkipPingScan {
-		// pinging for this scanner type is important because kernel will be build able to build the neighbor cache for those hosts that are up which will
-		// be useful for the macResolver
-		pingResults, pingErr := pingHosts(ctx, s.Targets, s.PingTimeout, int(s.Workers), s.PingCount)
+		// pinging for this scanner type is important because the kernel builds its neighbor cache for the hosts that answer pings, which
+		// the macResolver reads from. Hosts found with ARP or NDP never reach the kernel so their mac addresses are added directly.
+		pingResults, pingErr := pingHosts(ctx, PingScanOptions{
+			Targets:          s.Targets,
+			PingTimeout:      s.PingTimeout,
+			Workers:          s.Workers,
+			PingCount:        s.PingCount,
+			DiscoveryOptions: s.Discovery,
+		})
 		if pingErr != nil {
 			return pingErr
 		}
 		s.hostStates = pingResults
+		addNeighbourMACs(s.macResolver, pingResults)
 	}
 	s.results.Results = getResultSet(s.Targets, s.TargetPorts, s.HostNames, s.hostStates, "tcp")
+	s.osObservations = make(map[netip.Addr]osObservation)
+	for addr, hostResult := range s.results.Results {
+		// hosts that did not answer pings only get the mode's default port state once they answer a probe.
+		if hostResult.HostState != HostStateUp && !s.SkipPingScan {
+			continue
+		}
+		s.setDefaultPortStates(&hostResult)
+		s.results.Results[addr] = hostResult
+	}
+	streamUpHosts(s.results.Results, s.stream)
 
 	spinner, err := pterm.DefaultSpinner.Start("Scanning hosts")
 	if err != nil {
@@ -175,28 +349,13 @@ func (s *TCPSynScanner) runTCPSynScan(ctx context.Context) (err error) {
 		return err
 	}
 
-	var packetSender packet.PacketSender
-	// localhostPacketSender is necessary coz if packets heading to localhost or any ip on any of the device's interfaces are injected directly at the datalink,
-	// they never reache localhost, so they have to be injected at the ip layer. but the ip layer packet injector only works on linux, so for the other OSes there is
-	// no solution yet
-	var localhostPacketSender packet.PacketSender
-	if runtime.GOOS == "linux" {
-		packetSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypeLinkLayer)
-		if err != nil {
-			return err
-		}
-		localhostPacketSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypeIPLayer)
-	} else {
-		packetSender, err = packet.GetPacketSender(ctx, packet.PacketSenderTypePcap)
-		localhostPacketSender = packetSender
-	}
+	sender, err := newRawSender(ctx, s.ifaceProvider, s.router, s.macResolver)
 	if err != nil {
 		return err
 	}
-	defer packetSender.Close()
-	defer localhostPacketSender.Close()
+	defer sender.Close()
 
-	packetReceiver, err := packet.NewPacketReceiver(ctx, "(ip or ip6) and tcp", 1500, allIfaces...)
+	packetReceiver, err := packet.NewPacketReceiver(ctx, "((ip or ip6) and tcp) or "+icmpUnreachableFilter, 1500, allIfaces...)
 	if err != nil {
 		return err
 	}
@@ -209,7 +368,7 @@ func (s *TCPSynScanner) runTCPSynScan(ctx context.Context) (err error) {
 	g, ctx := errgroup.WithContext(ctx)
 	for range s.Workers {
 		g.Go(func() error {
-			return s.synScanTCPPort(jobs, packetSender, localhostPacketSender)
+			return s.synScanTCPPort(jobs, sender)
 		})
 	}
 
@@ -221,16 +380,35 @@ func (s *TCPSynScanner) runTCPSynScan(ctx context.Context) (err error) {
 		return err
 	}
 
-	packetSender.Wait() // wait for the packet sender to send all packets
+	sender.Wait() // wait for the packet sender to send all packets
 
 	<-time.After(s.ResponseTimeout) // wait for the response timeout
 	packetReceiver.Close()
 
 	<-masterDone // wait for master to finish processing what is already enqueued by the packet receiver
 	close(masterDone)
+
+	s.guessOperatingSystems()
 	return nil
 }
 
+// guessOperatingSystems guesses the operating systems of the hosts that replied to probes. A guess only replaces the one made from
+// pinging the host if it is at least as confident.
+func (s *TCPSynScanner) guessOperatingSystems() {
+	for addr, obs := range s.osObservations {
+		hostResult, found := s.results.Results[addr]
+		if !found {
+			continue
+		}
+		guess := guessOS(obs, osSignatures)
+		if guess != nil && (hostResult.OS == nil || guess.Confidence >= hostResult.OS.Confidence) {
+			hostResult.OS = guess
+			s.results.Results[addr] = hostResult
+			s.stream.writeHostResult(hostResult)
+		}
+	}
+}
+
 func (s *TCPSynScanner) getTCPSynScanResults(ctx context.Context, packetReceiver packet.PacketReceiver, masterDone chan<- struct{}) {
 	// To Be Run By Main Worker (aggregator)
 	packetChan := packetReceiver.Packets()
@@ -247,6 +425,14 @@ func (s *TCPSynScanner) getTCPSynScanResults(ctx context.Context, packetReceiver
 			if !ok {
 				return
 			}
+			// a router or firewall on the way dropped the probe.
+			if unreachable, ok := parseICMPUnreachable(packet); ok {
+				if unreachable.protocol == layers.IPProtocolTCP {
+					recordPortState(s.results.Results, s.stream, unreachable.dst, PortNumber(unreachable.dstPort()), PortStateFiltered, false)
+				}
+				continue
+			}
+
 			// Must be TCP.
 			tcpLayer := packet.Layer(layers.LayerTypeTCP)
 			if tcpLayer == nil {
@@ -257,191 +443,70 @@ func (s *TCPSynScanner) getTCPSynScanResults(ctx context.Context, packetReceiver
 				continue
 			}
 
-			// must be a syn-ack
-			if !tcpPacket.SYN || !tcpPacket.ACK {
-				continue
-			}
-
-			ethLayer := packet.Layer(layers.LayerTypeEthernet)
-			if ethLayer == nil {
+			state, ok := s.Mode.responseState(tcpPacket)
+			if !ok {
 				continue
 			}
-			eth := ethLayer.(*layers.Ethernet)
 
-			var srcIP netip.Addr
-
-			// Determine IP version from the Ethernet EtherType and extract the source IP.
-			switch eth.EthernetType {
-			case layers.EthernetTypeIPv4:
-				ipLayer := packet.Layer(layers.LayerTypeIPv4)
-				if ipLayer == nil {
-					continue
-				}
-				ip := ipLayer.(*layers.IPv4)
-
-				addr, ok := netip.AddrFromSlice(ip.SrcIP)
-				if !ok {
-					continue
-				}
-				srcIP = addr
-			case layers.EthernetTypeIPv6:
-				ipLayer := packet.Layer(layers.LayerTypeIPv6)
-				if ipLayer == nil {
-					continue
-				}
-				ip := ipLayer.(*layers.IPv6)
-
-				addr, ok := netip.AddrFromSlice(ip.SrcIP)
-				if !ok {
-					continue
-				}
-				srcIP = addr
-			default:
+			srcIP, ok := packetSourceAddr(packet)
+			if !ok {
 				continue
 			}
 
-			srcPort := uint16(tcpPacket.SrcPort)
-
 			hostResult, found := s.results.Results[srcIP]
 			if !found {
 				// response not from our scan
 				continue
 			}
-			hostResult.HostState = HostStateUp
-
-			portIndex, found := hostResult.portIndex[PortNumber(srcPort)]
-			if !found {
-				continue
+			if hostResult.HostState != HostStateUp {
+				s.setDefaultPortStates(&hostResult)
+				s.results.Results[srcIP] = hostResult
 			}
+			recordPortState(s.results.Results, s.stream, srcIP, PortNumber(tcpPacket.SrcPort), state, true)
 
-			port := hostResult.Ports[portIndex]
-			if port.State != PortStateOpen {
-				port.State = PortStateOpen
-				hostResult.OpenPorts++
-				hostResult.ClosedPorts--
+			if obs, ok := observeTCP(packet, tcpPacket); ok {
+				if old, found := s.osObservations[srcIP]; !found || obs.better(old) {
+					s.osObservations[srcIP] = obs
+				}
 			}
+		}
+	}
+}
 
-			hostResult.Ports[portIndex] = port
-			s.results.Results[srcIP] = hostResult
+// setDefaultPortStates sets the ports of hostResult that nothing was learnt about yet to the default state of the scan's mode.
+func (s *TCPSynScanner) setDefaultPortStates(hostResult *HostResult) {
+	defaultState := s.Mode.defaultPortState()
+	if defaultState == PortStateClosed {
+		return
+	}
+	for _, port := range hostResult.Ports {
+		if port.State == PortStateClosed {
+			hostResult.setPortState(port.Number, defaultState)
 		}
 	}
 }
 
-func (s *TCPSynScanner) synScanTCPPort(jobs chan PortScanJob, packetSender packet.PacketSender, localhostPacketSender packet.PacketSender) error {
+func (s *TCPSynScanner) synScanTCPPort(jobs chan PortScanJob, sender *rawSender) error {
 	// to be run by workers
 
 	packetBuf := gopacket.NewSerializeBuffer()
-	packetBufOpts := gopacket.SerializeOptions{
-		FixLengths:       true,
-		ComputeChecksums: true,
-	}
 
 	for job := range jobs {
-		portNum := job.target.Port()
-		addr := job.target.Addr()
-
-		route, err := s.router.Lookup(addr)
-		if err != nil {
-			return err
-		}
-
-		ps := packetSender
-		if addr == route.SrcAddr {
-			// if the target addr is the address of the interface, meaning we are sending to ourselves, we use the localhostPacketSender
-			ps = localhostPacketSender
-		}
-
-		packetHeaders := make([]gopacket.SerializableLayer, 0, 3)
-
-		iface := &route.Interface
-		if ps.Type() != packet.PacketSenderTypeIPLayer {
-			// If the packetSender is of type PacketSenderTypeIPLayer we dont bother with the ethernet header at all
-
-			var dstMac netutil.MAC
-
-			if addr == route.SrcAddr {
-				// if the target is the interface's ip we use the looback interface instead
-				iface, err = netutil.LoopbackInterface(s.ifaceProvider)
-				if err != nil {
-					return err
-				}
-			} else {
-				dstMac, err = s.macResolver.Resolve(route.NextHop)
-				var macErr resolving.ErrMacNotFound
-				if err != nil {
-					if !errors.As(err, &macErr) {
-						return err
-					}
-					// if we fail to get mac we just set to the broadcast.
-					dstMac = netutil.MAC{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
-				}
-			}
-			srcMac := netutil.MAC(iface.HardwareAddr)
-			if dstMac == nil {
-				dstMac = zeroMac()
-			}
-			if srcMac == nil {
-				srcMac = zeroMac()
-			}
-
-			eth := &layers.Ethernet{
-				SrcMAC:       net.HardwareAddr(srcMac),
-				DstMAC:       net.HardwareAddr(dstMac),
-				EthernetType: layers.EthernetTypeIPv4,
-			}
-			if addr.Is6() {
-				eth.EthernetType = layers.EthernetTypeIPv6
-			}
-
-			packetHeaders = append(packetHeaders, eth)
-		}
-
 		tcp := &layers.TCP{
 			SrcPort: layers.TCPPort(randomEphemeralPort()),
-			DstPort: layers.TCPPort(portNum),
+			DstPort: layers.TCPPort(job.target.Port()),
 			Seq:     rand.Uint32(),
-			SYN:     true,
 			Window:  65535,
 		}
-
-		var ip gopacket.SerializableLayer
-		if addr.Is4() {
-			ip4 := &layers.IPv4{
-				Version:  4,
-				IHL:      5,
-				TTL:      64,
-				Protocol: layers.IPProtocolTCP,
-				SrcIP:    route.SrcAddr.AsSlice(),
-				DstIP:    addr.AsSlice(),
-			}
-			tcp.SetNetworkLayerForChecksum(ip4)
-			ip = ip4
-		} else {
-			ip6 := &layers.IPv6{
-				Version:    6,
-				HopLimit:   64,
-				NextHeader: layers.IPProtocolTCP,
-				SrcIP:      route.SrcAddr.AsSlice(),
-				DstIP:      addr.AsSlice(),
-			}
-			tcp.SetNetworkLayerForChecksum(ip6)
-			ip = ip6
+		s.Mode.setFlags(tcp)
+		if s.Mode == TCPScanModeSyn {
+			tcp.Options = synProbeOptions()
 		}
 
-		packetHeaders = append(packetHeaders, ip, tcp)
-
-		err = gopacket.SerializeLayers(packetBuf, packetBufOpts, packetHeaders...)
+		err := sender.send(packetBuf, job.target.Addr(), tcp)
 		if err != nil {
 			return err
 		}
-
-		packetBytes := packetBuf.Bytes()
-
-		err = ps.SendPacket(packetBytes, iface)
-		if err != nil {
-			return err
-		}
-
 	}
 
 	return nil
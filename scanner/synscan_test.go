@@ -0,0 +1,217 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/packet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTCPScanModes(t *testing.T) {
+	tests := []struct {
+		mode         TCPScanMode
+		wantFlags    layers.TCP
+		defaultState PortState
+		// response is the answer from a port that the scan learns wantState from.
+		response  layers.TCP
+		wantState PortState
+	}{
+		{
+			mode:         TCPScanModeSyn,
+			wantFlags:    layers.TCP{SYN: true},
+			defaultState: PortStateClosed,
+			response:     layers.TCP{SYN: true, ACK: true},
+			wantState:    PortStateOpen,
+		},
+		{
+			mode:         TCPScanModeFin,
+			wantFlags:    layers.TCP{FIN: true},
+			defaultState: PortStatePossibleFilter,
+			response:     layers.TCP{RST: true, ACK: true},
+			wantState:    PortStateClosed,
+		},
+		{
+			mode:         TCPScanModeNull,
+			defaultState: PortStatePossibleFilter,
+			response:     layers.TCP{RST: true},
+			wantState:    PortStateClosed,
+		},
+		{
+			mode:         TCPScanModeXmas,
+			wantFlags:    layers.TCP{FIN: true, PSH: true, URG: true},
+			defaultState: PortStatePossibleFilter,
+			response:     layers.TCP{RST: true},
+			wantState:    PortStateClosed,
+		},
+		{
+			mode:         TCPScanModeAck,
+			wantFlags:    layers.TCP{ACK: true},
+			defaultState: PortStateFiltered,
+			response:     layers.TCP{RST: true},
+			wantState:    PortStateUnfiltered,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			var probe layers.TCP
+			tt.mode.setFlags(&probe)
+			probe.Ack = 0
+			assert.Equal(t, tt.wantFlags, probe)
+			assert.Equal(t, tt.defaultState, tt.mode.defaultPortState())
+
+			state, ok := tt.mode.responseState(&tt.response)
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantState, state)
+
+			// answers that tell nothing about the port are ignored.
+			_, ok = tt.mode.responseState(&layers.TCP{ACK: true, PSH: true})
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestHostResultSetPortState(t *testing.T) {
+	results := getResultSet([]netip.Prefix{netip.MustParsePrefix("10.1.1.1/32")}, []PortNumber{22, 80, 443}, nil, nil, "tcp")
+	host := results[netip.MustParseAddr("10.1.1.1")]
+
+	port, changed := host.setPortState(22, PortStateOpen)
+	assert.True(t, changed)
+	assert.Equal(t, PortStateOpen, port.State)
+
+	_, changed = host.setPortState(22, PortStateOpen)
+	assert.False(t, changed)
+	_, changed = host.setPortState(8080, PortStateOpen)
+	assert.False(t, changed)
+
+	host.setPortState(80, PortStatePossibleFilter)
+	host.setPortState(443, PortStateFiltered)
+	assert.Equal(t, 1, host.OpenPorts)
+	assert.Equal(t, 0, host.ClosedPorts)
+	assert.Equal(t, 2, host.FilteredPorts)
+	assert.Equal(t, 3, host.TotalNumberOfPorts())
+
+	host.setPortState(443, PortStateUnfiltered)
+	assert.Equal(t, 1, host.FilteredPorts)
+	assert.Equal(t, 1, host.UnfilteredPorts)
+	assert.Equal(t, 3, host.TotalNumberOfPorts())
+}
+
+func TestTCPSynScanResultsIgnoresOtherHosts(t *testing.T) {
+	// tcpReply answers come from 10.1.1.1.
+	scanned := netip.MustParseAddr("10.1.1.1")
+	synAck := &layers.TCP{SYN: true, ACK: true, Window: 64240, Options: tcpOptions("M,S,T,N,W", 7)}
+
+	tests := []struct {
+		name    string
+		target  netip.Addr
+		observe bool
+	}{
+		{name: "scanned host", target: scanned, observe: true},
+		{name: "host outside the scan", target: netip.MustParseAddr("10.1.1.3")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &TCPSynScanner{TCPSynScanOptions: TCPSynScanOptions{Mode: TCPScanModeSyn}}
+			s.results.Results = getResultSet([]netip.Prefix{netip.PrefixFrom(tt.target, 32)}, []PortNumber{22}, nil, nil, "tcp")
+			s.osObservations = make(map[netip.Addr]osObservation)
+
+			receiver := make(chanPacketReceiver, 1)
+			receiver <- tcpReply(t, 64, synAck)
+			receiver.Close()
+			s.getTCPSynScanResults(context.Background(), receiver, make(chan struct{}, 1))
+
+			_, found := s.osObservations[scanned]
+			assert.Equal(t, tt.observe, found)
+			assert.Len(t, s.results.Results, 1)
+		})
+	}
+}
+
+// capturePacketSender is a link layer packet sender that keeps the packets sent with it.
+type capturePacketSender struct {
+	packets [][]byte
+}
+
+func (s *capturePacketSender) Type() packet.PacketSenderType {
+	return packet.PacketSenderTypeLinkLayer
+}
+
+func (s *capturePacketSender) SendPacket(packet []byte, iface *netutil.Interface) error {
+	s.packets = append(s.packets, slices.Clone(packet))
+	return nil
+}
+
+func (s *capturePacketSender) Wait() {}
+
+func (s *capturePacketSender) Close() error {
+	return nil
+}
+
+func TestSynScanUsesNeighbourMACs(t *testing.T) {
+	host := netip.MustParseAddr("192.168.1.10")
+	mac := netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	eth0 := netutil.Interface{Interface: net.Interface{Index: 2, Name: "eth0", HardwareAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}}}
+
+	s := &TCPSynScanner{
+		TCPSynScanOptions: TCPSynScanOptions{Mode: TCPScanModeSyn},
+		macResolver:       resolving.NewResolver(nil),
+	}
+	// as found by ARP discovery before the ports are scanned.
+	addNeighbourMACs(s.macResolver, PingScanResultsMap{host: {IP: host, HostState: HostStateUp, MAC: mac}})
+
+	packetSender := &capturePacketSender{}
+	sender := &rawSender{
+		packetSender:          packetSender,
+		localhostPacketSender: packetSender,
+		router: testRouter{
+			{Network: netip.MustParsePrefix("192.168.1.0/24"), SrcAddr: netip.MustParseAddr("192.168.1.5"), NextHop: host, Interface: eth0, DirectlyConnected: true},
+		},
+		macResolver: s.macResolver,
+	}
+
+	jobs := make(chan PortScanJob, 1)
+	jobs <- PortScanJob{target: netip.AddrPortFrom(host, 22)}
+	close(jobs)
+	require.NoError(t, s.synScanTCPPort(jobs, sender))
+
+	require.Len(t, packetSender.packets, 1)
+	frame := gopacket.NewPacket(packetSender.packets[0], layers.LayerTypeEthernet, gopacket.Default)
+	eth, ok := frame.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	require.True(t, ok)
+	assert.Equal(t, net.HardwareAddr(mac), eth.DstMAC)
+}
+
+func TestTCPSynScanResultsDownHostAnswers(t *testing.T) {
+	// tcpReply answers come from 10.1.1.1 port 22.
+	host := netip.MustParseAddr("10.1.1.1")
+	s := &TCPSynScanner{TCPSynScanOptions: TCPSynScanOptions{Mode: TCPScanModeFin}}
+	s.results.Results = getResultSet([]netip.Prefix{netip.PrefixFrom(host, 32)}, []PortNumber{22, 80, 443}, nil,
+		PingScanResultsMap{host: {HostState: HostStateDown}}, "tcp")
+	s.osObservations = make(map[netip.Addr]osObservation)
+
+	receiver := make(chanPacketReceiver, 1)
+	receiver <- tcpReply(t, 64, &layers.TCP{RST: true, ACK: true})
+	receiver.Close()
+	s.getTCPSynScanResults(context.Background(), receiver, make(chan struct{}, 1))
+
+	hostResult := s.results.Results[host]
+	assert.Equal(t, HostStateUp, hostResult.HostState)
+	states := map[PortNumber]PortState{}
+	for _, port := range hostResult.Ports {
+		states[port.Number] = port.State
+	}
+	assert.Equal(t, map[PortNumber]PortState{22: PortStateClosed, 80: PortStatePossibleFilter, 443: PortStatePossibleFilter}, states)
+	assert.Equal(t, 1, hostResult.ClosedPorts)
+	assert.Equal(t, 2, hostResult.FilteredPorts)
+}
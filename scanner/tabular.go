@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// tabularResults is implemented by scan results that can be flattened into a table of rows for delimited output formats like csv and tsv.
+type tabularResults interface {
+	// table returns the results as rows of columns. The first row is the header row.
+	table() [][]string
+}
+
+// getDelimitedResults writes the scan results as delimiter separated values where each row of the results' table is one line.
+func getDelimitedResults(r ScanResults, delimiter rune) ([]byte, error) {
+	tabular, ok := r.(tabularResults)
+	if !ok {
+		return nil, fmt.Errorf("delimited output is not supported for these scan results")
+	}
+
+	buf := bytes.Buffer{}
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+
+	err := writer.WriteAll(tabular.table())
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// portScanTable flattens port scan results into one row per host and port, with hosts sorted by address.
+func portScanTable(r portScanResults) [][]string {
+	info := r.portScanInfo()
+
+	rows := [][]string{{"ip", "hostname", "host_state", "rtt_ms", "port", "protocol", "state", "service", "version"}}
+	for _, hostResult := range sortedHostResults(r.hostResults()) {
+		if hostResult.HostState == HostStateDown && info.printUpOnly {
+			continue
+		}
+		for _, port := range hostResult.Ports {
+			if port.State == PortStateClosed && info.printOpenOnly {
+				continue
+			}
+			rows = append(rows, []string{
+				hostResult.Addr.String(),
+				hostResult.HostName,
+				hostResult.HostState.String(),
+				durationMillis(hostResult.AverageRTT),
+				strconv.Itoa(int(port.Number)),
+				port.Protocol,
+				port.State.String(),
+				port.Name,
+				port.VersionInfo(),
+			})
+		}
+	}
+
+	return rows
+}
+
+// sortedHostResults returns the host results ordered by their IP addresses.
+func sortedHostResults(results HostResults) []HostResult {
+	addrs := make([]netip.Addr, 0, len(results))
+	for addr := range results {
+		addrs = append(addrs, addr)
+	}
+	slices.SortFunc(addrs, func(a, b netip.Addr) int {
+		return a.Compare(b)
+	})
+
+	sorted := make([]HostResult, 0, len(addrs))
+	for _, addr := range addrs {
+		sorted = append(sorted, results[addr])
+	}
+	return sorted
+}
+
+// durationMillis formats d as a number of milliseconds which is easier for spreadsheets and scripts to work with than Go's duration strings.
+func durationMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDelimitedResults(t *testing.T) {
+	arpResults := &ARPScanResults{
+		HostResults: []ARPHostResult{
+			{
+				IPAddr:   netip.MustParseAddr("10.1.1.1"),
+				MacAddr:  netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+				HostName: "router.lan",
+				Vendor:   "Acme, Inc.",
+			},
+		},
+	}
+
+	portResults := &TCPFullScanResults{
+		Results: HostResults{
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:       netip.MustParseAddr("10.1.1.2"),
+				HostState:  HostStateUp,
+				AverageRTT: 1500 * time.Microsecond,
+				Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen, Product: "OpenSSH", Version: "9.6", ExtraInfo: "protocol 2.0"},
+					{Number: 23, Name: "telnet", Protocol: "tcp", State: PortStateClosed},
+				},
+			},
+			netip.MustParseAddr("10.1.1.1"): {
+				Addr:      netip.MustParseAddr("10.1.1.1"),
+				HostState: HostStateDown,
+				Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateClosed},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		results   ScanResults
+		delimiter rune
+		want      string
+	}{
+		{
+			name:      "arp csv quotes fields with commas",
+			results:   arpResults,
+			delimiter: ',',
+			want: "ip,mac,hostname,vendor\n" +
+				"10.1.1.1,00:1a:2b:3c:4d:5e,router.lan,\"Acme, Inc.\"\n",
+		},
+		{
+			name:      "arp tsv",
+			results:   arpResults,
+			delimiter: '\t',
+			want: "ip\tmac\thostname\tvendor\n" +
+				"10.1.1.1\t00:1a:2b:3c:4d:5e\trouter.lan\tAcme, Inc.\n",
+		},
+		{
+			name:      "port scan has one row per host and port sorted by host",
+			results:   portResults,
+			delimiter: ',',
+			want: "ip,hostname,host_state,rtt_ms,port,protocol,state,service,version\n" +
+				"10.1.1.1,,down,0.000,22,tcp,closed,ssh,\n" +
+				"10.1.1.2,,up,1.500,22,tcp,open,ssh,OpenSSH 9.6 (protocol 2.0)\n" +
+				"10.1.1.2,,up,1.500,23,tcp,closed,telnet,\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getDelimitedResults(tt.results, tt.delimiter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestPortScanTableFilters(t *testing.T) {
+	results := &UDPScanResults{
+		Results: HostResults{
+			netip.MustParseAddr("10.1.1.1"): {
+				Addr:      netip.MustParseAddr("10.1.1.1"),
+				HostState: HostStateDown,
+				Ports:     []Port{{Number: 53, Protocol: "udp", State: PortStateClosed}},
+			},
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:      netip.MustParseAddr("10.1.1.2"),
+				HostState: HostStateUp,
+				Ports: []Port{
+					{Number: 53, Protocol: "udp", State: PortStatePossibleFilter},
+					{Number: 67, Protocol: "udp", State: PortStateClosed},
+				},
+			},
+		},
+		printUpOnly:   true,
+		printOpenOnly: true,
+	}
+
+	rows := results.table()
+	require.Len(t, rows, 2)
+	assert.Equal(t, []string{"10.1.1.2", "", "up", "0.000", "53", "udp", "open | filtered", "", ""}, rows[1])
+}
@@ -5,9 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/netip"
-	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/kakeetopius/gscn/internal/log"
@@ -21,6 +19,7 @@ type TCPFullScanner struct {
 	results    TCPFullScanResults
 	hostStates PingScanResultsMap
 	logger     log.Logger
+	stream     *resultStream
 }
 
 type TCPFullScanOptions struct {
@@ -33,6 +32,27 @@ type TCPFullScanOptions struct {
 	AddUnknownHostNames bool
 	PingTimeout         time.Duration
 	SkipPingScan        bool
+	// Discovery are the probes that find out which hosts are up before their ports are scanned. Hosts only get echo requests if it is
+	// empty.
+	Discovery DiscoveryOptions
+	// ServiceVersion turns on service detection, which connects to open ports and matches what the services on them answer to probes
+	// to find out which software they run.
+	ServiceVersion bool
+	// TLS turns on TLS inspection, which collects the TLS version, cipher suite and certificate chain of open ports that speak TLS or
+	// support STARTTLS.
+	TLS bool
+	// CertExpiryWarning is how close to expiring the certificates found by TLS inspection can get before a warning is added to the
+	// results. Setting it turns on TLS inspection.
+	CertExpiryWarning time.Duration
+	// HTTP turns on HTTP fingerprinting, which records the status code, headers, page title and favicon hash of open ports that answer
+	// HTTP or HTTPS.
+	HTTP bool
+	// SSHHostKeys turns on collection of the banner, host key algorithms and host key fingerprints of open ports that are port 22 or
+	// were identified as SSH.
+	SSHHostKeys bool
+	// ServiceTimeout is how long service detection, TLS inspection, HTTP fingerprinting and SSH host key collection wait for an answer
+	// to each probe.
+	ServiceTimeout time.Duration
 
 	PrintUpOnly   bool
 	PrintOpenOnly bool
@@ -41,6 +61,10 @@ type TCPFullScanOptions struct {
 type TCPFullScanResults struct {
 	Results HostResults      `json:"results"`
 	Stats   TCPFullScanStats `json:"stats"`
+	// PingSkipped is set when hosts were treated as up without being pinged first.
+	PingSkipped bool `json:"ping_skipped,omitempty"`
+	// CertificateWarnings are the certificates that have expired or are close to expiring.
+	CertificateWarnings []CertificateWarning `json:"certificate_warnings,omitempty"`
 
 	printUpOnly   bool `json:"-"`
 	printOpenOnly bool `json:"-"`
@@ -55,6 +79,9 @@ func NewTCPFullScanner(opts TCPFullScanOptions) *TCPFullScanner {
 	if opts.HostNames == nil {
 		opts.HostNames = make(map[netip.Addr]string)
 	}
+	if opts.ServiceTimeout == 0 {
+		opts.ServiceTimeout = defaultServiceTimeout
+	}
 	return &TCPFullScanner{
 		TCPFullScanOptions: opts,
 		results: TCPFullScanResults{
@@ -70,17 +97,37 @@ func (s *TCPFullScanner) Scan(ctx context.Context) (ScanResults, error) {
 	if err != nil {
 		return nil, err
 	}
+	if s.ServiceVersion {
+		detectServices(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.TLS || s.CertExpiryWarning > 0 {
+		inspectTLS(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.HTTP {
+		fingerprintHTTP(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.SSHHostKeys {
+		collectSSHHostKeys(ctx, s.results.Results, s.Workers, s.ServiceTimeout, s.stream)
+	}
+	if s.CertExpiryWarning > 0 {
+		s.results.CertificateWarnings = certificateWarnings(s.results.Results, s.CertExpiryWarning, time.Now())
+	}
 	stopTime := time.Now()
 
 	s.results.Stats.ScanTime = stopTime.Sub(startTime)
 	s.results.Stats.TotalNumOfHosts = len(s.results.Results)
 	s.results.printOpenOnly = s.PrintOpenOnly
 	s.results.printUpOnly = s.PrintUpOnly
+	s.results.PingSkipped = s.SkipPingScan
 
 	s.addResultsInfo()
 	return &s.results, nil
 }
 
+func (s *TCPFullScanner) setResultStream(stream *resultStream) {
+	s.stream = stream
+}
+
 func (s *TCPFullScanner) addResultsInfo() {
 	if s.AddUnknownHostNames {
 		spinner, _ := pterm.DefaultSpinner.Start("Resolving Host Names....")
@@ -95,22 +142,39 @@ func (s *TCPFullScanner) addResultsInfo() {
 			name := netutil.ReverseLookup(ctx, host.String())
 			results.HostName = name
 			s.results.Results[host] = results
+			if name != "" && results.HostState == HostStateUp {
+				s.stream.writeHostResult(results)
+			}
 		}
 	}
 }
 
 func (r *TCPFullScanResults) Print() {
 	printScanResultsMap(r.Results, r.Stats.ScanTime, r.printUpOnly, r.printOpenOnly)
+	printCertificateWarnings(r.CertificateWarnings)
 }
 
-func (r *TCPFullScanResults) String() string {
-	stringBuilder := strings.Builder{}
+func (r *TCPFullScanResults) hostResults() HostResults {
+	return r.Results
+}
+
+func (r *TCPFullScanResults) portScanInfo() portScanInfo {
+	return portScanInfo{
+		ScanType:      "connect",
+		Protocol:      "tcp",
+		ScanTime:      r.Stats.ScanTime,
+		pingSkipped:   r.PingSkipped,
+		printUpOnly:   r.printUpOnly,
+		printOpenOnly: r.printOpenOnly,
+	}
+}
 
-	hostTmpl := template.Must(template.New("host_result").Parse(HostResultTemplate))
-	tmpl := template.Must(hostTmpl.New("tcp_full_scan").Parse(TCPFullScanResultsTemplate))
+func (r *TCPFullScanResults) table() [][]string {
+	return portScanTable(r)
+}
 
-	tmpl.Execute(&stringBuilder, r)
-	return stringBuilder.String()
+func (r *TCPFullScanResults) String() string {
+	return executeResultsTemplate("tcp_full_scan", TCPFullScanResultsTemplate, r)
 }
 
 func (s *TCPFullScanner) runTCPFullScan(ctx context.Context) error {
@@ -127,13 +191,21 @@ func (s *TCPFullScanner) runTCPFullScan(ctx context.Context) error {
 	}
 
 	if !s.SkipPingScan {
-		pingResults, err := pingHosts(ctx, s.Targets, s.PingTimeout, int(s.Workers), s.PingCount) // first check if hosts are up.
+		// first check if hosts are up.
+		pingResults, err := pingHosts(ctx, PingScanOptions{
+			Targets:          s.Targets,
+			PingTimeout:      s.PingTimeout,
+			Workers:          s.Workers,
+			PingCount:        s.PingCount,
+			DiscoveryOptions: s.Discovery,
+		})
 		if err != nil {
 			return err
 		}
 		s.hostStates = pingResults
 	}
 	s.results.Results = getResultSet(s.Targets, s.TargetPorts, s.HostNames, s.hostStates, "tcp")
+	streamUpHosts(s.results.Results, s.stream)
 
 	jobs := make(chan PortScanJob, numWorkers)
 	workerResultsChan := make(chan PortScanWorkerResult, numWorkers)
@@ -190,9 +262,15 @@ func (s *TCPFullScanner) getTCPFullScanResults(ctx context.Context, workerResult
 				portIndex := hostResult.portIndex[result.Port.Number]
 				hostResult.Ports[portIndex].State = PortStateOpen
 
-				hostResult.HostState = HostStateUp // sometimes ping scan failed but port scan succeeds so if port is open then host is up.
+				if hostResult.HostState != HostStateUp {
+					// sometimes ping scan failed but port scan succeeds so if port is open then host is up.
+					hostResult.HostState = HostStateUp
+					s.stream.writeHostResult(hostResult)
+				}
 				hostResult.OpenPorts++
 				hostResult.ClosedPorts--
+
+				s.stream.writePort(hostIP, hostResult.Ports[portIndex])
 			}
 
 			s.results.Results[hostIP] = hostResult
@@ -1,5 +1,198 @@
 package scanner
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/pterm/pterm"
+)
+
+// TemplateFuncs are the functions available to the built-in templates and to user supplied templates on top of the ones text/template
+// provides:
+//
+//	pad WIDTH VALUE       VALUE left aligned and padded with spaces to WIDTH characters.
+//	padLeft WIDTH VALUE   VALUE right aligned and padded with spaces to WIDTH characters.
+//	color NAME VALUE      VALUE coloured with one of red, green, yellow, blue, magenta, cyan, white or gray.
+//	duration DURATION     DURATION rounded to the millisecond eg 1.532s.
+//	date TIME             The date of TIME eg 2024-01-31.
+//	mac ADDR              ADDR as an upper case, colon separated MAC address eg 00:1A:2B:3C:4D:5E.
+//	add A B               The sum of the integers A and B.
+//	join ADDRS            The IP addresses in ADDRS separated by commas.
+//
+// Since the value is the last argument, functions can be used in pipelines eg {{ .State | color "green" | pad 10 }}.
+var TemplateFuncs = template.FuncMap{
+	"pad": func(width int, value any) string {
+		return fmt.Sprintf("%-*v", width, value)
+	},
+	"padLeft": func(width int, value any) string {
+		return fmt.Sprintf("%*v", width, value)
+	},
+	"color": func(name string, value any) (string, error) {
+		color, ok := templateColors[name]
+		if !ok {
+			return "", fmt.Errorf("unknown color: %v", name)
+		}
+		return color.Sprint(value), nil
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"date": func(t time.Time) string {
+		return t.Format(time.DateOnly)
+	},
+	"mac": func(addr any) (string, error) {
+		switch addr := addr.(type) {
+		case netutil.MAC:
+			return strings.ToUpper(addr.String()), nil
+		case net.HardwareAddr:
+			return strings.ToUpper(addr.String()), nil
+		case string:
+			return strings.ToUpper(addr), nil
+		default:
+			return "", fmt.Errorf("cannot format %T as a mac address", addr)
+		}
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+	"join": joinAddrs,
+}
+
+var templateColors = map[string]pterm.Color{
+	"red":     pterm.FgRed,
+	"green":   pterm.FgGreen,
+	"yellow":  pterm.FgYellow,
+	"blue":    pterm.FgBlue,
+	"magenta": pterm.FgMagenta,
+	"cyan":    pterm.FgCyan,
+	"white":   pterm.FgWhite,
+	"gray":    pterm.FgGray,
+}
+
+// newResultsTemplate parses text into a template that has access to TemplateFuncs. Templates for port scan results can also use the
+// "host_result" template to print a single host and the "certificate_warnings" template to list certificate warnings.
+func newResultsTemplate(name string, text string, portScan bool) (*template.Template, error) {
+	tmpl := template.New(name).Funcs(TemplateFuncs)
+	if portScan {
+		hostTmpl, err := tmpl.New("host_result").Parse(HostResultTemplate)
+		if err != nil {
+			return nil, err
+		}
+		_, err = hostTmpl.Parse(CertificateWarningsTemplate)
+		if err != nil {
+			return nil, err
+		}
+		tmpl = hostTmpl.New(name)
+	}
+	return tmpl.Parse(text)
+}
+
+// executeResultsTemplate renders the built-in template text with the scan results r.
+func executeResultsTemplate(name string, text string, r any) string {
+	_, portScan := r.(portScanResults)
+	tmpl := template.Must(newResultsTemplate(name, text, portScan))
+
+	stringBuilder := strings.Builder{}
+	tmpl.Execute(&stringBuilder, r)
+	return stringBuilder.String()
+}
+
+// templateName returns the name a user supplied template for the scan results r has in the templates directory without the .tmpl extension.
+func templateName(r ScanResults) string {
+	switch r.(type) {
+	case *TCPFullScanResults:
+		return "tcp"
+	case *TCPSynScanResults:
+		return "syn"
+	case *UDPScanResults:
+		return "udp"
+	case *PingScanResults:
+		return "ping"
+	case *ARPScanResults:
+		return "arp"
+	case *NDPScanResults:
+		return "ndp"
+	case DHCPv4ScannerResults, *DHCPv4ScannerResults:
+		return "dhcp"
+	case *RouterScanResults:
+		return "router"
+	case *WiFiScanResults:
+		return "wifi"
+	case *TraceResults:
+		return "trace"
+	case *MTUResults:
+		return "mtu"
+	case *ScanDiff:
+		return "diff"
+	case *HistoryScans:
+		return "history"
+	case *HostHistory:
+		return "host_history"
+	default:
+		return ""
+	}
+}
+
+// templatedResults are scan results whose text output comes from a user supplied template.
+type templatedResults struct {
+	ScanResults
+	text string
+}
+
+func (r templatedResults) Print() {
+	fmt.Print(r.text)
+}
+
+func (r templatedResults) String() string {
+	return r.text
+}
+
+// applyResultsTemplate renders the results with the user supplied template selected in opts. The results are returned unchanged when no
+// template applies to them.
+func applyResultsTemplate(r ScanResults, opts ScanOptions) (ScanResults, error) {
+	path := opts.Template
+	if path == "" && opts.TemplatesDir != "" {
+		name := templateName(r)
+		if name == "" {
+			return r, nil
+		}
+		path = filepath.Join(opts.TemplatesDir, name+".tmpl")
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return r, nil
+		}
+	}
+	if path == "" {
+		return r, nil
+	}
+
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read template: %w", err)
+	}
+	_, portScan := r.(portScanResults)
+	tmpl, err := newResultsTemplate(filepath.Base(path), string(text), portScan)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template: %w", err)
+	}
+
+	buf := bytes.Buffer{}
+	err = tmpl.Execute(&buf, r)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute template: %w", err)
+	}
+
+	return templatedResults{ScanResults: r, text: buf.String()}, nil
+}
+
 var ARPScanResultsTemplate = `
 ARP Scan Results
 ================
@@ -37,12 +230,77 @@ Host:      {{ .Addr }}{{ if .HostName }} - {{ .HostName }}{{ end }} ({{ .HostSta
 Open:      {{ .OpenPorts }}
 Closed:    {{ .ClosedPorts }}
 Filtered:  {{ .FilteredPorts }}
+{{- if .UnfilteredPorts }}
+Unfiltered: {{ .UnfilteredPorts }}
+{{- end }}
 Avg RTT:   {{ .AverageRTT }}
+{{- if .OS }}
+OS:        {{ .OS }}
+{{- end }}
+{{- if .MAC }}
+MAC:       {{ .MAC }}{{ if .Vendor }} ({{ .Vendor }}){{ end }}
+{{- end }}
 {{ if eq (.HostState.String) "up" }}
-{{ printf "%-8s %-12s %-10s %s" "PORT" "PROTOCOL" "STATE" "SERVICE" }}
-{{ printf "%-8s %-12s %-10s %s" "----" "--------" "-----" "-------" }}
+{{ printf "%-8s %-12s %-10s %-15s %s" "PORT" "PROTOCOL" "STATE" "SERVICE" "VERSION" }}
+{{ printf "%-8s %-12s %-10s %-15s %s" "----" "--------" "-----" "-------" "-------" }}
 {{- range .Ports }}
-{{ printf "%-8d %-12s %-10s %s" .Number .Protocol .State .Name }}
+{{ printf "%-8d %-12s %-10s %-15s %s" .Number .Protocol .State .Name .VersionInfo }}
+{{- end }}
+{{- range .Ports }}
+{{- if .TLS }}
+
+TLS on {{ .Number }}/{{ .Protocol }}: {{ .TLS.Version }} {{ .TLS.CipherSuite }}{{ if .TLS.StartTLS }} (STARTTLS {{ .TLS.StartTLS }}){{ end }}
+{{- range $i, $cert := .TLS.Certificates }}
+  Certificate {{ add $i 1 }}
+    Subject:   {{ .Subject }}
+{{- if .SANs }}
+    SANs:      {{ range $j, $san := .SANs }}{{ if $j }}, {{ end }}{{ $san }}{{ end }}
+{{- end }}
+    Issuer:    {{ .Issuer }}
+    Valid:     {{ date .NotBefore }} to {{ date .NotAfter }}
+    Key:       {{ .KeyType }} {{ .KeyBits }} bits
+    Signature: {{ .SignatureAlgorithm }}
+{{- end }}
+{{- end }}
+{{- if .HTTP }}
+
+HTTP on {{ .Number }}/{{ .Protocol }}: {{ .HTTP.StatusCode }}{{ if .HTTP.Title }} "{{ .HTTP.Title }}"{{ end }}
+    URL:          {{ .HTTP.URL }}
+{{- if .HTTP.Server }}
+    Server:       {{ .HTTP.Server }}
+{{- end }}
+{{- if .HTTP.PoweredBy }}
+    X-Powered-By: {{ .HTTP.PoweredBy }}
+{{- end }}
+{{- if .HTTP.Location }}
+    Location:     {{ .HTTP.Location }}
+{{- end }}
+{{- if .HTTP.FaviconHash }}
+    Favicon Hash: {{ .HTTP.FaviconHash }}
+{{- end }}
+{{- end }}
+{{- if .SSH }}
+
+SSH on {{ .Number }}/{{ .Protocol }}: {{ .SSH.Banner }}
+    Host Key Algorithms: {{ range $i, $alg := .SSH.HostKeyAlgorithms }}{{ if $i }},{{ end }}{{ $alg }}{{ end }}
+{{- range .SSH.HostKeys }}
+    {{ printf "%-20s" .Type }} {{ .Fingerprint }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+`
+
+// CertificateWarningsTemplate defines the "certificate_warnings" template that lists the certificate warnings of TCP scan results.
+var CertificateWarningsTemplate = `
+{{- define "certificate_warnings" }}
+{{- if .CertificateWarnings }}
+
+Certificate Warnings
+--------------------
+{{- range .CertificateWarnings }}
+{{ .Addr }} port {{ .Port }}{{ if .HostName }} ({{ .HostName }}){{ end }} {{ .Subject }} {{ if .Expired }}expired{{ else }}expires{{ end }} on {{ date .NotAfter }}
+{{- end }}
 {{- end }}
 {{- end }}
 `
@@ -54,6 +312,8 @@ TCP Full Scan Results
 {{ template "host_result" . }}
 {{- end }}
 
+{{- template "certificate_warnings" . }}
+
 Stats
 -----
 Total Hosts Scanned: {{ .Stats.TotalNumOfHosts }}
@@ -61,12 +321,14 @@ Scan Duration:       {{ .Stats.ScanTime }}
 `
 
 var TCPSynScanResultsTemplate = `
-TCP SYN Scan Results
+TCP {{ .Mode.Name }} Scan Results
 =====================
 {{- range .Results }}
 {{ template "host_result" . }}
 {{- end }}
 
+{{- template "certificate_warnings" . }}
+
 Stats
 -----
 Total Hosts Scanned: {{ .Stats.TotalNumOfHosts }}
@@ -89,10 +351,10 @@ Scan Duration:       {{ .Stats.ScanTime }}
 var PingScanResultsTemplate = `
 Ping Scan Results
 =================
-{{ printf "%-40s %-10s %-10s %s" "IP ADDRESS" "HOSTNAME" "STATE" "AVG RTT" }}
-{{ printf "%-40s %-30s %-10s %s" "----------" "--------" "-----" "-------" }}
+{{ printf "%-40s %-10s %-10s %-12s %s" "IP ADDRESS" "HOSTNAME" "STATE" "AVG RTT" "OS" }}
+{{ printf "%-40s %-30s %-10s %-12s %s" "----------" "--------" "-----" "-------" "--" }}
 {{- range .HostResults }}
-{{ printf "%-40s %-30s %-10s %s" .IP .HostName .HostState .AverageRTT }}
+{{ printf "%-40s %-30s %-10s %-12s" .IP .HostName .HostState .AverageRTT }}{{ if .OS }} {{ .OS }}{{ end }}
 {{- end }}
 
 Stats
@@ -103,6 +365,35 @@ Down Hosts:          {{ .DownHosts }}
 Scan Time:           {{ .ScanTime }}
 `
 
+var TraceResultsTemplate = `
+Trace to {{ .Target }}{{ if .HostName }} ({{ .HostName }}){{ end }} with {{ .Method }} probes
+=====
+{{- range .Hops }}
+{{ printf "%3d" .TTL }}  {{ .Summary }}
+{{- end }}
+
+Stats
+-----
+Target Reached:   {{ .Reached }}
+Probes Sent:      {{ .Stats.ProbesSent }}
+Replies Received: {{ .Stats.RepliesReceived }}
+Trace Duration:   {{ .Stats.TraceTime }}
+`
+
+var MTUResultsTemplate = `
+Path MTU to {{ .Target }}{{ if .HostName }} ({{ .HostName }}){{ end }}
+===========
+Path MTU:      {{ .MTU }} bytes
+Interface MTU: {{ .InterfaceMTU }} bytes
+Limited By:    {{ if .LimitingHop }}{{ .LimitingHop }}{{ else if ge .MTU .InterfaceMTU }}the local interface{{ else }}an unknown hop{{ end }}
+Black Hole:    {{ .BlackHole }}
+
+Stats
+-----
+Probes Sent:   {{ .Stats.ProbesSent }}
+Scan Duration: {{ .Stats.ScanTime }}
+`
+
 var WiFiScanResultsTemplate = `
 WiFi Scan Results
 =================
@@ -146,3 +437,144 @@ Packets Sent:     {{ .Stats.PacketsSent }}
 Packets Received: {{ .Stats.PacketsReceived }}
 Scan Duration:    {{ .Stats.ScanDuration }}
 `
+
+var RouterScanResultsTemplate = `
+Router Discovery Results
+========================
+
+{{- range $i, $router := .Routers }}
+Router {{ add $i 1 }}
+--------
+IP Address:       {{ $router.IP }}
+MAC Address:      {{ $router.MACAddress }}
+Vendor:           {{ $router.Vendor }}
+Interface:        {{ $router.Interface }}
+Router Lifetime:  {{ $router.Lifetime }}
+Managed (M):      {{ $router.Managed }}
+Other Config (O): {{ $router.OtherConfig }}
+Hop Limit:        {{ $router.HopLimit }}
+MTU:              {{ $router.MTU }}
+DNS Servers:      {{ join $router.DNSServers }}
+DNS Search List:  {{ range $j, $domain := $router.DNSSearchList }}{{ if $j }}, {{ end }}{{ $domain }}{{ end }}
+Advertisements:   {{ $router.Advertisements }}
+{{- if $router.Prefixes }}
+
+Prefixes
+--------
+{{- range $router.Prefixes }}
+{{ printf "%-45s" .Prefix }} valid {{ .ValidLifetime }}, preferred {{ .PreferredLifetime }}, on-link {{ .OnLink }}, autonomous {{ .Autonomous }}
+{{- end }}
+{{- end }}
+
+{{- end }}
+Stats
+-----
+Packets Sent:     {{ .Stats.PacketsSent }}
+Packets Received: {{ .Stats.PacketsReceived }}
+Scan Duration:    {{ .Stats.ScanDuration }}
+`
+
+var ScanDiffTemplate = `
+Scan Diff ({{ .ScanType }})
+=========
+{{- if not .HasChanges }}
+No changes.
+{{- end }}
+{{- if .Hosts }}
+
+Hosts
+-----
+{{- range .Hosts }}
+{{ printf "%-8s %-40s %s" .Change .Addr .HostName }}
+{{- end }}
+{{- end }}
+{{- if .Ports }}
+
+Ports
+-----
+{{- range .Ports }}
+{{ printf "%-40s %-16s %-10s" .Addr (printf "%d/%s" .Number .Protocol) .Name }} {{ .OldState }} -> {{ .NewState }}
+{{- end }}
+{{- end }}
+{{- if .HostKeys }}
+
+SSH Host Keys
+-------------
+{{- range .HostKeys }}
+{{ printf "%-8s %-40s %-6d %-20s" .Change .Addr .Port .KeyType }} {{ if .OldFingerprint }}{{ .OldFingerprint }}{{ end }}{{ if and .OldFingerprint .NewFingerprint }} -> {{ end }}{{ if .NewFingerprint }}{{ .NewFingerprint }}{{ end }}
+{{- end }}
+{{- end }}
+{{- if .RTTs }}
+
+Round Trip Times
+----------------
+{{- range .RTTs }}
+{{ printf "%-40s" .Addr }} {{ duration .OldRTT }} -> {{ duration .NewRTT }}
+{{- end }}
+{{- end }}
+{{- if .Addresses }}
+
+Addresses
+---------
+{{- range .Addresses }}
+{{ printf "%-8s %-40s" .Change .IPAddr }} {{ if .OldMAC }}{{ .OldMAC }}{{ end }}{{ if and .OldMAC .NewMAC }} -> {{ end }}{{ if .NewMAC }}{{ .NewMAC }}{{ end }}
+{{- end }}
+{{- end }}
+{{- if .DHCPServers }}
+
+DHCP Servers
+------------
+{{- range .DHCPServers }}
+{{ printf "%-8s %s" .Change .IP }}
+{{- range .Options }}
+         {{ .Name }}: {{ .OldValue }} -> {{ .NewValue }}
+{{- end }}
+{{- end }}
+{{- end }}
+`
+
+var HistoryScansTemplate = `
+Scan History
+============
+{{ printf "%-6s %-20s %-6s %-6s %s" "ID" "TIME" "TYPE" "HOSTS" "COMMAND" }}
+{{ printf "%-6s %-20s %-6s %-6s %s" "--" "----" "----" "-----" "-------" }}
+{{- range .Scans }}
+{{ printf "%-6d %-20s %-6s %-6d %s" .ID (.Time.Format "2006-01-02 15:04:05") .ScanType .NumHosts .CommandLine }}
+{{- end }}
+`
+
+var HostHistoryTemplate = `
+History of {{ .IP }}
+===========
+{{ printf "%-8s %-20s %-6s %-20s %s" "SCAN ID" "TIME" "TYPE" "MAC ADDRESS" "OPEN PORTS" }}
+{{ printf "%-8s %-20s %-6s %-20s %s" "-------" "----" "----" "-----------" "----------" }}
+{{- range .Observations }}
+{{ printf "%-8d %-20s %-6s %-20s" .ScanID (.Time.Format "2006-01-02 15:04:05") .ScanType .Host.MAC }}
+{{- range $.OpenPortsOf .Host }} {{ . }}{{ end }}
+{{- end }}
+{{- if .MACs }}
+
+MAC Addresses
+-------------
+{{- range .MACs }}
+{{ printf "%-20s" .Value }} first seen {{ .FirstSeen.Format "2006-01-02 15:04:05" }}, last seen {{ .LastSeen.Format "2006-01-02 15:04:05" }}
+{{- end }}
+{{- end }}
+{{- if .OpenPorts }}
+
+Open Ports
+----------
+{{- range .OpenPorts }}
+{{ printf "%-20s" .Value }} first seen {{ .FirstSeen.Format "2006-01-02 15:04:05" }}, last seen {{ .LastSeen.Format "2006-01-02 15:04:05" }}
+{{- end }}
+{{- end }}
+{{- if .HostKeys }}
+
+SSH Host Keys
+-------------
+{{- range .HostKeys }}
+{{ .Value }}
+    first seen {{ .FirstSeen.Format "2006-01-02 15:04:05" }}, last seen {{ .LastSeen.Format "2006-01-02 15:04:05" }}
+{{- end }}
+{{- end }}
+`
@@ -0,0 +1,105 @@
+package scanner
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyResultsTemplate(t *testing.T) {
+	arpResults := &ARPScanResults{
+		HostResults: []ARPHostResult{
+			{
+				IPAddr:  netip.MustParseAddr("10.1.1.1"),
+				MacAddr: netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+			},
+		},
+		ARPScanStats: ARPScanStats{ScanDuration: 1532400 * time.Microsecond},
+	}
+	portResults := &TCPFullScanResults{
+		Results: HostResults{
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:      netip.MustParseAddr("10.1.1.2"),
+				HostState: HostStateUp,
+				Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen},
+				},
+			},
+		},
+	}
+
+	dir := t.TempDir()
+	writeTemplate := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(text), 0o644))
+		return path
+	}
+	arpTemplate := `{{ range .HostResults }}{{ .IPAddr | pad 10 }}|{{ mac .MacAddr }}{{ end }} in {{ duration .ScanDuration }}`
+	writeTemplate("arp.tmpl", arpTemplate)
+	hostTemplate := writeTemplate("host.tmpl", `{{ range .Results }}{{ template "host_result" . }}{{ end }}`)
+	badTemplate := writeTemplate("bad.tmpl", `{{ .Missing `)
+	badColor := writeTemplate("color.tmpl", `{{ color "purple" "x" }}`)
+
+	tests := []struct {
+		name    string
+		results ScanResults
+		opts    ScanOptions
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "template from templates dir",
+			results: arpResults,
+			opts:    ScanOptions{TemplatesDir: dir},
+			want:    "10.1.1.1  |00:1A:2B:3C:4D:5E in 1.532s",
+		},
+		{
+			name:    "template flag takes precedence",
+			results: arpResults,
+			opts:    ScanOptions{Template: badColor, TemplatesDir: dir},
+			wantErr: true,
+		},
+		{
+			name:    "port scan templates can use host_result",
+			results: portResults,
+			opts:    ScanOptions{Template: hostTemplate},
+			want:    executeResultsTemplate("host", `{{ range .Results }}{{ template "host_result" . }}{{ end }}`, portResults),
+		},
+		{
+			name:    "no template for scan type",
+			results: portResults,
+			opts:    ScanOptions{TemplatesDir: dir},
+			want:    portResults.String(),
+		},
+		{
+			name:    "parse error",
+			results: arpResults,
+			opts:    ScanOptions{Template: badTemplate},
+			wantErr: true,
+		},
+		{
+			name:    "missing template file",
+			results: arpResults,
+			opts:    ScanOptions{Template: filepath.Join(dir, "missing.tmpl")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyResultsTemplate(tt.results, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package scanner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// TLSInfo describes the TLS session negotiated with the service on a port.
+type TLSInfo struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	// StartTLS is the protocol whose STARTTLS command was used to start TLS eg smtp. It is empty for ports that speak TLS from the start.
+	StartTLS string `json:"starttls,omitempty"`
+	// Certificates is the certificate chain sent by the service, leaf certificate first.
+	Certificates []CertificateInfo `json:"certificates"`
+}
+
+// CertificateInfo describes a certificate sent by a TLS service.
+type CertificateInfo struct {
+	Subject string `json:"subject"`
+	// SANs are the DNS names and IP addresses in the certificate's subject alternative name extension.
+	SANs               []string  `json:"sans,omitempty"`
+	Issuer             string    `json:"issuer"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	KeyType            string    `json:"key_type"`
+	KeyBits            int       `json:"key_bits"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+}
+
+// CertificateWarning is a certificate found by TLS inspection that has expired or expires within the warning threshold.
+type CertificateWarning struct {
+	Addr     netip.Addr `json:"ip"`
+	HostName string     `json:"hostname,omitempty"`
+	Port     PortNumber `json:"port"`
+	Subject  string     `json:"subject"`
+	NotAfter time.Time  `json:"not_after"`
+	Expired  bool       `json:"expired"`
+}
+
+// startTLSProtocols maps the names of services that can upgrade their connections to TLS to the protocol spoken to do so.
+var startTLSProtocols = map[string]string{
+	"smtp":       "smtp",
+	"submission": "smtp",
+	"imap":       "imap",
+	"pop3":       "pop3",
+	"ftp":        "ftp",
+}
+
+// inspectTLS collects the TLS version, cipher suite and certificate chain of the open tcp ports of the hosts in results that speak TLS
+// or support STARTTLS.
+func inspectTLS(ctx context.Context, results HostResults, workers int, timeout time.Duration, stream *resultStream) {
+	enrichOpenPorts(ctx, results, workers, stream, "Inspecting TLS....", "TLS inspection done",
+		func(ctx context.Context, host HostResult, port Port) func(*Port) {
+			info, err := tlsHandshake(ctx, netip.AddrPortFrom(host.Addr, uint16(port.Number)), host.HostName, startTLSProtocols[port.Name], timeout)
+			if err != nil {
+				return nil
+			}
+			return func(port *Port) {
+				port.TLS = info
+			}
+		})
+}
+
+// tlsHandshake connects to target and does a TLS handshake, after upgrading the connection with the STARTTLS command of startTLS if it
+// is not empty. serverName is sent in the handshake if it is not empty. Certificates are not verified since they are only being looked
+// at.
+func tlsHandshake(ctx context.Context, target netip.AddrPort, serverName string, startTLS string, timeout time.Duration) (*TLSInfo, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if startTLS != "" {
+		err = startTLSCommand(conn, startTLS)
+		if err != nil {
+			return nil, fmt.Errorf("could not start tls with %v: %w", startTLS, err)
+		}
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	})
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+	info := &TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		StartTLS:    startTLS,
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, certificateInfo(cert))
+	}
+	return info, nil
+}
+
+// startTLSCommand asks the service on conn to upgrade the connection to TLS with the STARTTLS command of protocol.
+func startTLSCommand(conn net.Conn, protocol string) error {
+	// not closed since that would close conn, which the TLS handshake still needs.
+	text := textproto.NewConn(conn)
+
+	// expectLine reads a line and checks that it starts with prefix.
+	expectLine := func(prefix string) error {
+		line, err := text.ReadLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, prefix) {
+			return fmt.Errorf("unexpected reply %q", line)
+		}
+		return nil
+	}
+
+	var err error
+	switch protocol {
+	case "smtp":
+		if _, _, err = text.ReadResponse(220); err != nil {
+			return err
+		}
+		if err = text.PrintfLine("EHLO gscn"); err != nil {
+			return err
+		}
+		if _, _, err = text.ReadResponse(250); err != nil {
+			return err
+		}
+		if err = text.PrintfLine("STARTTLS"); err != nil {
+			return err
+		}
+		_, _, err = text.ReadResponse(220)
+	case "ftp":
+		if _, _, err = text.ReadResponse(220); err != nil {
+			return err
+		}
+		if err = text.PrintfLine("AUTH TLS"); err != nil {
+			return err
+		}
+		_, _, err = text.ReadResponse(234)
+	case "pop3":
+		if err = expectLine("+OK"); err != nil {
+			return err
+		}
+		if err = text.PrintfLine("STLS"); err != nil {
+			return err
+		}
+		err = expectLine("+OK")
+	case "imap":
+		if err = expectLine("* OK"); err != nil {
+			return err
+		}
+		if err = text.PrintfLine("a1 STARTTLS"); err != nil {
+			return err
+		}
+		// untagged replies may come before the tagged one.
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(line, "a1 ") {
+				if !strings.HasPrefix(line, "a1 OK") {
+					return fmt.Errorf("unexpected reply %q", line)
+				}
+				return nil
+			}
+		}
+	default:
+		return fmt.Errorf("starttls is not supported for %v", protocol)
+	}
+	return err
+}
+
+func certificateInfo(cert *x509.Certificate) CertificateInfo {
+	info := CertificateInfo{
+		Subject:            cert.Subject.String(),
+		SANs:               append([]string{}, cert.DNSNames...),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	if len(info.SANs) == 0 {
+		info.SANs = nil
+	}
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyType, info.KeyBits = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.KeyType, info.KeyBits = "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.KeyType, info.KeyBits = "Ed25519", 256
+	default:
+		info.KeyType = cert.PublicKeyAlgorithm.String()
+	}
+	return info
+}
+
+// certificateWarnings returns the leaf certificates of the ports in results that have expired at now or expire within threshold of it,
+// sorted by host and port.
+func certificateWarnings(results HostResults, threshold time.Duration, now time.Time) []CertificateWarning {
+	var warnings []CertificateWarning
+	for _, hostResult := range sortedHostResults(results) {
+		for _, port := range hostResult.Ports {
+			if port.TLS == nil || len(port.TLS.Certificates) == 0 {
+				continue
+			}
+			cert := port.TLS.Certificates[0]
+			if cert.NotAfter.Sub(now) > threshold {
+				continue
+			}
+			warnings = append(warnings, CertificateWarning{
+				Addr:     hostResult.Addr,
+				HostName: hostResult.HostName,
+				Port:     port.Number,
+				Subject:  cert.Subject,
+				NotAfter: cert.NotAfter,
+				Expired:  !cert.NotAfter.After(now),
+			})
+		}
+	}
+	return warnings
+}
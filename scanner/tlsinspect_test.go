@@ -0,0 +1,156 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate returns a self signed certificate for localhost that is valid until notAfter.
+func testCertificate(t *testing.T, notAfter time.Time) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"gscn"}},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSHandshake(t *testing.T) {
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := &tls.Config{Certificates: []tls.Certificate{testCertificate(t, notAfter)}}
+
+	tests := []struct {
+		name     string
+		startTLS string
+		// dialog is what the server says and expects before the TLS handshake. Lines starting with "> " are expected from the client.
+		dialog []string
+	}{
+		{name: "tls from the start"},
+		{
+			name:     "smtp starttls",
+			startTLS: "smtp",
+			dialog:   []string{"220 mail.lan ESMTP", "> EHLO gscn", "250-mail.lan", "250 STARTTLS", "> STARTTLS", "220 go ahead"},
+		},
+		{
+			name:     "imap starttls",
+			startTLS: "imap",
+			dialog:   []string{"* OK IMAP ready", "> a1 STARTTLS", "* CAPABILITY IMAP4rev1", "a1 OK begin tls"},
+		},
+		{
+			name:     "pop3 starttls",
+			startTLS: "pop3",
+			dialog:   []string{"+OK POP3 ready", "> STLS", "+OK begin tls"},
+		},
+		{
+			name:     "ftp auth tls",
+			startTLS: "ftp",
+			dialog:   []string{"220-welcome", "220 ftp ready", "> AUTH TLS", "234 begin tls"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := serveOnce(t, func(conn net.Conn) {
+				reader := bufio.NewReader(conn)
+				for _, line := range tt.dialog {
+					if expected, ok := strings.CutPrefix(line, "> "); ok {
+						got, err := reader.ReadString('\n')
+						if err != nil || strings.TrimSpace(got) != expected {
+							return
+						}
+						continue
+					}
+					conn.Write([]byte(line + "\r\n"))
+				}
+				tls.Server(conn, config).Handshake()
+			})
+
+			info, err := tlsHandshake(context.Background(), target, "localhost", tt.startTLS, time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "TLS 1.3", info.Version)
+			assert.NotEmpty(t, info.CipherSuite)
+			assert.Equal(t, tt.startTLS, info.StartTLS)
+			require.Len(t, info.Certificates, 1)
+			assert.Equal(t, CertificateInfo{
+				Subject:            "CN=localhost,O=gscn",
+				SANs:               []string{"localhost", "127.0.0.1"},
+				Issuer:             "CN=localhost,O=gscn",
+				NotBefore:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+				NotAfter:           notAfter,
+				KeyType:            "ECDSA",
+				KeyBits:            256,
+				SignatureAlgorithm: "ECDSA-SHA256",
+			}, info.Certificates[0])
+		})
+	}
+}
+
+func TestTLSHandshakeNotTLS(t *testing.T) {
+	target := serveOnce(t, func(conn net.Conn) {
+		conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	})
+	_, err := tlsHandshake(context.Background(), target, "", "", time.Second)
+	assert.Error(t, err)
+}
+
+func TestCertificateWarnings(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	withCert := func(number PortNumber, notAfter time.Time) Port {
+		return Port{Number: number, Protocol: "tcp", State: PortStateOpen, TLS: &TLSInfo{
+			Certificates: []CertificateInfo{
+				{Subject: "CN=leaf", NotAfter: notAfter},
+				{Subject: "CN=intermediate", NotAfter: now.Add(-time.Hour)},
+			},
+		}}
+	}
+
+	addr := netip.MustParseAddr("10.1.1.1")
+	results := HostResults{
+		addr: {
+			Addr:     addr,
+			HostName: "web.lan",
+			Ports: []Port{
+				withCert(443, now.Add(-24*time.Hour)),
+				withCert(465, now.Add(10*24*time.Hour)),
+				withCert(993, now.Add(60*24*time.Hour)),
+				{Number: 22, Protocol: "tcp", State: PortStateOpen},
+			},
+		},
+	}
+
+	warnings := certificateWarnings(results, 30*24*time.Hour, now)
+	assert.Equal(t, []CertificateWarning{
+		{Addr: addr, HostName: "web.lan", Port: 443, Subject: "CN=leaf", NotAfter: now.Add(-24 * time.Hour), Expired: true},
+		{Addr: addr, HostName: "web.lan", Port: 465, Subject: "CN=leaf", NotAfter: now.Add(10 * 24 * time.Hour)},
+	}, warnings)
+
+	text := (&TCPFullScanResults{Results: results, CertificateWarnings: warnings}).String()
+	assert.Contains(t, text, "10.1.1.1 port 443 (web.lan) CN=leaf expired on 2025-05-31")
+	assert.Contains(t, text, "10.1.1.1 port 465 (web.lan) CN=leaf expires on 2025-06-11")
+}
@@ -0,0 +1,776 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/kakeetopius/gscn/packet"
+	"github.com/pterm/pterm"
+)
+
+// TraceMethod is the kind of probe a trace sends towards its target.
+type TraceMethod string
+
+const (
+	// TraceMethodUDP sends UDP datagrams to unlikely ports, which the target answers with an ICMP port unreachable message.
+	TraceMethodUDP TraceMethod = "udp"
+	// TraceMethodICMP sends ICMP echo requests, which the target answers with echo replies.
+	TraceMethodICMP TraceMethod = "icmp"
+	// TraceMethodTCP sends TCP SYNs to a port, which the target answers with a SYN-ACK or a RST.
+	TraceMethodTCP TraceMethod = "tcp"
+)
+
+var TraceMethods = []TraceMethod{TraceMethodUDP, TraceMethodICMP, TraceMethodTCP}
+
+const (
+	defaultTraceUDPPort  = 33434
+	defaultTraceTCPPort  = 80
+	defaultTraceMaxHops  = 30
+	defaultTraceQueries  = 3
+	defaultTraceParallel = 16
+	defaultTraceTimeout  = 2 * time.Second
+	maxTraceHops         = 255
+	maxTraceQueries      = 10
+)
+
+// The kinds of replies a trace probe can get.
+const (
+	traceReplyTimeExceeded        = "time-exceeded"
+	traceReplyPortUnreachable     = "port-unreachable"
+	traceReplyHostUnreachable     = "host-unreachable"
+	traceReplyNetUnreachable      = "net-unreachable"
+	traceReplyProtocolUnreachable = "protocol-unreachable"
+	traceReplyProhibited          = "prohibited"
+	traceReplyUnreachable         = "unreachable"
+	traceReplyEchoReply           = "echo-reply"
+	traceReplySYNAck              = "syn-ack"
+	traceReplyRST                 = "rst"
+)
+
+type TraceOptions struct {
+	Target netip.Addr
+	// HostName is the name the target was given as, if any.
+	HostName string
+	Method   TraceMethod
+	// Port is the port TCP probes are sent to or the port the first UDP probe is sent to, with every following UDP probe sent to the
+	// next port so that replies can be matched to their probe. Defaults to 80 for TCP and 33434 for UDP.
+	Port PortNumber
+	// FirstHop is the TTL or hop limit of the first probes. Defaults to 1.
+	FirstHop int
+	// MaxHops is the largest TTL or hop limit probes are sent with. Defaults to 30.
+	MaxHops int
+	// Queries is the number of probes sent to each hop. Defaults to 3.
+	Queries int
+	// Parallel is the number of hops that are probed at the same time. Defaults to 16.
+	Parallel int
+	// ResponseTimeout is how long to wait for replies after the probes of a round are sent. Defaults to 2 seconds.
+	ResponseTimeout time.Duration
+	// NoHostNames turns off the reverse lookups of the hop addresses.
+	NoHostNames bool
+}
+
+// Tracer finds the routers on the way to a host by sending probes whose TTL or hop limit runs out one hop further each time and
+// listening for the ICMP time exceeded messages the routers send back.
+type Tracer struct {
+	TraceOptions
+
+	results       TraceResults
+	ifaceProvider netutil.NetInterfaceProvider
+	macResolver   resolving.Resolver
+	router        routing.Router
+
+	// srcPort is the source port of UDP probes or the source port of the first TCP probe, with every following TCP probe sent from
+	// the next port.
+	srcPort uint16
+	// icmpID is the identifier of ICMP echo probes, whose sequence number is the index of the probe.
+	icmpID uint16
+
+	mu     sync.Mutex
+	probes []traceProbe
+	// replied is signalled whenever a probe gets a reply.
+	replied chan struct{}
+}
+
+type TraceResults struct {
+	Target   netip.Addr  `json:"target"`
+	HostName string      `json:"hostname,omitempty"`
+	Method   TraceMethod `json:"method"`
+	Port     PortNumber  `json:"port,omitempty"`
+	// Reached is true if the target answered any of the probes.
+	Reached bool       `json:"reached"`
+	Hops    []TraceHop `json:"hops"`
+	Stats   TraceStats `json:"stats"`
+}
+
+type TraceStats struct {
+	ProbesSent      int           `json:"probes_sent"`
+	RepliesReceived int           `json:"replies_received"`
+	TraceTime       time.Duration `json:"trace_duration"`
+}
+
+// TraceHop is what the probes sent with one TTL or hop limit found.
+type TraceHop struct {
+	TTL    int          `json:"ttl"`
+	Probes []TraceProbe `json:"probes"`
+}
+
+// TraceProbe is the reply to a single probe. All fields are empty if the probe was not answered.
+type TraceProbe struct {
+	Addr     netip.Addr    `json:"ip,omitzero"`
+	HostName string        `json:"hostname,omitempty"`
+	RTT      time.Duration `json:"rtt,omitempty"`
+	// Reply is the kind of reply eg time-exceeded, port-unreachable, echo-reply, syn-ack or rst.
+	Reply string `json:"reply,omitempty"`
+}
+
+// traceProbe is a probe that was sent and the reply it got.
+type traceProbe struct {
+	ttl      int
+	sent     time.Time
+	answered bool
+	reply    TraceProbe
+	// final is set for replies that mean no probe gets any further, which are all replies but time exceeded messages.
+	final bool
+}
+
+// traceReply is what a reply tells about the probe it answers.
+type traceReply struct {
+	addr  netip.Addr
+	kind  string
+	final bool
+}
+
+func NewTracer(opts TraceOptions) (*Tracer, error) {
+	if !opts.Target.IsValid() {
+		return nil, fmt.Errorf("no target to trace provided")
+	}
+	opts.Target = opts.Target.Unmap()
+	if opts.Method == "" {
+		opts.Method = TraceMethodUDP
+	}
+	if !slices.Contains(TraceMethods, opts.Method) {
+		return nil, fmt.Errorf("unknown trace method: %v", opts.Method)
+	}
+	if opts.Port == 0 {
+		switch opts.Method {
+		case TraceMethodUDP:
+			opts.Port = defaultTraceUDPPort
+		case TraceMethodTCP:
+			opts.Port = defaultTraceTCPPort
+		}
+	}
+	if opts.FirstHop == 0 {
+		opts.FirstHop = 1
+	}
+	if opts.MaxHops == 0 {
+		opts.MaxHops = defaultTraceMaxHops
+	}
+	if opts.Queries == 0 {
+		opts.Queries = defaultTraceQueries
+	}
+	if opts.Parallel == 0 {
+		opts.Parallel = defaultTraceParallel
+	}
+	if opts.ResponseTimeout == 0 {
+		opts.ResponseTimeout = defaultTraceTimeout
+	}
+
+	if opts.MaxHops < 1 || opts.MaxHops > maxTraceHops {
+		return nil, fmt.Errorf("maximum number of hops must be between 1 and %v", maxTraceHops)
+	}
+	if opts.FirstHop < 1 || opts.FirstHop > opts.MaxHops {
+		return nil, fmt.Errorf("first hop must be between 1 and the maximum number of hops")
+	}
+	if opts.Queries < 1 || opts.Queries > maxTraceQueries {
+		return nil, fmt.Errorf("number of probes per hop must be between 1 and %v", maxTraceQueries)
+	}
+	if opts.Parallel < 1 {
+		return nil, fmt.Errorf("number of hops probed at the same time must be at least 1")
+	}
+	numProbes := opts.MaxHops * opts.Queries
+	if opts.Method == TraceMethodUDP && int(opts.Port)+numProbes-1 > 65535 {
+		return nil, fmt.Errorf("udp port %v is too high to send %v probes to the ports after it", opts.Port, numProbes)
+	}
+
+	ifaceProvider, err := netutil.InterfaceProvider()
+	if err != nil {
+		return nil, err
+	}
+	router, err := routing.NewRouter(ifaceProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tracer{
+		TraceOptions: opts,
+		results: TraceResults{
+			Target:   opts.Target,
+			HostName: opts.HostName,
+			Method:   opts.Method,
+			Port:     opts.Port,
+		},
+		ifaceProvider: ifaceProvider,
+		macResolver:   resolving.NewResolver(ifaceProvider),
+		router:        router,
+		icmpID:        uint16(rand.UintN(65536)),
+	}
+	t.srcPort = randomEphemeralPort()
+	if opts.Method == TraceMethodTCP {
+		// every probe needs its own port above the first one.
+		t.srcPort = uint16(49152 + rand.IntN(65535-49152-numProbes+2))
+	}
+	return t, nil
+}
+
+func (t *Tracer) Scan(ctx context.Context) (ScanResults, error) {
+	startTime := time.Now()
+	err := t.runTrace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.results.Hops, t.results.Reached = t.hops()
+	if !t.NoHostNames {
+		t.addHostNames()
+	}
+	t.results.Stats.TraceTime = time.Since(startTime)
+	return &t.results, nil
+}
+
+func (t *Tracer) runTrace(ctx context.Context) (err error) {
+	t.probes = make([]traceProbe, t.MaxHops*t.Queries)
+	t.replied = make(chan struct{}, 1)
+
+	spinner, err := pterm.DefaultSpinner.Start(fmt.Sprintf("Tracing the route to %v", t.Target))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			spinner.Fail("Trace Failed")
+		} else {
+			spinner.Success("Tracing Done")
+		}
+	}()
+
+	allIfaces, err := t.ifaceProvider.Interfaces()
+	if err != nil {
+		return err
+	}
+
+	sender, err := newRawSender(ctx, t.ifaceProvider, t.router, t.macResolver)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	packetReceiver, err := packet.NewPacketReceiver(ctx, t.filter(), 1500, allIfaces...)
+	if err != nil {
+		return err
+	}
+
+	masterDone := make(chan struct{})
+	go t.getTraceResults(ctx, packetReceiver, masterDone)
+	defer func() {
+		packetReceiver.Close()
+		<-masterDone // wait for master to finish processing what is already enqueued by the packet receiver
+	}()
+
+	packetBuf := gopacket.NewSerializeBuffer()
+	for first := t.FirstHop; first <= t.MaxHops; first += t.Parallel {
+		last := min(first+t.Parallel-1, t.MaxHops)
+		for ttl := first; ttl <= last; ttl++ {
+			for query := range t.Queries {
+				err = t.sendProbe(sender, packetBuf, ttl, query)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		sender.Wait() // wait for the packet sender to send all packets
+
+		err = t.waitForReplies(ctx, first, last)
+		if err != nil {
+			return err
+		}
+		if t.finalHop() != 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// filter returns the bpf filter that matches the replies to the probes.
+func (t *Tracer) filter() string {
+	filter := "icmp or icmp6"
+	if t.Method == TraceMethodTCP {
+		filter += fmt.Sprintf(" or (tcp and src host %v and src port %v)", t.Target, t.Port)
+	}
+	return filter
+}
+
+// probeIndex returns the index of the query'th probe sent with ttl, which replies are matched to the probe with.
+func (t *Tracer) probeIndex(ttl, query int) int {
+	return (ttl-1)*t.Queries + query
+}
+
+func (t *Tracer) sendProbe(sender *rawSender, buf gopacket.SerializeBuffer, ttl, query int) error {
+	index := t.probeIndex(ttl, query)
+	transport, payload := t.probeLayers(index)
+
+	t.mu.Lock()
+	t.probes[index] = traceProbe{ttl: ttl, sent: time.Now()}
+	t.mu.Unlock()
+	t.results.Stats.ProbesSent++
+
+	return sender.sendWithOptions(buf, t.Target, ipOptions{ttl: uint8(ttl)}, transport, payload...)
+}
+
+// probeLayers returns the headers of the probe at index, which carry the index so that replies can be matched to the probe.
+func (t *Tracer) probeLayers(index int) (transport gopacket.SerializableLayer, payload []gopacket.SerializableLayer) {
+	switch t.Method {
+	case TraceMethodUDP:
+		transport = &layers.UDP{
+			SrcPort: layers.UDPPort(t.srcPort),
+			DstPort: layers.UDPPort(int(t.Port) + index),
+		}
+	case TraceMethodTCP:
+		transport = &layers.TCP{
+			SrcPort: layers.TCPPort(int(t.srcPort) + index),
+			DstPort: layers.TCPPort(t.Port),
+			Seq:     rand.Uint32(),
+			SYN:     true,
+			Window:  65535,
+			Options: []layers.TCPOption{{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}}},
+		}
+	case TraceMethodICMP:
+		if t.Target.Is4() {
+			transport = &layers.ICMPv4{
+				TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
+				Id:       t.icmpID,
+				Seq:      uint16(index),
+			}
+		} else {
+			transport = &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)}
+			payload = append(payload, &layers.ICMPv6Echo{Identifier: t.icmpID, SeqNumber: uint16(index)})
+		}
+	}
+	return transport, payload
+}
+
+// waitForReplies waits until every probe sent with a TTL from first to last is answered or the response timeout runs out. Probes
+// beyond the hop that ends the trace are not waited for.
+func (t *Tracer) waitForReplies(ctx context.Context, first, last int) error {
+	timeout := time.NewTimer(t.ResponseTimeout)
+	defer timeout.Stop()
+
+	for !t.answeredUpTo(first, last) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return nil
+		case <-t.replied:
+		}
+	}
+	return nil
+}
+
+// answeredUpTo reports whether every probe sent with a TTL from first to last, or to the hop that ends the trace if it comes before
+// last, has been answered.
+func (t *Tracer) answeredUpTo(first, last int) bool {
+	if final := t.finalHop(); final != 0 {
+		last = min(last, final)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ttl := first; ttl <= last; ttl++ {
+		for query := range t.Queries {
+			if !t.probes[t.probeIndex(ttl, query)].answered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// finalHop returns the lowest TTL whose probes got a reply that ends the trace or 0 if there is none yet.
+func (t *Tracer) finalHop() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, probe := range t.probes {
+		if probe.answered && probe.final {
+			return probe.ttl
+		}
+	}
+	return 0
+}
+
+func (t *Tracer) getTraceResults(ctx context.Context, packetReceiver packet.PacketReceiver, masterDone chan<- struct{}) {
+	// To Be Run By Main Worker (aggregator)
+	packetChan := packetReceiver.Packets()
+
+	defer close(masterDone)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet, ok := <-packetChan:
+			if !ok {
+				return
+			}
+			index, reply, ok := t.matchReply(packet)
+			if !ok {
+				continue
+			}
+
+			received := packet.Metadata().Timestamp
+			if received.IsZero() {
+				received = time.Now()
+			}
+			t.recordReply(index, reply, received)
+		}
+	}
+}
+
+// recordReply records the first reply to the probe at index.
+func (t *Tracer) recordReply(index int, reply traceReply, received time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	probe := &t.probes[index]
+	if probe.sent.IsZero() || probe.answered {
+		return
+	}
+	probe.answered = true
+	probe.final = reply.final
+	probe.reply = TraceProbe{Addr: reply.addr, RTT: max(received.Sub(probe.sent), 0), Reply: reply.kind}
+	t.results.Stats.RepliesReceived++
+
+	select {
+	case t.replied <- struct{}{}:
+	default:
+	}
+}
+
+// matchReply returns the index of the probe that packet is a reply to and what the reply says. ok is false if packet is not a reply to
+// any of the probes.
+func (t *Tracer) matchReply(packet gopacket.Packet) (index int, reply traceReply, ok bool) {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return 0, reply, false
+	}
+	reply.addr, ok = netip.AddrFromSlice(network.NetworkFlow().Src().Raw())
+	if !ok {
+		return 0, reply, false
+	}
+	reply.addr = reply.addr.Unmap()
+
+	if layer := packet.Layer(layers.LayerTypeICMPv4); layer != nil {
+		icmp := layer.(*layers.ICMPv4)
+		switch icmp.TypeCode.Type() {
+		case layers.ICMPv4TypeTimeExceeded:
+			reply.kind = traceReplyTimeExceeded
+		case layers.ICMPv4TypeDestinationUnreachable:
+			reply.kind, reply.final = icmpv4UnreachableReply(icmp.TypeCode.Code()), true
+		case layers.ICMPv4TypeEchoReply:
+			if t.Method != TraceMethodICMP || icmp.Id != t.icmpID || reply.addr != t.Target {
+				return 0, reply, false
+			}
+			reply.kind, reply.final = traceReplyEchoReply, true
+			return t.checkIndex(int(icmp.Seq), reply)
+		default:
+			return 0, reply, false
+		}
+		index, ok = t.matchQuotedProbe(icmp.Payload)
+		return index, reply, ok
+	}
+
+	if layer := packet.Layer(layers.LayerTypeICMPv6); layer != nil {
+		icmp := layer.(*layers.ICMPv6)
+		switch icmp.TypeCode.Type() {
+		case layers.ICMPv6TypeTimeExceeded:
+			reply.kind = traceReplyTimeExceeded
+		case layers.ICMPv6TypeDestinationUnreachable:
+			reply.kind, reply.final = icmpv6UnreachableReply(icmp.TypeCode.Code()), true
+		case layers.ICMPv6TypeEchoReply:
+			echoLayer := packet.Layer(layers.LayerTypeICMPv6Echo)
+			if t.Method != TraceMethodICMP || echoLayer == nil || reply.addr != t.Target {
+				return 0, reply, false
+			}
+			echo := echoLayer.(*layers.ICMPv6Echo)
+			if echo.Identifier != t.icmpID {
+				return 0, reply, false
+			}
+			reply.kind, reply.final = traceReplyEchoReply, true
+			return t.checkIndex(int(echo.SeqNumber), reply)
+		default:
+			return 0, reply, false
+		}
+		quoted, ok := icmpv6QuotedPacket(icmp)
+		if !ok {
+			return 0, reply, false
+		}
+		index, ok = t.matchQuotedProbe(quoted)
+		return index, reply, ok
+	}
+
+	if layer := packet.Layer(layers.LayerTypeTCP); layer != nil && t.Method == TraceMethodTCP {
+		tcp := layer.(*layers.TCP)
+		if reply.addr != t.Target || PortNumber(tcp.SrcPort) != t.Port {
+			return 0, reply, false
+		}
+		switch {
+		case tcp.SYN && tcp.ACK:
+			reply.kind = traceReplySYNAck
+		case tcp.RST:
+			reply.kind = traceReplyRST
+		default:
+			return 0, reply, false
+		}
+		reply.final = true
+		return t.checkIndex(int(tcp.DstPort)-int(t.srcPort), reply)
+	}
+
+	return 0, reply, false
+}
+
+// checkIndex returns index and reply with ok set if index is the index of a probe.
+func (t *Tracer) checkIndex(index int, reply traceReply) (int, traceReply, bool) {
+	if index < 0 || index >= len(t.probes) {
+		return 0, reply, false
+	}
+	return index, reply, true
+}
+
+// matchQuotedProbe returns the index of the probe whose headers are quoted at the start of data by an ICMP or ICMPv6 error message.
+func (t *Tracer) matchQuotedProbe(data []byte) (int, bool) {
+	quoted, ok := parseQuotedHeaders(data)
+	if !ok || quoted.dst != t.Target {
+		return 0, false
+	}
+
+	index := -1
+	switch {
+	case t.Method == TraceMethodUDP && quoted.protocol == layers.IPProtocolUDP && quoted.srcPort() == t.srcPort:
+		index = int(quoted.dstPort()) - int(t.Port)
+	case t.Method == TraceMethodTCP && quoted.protocol == layers.IPProtocolTCP && quoted.dstPort() == uint16(t.Port):
+		index = int(quoted.srcPort()) - int(t.srcPort)
+	case t.Method == TraceMethodICMP && quoted.isEcho():
+		if quoted.echoID() != t.icmpID {
+			return 0, false
+		}
+		index = int(quoted.echoSeq())
+	}
+	_, _, ok = t.checkIndex(index, traceReply{})
+	return index, ok
+}
+
+func icmpv4UnreachableReply(code uint8) string {
+	switch code {
+	case layers.ICMPv4CodePort:
+		return traceReplyPortUnreachable
+	case layers.ICMPv4CodeHost:
+		return traceReplyHostUnreachable
+	case layers.ICMPv4CodeNet:
+		return traceReplyNetUnreachable
+	case layers.ICMPv4CodeProtocol:
+		return traceReplyProtocolUnreachable
+	case layers.ICMPv4CodeNetAdminProhibited, layers.ICMPv4CodeHostAdminProhibited, layers.ICMPv4CodeCommAdminProhibited:
+		return traceReplyProhibited
+	default:
+		return traceReplyUnreachable
+	}
+}
+
+func icmpv6UnreachableReply(code uint8) string {
+	switch code {
+	case layers.ICMPv6CodePortUnreachable:
+		return traceReplyPortUnreachable
+	case layers.ICMPv6CodeAddressUnreachable:
+		return traceReplyHostUnreachable
+	case layers.ICMPv6CodeNoRouteToDst:
+		return traceReplyNetUnreachable
+	case layers.ICMPv6CodeAdminProhibited:
+		return traceReplyProhibited
+	default:
+		return traceReplyUnreachable
+	}
+}
+
+// hops returns the replies to the probes by hop, up to the hop that ended the trace, and whether the target answered any of them.
+func (t *Tracer) hops() (hops []TraceHop, reached bool) {
+	last := t.MaxHops
+	if final := t.finalHop(); final != 0 {
+		last = final
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ttl := t.FirstHop; ttl <= last; ttl++ {
+		hop := TraceHop{TTL: ttl}
+		for query := range t.Queries {
+			probe := t.probes[t.probeIndex(ttl, query)]
+			if probe.sent.IsZero() {
+				continue
+			}
+			hop.Probes = append(hop.Probes, probe.reply)
+			reached = reached || (probe.answered && probe.reply.Addr == t.Target)
+		}
+		if len(hop.Probes) != 0 {
+			hops = append(hops, hop)
+		}
+	}
+	return hops, reached
+}
+
+// addHostNames looks up the host names of the addresses that answered probes.
+func (t *Tracer) addHostNames() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	names := make(map[netip.Addr]string)
+	if t.HostName != "" {
+		names[t.Target] = t.HostName
+	}
+	for _, hop := range t.results.Hops {
+		for _, probe := range hop.Probes {
+			if probe.Addr.IsValid() {
+				if _, found := names[probe.Addr]; !found {
+					names[probe.Addr] = ""
+				}
+			}
+		}
+	}
+
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for addr, name := range names {
+		if name != "" {
+			continue
+		}
+		wg.Go(func() {
+			name := strings.TrimSuffix(netutil.ReverseLookup(ctx, addr.String()), ".")
+			mu.Lock()
+			names[addr] = name
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	for i, hop := range t.results.Hops {
+		for j, probe := range hop.Probes {
+			if probe.Addr.IsValid() {
+				t.results.Hops[i].Probes[j].HostName = names[probe.Addr]
+			}
+		}
+	}
+}
+
+// Summary returns the hop as a line of traceroute output: every address that replied followed by the round trip times of its replies,
+// with a * for every probe that was not answered.
+func (h TraceHop) Summary() string {
+	var parts []string
+	var last netip.Addr
+	for _, probe := range h.Probes {
+		if !probe.Addr.IsValid() {
+			parts = append(parts, "*")
+			continue
+		}
+		if probe.Addr != last {
+			parts = append(parts, traceProbeHost(probe))
+			last = probe.Addr
+		}
+		parts = append(parts, probe.RTT.Round(time.Microsecond).String())
+	}
+	return strings.Join(parts, "  ")
+}
+
+func traceProbeHost(probe TraceProbe) string {
+	if probe.HostName == "" {
+		return probe.Addr.String()
+	}
+	return fmt.Sprintf("%v (%v)", probe.HostName, probe.Addr)
+}
+
+func (r *TraceResults) Print() {
+	tableData := pterm.TableData{{"Hop", "Host", "RTTs", "Reply"}}
+	for _, hop := range r.Hops {
+		hopNumber := fmt.Sprint(hop.TTL)
+		var lost []string
+		var addrs []netip.Addr
+		rows := make(map[netip.Addr][]string)
+		replies := make(map[netip.Addr]string)
+		for _, probe := range hop.Probes {
+			if !probe.Addr.IsValid() {
+				lost = append(lost, "*")
+				continue
+			}
+			if _, found := rows[probe.Addr]; !found {
+				addrs = append(addrs, probe.Addr)
+				rows[probe.Addr] = []string{traceProbeHost(probe)}
+				replies[probe.Addr] = probe.Reply
+			}
+			rows[probe.Addr] = append(rows[probe.Addr], probe.RTT.Round(time.Microsecond).String())
+		}
+		if len(addrs) == 0 {
+			tableData = append(tableData, []string{hopNumber, pterm.FgGray.Sprint("*"), strings.Join(lost, " "), ""})
+			continue
+		}
+		for i, addr := range addrs {
+			rtts := rows[addr][1:]
+			if i == 0 {
+				rtts = append(rtts, lost...)
+			} else {
+				hopNumber = ""
+			}
+			tableData = append(tableData, []string{hopNumber, rows[addr][0], strings.Join(rtts, " "), replies[addr]})
+		}
+	}
+	pterm.DefaultTable.WithHasHeader().WithBoxed().WithHeaderRowSeparator("-").WithData(tableData).Render()
+
+	target := r.Target.String()
+	if r.HostName != "" {
+		target = fmt.Sprintf("%v (%v)", r.HostName, r.Target)
+	}
+	reached := pterm.FgGreen.Sprint("yes")
+	if !r.Reached {
+		reached = pterm.FgRed.Sprint("no")
+	}
+	fmt.Println("\nTarget:           ", target)
+	fmt.Println("Method:           ", r.Method)
+	fmt.Println("Target Reached:   ", reached)
+	fmt.Println("Probes Sent:      ", r.Stats.ProbesSent)
+	fmt.Println("Replies Received: ", r.Stats.RepliesReceived)
+	fmt.Printf("Trace Duration:    %v\n\n", r.Stats.TraceTime.Truncate(time.Millisecond))
+}
+
+func (r *TraceResults) table() [][]string {
+	rows := [][]string{{"hop", "ip", "hostname", "rtt_ms", "reply"}}
+	for _, hop := range r.Hops {
+		for _, probe := range hop.Probes {
+			row := []string{fmt.Sprint(hop.TTL), "", "", "", ""}
+			if probe.Addr.IsValid() {
+				row = []string{fmt.Sprint(hop.TTL), probe.Addr.String(), probe.HostName, durationMillis(probe.RTT), probe.Reply}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func (r TraceResults) String() string {
+	return executeResultsTemplate("trace_results", TraceResultsTemplate, r)
+}
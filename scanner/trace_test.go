@@ -0,0 +1,353 @@
+package scanner
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTracer(method TraceMethod, target netip.Addr, port PortNumber) *Tracer {
+	return &Tracer{
+		TraceOptions: TraceOptions{Target: target, Method: method, Port: port, FirstHop: 1, MaxHops: 10, Queries: 3},
+		srcPort:      50000,
+		icmpID:       0x1234,
+		probes:       make([]traceProbe, 30),
+	}
+}
+
+// tracePacket builds the ethernet frame carrying transport and payload from src to dst.
+func tracePacket(t *testing.T, src, dst netip.Addr, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) gopacket.Packet {
+	t.Helper()
+
+	eth := &layers.Ethernet{SrcMAC: []byte{0, 1, 2, 3, 4, 5}, DstMAC: []byte{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4}
+	data := serializeTraceLayers(t, src, dst, transport, payload...)
+	if src.Is6() {
+		eth.EthernetType = layers.EthernetTypeIPv6
+	}
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, eth, gopacket.Payload(data)))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+// serializeTraceLayers returns the IP packet carrying transport and payload from src to dst.
+func serializeTraceLayers(t *testing.T, src, dst netip.Addr, transport gopacket.SerializableLayer, payload ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+
+	var protocol layers.IPProtocol
+	switch transport.LayerType() {
+	case layers.LayerTypeTCP:
+		protocol = layers.IPProtocolTCP
+	case layers.LayerTypeUDP:
+		protocol = layers.IPProtocolUDP
+	case layers.LayerTypeICMPv4:
+		protocol = layers.IPProtocolICMPv4
+	case layers.LayerTypeICMPv6:
+		protocol = layers.IPProtocolICMPv6
+	}
+
+	var ip gopacket.NetworkLayer
+	if src.Is4() {
+		ip = &layers.IPv4{Version: 4, IHL: 5, TTL: 1, Protocol: protocol, SrcIP: src.AsSlice(), DstIP: dst.AsSlice()}
+	} else {
+		ip = &layers.IPv6{Version: 6, HopLimit: 1, NextHeader: protocol, SrcIP: src.AsSlice(), DstIP: dst.AsSlice()}
+	}
+	if transport, ok := transport.(transportLayer); ok {
+		require.NoError(t, transport.SetNetworkLayerForChecksum(ip))
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	headers := append([]gopacket.SerializableLayer{ip.(gopacket.SerializableLayer), transport}, payload...)
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, headers...))
+	return buf.Bytes()
+}
+
+// traceICMPError builds the ICMP or ICMPv6 error message that router sends back to local for the probe of tracer at index.
+func traceICMPError(t *testing.T, tracer *Tracer, router, local netip.Addr, index int, icmpType, code uint8) gopacket.Packet {
+	t.Helper()
+
+	transport, payload := tracer.probeLayers(index)
+	original := serializeTraceLayers(t, local, tracer.Target, transport, payload...)
+	if local.Is4() {
+		// only the ip header and the first 8 bytes of the transport header are guaranteed to be quoted.
+		return tracePacket(t, router, local, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(icmpType, code)}, gopacket.Payload(original[:28]))
+	}
+	return tracePacket(t, router, local, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(icmpType, code)},
+		gopacket.Payload(append([]byte{0, 0, 0, 0}, original...)))
+}
+
+func TestTracerMatchReply(t *testing.T) {
+	local4 := netip.MustParseAddr("10.0.0.2")
+	router4 := netip.MustParseAddr("10.0.0.1")
+	target4 := netip.MustParseAddr("192.168.1.10")
+	local6 := netip.MustParseAddr("2001:db8::2")
+	router6 := netip.MustParseAddr("2001:db8::1")
+	target6 := netip.MustParseAddr("2001:db8:1::10")
+
+	udp4 := testTracer(TraceMethodUDP, target4, 33434)
+	icmp4 := testTracer(TraceMethodICMP, target4, 0)
+	tcp4 := testTracer(TraceMethodTCP, target4, 443)
+	udp6 := testTracer(TraceMethodUDP, target6, 33434)
+	icmp6 := testTracer(TraceMethodICMP, target6, 0)
+	otherTarget := testTracer(TraceMethodUDP, netip.MustParseAddr("192.168.1.11"), 33434)
+	otherSource := testTracer(TraceMethodUDP, target4, 33434)
+	otherSource.srcPort = 50001
+	otherID := testTracer(TraceMethodICMP, target4, 0)
+	otherID.icmpID = 0x4321
+
+	tests := []struct {
+		name   string
+		tracer *Tracer
+		packet gopacket.Packet
+		index  int
+		reply  traceReply
+		ok     bool
+	}{
+		{
+			name:   "udp time exceeded",
+			tracer: udp4,
+			packet: traceICMPError(t, udp4, router4, local4, 5, layers.ICMPv4TypeTimeExceeded, 0),
+			index:  5,
+			reply:  traceReply{addr: router4, kind: traceReplyTimeExceeded},
+			ok:     true,
+		},
+		{
+			name:   "udp port unreachable from the target",
+			tracer: udp4,
+			packet: traceICMPError(t, udp4, target4, local4, 12, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodePort),
+			index:  12,
+			reply:  traceReply{addr: target4, kind: traceReplyPortUnreachable, final: true},
+			ok:     true,
+		},
+		{
+			name:   "admin prohibited by a router",
+			tracer: udp4,
+			packet: traceICMPError(t, udp4, router4, local4, 3, layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeCommAdminProhibited),
+			index:  3,
+			reply:  traceReply{addr: router4, kind: traceReplyProhibited, final: true},
+			ok:     true,
+		},
+		{
+			name:   "icmp time exceeded",
+			tracer: icmp4,
+			packet: traceICMPError(t, icmp4, router4, local4, 7, layers.ICMPv4TypeTimeExceeded, 0),
+			index:  7,
+			reply:  traceReply{addr: router4, kind: traceReplyTimeExceeded},
+			ok:     true,
+		},
+		{
+			name:   "icmp echo reply",
+			tracer: icmp4,
+			packet: tracePacket(t, target4, local4, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 0x1234, Seq: 9}),
+			index:  9,
+			reply:  traceReply{addr: target4, kind: traceReplyEchoReply, final: true},
+			ok:     true,
+		},
+		{
+			name:   "tcp time exceeded",
+			tracer: tcp4,
+			packet: traceICMPError(t, tcp4, router4, local4, 4, layers.ICMPv4TypeTimeExceeded, 0),
+			index:  4,
+			reply:  traceReply{addr: router4, kind: traceReplyTimeExceeded},
+			ok:     true,
+		},
+		{
+			name:   "tcp syn-ack",
+			tracer: tcp4,
+			packet: tracePacket(t, target4, local4, &layers.TCP{SrcPort: 443, DstPort: 50004, SYN: true, ACK: true}),
+			index:  4,
+			reply:  traceReply{addr: target4, kind: traceReplySYNAck, final: true},
+			ok:     true,
+		},
+		{
+			name:   "tcp rst",
+			tracer: tcp4,
+			packet: tracePacket(t, target4, local4, &layers.TCP{SrcPort: 443, DstPort: 50010, RST: true, ACK: true}),
+			index:  10,
+			reply:  traceReply{addr: target4, kind: traceReplyRST, final: true},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 udp time exceeded",
+			tracer: udp6,
+			packet: traceICMPError(t, udp6, router6, local6, 2, layers.ICMPv6TypeTimeExceeded, 0),
+			index:  2,
+			reply:  traceReply{addr: router6, kind: traceReplyTimeExceeded},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 udp port unreachable",
+			tracer: udp6,
+			packet: traceICMPError(t, udp6, target6, local6, 20, layers.ICMPv6TypeDestinationUnreachable, layers.ICMPv6CodePortUnreachable),
+			index:  20,
+			reply:  traceReply{addr: target6, kind: traceReplyPortUnreachable, final: true},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 icmp time exceeded",
+			tracer: icmp6,
+			packet: traceICMPError(t, icmp6, router6, local6, 8, layers.ICMPv6TypeTimeExceeded, 0),
+			index:  8,
+			reply:  traceReply{addr: router6, kind: traceReplyTimeExceeded},
+			ok:     true,
+		},
+		{
+			name:   "ipv6 echo reply",
+			tracer: icmp6,
+			packet: tracePacket(t, target6, local6, &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0)},
+				&layers.ICMPv6Echo{Identifier: 0x1234, SeqNumber: 11}),
+			index: 11,
+			reply: traceReply{addr: target6, kind: traceReplyEchoReply, final: true},
+			ok:    true,
+		},
+		{
+			name:   "probe to another target",
+			tracer: udp4,
+			packet: traceICMPError(t, otherTarget, router4, local4, 5, layers.ICMPv4TypeTimeExceeded, 0),
+		},
+		{
+			name:   "probe from another source port",
+			tracer: udp4,
+			packet: traceICMPError(t, otherSource, router4, local4, 5, layers.ICMPv4TypeTimeExceeded, 0),
+		},
+		{
+			name:   "echo reply with another identifier",
+			tracer: icmp4,
+			packet: tracePacket(t, target4, local4, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 0x4321, Seq: 9}),
+		},
+		{
+			name:   "icmp probe with another identifier",
+			tracer: icmp4,
+			packet: traceICMPError(t, otherID, router4, local4, 7, layers.ICMPv4TypeTimeExceeded, 0),
+		},
+		{
+			name:   "port beyond the probes",
+			tracer: udp4,
+			packet: traceICMPError(t, testTracer(TraceMethodUDP, target4, 33404), router4, local4, 0, layers.ICMPv4TypeTimeExceeded, 0),
+		},
+		{
+			name:   "tcp from another port",
+			tracer: tcp4,
+			packet: tracePacket(t, target4, local4, &layers.TCP{SrcPort: 80, DstPort: 50004, SYN: true, ACK: true}),
+		},
+		{
+			name:   "udp error for a tcp trace",
+			tracer: tcp4,
+			packet: traceICMPError(t, udp4, router4, local4, 5, layers.ICMPv4TypeTimeExceeded, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, reply, ok := tt.tracer.matchReply(tt.packet)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.index, index)
+				assert.Equal(t, tt.reply, reply)
+			}
+		})
+	}
+}
+
+func TestTracerHops(t *testing.T) {
+	target := netip.MustParseAddr("192.168.1.10")
+	router1 := netip.MustParseAddr("10.0.0.1")
+	router2 := netip.MustParseAddr("10.0.1.1")
+	router3 := netip.MustParseAddr("10.0.1.2")
+	sent := time.Now()
+
+	tracer := testTracer(TraceMethodUDP, target, 33434)
+	tracer.MaxHops, tracer.Queries = 6, 2
+	tracer.probes = make([]traceProbe, 12)
+	tracer.replied = make(chan struct{}, 1)
+	for ttl := 1; ttl <= 5; ttl++ {
+		for query := range 2 {
+			tracer.probes[tracer.probeIndex(ttl, query)] = traceProbe{ttl: ttl, sent: sent}
+		}
+	}
+	timeExceeded := func(addr netip.Addr) traceReply {
+		return traceReply{addr: addr, kind: traceReplyTimeExceeded}
+	}
+	portUnreachable := traceReply{addr: target, kind: traceReplyPortUnreachable, final: true}
+
+	tracer.recordReply(0, timeExceeded(router1), sent.Add(time.Millisecond))
+	tracer.recordReply(1, timeExceeded(router1), sent.Add(2*time.Millisecond))
+	// the second hop has two routers and the third does not answer.
+	tracer.recordReply(2, timeExceeded(router2), sent.Add(3*time.Millisecond))
+	tracer.recordReply(3, timeExceeded(router3), sent.Add(4*time.Millisecond))
+	tracer.recordReply(7, portUnreachable, sent.Add(5*time.Millisecond))
+	// a second reply to the same probe is ignored.
+	tracer.recordReply(7, timeExceeded(router1), sent.Add(6*time.Millisecond))
+	// the fifth hop went beyond the target.
+	tracer.recordReply(8, portUnreachable, sent.Add(7*time.Millisecond))
+
+	assert.Equal(t, 4, tracer.finalHop())
+	assert.False(t, tracer.answeredUpTo(1, 5))
+	tracer.recordReply(6, portUnreachable, sent.Add(8*time.Millisecond))
+	// the third hop never answers but is not waited for.
+	assert.False(t, tracer.answeredUpTo(1, 5))
+	assert.True(t, tracer.answeredUpTo(4, 5))
+
+	hops, reached := tracer.hops()
+	assert.True(t, reached)
+	assert.Equal(t, []TraceHop{
+		{TTL: 1, Probes: []TraceProbe{
+			{Addr: router1, RTT: time.Millisecond, Reply: traceReplyTimeExceeded},
+			{Addr: router1, RTT: 2 * time.Millisecond, Reply: traceReplyTimeExceeded},
+		}},
+		{TTL: 2, Probes: []TraceProbe{
+			{Addr: router2, RTT: 3 * time.Millisecond, Reply: traceReplyTimeExceeded},
+			{Addr: router3, RTT: 4 * time.Millisecond, Reply: traceReplyTimeExceeded},
+		}},
+		{TTL: 3, Probes: []TraceProbe{{}, {}}},
+		{TTL: 4, Probes: []TraceProbe{
+			{Addr: target, RTT: 8 * time.Millisecond, Reply: traceReplyPortUnreachable},
+			{Addr: target, RTT: 5 * time.Millisecond, Reply: traceReplyPortUnreachable},
+		}},
+	}, hops)
+	assert.Equal(t, 7, tracer.results.Stats.RepliesReceived)
+}
+
+func TestTraceHopSummary(t *testing.T) {
+	router1 := netip.MustParseAddr("10.0.0.1")
+	router2 := netip.MustParseAddr("10.0.0.2")
+
+	tests := []struct {
+		name string
+		hop  TraceHop
+		want string
+	}{
+		{
+			name: "one router",
+			hop: TraceHop{Probes: []TraceProbe{
+				{Addr: router1, HostName: "router.lan", RTT: 1500 * time.Microsecond},
+				{Addr: router1, HostName: "router.lan", RTT: 2 * time.Millisecond},
+			}},
+			want: "router.lan (10.0.0.1)  1.5ms  2ms",
+		},
+		{
+			name: "two routers and a lost probe",
+			hop: TraceHop{Probes: []TraceProbe{
+				{Addr: router1, RTT: time.Millisecond},
+				{},
+				{Addr: router2, RTT: 3 * time.Millisecond},
+			}},
+			want: "10.0.0.1  1ms  *  10.0.0.2  3ms",
+		},
+		{
+			name: "no replies",
+			hop:  TraceHop{Probes: []TraceProbe{{}, {}, {}}},
+			want: "*  *  *",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.hop.Summary())
+		})
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/netip"
+	"strings"
 	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
 )
 
 type (
@@ -23,6 +26,8 @@ const (
 	PortStateClosed PortState = iota
 	PortStateOpen
 	PortStatePossibleFilter // used when  a host's port state cant be known definitevly
+	PortStateFiltered       // used when a firewall is known to block probes to the port eg it sent back an ICMP unreachable message
+	PortStateUnfiltered     // used when probes reach the port but whether it is open or closed cant be known eg in ACK scans
 )
 
 // Scanner defines the interface for network scanners
@@ -37,6 +42,34 @@ type ScanResults interface {
 	fmt.Stringer
 }
 
+// portScanResults is implemented by the results of scanners that probe ports on hosts. It lets output formats
+// that only make sense for port scans (for example Nmap XML) get at the host results without caring about the scan type.
+type portScanResults interface {
+	ScanResults
+	// hostResults returns the per host results of the scan.
+	hostResults() HostResults
+	// portScanInfo returns general information about how the scan was carried out.
+	portScanInfo() portScanInfo
+}
+
+// portScanInfo describes a completed port scan.
+type portScanInfo struct {
+	// ScanType is the Nmap name of the scan technique used eg connect, syn or udp.
+	ScanType string
+	// Protocol is the transport protocol that was scanned.
+	Protocol string
+	// ScanTime is how long the scan took.
+	ScanTime time.Duration
+	// pingSkipped is set when hosts were not pinged before their ports were scanned.
+	pingSkipped bool
+	// defaultPortState is the state of ports that never answered a probe. Ports are only streamed when they leave this state so ports
+	// still in it are streamed once the scan is done.
+	defaultPortState PortState
+
+	printUpOnly   bool
+	printOpenOnly bool
+}
+
 // HostResult is the result of a single host after port scanning
 type HostResult struct {
 	Addr netip.Addr `json:"ip"`
@@ -50,8 +83,16 @@ type HostResult struct {
 	ClosedPorts int `json:"closed"`
 	// FilteredPorts represents the total count of ports where traffic was dropped or blocked (where the port state is uncertain)
 	FilteredPorts int `json:"filtered"`
+	// UnfilteredPorts represents the total count of ports that probes reached but whose state could not be told apart as open or closed.
+	UnfilteredPorts int `json:"unfiltered,omitempty"`
 	// AverageRTT is the mean round-trip time for packets sent to the host.
 	AverageRTT time.Duration `json:"rtt"`
+	// OS is the operating system the host most likely runs going by its replies to the scan's probes and pings.
+	OS *OSGuess `json:"os,omitempty"`
+	// MAC is the hardware address of hosts on directly connected networks, which are found out to be up with ARP or NDP requests.
+	MAC netutil.MAC `json:"mac,omitempty"`
+	// Vendor is the vendor the MAC address was given to.
+	Vendor string `json:"vendor,omitempty"`
 	// Ports contains the specific details for each port scanned on the host.
 	Ports []Port `json:"ports"`
 	// keeps track of where each port is in the Ports slice
@@ -73,6 +114,31 @@ type Port struct {
 	Protocol string `json:"protocol"`
 	// State describes the current state of the port.
 	State PortState `json:"state"`
+	// Product, Version and ExtraInfo describe the software found listening on the port by service detection.
+	Product   string `json:"product,omitempty"`
+	Version   string `json:"version,omitempty"`
+	ExtraInfo string `json:"extra_info,omitempty"`
+	// TLS describes the TLS session negotiated with the service on the port by TLS inspection.
+	TLS *TLSInfo `json:"tls,omitempty"`
+	// HTTP describes the web server on the port found by HTTP fingerprinting.
+	HTTP *HTTPInfo `json:"http,omitempty"`
+	// SSH describes the SSH server on the port and its host keys.
+	SSH *SSHInfo `json:"ssh,omitempty"`
+}
+
+// VersionInfo returns the product, version and extra information of the service on the port in one string eg
+// "OpenSSH 9.6 (protocol 2.0)".
+func (p Port) VersionInfo() string {
+	info := strings.TrimSpace(p.Product + " " + p.Version)
+	if p.ExtraInfo != "" {
+		info = strings.TrimSpace(info + " (" + p.ExtraInfo + ")")
+	}
+	return info
+}
+
+// serviceDetected reports whether service detection found out anything about the service on the port.
+func (p Port) serviceDetected() bool {
+	return p.Product != "" || p.Version != "" || p.ExtraInfo != ""
 }
 
 func (p PortState) String() string {
@@ -83,6 +149,10 @@ func (p PortState) String() string {
 		return "closed"
 	case PortStatePossibleFilter:
 		return "open | filtered"
+	case PortStateFiltered:
+		return "filtered"
+	case PortStateUnfiltered:
+		return "unfiltered"
 	default:
 		return "unknown"
 	}
@@ -92,6 +162,22 @@ func (p PortState) MarshalJSON() ([]byte, error) {
 	return json.Marshal(p.String())
 }
 
+func (p *PortState) UnmarshalJSON(data []byte) error {
+	var state string
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	for _, known := range []PortState{PortStateClosed, PortStateOpen, PortStatePossibleFilter, PortStateFiltered, PortStateUnfiltered} {
+		if state == known.String() {
+			*p = known
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown port state: %v", state)
+}
+
 func (s HostState) String() string {
 	switch s {
 	case HostStateUp:
@@ -107,6 +193,22 @@ func (s HostState) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s.String())
 }
 
+func (s *HostState) UnmarshalJSON(data []byte) error {
+	var state string
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+
+	for _, known := range []HostState{HostStateDown, HostStateUp} {
+		if state == known.String() {
+			*s = known
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown host state: %v", state)
+}
+
 func (s HostResults) MarshalJSON() ([]byte, error) {
 	vals := make([]HostResult, 0, len(s))
 	for _, v := range s {
@@ -115,6 +217,54 @@ func (s HostResults) MarshalJSON() ([]byte, error) {
 	return json.Marshal(vals)
 }
 
+// UnmarshalJSON reads host results written by MarshalJSON back into a map indexed by the hosts' addresses.
+func (s *HostResults) UnmarshalJSON(data []byte) error {
+	var vals []HostResult
+	err := json.Unmarshal(data, &vals)
+	if err != nil {
+		return err
+	}
+
+	results := make(HostResults, len(vals))
+	for _, v := range vals {
+		v.portIndex = make(map[PortNumber]int, len(v.Ports))
+		for i, port := range v.Ports {
+			v.portIndex[port.Number] = i
+		}
+		results[v.Addr] = v
+	}
+	*s = results
+	return nil
+}
+
 func (s HostResult) TotalNumberOfPorts() int {
-	return s.OpenPorts + s.ClosedPorts + s.FilteredPorts
+	return s.OpenPorts + s.ClosedPorts + s.FilteredPorts + s.UnfilteredPorts
+}
+
+// setPortState changes the state of the port with the given number and keeps the open, closed and filtered port counts in step. It
+// returns the port and whether its state was changed.
+func (s *HostResult) setPortState(number PortNumber, state PortState) (Port, bool) {
+	i, found := s.portIndex[number]
+	if !found || s.Ports[i].State == state {
+		return Port{}, false
+	}
+
+	*s.portCount(s.Ports[i].State)--
+	*s.portCount(state)++
+	s.Ports[i].State = state
+	return s.Ports[i], true
+}
+
+// portCount returns the count of ports in the given state.
+func (s *HostResult) portCount(state PortState) *int {
+	switch state {
+	case PortStateOpen:
+		return &s.OpenPorts
+	case PortStateClosed:
+		return &s.ClosedPorts
+	case PortStateUnfiltered:
+		return &s.UnfilteredPorts
+	default:
+		return &s.FilteredPorts
+	}
 }
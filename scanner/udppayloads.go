@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/spf13/viper"
+)
+
+// UDPPayload is data sent in the probes of a udp scan to ports whose services only answer valid requests. Without an answer the
+// scan can only tell that such ports are open or filtered.
+type UDPPayload struct {
+	// Name is the protocol the payload is a request of eg dns.
+	Name  string
+	Ports []PortNumber
+	Data  []byte
+}
+
+// DefaultUDPPayloads are the payloads sent to well known ports. Ports with more than one payload are sent a probe with each of them.
+var DefaultUDPPayloads = []UDPPayload{
+	{
+		// a query for the root name servers.
+		Name:  "dns",
+		Ports: []PortNumber{53},
+		Data:  []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01},
+	},
+	{
+		Name:  "dhcp",
+		Ports: []PortNumber{67},
+		Data:  dhcpInform(),
+	},
+	{
+		// a read request for a file that is unlikely to exist. Servers answer with an error packet.
+		Name:  "tftp",
+		Ports: []PortNumber{69},
+		Data:  []byte("\x00\x01gscn.txt\x00octet\x00"),
+	},
+	{
+		// a version 4 client request.
+		Name:  "ntp",
+		Ports: []PortNumber{123},
+		Data:  append([]byte{0xe3}, make([]byte, 47)...),
+	},
+	{
+		// a node status request for the wildcard name "*".
+		Name:  "netbios-ns",
+		Ports: []PortNumber{137},
+		Data:  []byte("\x80\xf0\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x20CK" + strings.Repeat("A", 30) + "\x00\x00\x21\x00\x01"),
+	},
+	{
+		Name:  "snmp",
+		Ports: []PortNumber{161},
+		Data:  snmpGetRequest("public"),
+	},
+	{
+		Name:  "snmp",
+		Ports: []PortNumber{161},
+		Data:  snmpGetRequest("private"),
+	},
+	{
+		Name:  "ssdp",
+		Ports: []PortNumber{1900},
+		Data:  []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"),
+	},
+	{
+		// a query for the services on the host with the unicast response bit set since the probe does not come from port 5353.
+		Name:  "mdns",
+		Ports: []PortNumber{5353},
+		Data: []byte("\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00" +
+			"\x09_services\x07_dns-sd\x04_udp\x05local\x00\x00\x0c\x80\x01"),
+	},
+	{
+		// a version command in the udp frame memcached expects.
+		Name:  "memcached",
+		Ports: []PortNumber{11211},
+		Data:  []byte("\x00\x01\x00\x00\x00\x01\x00\x00version\r\n"),
+	},
+}
+
+// udpPayloadsByPort indexes payloads by the ports they are sent to.
+func udpPayloadsByPort(payloads []UDPPayload) map[PortNumber][][]byte {
+	byPort := make(map[PortNumber][][]byte)
+	for _, payload := range payloads {
+		for _, port := range payload.Ports {
+			byPort[port] = append(byPort[port], payload.Data)
+		}
+	}
+	return byPort
+}
+
+// UDPPayloadsFromConfig reads the payloads added in the config file. Each payload has a name, the ports it is sent to and its data
+// either as hex or as text eg
+//
+//	[[udp.payloads]]
+//	name = "coap"
+//	ports = "5683"
+//	hex = "40 01 01 ce bb 2e 77 65 6c 6c 2d 6b 6e 6f 77 6e 04 63 6f 72 65"
+func UDPPayloadsFromConfig(config *viper.Viper) ([]UDPPayload, error) {
+	var configPayloads []struct {
+		Name  string `mapstructure:"name"`
+		Ports string `mapstructure:"ports"`
+		Hex   string `mapstructure:"hex"`
+		Text  string `mapstructure:"text"`
+	}
+	err := config.UnmarshalKey("udp.payloads", &configPayloads)
+	if err != nil {
+		return nil, fmt.Errorf("invalid udp payloads in config file: %w", err)
+	}
+
+	payloads := make([]UDPPayload, 0, len(configPayloads))
+	for _, configPayload := range configPayloads {
+		ports, err := PortsFromString(configPayload.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ports for udp payload %v: %w", configPayload.Name, err)
+		}
+
+		payload := UDPPayload{Name: configPayload.Name, Ports: ports}
+		switch {
+		case configPayload.Hex != "" && configPayload.Text != "":
+			return nil, fmt.Errorf("udp payload %v cannot have both hex and text data", configPayload.Name)
+		case configPayload.Hex != "":
+			payload.Data, err = hex.DecodeString(strings.Join(strings.Fields(configPayload.Hex), ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex data for udp payload %v: %w", configPayload.Name, err)
+			}
+		case configPayload.Text != "":
+			payload.Data = []byte(configPayload.Text)
+		default:
+			return nil, fmt.Errorf("udp payload %v has no data", configPayload.Name)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	return payloads, nil
+}
+
+// snmpGetRequest returns an SNMPv1 get-request for sysDescr.0 with the given community.
+func snmpGetRequest(community string) []byte {
+	// ber encodes a value with the given tag. All lengths used here fit in the short form.
+	ber := func(tag byte, value ...[]byte) []byte {
+		contents := []byte{}
+		for _, v := range value {
+			contents = append(contents, v...)
+		}
+		return append([]byte{tag, byte(len(contents))}, contents...)
+	}
+
+	sysDescr := []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00} // 1.3.6.1.2.1.1.1.0
+	varBind := ber(0x30, ber(0x06, sysDescr), ber(0x05))
+	pdu := ber(0xa0,
+		ber(0x02, binary.BigEndian.AppendUint32(nil, 0x67736e63)), // request id
+		ber(0x02, []byte{0}), // error status
+		ber(0x02, []byte{0}), // error index
+		ber(0x30, varBind),
+	)
+	return ber(0x30, ber(0x02, []byte{0}), ber(0x04, []byte(community)), pdu)
+}
+
+// dhcpInform returns a DHCPINFORM message asking for the server's configuration.
+func dhcpInform() []byte {
+	dhcp := &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          0x67736e63,
+		ClientHWAddr: net.HardwareAddr(zeroMac()),
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeInform)}),
+			layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{byte(layers.DHCPOptSubnetMask), byte(layers.DHCPOptRouter)}),
+		},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	err := dhcp.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true})
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
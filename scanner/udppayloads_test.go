@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultUDPPayloads(t *testing.T) {
+	for _, payload := range DefaultUDPPayloads {
+		assert.NotEmpty(t, payload.Data, payload.Name)
+		assert.NotEmpty(t, payload.Ports, payload.Name)
+	}
+
+	byPort := udpPayloadsByPort(DefaultUDPPayloads)
+	assert.Len(t, byPort[161], 2)
+
+	dns := gopacket.NewPacket(byPort[53][0], layers.LayerTypeDNS, gopacket.Default).Layer(layers.LayerTypeDNS)
+	require.NotNil(t, dns)
+	require.Len(t, dns.(*layers.DNS).Questions, 1)
+	assert.Equal(t, layers.DNSTypeNS, dns.(*layers.DNS).Questions[0].Type)
+
+	mdns := gopacket.NewPacket(byPort[5353][0], layers.LayerTypeDNS, gopacket.Default).Layer(layers.LayerTypeDNS)
+	require.NotNil(t, mdns)
+	require.Len(t, mdns.(*layers.DNS).Questions, 1)
+	assert.Equal(t, "_services._dns-sd._udp.local", string(mdns.(*layers.DNS).Questions[0].Name))
+
+	dhcp := gopacket.NewPacket(byPort[67][0], layers.LayerTypeDHCPv4, gopacket.Default).Layer(layers.LayerTypeDHCPv4)
+	require.NotNil(t, dhcp)
+	assert.Equal(t, layers.DHCPOpRequest, dhcp.(*layers.DHCPv4).Operation)
+	assert.Contains(t, dhcp.(*layers.DHCPv4).Options, layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeInform)}))
+
+	snmp := byPort[161][0]
+	assert.Equal(t, byte(0x30), snmp[0])
+	assert.Equal(t, len(snmp)-2, int(snmp[1]))
+	assert.Contains(t, string(snmp), "public")
+	assert.Contains(t, string(byPort[161][1]), "private")
+}
+
+func TestUDPPayloadsFromConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []UDPPayload
+		wantErr  bool
+	}{
+		{
+			name:     "no payloads",
+			config:   "",
+			expected: []UDPPayload{},
+		},
+		{
+			name: "hex and text payloads",
+			config: `
+[[udp.payloads]]
+name = "coap"
+ports = "5683"
+hex = "40 01 01 ce"
+
+[[udp.payloads]]
+name = "echo"
+ports = "7,8-9"
+text = "gscn"
+`,
+			expected: []UDPPayload{
+				{Name: "coap", Ports: []PortNumber{5683}, Data: []byte{0x40, 0x01, 0x01, 0xce}},
+				{Name: "echo", Ports: []PortNumber{7, 8, 9}, Data: []byte("gscn")},
+			},
+		},
+		{
+			name:    "invalid hex",
+			config:  "[[udp.payloads]]\nname = \"bad\"\nports = \"7\"\nhex = \"4g\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid ports",
+			config:  "[[udp.payloads]]\nname = \"bad\"\nports = \"seven\"\ntext = \"gscn\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "no data",
+			config:  "[[udp.payloads]]\nname = \"bad\"\nports = \"7\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "hex and text",
+			config:  "[[udp.payloads]]\nname = \"bad\"\nports = \"7\"\nhex = \"00\"\ntext = \"gscn\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := viper.New()
+			config.SetConfigType("toml")
+			require.NoError(t, config.ReadConfig(strings.NewReader(tt.config)))
+
+			payloads, err := UDPPayloadsFromConfig(config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, payloads)
+		})
+	}
+}
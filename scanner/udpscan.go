@@ -7,14 +7,19 @@ import (
 	"net"
 	"net/netip"
 	"os"
-	"strings"
+	"slices"
 	"sync"
-	"text/template"
 	"time"
 
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/kakeetopius/gscn/internal/log"
 	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/kakeetopius/gscn/internal/resolving"
+	"github.com/kakeetopius/gscn/internal/routing"
+	"github.com/kakeetopius/gscn/packet"
 	"github.com/pterm/pterm"
+	"golang.org/x/sync/errgroup"
 )
 
 type UDPScanner struct {
@@ -23,6 +28,13 @@ type UDPScanner struct {
 	results    UDPScanResults
 	hostStates PingScanResultsMap
 	logger     log.Logger
+	stream     *resultStream
+	// mu guards results in raw scans where they are read to find unanswered probes while responses come in.
+	mu sync.Mutex
+	// srcPort is the port raw probes are sent from so that answers to them can be told apart from other udp traffic.
+	srcPort uint16
+	// payloads are the payloads sent to each port.
+	payloads map[PortNumber][][]byte
 }
 
 type UDPScanOptions struct {
@@ -34,6 +46,17 @@ type UDPScanOptions struct {
 	ResponseTimeout     time.Duration
 	HostNames           map[netip.Addr]string
 	AddUnknownHostNames bool
+	// Discovery are the probes that find out which hosts are up before their ports are scanned. Hosts only get echo requests if it is
+	// empty.
+	Discovery DiscoveryOptions
+	// Raw sends the probes as raw packets and reads the ICMP port unreachable messages sent back for closed ports instead of relying
+	// on the operating system to report them on a socket.
+	Raw bool
+	// Retries is the number of times probes that were not answered are sent again in raw scans. ICMP messages are often rate limited
+	// so closed ports may need a few probes before they answer.
+	Retries int
+	// Payloads are sent to their ports along with DefaultUDPPayloads. Ports without a payload are sent a single zero byte.
+	Payloads []UDPPayload
 
 	PrintUpOnly   bool
 	PrintOpenOnly bool
@@ -42,6 +65,8 @@ type UDPScanOptions struct {
 type UDPScanResults struct {
 	Results HostResults  `json:"results"`
 	Stats   UDPScanStats `json:"stats"`
+	// Raw is set when the probes were sent as raw packets, in which case ports that never answered are open | filtered.
+	Raw bool `json:"raw,omitempty"`
 
 	printUpOnly   bool `json:"-"`
 	printOpenOnly bool `json:"-"`
@@ -61,10 +86,19 @@ func NewUDPScanner(opts UDPScanOptions) *UDPScanner {
 		results: UDPScanResults{
 			Results: make(HostResults),
 		},
-		logger: log.NewLogger(true),
+		logger:   log.NewLogger(true),
+		payloads: udpPayloadsByPort(append(slices.Clone(DefaultUDPPayloads), opts.Payloads...)),
 	}
 }
 
+// probePayloads returns the payloads sent to port. Ports without a known payload are sent a single zero byte.
+func (s *UDPScanner) probePayloads(port PortNumber) [][]byte {
+	if payloads, found := s.payloads[port]; found {
+		return payloads
+	}
+	return [][]byte{{0}}
+}
+
 func (s *UDPScanner) Scan(ctx context.Context) (ScanResults, error) {
 	startTime := time.Now()
 	err := s.runUDPScan(ctx)
@@ -75,6 +109,7 @@ func (s *UDPScanner) Scan(ctx context.Context) (ScanResults, error) {
 
 	s.results.Stats.ScanTime = stopTime.Sub(startTime)
 	s.results.Stats.TotalNumOfHosts = len(s.results.Results)
+	s.results.Raw = s.Raw
 	s.results.printOpenOnly = s.PrintOpenOnly
 	s.results.printUpOnly = s.PrintUpOnly
 
@@ -82,6 +117,10 @@ func (s *UDPScanner) Scan(ctx context.Context) (ScanResults, error) {
 	return &s.results, nil
 }
 
+func (s *UDPScanner) setResultStream(stream *resultStream) {
+	s.stream = stream
+}
+
 func (s *UDPScanner) addResultsInfo() {
 	if s.AddUnknownHostNames {
 		spinner, _ := pterm.DefaultSpinner.Start("Resolving Host Names....")
@@ -95,6 +134,9 @@ func (s *UDPScanner) addResultsInfo() {
 			name := netutil.ReverseLookup(ctx, host.String())
 			results.HostName = name
 			s.results.Results[host] = results
+			if name != "" && results.HostState == HostStateUp {
+				s.stream.writeHostResult(results)
+			}
 		}
 	}
 }
@@ -103,14 +145,30 @@ func (r *UDPScanResults) Print() {
 	printScanResultsMap(r.Results, r.Stats.ScanTime, r.printUpOnly, r.printOpenOnly)
 }
 
-func (r *UDPScanResults) String() string {
-	stringBuilder := strings.Builder{}
+func (r *UDPScanResults) hostResults() HostResults {
+	return r.Results
+}
 
-	hostTmpl := template.Must(template.New("host_result").Parse(HostResultTemplate))
-	tmpl := template.Must(hostTmpl.New("udp_full_scan").Parse(UDPScanResultsTemplate))
+func (r *UDPScanResults) portScanInfo() portScanInfo {
+	info := portScanInfo{
+		ScanType:      "udp",
+		Protocol:      "udp",
+		ScanTime:      r.Stats.ScanTime,
+		printUpOnly:   r.printUpOnly,
+		printOpenOnly: r.printOpenOnly,
+	}
+	if r.Raw {
+		info.defaultPortState = PortStatePossibleFilter
+	}
+	return info
+}
 
-	tmpl.Execute(&stringBuilder, r)
-	return stringBuilder.String()
+func (r *UDPScanResults) table() [][]string {
+	return portScanTable(r)
+}
+
+func (r *UDPScanResults) String() string {
+	return executeResultsTemplate("udp_full_scan", UDPScanResultsTemplate, r)
 }
 
 func (s *UDPScanner) runUDPScan(ctx context.Context) error {
@@ -119,7 +177,9 @@ func (s *UDPScanner) runUDPScan(ctx context.Context) error {
 	}
 	numWorkers := s.Workers
 
-	pterm.Warning.Println("UDP Scans are not reliable and may show inconsistent or wrong results.")
+	if !s.Raw {
+		pterm.Warning.Println("UDP Scans are not reliable and may show inconsistent or wrong results.")
+	}
 	if len(s.Targets) == 0 {
 		return fmt.Errorf("no hosts to scan provided")
 	}
@@ -127,12 +187,24 @@ func (s *UDPScanner) runUDPScan(ctx context.Context) error {
 		s.TargetPorts = CommonPorts
 	}
 
-	pingResults, err := pingHosts(ctx, s.Targets, s.PingTimeout, int(s.Workers), s.PingCount) // first check if hosts are up.
+	// first check if hosts are up.
+	pingResults, err := pingHosts(ctx, PingScanOptions{
+		Targets:          s.Targets,
+		PingTimeout:      s.PingTimeout,
+		Workers:          s.Workers,
+		PingCount:        s.PingCount,
+		DiscoveryOptions: s.Discovery,
+	})
 	if err != nil {
 		return err
 	}
 	s.hostStates = pingResults
 	s.results.Results = getResultSet(s.Targets, s.TargetPorts, s.HostNames, s.hostStates, "udp")
+	streamUpHosts(s.results.Results, s.stream)
+
+	if s.Raw {
+		return s.runRawUDPScan(ctx)
+	}
 
 	jobs := make(chan PortScanJob, numWorkers)
 	workerResultsChan := make(chan PortScanWorkerResult, numWorkers)
@@ -204,8 +276,11 @@ func scanUDPPort(scanner *UDPScanner, wg *sync.WaitGroup, jobs chan PortScanJob,
 			resultsChan <- result
 			continue
 		}
+		// first write to the connection so we can get responses if any
+		for _, payload := range scanner.probePayloads(PortNumber(target.Port())) {
+			conn.Write(payload)
+		}
 		buf := make([]byte, 1)
-		conn.Write(buf) // first write to the connection so we can get responses if any
 		_, err = conn.Read(buf)
 		if err != nil {
 			// Here we assume that if the read attempt on the socket timed out then the port is open
@@ -248,15 +323,213 @@ func (s *UDPScanner) getUDPScanResults(ctx context.Context, workerResultsChan ch
 
 			switch result.Port.State {
 			case PortStateOpen:
-				hostResult.HostState = HostStateUp // sometimes ping scan failed but port scan succeeds so if port is open then host is up.
+				if hostResult.HostState != HostStateUp {
+					// sometimes ping scan failed but port scan succeeds so if port is open then host is up.
+					hostResult.HostState = HostStateUp
+					s.stream.writeHostResult(hostResult)
+				}
 				hostResult.OpenPorts++
 				hostResult.ClosedPorts--
 			case PortStatePossibleFilter:
 				hostResult.FilteredPorts++
 				hostResult.ClosedPorts--
 			}
+			if result.Port.State != PortStateClosed {
+				s.stream.writePort(hostIP, hostResult.Ports[portIndex])
+			}
 
 			s.results.Results[hostIP] = hostResult
 		}
 	}
 }
+
+// runRawUDPScan probes the ports of hosts that are up with raw UDP packets. Ports that answer are open, ports whose probes are answered
+// with an ICMP port unreachable message are closed and ports whose probes are answered with another ICMP unreachable message are
+// filtered. Probes that are not answered are sent again up to Retries times before their ports are reported as open or filtered.
+func (s *UDPScanner) runRawUDPScan(ctx context.Context) (err error) {
+	ifaceProvider, err := netutil.InterfaceProvider()
+	if err != nil {
+		return err
+	}
+	router, err := routing.NewRouter(ifaceProvider)
+	if err != nil {
+		return err
+	}
+	allIfaces, err := ifaceProvider.Interfaces()
+	if err != nil {
+		return err
+	}
+
+	s.srcPort = randomEphemeralPort()
+
+	// ports of hosts that are up are open or filtered until their probes are answered.
+	for addr, hostResult := range s.results.Results {
+		if hostResult.HostState != HostStateUp {
+			continue
+		}
+		for _, port := range s.TargetPorts {
+			hostResult.setPortState(port, PortStatePossibleFilter)
+		}
+		s.results.Results[addr] = hostResult
+	}
+
+	spinner, err := pterm.DefaultSpinner.Start("Scanning hosts")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			spinner.Fail("Scan Failed")
+		} else {
+			spinner.Success("Scanning Done")
+		}
+	}()
+
+	macResolver := resolving.NewResolver(ifaceProvider)
+	addNeighbourMACs(macResolver, s.hostStates)
+	sender, err := newRawSender(ctx, ifaceProvider, router, macResolver)
+	if err != nil {
+		return err
+	}
+	defer sender.Close()
+
+	packetReceiver, err := packet.NewPacketReceiver(ctx, "((ip or ip6) and udp) or "+icmpUnreachableFilter, 1500, allIfaces...)
+	if err != nil {
+		return err
+	}
+	defer packetReceiver.Close()
+
+	masterDone := make(chan struct{})
+	go s.getRawUDPScanResults(ctx, packetReceiver, masterDone)
+
+	for range s.Retries + 1 {
+		probes := s.unansweredProbes()
+		if len(probes) == 0 {
+			break
+		}
+
+		jobs := make(chan PortScanJob, s.Workers)
+		g, gctx := errgroup.WithContext(ctx)
+		for range s.Workers {
+			g.Go(func() error {
+				return s.rawScanUDPPort(jobs, sender)
+			})
+		}
+
+	sendProbes:
+		for _, probe := range probes {
+			select {
+			case <-gctx.Done():
+				break sendProbes
+			case jobs <- PortScanJob{target: probe, scanTimeout: s.ResponseTimeout}:
+			}
+		}
+		close(jobs)
+		err = g.Wait()
+		if err != nil {
+			return err
+		}
+
+		<-time.After(s.ResponseTimeout) // wait for the response timeout before sending unanswered probes again
+	}
+
+	sender.Wait()
+	packetReceiver.Close()
+
+	<-masterDone // wait for master to finish processing what is already enqueued by the packet receiver
+	close(masterDone)
+	return nil
+}
+
+// unansweredProbes returns the ports whose probes have not been answered yet.
+func (s *UDPScanner) unansweredProbes() []netip.AddrPort {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probes := []netip.AddrPort{}
+	for _, hostResult := range sortedHostResults(s.results.Results) {
+		for _, port := range hostResult.Ports {
+			if port.State == PortStatePossibleFilter {
+				probes = append(probes, netip.AddrPortFrom(hostResult.Addr, uint16(port.Number)))
+			}
+		}
+	}
+	return probes
+}
+
+func (s *UDPScanner) rawScanUDPPort(jobs chan PortScanJob, sender *rawSender) error {
+	// to be run by workers
+
+	packetBuf := gopacket.NewSerializeBuffer()
+
+	for job := range jobs {
+		for _, payload := range s.probePayloads(PortNumber(job.target.Port())) {
+			udp := &layers.UDP{
+				SrcPort: layers.UDPPort(s.srcPort),
+				DstPort: layers.UDPPort(job.target.Port()),
+			}
+
+			err := sender.send(packetBuf, job.target.Addr(), udp, gopacket.Payload(payload))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *UDPScanner) getRawUDPScanResults(ctx context.Context, packetReceiver packet.PacketReceiver, masterDone chan<- struct{}) {
+	// To Be Run By Main Worker (aggregator)
+	packetChan := packetReceiver.Packets()
+
+	defer func() {
+		masterDone <- struct{}{}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case packet, ok := <-packetChan:
+			if !ok {
+				return
+			}
+
+			srcIP, ok := packetSourceAddr(packet)
+			if !ok {
+				continue
+			}
+
+			if unreachable, ok := parseICMPUnreachable(packet); ok {
+				// unreachables for other udp traffic to the same port, eg our own reverse lookups, say nothing about our probes.
+				if unreachable.protocol != layers.IPProtocolUDP || unreachable.srcPort() != s.srcPort {
+					continue
+				}
+				state := PortStateFiltered
+				if unreachable.portUnreachable {
+					state = PortStateClosed
+				}
+				s.recordPortState(unreachable.dst, PortNumber(unreachable.dstPort()), state, srcIP == unreachable.dst)
+				continue
+			}
+
+			udpLayer := packet.Layer(layers.LayerTypeUDP)
+			if udpLayer == nil {
+				continue
+			}
+			udpPacket, ok := udpLayer.(*layers.UDP)
+			if !ok || uint16(udpPacket.DstPort) != s.srcPort {
+				continue
+			}
+			s.recordPortState(srcIP, PortNumber(udpPacket.SrcPort), PortStateOpen, true)
+		}
+	}
+}
+
+func (s *UDPScanner) recordPortState(addr netip.Addr, number PortNumber, state PortState, hostUp bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordPortState(s.results.Results, s.stream, addr, number, state, hostUp)
+}
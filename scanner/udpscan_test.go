@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanPacketReceiver is a packet receiver that delivers the packets sent on its channel.
+type chanPacketReceiver chan gopacket.Packet
+
+func (r chanPacketReceiver) Packets() <-chan gopacket.Packet {
+	return r
+}
+
+func (r chanPacketReceiver) Close() error {
+	close(r)
+	return nil
+}
+
+// udpReply builds the ethernet frame of a udp packet from src to dst.
+func udpReply(t *testing.T, src netip.AddrPort, dst netip.AddrPort) gopacket.Packet {
+	t.Helper()
+
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: src.Addr().AsSlice(), DstIP: dst.Addr().AsSlice()}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(src.Port()), DstPort: layers.UDPPort(dst.Port())}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	require.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&layers.Ethernet{SrcMAC: []byte{0, 1, 2, 3, 4, 5}, DstMAC: []byte{0, 1, 2, 3, 4, 6}, EthernetType: layers.EthernetTypeIPv4},
+		ip, udp, gopacket.Payload("reply")))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestRawUDPScanResults(t *testing.T) {
+	local := netip.MustParseAddr("10.1.1.100")
+	router := netip.MustParseAddr("10.1.1.1")
+	host := netip.MustParseAddr("10.1.1.10")
+	s := NewUDPScanner(UDPScanOptions{Raw: true})
+	s.srcPort = 50000
+	s.results.Results = getResultSet([]netip.Prefix{netip.PrefixFrom(host, 32)}, []PortNumber{53, 69, 123, 137, 161, 500}, nil,
+		PingScanResultsMap{host: {HostState: HostStateUp}}, "udp")
+	hostResult := s.results.Results[host]
+	for _, port := range []PortNumber{53, 69, 123, 137, 161, 500} {
+		hostResult.setPortState(port, PortStatePossibleFilter)
+	}
+	s.results.Results[host] = hostResult
+
+	receiver := make(chanPacketReceiver, 10)
+	receiver <- udpReply(t, netip.AddrPortFrom(host, 53), netip.AddrPortFrom(local, 50000))
+	receiver <- icmpUnreachableReply(t, host, local, netip.AddrPortFrom(host, 69), layers.IPProtocolUDP, layers.ICMPv4CodePort)
+	receiver <- icmpUnreachableReply(t, router, local, netip.AddrPortFrom(host, 123), layers.IPProtocolUDP, layers.ICMPv4CodeCommAdminProhibited)
+	// not answers to our probes.
+	receiver <- udpReply(t, netip.AddrPortFrom(host, 161), netip.AddrPortFrom(local, 5353))
+	receiver <- icmpUnreachableReply(t, router, local, netip.AddrPortFrom(host, 500), layers.IPProtocolTCP, layers.ICMPv4CodeCommAdminProhibited)
+	// sent back for a reverse lookup to the host's name service.
+	receiver <- icmpUnreachableReplyFromPort(t, host, local, 53, netip.AddrPortFrom(host, 137), layers.IPProtocolUDP, layers.ICMPv4CodePort)
+	receiver.Close()
+
+	masterDone := make(chan struct{}, 1)
+	s.getRawUDPScanResults(context.Background(), receiver, masterDone)
+
+	hostResult = s.results.Results[host]
+	states := map[PortNumber]PortState{}
+	for _, port := range hostResult.Ports {
+		states[port.Number] = port.State
+	}
+	assert.Equal(t, map[PortNumber]PortState{
+		53:  PortStateOpen,
+		69:  PortStateClosed,
+		123: PortStateFiltered,
+		137: PortStatePossibleFilter,
+		161: PortStatePossibleFilter,
+		500: PortStatePossibleFilter,
+	}, states)
+	assert.Equal(t, 1, hostResult.OpenPorts)
+	assert.Equal(t, 1, hostResult.ClosedPorts)
+	assert.Equal(t, 4, hostResult.FilteredPorts)
+
+	assert.Equal(t, []netip.AddrPort{netip.AddrPortFrom(host, 137), netip.AddrPortFrom(host, 161), netip.AddrPortFrom(host, 500)}, s.unansweredProbes())
+}
@@ -3,8 +3,7 @@ package scanner
 import (
 	"context"
 	"fmt"
-	"strings"
-	"text/template"
+	"strconv"
 	"time"
 
 	"github.com/mdlayher/wifi"
@@ -52,13 +51,25 @@ func (r *WiFiScanResults) Print() {
 	displayWifiScanResults(r)
 }
 
-func (r *WiFiScanResults) String() string {
-	stringBuilder := strings.Builder{}
-
-	tmpl := template.Must(template.New("wifi_scan_results").Parse(WiFiScanResultsTemplate))
-	tmpl.Execute(&stringBuilder, r)
+func (r *WiFiScanResults) table() [][]string {
+	rows := [][]string{{"ssid", "bssid", "status", "frequency_mhz", "channel", "signal_dbm", "stations", "last_seen_ms"}}
+	for _, ap := range r.AccessPoints {
+		rows = append(rows, []string{
+			ap.SSID,
+			ap.BSSID.String(),
+			ap.Status.String(),
+			strconv.Itoa(ap.Frequency),
+			strconv.Itoa(FreqToChannel(ap.Frequency)),
+			strconv.Itoa(int(ap.Signal / 100)),
+			strconv.Itoa(int(ap.Load.StationCount)),
+			durationMillis(ap.LastSeen),
+		})
+	}
+	return rows
+}
 
-	return stringBuilder.String()
+func (r *WiFiScanResults) String() string {
+	return executeResultsTemplate("wifi_scan_results", WiFiScanResultsTemplate, r)
 }
 
 func runWifiScan(ctx context.Context, scanner *WiFiScanner) error {
@@ -0,0 +1,329 @@
+package scanner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types below mirror the subset of the Nmap XML output format (https://nmap.org/book/nmap-dtd.html) that tools like report generators
+// and Metasploit's db_import rely on.
+
+type nmapRun struct {
+	XMLName          xml.Name     `xml:"nmaprun"`
+	Scanner          string       `xml:"scanner,attr"`
+	Args             string       `xml:"args,attr"`
+	Start            int64        `xml:"start,attr"`
+	StartStr         string       `xml:"startstr,attr"`
+	Version          string       `xml:"version,attr"`
+	XMLOutputVersion string       `xml:"xmloutputversion,attr"`
+	ScanInfo         nmapScanInfo `xml:"scaninfo"`
+	Hosts            []nmapHost   `xml:"host"`
+	RunStats         nmapRunStats `xml:"runstats"`
+}
+
+type nmapScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type nmapHost struct {
+	Status    nmapStatus     `xml:"status"`
+	Addresses []nmapAddress  `xml:"address"`
+	HostNames nmapHostNames  `xml:"hostnames"`
+	Ports     nmapPorts      `xml:"ports"`
+	OS        *nmapOS        `xml:"os,omitempty"`
+	Times     *nmapHostTimes `xml:"times,omitempty"`
+}
+
+type nmapStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr,omitempty"`
+}
+
+type nmapHostNames struct {
+	HostNames []nmapHostName `xml:"hostname"`
+}
+
+type nmapHostName struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapPorts struct {
+	Ports []nmapPort `xml:"port"`
+}
+
+type nmapPort struct {
+	Protocol string       `xml:"protocol,attr"`
+	PortID   PortNumber   `xml:"portid,attr"`
+	State    nmapState    `xml:"state"`
+	Service  *nmapService `xml:"service,omitempty"`
+}
+
+type nmapState struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapService struct {
+	Name      string `xml:"name,attr"`
+	Product   string `xml:"product,attr,omitempty"`
+	Version   string `xml:"version,attr,omitempty"`
+	ExtraInfo string `xml:"extrainfo,attr,omitempty"`
+	Method    string `xml:"method,attr"`
+	Conf      int    `xml:"conf,attr"`
+}
+
+type nmapOS struct {
+	OSMatch nmapOSMatch `xml:"osmatch"`
+}
+
+type nmapOSMatch struct {
+	Name     string      `xml:"name,attr"`
+	Accuracy int         `xml:"accuracy,attr"`
+	OSClass  nmapOSClass `xml:"osclass"`
+}
+
+type nmapOSClass struct {
+	Type     string `xml:"type,attr"`
+	OSFamily string `xml:"osfamily,attr"`
+	Accuracy int    `xml:"accuracy,attr"`
+}
+
+type nmapHostTimes struct {
+	SRTT int64 `xml:"srtt,attr"`
+}
+
+type nmapRunStats struct {
+	Finished nmapFinished  `xml:"finished"`
+	Hosts    nmapHostStats `xml:"hosts"`
+}
+
+type nmapFinished struct {
+	Time    int64  `xml:"time,attr"`
+	TimeStr string `xml:"timestr,attr"`
+	Elapsed string `xml:"elapsed,attr"`
+	Summary string `xml:"summary,attr"`
+	Exit    string `xml:"exit,attr"`
+}
+
+type nmapHostStats struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+// getXMLResults marshals the results of a port scan into Nmap compatible XML. It returns an error for results of scans that do not probe ports.
+func getXMLResults(r ScanResults) ([]byte, error) {
+	portResults, ok := r.(portScanResults)
+	if !ok {
+		return nil, fmt.Errorf("xml output is only supported for port scans")
+	}
+
+	run := nmapRunFromResults(portResults, time.Now())
+
+	xmlBytes, err := xml.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	output := []byte(xml.Header + "<!DOCTYPE nmaprun>\n")
+	output = append(output, xmlBytes...)
+	return append(output, '\n'), nil
+}
+
+// nmapRunFromResults converts the port scan results into the nmaprun document. finishTime is the time the scan is considered to have finished.
+func nmapRunFromResults(r portScanResults, finishTime time.Time) nmapRun {
+	info := r.portScanInfo()
+	results := r.hostResults()
+	startTime := finishTime.Add(-info.ScanTime)
+
+	run := nmapRun{
+		Scanner:          "gscn",
+		Args:             strings.Join(os.Args, " "),
+		Start:            startTime.Unix(),
+		StartStr:         startTime.Format(time.ANSIC),
+		XMLOutputVersion: "1.05",
+		ScanInfo: nmapScanInfo{
+			Type:     info.ScanType,
+			Protocol: info.Protocol,
+		},
+		Hosts: make([]nmapHost, 0, len(results)),
+	}
+
+	for _, hostResult := range sortedHostResults(results) {
+		if run.ScanInfo.Services == "" && len(hostResult.Ports) != 0 {
+			run.ScanInfo.NumServices = len(hostResult.Ports)
+			run.ScanInfo.Services = portList(hostResult.Ports)
+		}
+
+		if hostResult.HostState == HostStateUp {
+			run.RunStats.Hosts.Up++
+		} else {
+			run.RunStats.Hosts.Down++
+			if info.printUpOnly {
+				continue
+			}
+		}
+		run.Hosts = append(run.Hosts, nmapHostFromResult(hostResult, info))
+	}
+	run.RunStats.Hosts.Total = len(results)
+
+	run.RunStats.Finished = nmapFinished{
+		Time:    finishTime.Unix(),
+		TimeStr: finishTime.Format(time.ANSIC),
+		Elapsed: strconv.FormatFloat(info.ScanTime.Seconds(), 'f', 2, 64),
+		Exit:    "success",
+		Summary: fmt.Sprintf("gscn done at %s; %d IP address (%d host up) scanned in %.2f seconds",
+			finishTime.Format(time.ANSIC), run.RunStats.Hosts.Total, run.RunStats.Hosts.Up, info.ScanTime.Seconds()),
+	}
+
+	return run
+}
+
+func nmapHostFromResult(hostResult HostResult, info portScanInfo) nmapHost {
+	addrType := "ipv4"
+	if hostResult.Addr.Is6() {
+		addrType = "ipv6"
+	}
+
+	host := nmapHost{
+		Status: nmapStatus{
+			State:  hostResult.HostState.String(),
+			Reason: "no-response",
+		},
+		Addresses: []nmapAddress{
+			{Addr: hostResult.Addr.String(), AddrType: addrType},
+		},
+		Ports: nmapPorts{
+			Ports: make([]nmapPort, 0, len(hostResult.Ports)),
+		},
+	}
+	if hostResult.HostState == HostStateUp {
+		host.Status.Reason = "echo-reply"
+		if info.pingSkipped {
+			// hosts are only assumed to be up when they are not pinged.
+			host.Status.Reason = "user-set"
+		}
+	}
+	if hostResult.MAC != nil {
+		// hosts with a MAC address were found to be up with ARP or NDP requests.
+		host.Addresses = append(host.Addresses, nmapAddress{
+			Addr:     strings.ToUpper(hostResult.MAC.String()),
+			AddrType: "mac",
+			Vendor:   hostResult.Vendor,
+		})
+		if hostResult.HostState == HostStateUp {
+			host.Status.Reason = "arp-response"
+			if hostResult.Addr.Is6() {
+				host.Status.Reason = "nd-response"
+			}
+		}
+	}
+	if hostResult.HostName != "" {
+		host.HostNames.HostNames = append(host.HostNames.HostNames, nmapHostName{
+			Name: hostResult.HostName,
+			Type: "PTR",
+		})
+	}
+	if hostResult.OS != nil {
+		host.OS = &nmapOS{OSMatch: nmapOSMatch{
+			Name:     hostResult.OS.Name,
+			Accuracy: hostResult.OS.Confidence,
+			OSClass: nmapOSClass{
+				Type:     hostResult.OS.Class,
+				OSFamily: hostResult.OS.Family,
+				Accuracy: hostResult.OS.Confidence,
+			},
+		}}
+	}
+	if hostResult.AverageRTT > 0 {
+		host.Times = &nmapHostTimes{
+			SRTT: hostResult.AverageRTT.Microseconds(),
+		}
+	}
+
+	for _, port := range hostResult.Ports {
+		if port.State == PortStateClosed && info.printOpenOnly {
+			continue
+		}
+		nmapPort := nmapPort{
+			Protocol: port.Protocol,
+			PortID:   port.Number,
+			State: nmapState{
+				State:  nmapPortState(port.State),
+				Reason: nmapPortStateReason(port.State, port.Protocol),
+			},
+		}
+		switch {
+		case port.serviceDetected():
+			nmapPort.Service = &nmapService{
+				Name:      port.Name,
+				Product:   port.Product,
+				Version:   port.Version,
+				ExtraInfo: port.ExtraInfo,
+				Method:    "probed",
+				Conf:      10,
+			}
+		case port.Name != "":
+			nmapPort.Service = &nmapService{
+				Name:   port.Name,
+				Method: "table",
+				Conf:   3,
+			}
+		}
+		host.Ports.Ports = append(host.Ports.Ports, nmapPort)
+	}
+
+	return host
+}
+
+// nmapPortState returns the name Nmap uses for the given port state.
+func nmapPortState(state PortState) string {
+	switch state {
+	case PortStatePossibleFilter:
+		return "open|filtered"
+	default:
+		return state.String()
+	}
+}
+
+// nmapPortStateReason returns the reason Nmap would give for a port being in the given state.
+func nmapPortStateReason(state PortState, protocol string) string {
+	switch state {
+	case PortStateOpen:
+		if protocol == "udp" {
+			return "udp-response"
+		}
+		return "syn-ack"
+	case PortStateClosed:
+		if protocol == "udp" {
+			return "port-unreach"
+		}
+		return "reset"
+	case PortStateUnfiltered:
+		return "reset"
+	default:
+		return "no-response"
+	}
+}
+
+func portList(ports []Port) string {
+	portStrs := make([]string, 0, len(ports))
+	for _, port := range ports {
+		portStrs = append(portStrs, strconv.Itoa(int(port.Number)))
+	}
+	return strings.Join(portStrs, ",")
+}
@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"encoding/xml"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/kakeetopius/gscn/internal/netutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetXMLResults(t *testing.T) {
+	addr := netip.MustParseAddr("10.1.1.1")
+	results := &TCPSynScanResults{
+		Results: HostResults{
+			addr: {
+				Addr:        addr,
+				HostState:   HostStateUp,
+				HostName:    "host.example",
+				OpenPorts:   1,
+				ClosedPorts: 1,
+				AverageRTT:  1500 * time.Microsecond,
+				OS:          &OSGuess{Name: "Linux 3.x - 6.x", Family: "Linux", Class: "general purpose", Confidence: 85},
+				MAC:         netutil.MAC{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e},
+				Vendor:      "Ayecom Technology",
+				Ports: []Port{
+					{Number: 22, Name: "ssh", Protocol: "tcp", State: PortStateOpen},
+					{Number: 23, Name: "telnet", Protocol: "tcp", State: PortStateClosed},
+				},
+			},
+			netip.MustParseAddr("10.1.1.2"): {
+				Addr:      netip.MustParseAddr("10.1.1.2"),
+				HostState: HostStateDown,
+			},
+		},
+		Stats: TCPSynScanStats{TotalNumOfHosts: 2, ScanTime: 2 * time.Second},
+	}
+
+	out, err := getXMLResults(results)
+	require.NoError(t, err)
+
+	var run nmapRun
+	require.NoError(t, xml.Unmarshal(out, &run))
+
+	assert.Equal(t, "gscn", run.Scanner)
+	assert.Equal(t, "syn", run.ScanInfo.Type)
+	assert.Equal(t, "22,23", run.ScanInfo.Services)
+	require.Len(t, run.Hosts, 2)
+
+	host := run.Hosts[0]
+	assert.Equal(t, "up", host.Status.State)
+	assert.Equal(t, "arp-response", host.Status.Reason)
+	assert.Equal(t, []nmapAddress{
+		{Addr: "10.1.1.1", AddrType: "ipv4"},
+		{Addr: "00:1A:2B:3C:4D:5E", AddrType: "mac", Vendor: "Ayecom Technology"},
+	}, host.Addresses)
+	require.Len(t, host.HostNames.HostNames, 1)
+	assert.Equal(t, "host.example", host.HostNames.HostNames[0].Name)
+	require.Len(t, host.Ports.Ports, 2)
+	assert.Equal(t, PortNumber(22), host.Ports.Ports[0].PortID)
+	assert.Equal(t, "open", host.Ports.Ports[0].State.State)
+	assert.Equal(t, "closed", host.Ports.Ports[1].State.State)
+	assert.Equal(t, int64(1500), host.Times.SRTT)
+	require.NotNil(t, host.OS)
+	assert.Equal(t, nmapOSMatch{
+		Name:     "Linux 3.x - 6.x",
+		Accuracy: 85,
+		OSClass:  nmapOSClass{Type: "general purpose", OSFamily: "Linux", Accuracy: 85},
+	}, host.OS.OSMatch)
+	assert.Nil(t, run.Hosts[1].OS)
+	assert.Len(t, run.Hosts[1].Addresses, 1)
+
+	assert.Equal(t, 1, run.RunStats.Hosts.Up)
+	assert.Equal(t, 1, run.RunStats.Hosts.Down)
+	assert.Equal(t, 2, run.RunStats.Hosts.Total)
+	assert.Equal(t, "2.00", run.RunStats.Finished.Elapsed)
+}
+
+func TestGetXMLResultsHostReason(t *testing.T) {
+	addr := netip.MustParseAddr("10.1.2.1")
+	tests := []struct {
+		name    string
+		results *TCPFullScanResults
+		want    string
+	}{
+		{
+			name:    "pinged",
+			results: &TCPFullScanResults{Results: HostResults{addr: {Addr: addr, HostState: HostStateUp}}},
+			want:    "echo-reply",
+		},
+		{
+			name:    "ping skipped",
+			results: &TCPFullScanResults{Results: HostResults{addr: {Addr: addr, HostState: HostStateUp}}, PingSkipped: true},
+			want:    "user-set",
+		},
+		{
+			name:    "down",
+			results: &TCPFullScanResults{Results: HostResults{addr: {Addr: addr, HostState: HostStateDown}}},
+			want:    "no-response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := getXMLResults(tt.results)
+			require.NoError(t, err)
+
+			var run nmapRun
+			require.NoError(t, xml.Unmarshal(out, &run))
+			require.Len(t, run.Hosts, 1)
+			assert.Equal(t, tt.want, run.Hosts[0].Status.Reason)
+		})
+	}
+}
+
+func TestGetXMLResultsUnsupported(t *testing.T) {
+	_, err := getXMLResults(&PingScanResults{})
+	assert.Error(t, err)
+}
+
+func TestNmapPortState(t *testing.T) {
+	assert.Equal(t, "open", nmapPortState(PortStateOpen))
+	assert.Equal(t, "closed", nmapPortState(PortStateClosed))
+	assert.Equal(t, "open|filtered", nmapPortState(PortStatePossibleFilter))
+}